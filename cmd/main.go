@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"expvar"
+	"maps"
 	"runtime"
 	"time"
 
@@ -9,9 +11,19 @@ import (
 	"github.com/dottox/social/internal/auth"
 	"github.com/dottox/social/internal/db"
 	"github.com/dottox/social/internal/env"
+	"github.com/dottox/social/internal/events"
+	"github.com/dottox/social/internal/jobs"
 	"github.com/dottox/social/internal/mailer"
+	"github.com/dottox/social/internal/notifications"
+	"github.com/dottox/social/internal/ranking"
 	"github.com/dottox/social/internal/ratelimiter"
+	"github.com/dottox/social/internal/realtime"
+	"github.com/dottox/social/internal/retry"
+	"github.com/dottox/social/internal/search"
 	"github.com/dottox/social/internal/store"
+	"github.com/dottox/social/internal/timeline"
+	"github.com/dottox/social/internal/trending"
+	"github.com/dottox/social/internal/webhooks"
 	"github.com/dottox/social/web"
 	"go.uber.org/zap"
 )
@@ -47,6 +59,45 @@ func main() {
 		MaxIdleTime:  env.GetString("DB_MAX_IDLE_TIME", "15m"),
 	}
 
+	// Limits of the rate limit policies of the routes, overridden by the
+	// policies file and then by RATE_LIMIT_POLICIES, e.g. "auth=10/1m,read=300/1m"
+	rateLimitDefaults := ratelimiter.Config{
+		Enabled:  true,
+		Strategy: env.GetString("RATE_LIMITER_STRATEGY", ratelimiter.StrategyTokenBucket),
+		// Set to redis to share the limits between the instances
+		Backend: env.GetString("RATE_LIMITER_BACKEND", ratelimiter.BackendMemory),
+		Redis: ratelimiter.RedisConfig{
+			Addr:     env.GetString("REDIS_ADDR", "localhost:6379"),
+			Password: env.GetString("REDIS_PASSWORD", ""),
+			DB:       env.GetInt("REDIS_DB", 0),
+			Prefix:   "ratelimit:",
+			Timeout:  100 * time.Millisecond,
+			PoolSize: env.GetInt("REDIS_POOL_SIZE", 16),
+			FailOpen: env.GetString("RATE_LIMITER_FAIL", "open") == "open",
+		},
+	}
+	rateLimitPolicies, err := ratelimiter.ParsePolicies("ip=600/1m,auth=10/1m,read=300/1m,default=50/1m", rateLimitDefaults)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if path := env.GetString("RATE_LIMIT_POLICIES_FILE", ""); path != "" {
+		filePolicies, err := ratelimiter.LoadPolicies(path, rateLimitDefaults)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		maps.Copy(rateLimitPolicies, filePolicies)
+	}
+	envPolicies, err := ratelimiter.ParsePolicies(env.GetString("RATE_LIMIT_POLICIES", ""), rateLimitDefaults)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	maps.Copy(rateLimitPolicies, envPolicies)
+	// Only the proxies in front of the API can set the client IP
+	trustedProxies, err := api.ParseTrustedProxies(env.GetString("TRUSTED_PROXIES", ""))
+	if err != nil {
+		logger.Fatal(err)
+	}
+
 	// Creates the api configuration, containing the DBConfig
 	cfg := api.Config{
 		Protocol:    env.GetString("PROTOCOL", "http"),
@@ -57,10 +108,37 @@ func main() {
 		Version:     version,
 		DB:          dbCfg,
 		Mail: api.MailConfig{
-			Exp:       time.Hour * 24, // 24 hours
-			FromEmail: env.GetString("FROM_EMAIL", ""),
-			SendGrid: api.SendGridConfig{
-				APIKey: env.GetString("SENDGRID_API_KEY", ""),
+			Exp: time.Hour * 24, // 24 hours
+			// Signs the unsubscribe links of the notification emails
+			UnsubscribeSecret: env.GetString("MAIL_UNSUBSCRIBE_SECRET", "secret"),
+			Client: mailer.ClientConfig{
+				// Set to capture to write the emails to disk in development
+				Provider:  env.GetString("MAIL_PROVIDER", mailer.ProviderSendGrid),
+				FromEmail: env.GetString("FROM_EMAIL", ""),
+				SendGrid: mailer.SendGridConfig{
+					APIKey: env.GetString("SENDGRID_API_KEY", ""),
+					// Outside production SendGrid only validates the emails
+					Sandbox: env.GetString("ENV", "development") != "production",
+				},
+				SMTP: mailer.SMTPConfig{
+					Host:     env.GetString("SMTP_HOST", "localhost"),
+					Port:     env.GetInt("SMTP_PORT", 587),
+					Username: env.GetString("SMTP_USERNAME", ""),
+					Password: env.GetString("SMTP_PASSWORD", ""),
+					Security: env.GetString("SMTP_SECURITY", mailer.SMTPStartTLS),
+					Auth:     env.GetString("SMTP_AUTH", mailer.SMTPAuthPlain),
+				},
+				CaptureDir: env.GetString("MAIL_CAPTURE_DIR", "data/mail"),
+			},
+			Queue: mailer.Config{
+				Workers:      env.GetInt("MAIL_WORKERS", 2),
+				PollInterval: time.Second * 5,
+				Timeout:      time.Second * 15,
+				Retry: retry.Config{
+					MaxAttempts: env.GetInt("MAIL_MAX_ATTEMPTS", 8),
+					BackoffBase: time.Second * 30,
+					BackoffMax:  time.Hour * 2,
+				},
 			},
 		},
 		Auth: api.AuthConfig{
@@ -74,10 +152,94 @@ func main() {
 				Iss:    "gophersocial",
 			},
 		},
-		RateLimiter: ratelimiter.Config{
-			RequestsPerTimeFrame: 50,
-			TimeFrame:            time.Minute,
-			Enabled:              true,
+		RateLimiter: api.RateLimitConfig{
+			Enabled:        true,
+			TrustedProxies: trustedProxies,
+			Policies:       rateLimitPolicies,
+		},
+		Feed: timeline.Config{
+			Mode:            timeline.Mode(env.GetString("FEED_MODE", "read")),
+			FanOutThreshold: env.GetInt("FEED_FANOUT_THRESHOLD", 10000),
+			Workers:         env.GetInt("FEED_FANOUT_WORKERS", 4),
+			QueueSize:       1024,
+		},
+		Ranking: ranking.Config{
+			HalfLife:         time.Hour * 12,
+			RecencyWeight:    1.0,
+			EngagementWeight: 0.6,
+			AffinityWeight:   0.8,
+			TagOverlapWeight: 0.4,
+			CommentWeight:    2.0,
+			ReactionWeight:   1.0,
+		},
+		Trending: trending.Config{
+			Schedule:  env.GetString("TRENDING_SCHEDULE", "*/5 * * * *"),
+			Limit:     20,
+			Retention: time.Hour * 24,
+			Windows:   trending.DefaultWindows,
+		},
+		Search: search.Config{
+			Backend:      env.GetString("SEARCH_BACKEND", search.BackendPostgres),
+			IndexPath:    env.GetString("SEARCH_INDEX_PATH", "data/search.idx"),
+			SaveInterval: time.Minute,
+		},
+		Notifications: notifications.Config{
+			Workers:   env.GetInt("NOTIFICATION_WORKERS", 2),
+			QueueSize: 1024,
+		},
+		Realtime: realtime.Config{
+			BufferSize:  env.GetInt("REALTIME_BUFFER_SIZE", 64),
+			HistorySize: env.GetInt("REALTIME_HISTORY_SIZE", 1024),
+			Heartbeat:   15 * time.Second,
+			Broker:      env.GetString("REALTIME_BROKER", realtime.BrokerLocal),
+		},
+		WebSocket: api.WebSocketConfig{
+			RateLimiter: ratelimiter.Config{
+				RequestsPerTimeFrame: 20,
+				TimeFrame:            10 * time.Second,
+				Enabled:              true,
+				Strategy:             ratelimiter.StrategyTokenBucket,
+			},
+		},
+		Webhooks: webhooks.Config{
+			Workers:      env.GetInt("WEBHOOK_WORKERS", 4),
+			PollInterval: 5 * time.Second,
+			Timeout:      10 * time.Second,
+			Retry: retry.Config{
+				MaxAttempts: env.GetInt("WEBHOOK_MAX_ATTEMPTS", 8),
+				BackoffBase: 30 * time.Second,
+				BackoffMax:  6 * time.Hour,
+			},
+			DisableAfter: env.GetInt("WEBHOOK_DISABLE_AFTER", 20),
+		},
+		Events: events.Config{
+			PollInterval: time.Second,
+			BatchSize:    100,
+			Timeout:      30 * time.Second,
+			Retry: retry.Config{
+				MaxAttempts: env.GetInt("EVENT_MAX_ATTEMPTS", 10),
+				BackoffBase: 10 * time.Second,
+				BackoffMax:  time.Hour,
+			},
+		},
+		Jobs: jobs.Config{
+			Workers:      env.GetInt("JOB_WORKERS", 4),
+			PollInterval: time.Second * 5,
+			Timeout:      time.Minute * 5,
+			Retry: retry.Config{
+				MaxAttempts: env.GetInt("JOB_MAX_ATTEMPTS", 5),
+				BackoffBase: time.Second * 30,
+				BackoffMax:  time.Hour,
+			},
+		},
+		Cleanup: api.CleanupConfig{
+			InvitationsSchedule: env.GetString("CLEANUP_INVITATIONS_SCHEDULE", "@hourly"),
+			HistorySchedule:     env.GetString("CLEANUP_HISTORY_SCHEDULE", "0 3 * * *"),
+			Retention:           time.Hour * 24 * 7,
+		},
+		Digest: api.DigestConfig{
+			DailySchedule:  env.GetString("DIGEST_DAILY_SCHEDULE", "0 8 * * *"),
+			WeeklySchedule: env.GetString("DIGEST_WEEKLY_SCHEDULE", "0 8 * * 1"),
 		},
 	}
 
@@ -96,7 +258,18 @@ func main() {
 	// Storage is a struct containing all the repositories (stores)
 	store := store.NewStorage(db)
 
-	mailer := mailer.NewSendGridMailer(cfg.Mail.SendGrid.APIKey, cfg.Mail.FromEmail)
+	mailClient, err := mailer.NewClient(cfg.Mail.Client)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	// Every template is checked on startup
+	mailTemplates, err := mailer.ParseTemplates(mailer.FS, mailer.DefaultLocale)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	mailQueue := mailer.NewQueue(cfg.Mail.Queue, mailClient, mailTemplates, store, logger)
+	mailQueue.Start()
 
 	jwtAuthenticator := auth.NewJWTAuthenticator(
 		cfg.Auth.Token.Secret,
@@ -104,20 +277,69 @@ func main() {
 		cfg.Auth.Token.Iss,
 	)
 
-	rateLimiter := ratelimiter.NewFixedWindowRateLimiter(
-		cfg.RateLimiter.RequestsPerTimeFrame,
-		cfg.RateLimiter.TimeFrame,
-	)
+	rateLimiter, err := ratelimiter.NewPolicies(cfg.RateLimiter.Policies, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	timelineService, err := timeline.NewService(cfg.Feed, store, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	// The snapshots are refreshed by the refresh_trending job
+	trendingWorker := trending.NewWorker(cfg.Trending, store, logger)
+
+	searchBackend, err := search.NewBackend(context.Background(), cfg.Search, store, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	realtimeHub := realtime.NewHub(cfg.Realtime, logger)
+	if cfg.Realtime.Broker == realtime.BrokerPostgres {
+		broker := realtime.NewPostgresBroker(db, dbCfg.Addr, "realtime_events", logger)
+		if err := realtimeHub.Connect(broker); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	notificationService := notifications.NewService(cfg.Notifications, store, logger)
+	notificationService.AddPublisher(realtimeHub)
+
+	webhookDispatcher := webhooks.NewDispatcher(cfg.Webhooks, store, logger)
+	webhookDispatcher.Start()
 
 	// Create a new application
 	app := &api.Application{
 		Config:        cfg,
 		Store:         store,
 		Logger:        logger,
-		Mailer:        mailer,
+		Mailer:        mailQueue,
 		Authenticator: jwtAuthenticator,
 		RateLimiter:   rateLimiter,
+		Timeline:      timelineService,
+		Ranker:        ranking.NewRanker(cfg.Ranking),
+		Trending:      trendingWorker,
+		Search:        searchBackend,
+		Notifications: notificationService,
+		Realtime:      realtimeHub,
+		Webhooks:      webhookDispatcher,
+		Events:        events.NewDispatcher(cfg.Events, store, logger),
+		Jobs:          jobs.NewQueue(cfg.Jobs, store, logger),
+	}
+
+	// Email the notifications of the kinds the users want right away
+	notificationService.AddPublisher(notifications.PublisherFunc(app.EmailNotification))
+
+	// Deliver the domain events recorded in the outbox to their subscribers
+	app.SubscribeEvents()
+	app.Events.Start()
+
+	// Run the background and recurring jobs
+	if err := app.RegisterJobs(); err != nil {
+		logger.Fatal(err)
 	}
+	app.Jobs.Start()
 
 	// Publish some metrics to /v1/metrics
 	expvar.NewString("version").Set(cfg.Version)
@@ -140,6 +362,11 @@ func main() {
 		env.GetString("FRONTEND_PORT", ":4000"),
 		apiUrl,
 	)
+	// The captured emails can be read on /inbox, never in production as
+	// the inbox has no authentication
+	if cfg.Mail.Client.Provider == mailer.ProviderCapture && cfg.Env != "production" {
+		webApp.ServeInbox(cfg.Mail.Client.CaptureDir)
+	}
 	webRouter := webApp.Mount()
 	go func() {
 		err := webApp.Run(webRouter)
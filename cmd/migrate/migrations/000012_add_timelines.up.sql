@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS timelines (
+    user_id BIGINT NOT NULL,
+    post_id BIGINT NOT NULL,
+    author_id BIGINT NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+
+    PRIMARY KEY (user_id, post_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_timelines_user_created_at ON timelines (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_timelines_user_author ON timelines (user_id, author_id);
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id ON followers (follower_id);
\ No newline at end of file
@@ -0,0 +1,8 @@
+ALTER TABLE
+    posts
+DROP
+    COLUMN reactions_count;
+
+DROP INDEX IF EXISTS idx_comments_user_id;
+
+DROP TABLE IF EXISTS post_reactions;
\ No newline at end of file
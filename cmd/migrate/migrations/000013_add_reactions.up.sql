@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS post_reactions (
+    post_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (post_id, user_id),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_reactions_user_id ON post_reactions (user_id);
+CREATE INDEX IF NOT EXISTS idx_comments_user_id ON comments (user_id);
+
+ALTER TABLE
+    posts
+ADD
+    COLUMN reactions_count INT NOT NULL DEFAULT 0;
\ No newline at end of file
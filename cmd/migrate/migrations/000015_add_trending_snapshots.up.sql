@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS trending_snapshots (
+    id BIGSERIAL PRIMARY KEY,
+    time_window VARCHAR(8) NOT NULL,
+    computed_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    tags JSONB NOT NULL DEFAULT '[]',
+    posts JSONB NOT NULL DEFAULT '[]'
+);
+
+CREATE INDEX IF NOT EXISTS idx_trending_snapshots_window_computed_at ON trending_snapshots (time_window, computed_at DESC);
+CREATE INDEX IF NOT EXISTS idx_comments_created_at ON comments (created_at);
+CREATE INDEX IF NOT EXISTS idx_post_reactions_created_at ON post_reactions (created_at);
\ No newline at end of file
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_users_search_vector;
+DROP INDEX IF EXISTS idx_comments_search_vector;
+DROP INDEX IF EXISTS idx_posts_search_vector;
+
+ALTER TABLE users DROP COLUMN IF EXISTS search_vector;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE comments DROP COLUMN IF EXISTS language;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE posts DROP COLUMN IF EXISTS language;
\ No newline at end of file
@@ -0,0 +1,35 @@
+ALTER TABLE
+    posts
+ADD
+    COLUMN language regconfig NOT NULL DEFAULT 'english';
+
+ALTER TABLE
+    posts
+ADD
+    COLUMN search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector(language, coalesce(title, '')), 'A') ||
+        setweight(to_tsvector(language, coalesce(content, '')), 'B')
+    ) STORED;
+
+ALTER TABLE
+    comments
+ADD
+    COLUMN language regconfig NOT NULL DEFAULT 'english';
+
+ALTER TABLE
+    comments
+ADD
+    COLUMN search_vector tsvector GENERATED ALWAYS AS (
+        to_tsvector(language, coalesce(content, ''))
+    ) STORED;
+
+ALTER TABLE
+    users
+ADD
+    COLUMN search_vector tsvector GENERATED ALWAYS AS (
+        to_tsvector('simple', username)
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING gin (search_vector);
+CREATE INDEX IF NOT EXISTS idx_comments_search_vector ON comments USING gin (search_vector);
+CREATE INDEX IF NOT EXISTS idx_users_search_vector ON users USING gin (search_vector);
\ No newline at end of file
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_users_display_name_trgm;
+DROP INDEX IF EXISTS idx_users_username_trgm;
+
+ALTER TABLE users DROP COLUMN IF EXISTS display_name;
\ No newline at end of file
@@ -0,0 +1,8 @@
+ALTER TABLE
+    users
+ADD
+    COLUMN display_name VARCHAR(100) NOT NULL DEFAULT '';
+
+-- Trigram indexes for the prefix and fuzzy user search
+CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING gin (username gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_display_name_trgm ON users USING gin (display_name gin_trgm_ops);
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE comments DROP COLUMN IF EXISTS entities;
+ALTER TABLE posts DROP COLUMN IF EXISTS entities;
+
+DROP TABLE IF EXISTS mentions;
\ No newline at end of file
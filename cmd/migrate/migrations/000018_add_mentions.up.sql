@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS mentions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    author_id BIGINT NOT NULL,
+    post_id BIGINT NOT NULL,
+    comment_id BIGINT,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+-- A user is mentioned at most once per post and once per comment
+CREATE UNIQUE INDEX IF NOT EXISTS idx_mentions_post_user ON mentions (post_id, user_id) WHERE comment_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_mentions_comment_user ON mentions (comment_id, user_id) WHERE comment_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_mentions_user_id ON mentions (user_id, created_at);
+
+ALTER TABLE
+    posts
+ADD
+    COLUMN entities JSONB NOT NULL DEFAULT '[]';
+
+ALTER TABLE
+    comments
+ADD
+    COLUMN entities JSONB NOT NULL DEFAULT '[]';
\ No newline at end of file
@@ -0,0 +1,2 @@
+-- The original case of the tags is not restored
+DROP TABLE IF EXISTS tag_follows;
\ No newline at end of file
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS tag_follows (
+    user_id BIGINT NOT NULL,
+    tag VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (user_id, tag),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_tag_follows_tag ON tag_follows (tag);
+
+-- Normalise the existing tags like the API does: no leading #, NFKC, lowercase,
+-- keeping the first occurrence of duplicates
+UPDATE
+    posts
+SET
+    tags = ARRAY(
+        SELECT n.tag
+        FROM (
+            SELECT DISTINCT ON (tag) tag, ord
+            FROM UNNEST(posts.tags) WITH ORDINALITY AS t(raw, ord),
+                LATERAL (SELECT lower(normalize(btrim(ltrim(btrim(t.raw), '#')), NFKC)) AS tag) AS normalised
+            WHERE tag <> ''
+            ORDER BY tag, ord
+        ) AS n
+        ORDER BY n.ord
+    )
+WHERE
+    tags IS NOT NULL;
\ No newline at end of file
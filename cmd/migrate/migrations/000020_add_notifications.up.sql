@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS notifications (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    post_id BIGINT,
+    -- Distinct actors of the group, most recent first
+    actor_ids BIGINT[] NOT NULL,
+    read_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+-- Similar unread notifications are grouped into a single row
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_unread_group ON notifications (user_id, kind, COALESCE(post_id, 0)) WHERE read_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications (user_id, updated_at);
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS conversation_members;
+DROP TABLE IF EXISTS conversations;
+
+ALTER TABLE users DROP COLUMN IF EXISTS dm_following_only;
\ No newline at end of file
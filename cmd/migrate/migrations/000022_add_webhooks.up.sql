@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+    id BIGSERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    -- Events delivered to the webhook, every event when empty
+    events VARCHAR(64)[] NOT NULL DEFAULT '{}',
+    secret VARCHAR(128) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT true,
+    -- Consecutive failed attempts, the webhook is disabled past a threshold
+    failure_count INT NOT NULL DEFAULT 0,
+    disabled_at TIMESTAMP(0) WITH TIME ZONE,
+    created_by BIGINT,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id BIGINT NOT NULL,
+    event VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    -- pending, succeeded or failed
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    -- Outcome of the last attempt
+    response_status INT,
+    response_body TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMP(0) WITH TIME ZONE,
+
+    FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, id);
\ No newline at end of file
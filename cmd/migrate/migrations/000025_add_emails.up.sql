@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS emails (
+    id BIGSERIAL PRIMARY KEY,
+    template VARCHAR(64) NOT NULL,
+    to_name VARCHAR(255) NOT NULL DEFAULT '',
+    to_email CITEXT NOT NULL,
+    subject TEXT NOT NULL,
+    body TEXT NOT NULL,
+    -- queued, sending, sent or failed
+    status VARCHAR(16) NOT NULL DEFAULT 'queued',
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL,
+    send_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    -- An email being sent and not recorded by then is sent again
+    locked_until TIMESTAMP WITH TIME ZONE,
+    last_error TEXT NOT NULL DEFAULT '',
+    -- Emails with the same key are only queued once, e.g. the invitation of a user
+    dedup_key VARCHAR(255) UNIQUE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMP(0) WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_emails_queued ON emails (send_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS idx_emails_sending ON emails (locked_until) WHERE status = 'sending';
+CREATE INDEX IF NOT EXISTS idx_emails_status ON emails (status, id);
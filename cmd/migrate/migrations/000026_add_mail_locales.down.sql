@@ -0,0 +1,4 @@
+ALTER TABLE emails DROP COLUMN IF EXISTS text_body;
+ALTER TABLE emails DROP COLUMN IF EXISTS locale;
+
+ALTER TABLE users DROP COLUMN IF EXISTS language;
\ No newline at end of file
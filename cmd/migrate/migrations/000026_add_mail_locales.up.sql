@@ -0,0 +1,5 @@
+-- Language of the emails sent to the user, e.g. "en" or "es-AR"
+ALTER TABLE users ADD COLUMN IF NOT EXISTS language VARCHAR(35) NOT NULL DEFAULT 'en';
+
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS locale VARCHAR(35) NOT NULL DEFAULT 'en';
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS text_body TEXT NOT NULL DEFAULT '';
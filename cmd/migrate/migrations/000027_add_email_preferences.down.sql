@@ -0,0 +1,5 @@
+ALTER TABLE emails DROP COLUMN IF EXISTS unsubscribe_url;
+
+DROP INDEX IF EXISTS idx_notifications_unread;
+
+DROP TABLE IF EXISTS email_preferences;
\ No newline at end of file
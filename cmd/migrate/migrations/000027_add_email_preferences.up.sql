@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS email_preferences (
+    user_id BIGINT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    -- How often each kind of notification is emailed: immediate, daily,
+    -- weekly or off
+    follow VARCHAR(16) NOT NULL DEFAULT 'weekly',
+    comment VARCHAR(16) NOT NULL DEFAULT 'daily',
+    mention VARCHAR(16) NOT NULL DEFAULT 'immediate',
+    reaction VARCHAR(16) NOT NULL DEFAULT 'weekly',
+    -- Notifications updated up to then were included in a digest
+    daily_digest_at TIMESTAMP WITH TIME ZONE,
+    weekly_digest_at TIMESTAMP WITH TIME ZONE
+);
+
+INSERT INTO email_preferences (user_id)
+SELECT id FROM users
+ON CONFLICT (user_id) DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications (updated_at) WHERE read_at IS NULL;
+
+-- Sent in the List-Unsubscribe header of the email
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS unsubscribe_url TEXT NOT NULL DEFAULT '';
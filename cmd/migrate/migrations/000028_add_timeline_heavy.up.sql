@@ -0,0 +1,3 @@
+-- Authors with more followers than the fan-out threshold in hybrid mode.
+-- Their posts are merged into the feeds at read time instead of copied.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timeline_heavy BOOLEAN NOT NULL DEFAULT false;
\ No newline at end of file
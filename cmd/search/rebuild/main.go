@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/dottox/social/internal/db"
+	"github.com/dottox/social/internal/env"
+	"github.com/dottox/social/internal/search"
+	"github.com/dottox/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// Rebuilds the embedded search index from the database.
+// Run it with the API stopped, otherwise the API overwrites the file on shutdown.
+func main() {
+	err := env.LoadEnvs()
+	if err != nil {
+		log.Fatal(err)
+	}
+	dbAddr := env.GetString("DB_ADDR", "")
+	conn, err := db.New(db.DBConfig{
+		Addr:         dbAddr,
+		MaxOpenConns: 15,
+		MaxIdleConns: 15,
+		MaxIdleTime:  "15m",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	myStore := store.NewStorage(conn)
+	logger := zap.Must(zap.NewProduction()).Sugar()
+	defer logger.Sync()
+
+	indexPath := env.GetString("SEARCH_INDEX_PATH", "data/search.idx")
+	backend := search.NewEmbeddedBackend(search.NewMemoryIndex(), myStore, indexPath, logger)
+
+	err = backend.Rebuild(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+}
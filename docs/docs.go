@@ -524,13 +524,13 @@ const docTemplate = `{
                     },
                     {
                         "type": "string",
-                        "description": "ISO 8601 date to filter posts created after this date",
+                        "description": "RFC 3339 timestamp (or YYYY-MM-DD) to filter posts created at or after this date",
                         "name": "since",
                         "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "ISO 8601 date to filter posts created before this date",
+                        "description": "RFC 3339 timestamp (or YYYY-MM-DD) to filter posts created at or before this date",
                         "name": "until",
                         "in": "query"
                     }
@@ -6,6 +6,7 @@ import (
 	"expvar"
 	"fmt"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"syscall"
@@ -14,9 +15,18 @@ import (
 	"github.com/dottox/social/docs"
 	"github.com/dottox/social/internal/auth"
 	"github.com/dottox/social/internal/db"
+	"github.com/dottox/social/internal/events"
+	"github.com/dottox/social/internal/jobs"
 	"github.com/dottox/social/internal/mailer"
+	"github.com/dottox/social/internal/notifications"
+	"github.com/dottox/social/internal/ranking"
 	"github.com/dottox/social/internal/ratelimiter"
+	"github.com/dottox/social/internal/realtime"
+	"github.com/dottox/social/internal/search"
 	"github.com/dottox/social/internal/store"
+	"github.com/dottox/social/internal/timeline"
+	"github.com/dottox/social/internal/trending"
+	"github.com/dottox/social/internal/webhooks"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
@@ -27,21 +37,72 @@ type Application struct {
 	Config        Config
 	Store         store.Storage
 	Logger        *zap.SugaredLogger
-	Mailer        mailer.Client
+	Mailer        *mailer.Queue
 	Authenticator auth.Authenticator
-	RateLimiter   ratelimiter.Limiter
+	RateLimiter   *ratelimiter.Policies
+	Timeline      *timeline.Service
+	Ranker        *ranking.Ranker
+	Trending      *trending.Worker
+	Search        search.Backend
+	Notifications *notifications.Service
+	Realtime      *realtime.Hub
+	Webhooks      *webhooks.Dispatcher
+	Events        *events.Dispatcher
+	Jobs          *jobs.Queue
 }
 
 type Config struct {
-	Protocol    string
-	Addr        string
-	Port        string
-	FrontendURL string
-	Env         string
-	Version     string
-	Mail        MailConfig
-	DB          db.DBConfig
-	Auth        AuthConfig
+	Protocol      string
+	Addr          string
+	Port          string
+	FrontendURL   string
+	Env           string
+	Version       string
+	Mail          MailConfig
+	DB            db.DBConfig
+	Auth          AuthConfig
+	RateLimiter   RateLimitConfig
+	Feed          timeline.Config
+	Ranking       ranking.Config
+	Trending      trending.Config
+	Search        search.Config
+	Notifications notifications.Config
+	Realtime      realtime.Config
+	WebSocket     WebSocketConfig
+	Webhooks      webhooks.Config
+	Events        events.Config
+	Jobs          jobs.Config
+	Cleanup       CleanupConfig
+	Digest        DigestConfig
+}
+
+type CleanupConfig struct {
+	// Cron schedules of the cleanup jobs
+	InvitationsSchedule string
+	HistorySchedule     string
+	// Age of the dispatched events, finished webhook deliveries, succeeded
+	// jobs and sent emails deleted by the history cleanup
+	Retention time.Duration
+}
+
+type RateLimitConfig struct {
+	Enabled bool
+	// Proxies whose X-Forwarded-For and X-Real-IP headers are trusted to
+	// carry the client IP
+	TrustedProxies []netip.Prefix
+	// Limits of the policies of the routes by name, the routes of a policy
+	// that isn't enabled aren't limited
+	Policies map[string]ratelimiter.Config
+}
+
+type DigestConfig struct {
+	// Cron schedules of the daily and weekly notification digests
+	DailySchedule  string
+	WeeklySchedule string
+}
+
+type WebSocketConfig struct {
+	// Limit of the messages sent by each connection
 	RateLimiter ratelimiter.Config
 }
 
@@ -62,13 +123,11 @@ type TokenConfig struct {
 }
 
 type MailConfig struct {
-	SendGrid  SendGridConfig
-	Exp       time.Duration
-	FromEmail string
-}
-
-type SendGridConfig struct {
-	APIKey string
+	Exp time.Duration
+	// Key of the signatures of the unsubscribe links
+	UnsubscribeSecret string
+	Client            mailer.ClientConfig
+	Queue             mailer.Config
 }
 
 // Mount functions allow the app to create their router
@@ -82,59 +141,171 @@ func (app *Application) Mount() http.Handler {
 
 	// Assign the router to use these middlewares
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(app.RealIPMiddleware)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(app.RateLimitMiddleware)
 
-	// Timeout for the middlewares
-	r.Use(middleware.Timeout(60 * time.Second))
-	docsURL := fmt.Sprintf("%s://%s%s/swagger/doc.json", app.Config.Protocol, app.Config.Addr, app.Config.Port)
-	r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsURL)))
+	// The event stream and the WebSocket are long lived, so they are left out
+	// of the timeout
+	r.With(app.IPRateLimitMiddleware, app.AuthTokenMiddleware, app.RateLimitMiddleware(RateLimitDefault)).Get("/v1/stream", app.streamHandler)
+	r.With(app.IPRateLimitMiddleware, app.webSocketAuthMiddleware, app.RateLimitMiddleware(RateLimitDefault)).Get("/v1/ws", app.webSocketHandler)
+
+	r.Group(func(r chi.Router) {
+		// Timeout for the middlewares
+		r.Use(middleware.Timeout(60 * time.Second))
+		docsURL := fmt.Sprintf("%s://%s%s/swagger/doc.json", app.Config.Protocol, app.Config.Addr, app.Config.Port)
+		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsURL)))
+
+		// Define routes, you can have subroutes
+		r.Route("/v1", func(r chi.Router) {
+			// Health checks and metrics aren't rate limited
+			r.Get("/health", app.healthCheckHandler)
+			r.With(app.BasicAuthMiddleware()).Get("/metrics", expvar.Handler().ServeHTTP)
+
+			r.Route("/posts", func(r chi.Router) {
+				r.Use(app.IPRateLimitMiddleware)
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.RateLimitMiddleware(RateLimitDefault))
+				r.Post("/", app.createPostHandler)
+
+				r.Route("/{postId}", func(r chi.Router) {
+					r.Use(app.postsContextMiddleware)
+
+					r.Get("/", app.getPostHandler)
+					r.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
+					r.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
+
+					r.Put("/reactions", app.reactToPostHandler)
+					r.Delete("/reactions", app.removeReactionHandler)
+
+					r.Route("/comments", func(r chi.Router) {
+						r.Post("/", app.createCommentHandler)
+						r.Get("/", app.getCommentsByPostHandler)
+					})
+				})
+			})
 
-	// Define routes, you can have subroutes
-	r.Route("/v1", func(r chi.Router) {
-		r.Get("/health", app.healthCheckHandler)
-		r.With(app.BasicAuthMiddleware()).Get("/metrics", expvar.Handler().ServeHTTP)
+			r.Route("/users", func(r chi.Router) {
+				r.Use(app.IPRateLimitMiddleware)
+				r.Use(app.AuthTokenMiddleware)
+
+				r.Route("/{userId}", func(r chi.Router) {
+					r.Use(app.RateLimitMiddleware(RateLimitDefault))
+					r.Use(app.userContextMiddleware)
+
+					r.Get("/", app.getUserHandler)
+					r.Put("/follow", app.followUserHandler)
+					r.Put("/unfollow", app.unfollowUserHandler)
+					r.Put("/block", app.blockUserHandler)
+					r.Put("/unblock", app.unblockUserHandler)
+				})
 
-		r.Route("/posts", func(r chi.Router) {
-			r.Use(app.AuthTokenMiddleware)
-			r.Post("/", app.createPostHandler)
+				r.Group(func(r chi.Router) {
+					r.Use(app.RateLimitMiddleware(RateLimitRead))
+					r.Get("/feed", app.getUserFeedHandler)
+					r.Get("/search", app.searchUsersHandler)
+					r.Get("/mentions", app.getMentionsHandler)
+					r.Get("/tags", app.getFollowedTagsHandler)
+				})
+			})
 
-			r.Route("/{postId}", func(r chi.Router) {
-				r.Use(app.postsContextMiddleware)
+			r.Group(func(r chi.Router) {
+				r.Use(app.IPRateLimitMiddleware)
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.RateLimitMiddleware(RateLimitRead))
+				r.Get("/explore", app.getExploreHandler)
+				r.Get("/trending", app.getTrendingHandler)
+				r.Get("/search", app.searchHandler)
+			})
 
-				r.Get("/", app.getPostHandler)
-				r.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
-				r.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
+			r.Route("/tags", func(r chi.Router) {
+				r.Use(app.IPRateLimitMiddleware)
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.RateLimitMiddleware(RateLimitDefault))
+				r.Get("/{tag}", app.getTagHandler)
+				r.Get("/{tag}/posts", app.getTagPostsHandler)
+				r.Put("/{tag}/follow", app.followTagHandler)
+				r.Put("/{tag}/unfollow", app.unfollowTagHandler)
+			})
 
-				r.Route("/comments", func(r chi.Router) {
-					r.Post("/", app.createCommentHandler)
-					r.Get("/", app.getCommentsByPostHandler)
+			r.Route("/notifications", func(r chi.Router) {
+				// Authenticated by the signed token of the email
+				r.With(app.RateLimitMiddleware(RateLimitAuth)).Post("/unsubscribe", app.unsubscribeEmailsHandler)
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.IPRateLimitMiddleware)
+					r.Use(app.AuthTokenMiddleware)
+					r.Use(app.RateLimitMiddleware(RateLimitDefault))
+					r.Get("/", app.getNotificationsHandler)
+					r.Get("/unread_count", app.getUnreadNotificationsCountHandler)
+					r.Put("/read", app.markAllNotificationsReadHandler)
+					r.Put("/{notificationId}/read", app.markNotificationReadHandler)
+					r.Get("/email", app.getEmailPreferencesHandler)
+					r.Put("/email", app.updateEmailPreferencesHandler)
 				})
 			})
-		})
 
-		r.Route("/users", func(r chi.Router) {
-			r.Use(app.AuthTokenMiddleware)
+			r.Route("/conversations", func(r chi.Router) {
+				r.Use(app.IPRateLimitMiddleware)
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.RateLimitMiddleware(RateLimitDefault))
+				r.Post("/", app.createConversationHandler)
+				r.Get("/", app.getConversationsHandler)
+				r.Get("/unread_count", app.getUnreadMessagesCountHandler)
+				r.Get("/settings", app.getMessagingSettingsHandler)
+				r.Put("/settings", app.updateMessagingSettingsHandler)
+
+				r.Route("/{conversationId}", func(r chi.Router) {
+					r.Use(app.conversationContextMiddleware)
+
+					r.Get("/", app.getConversationHandler)
+					r.Get("/messages", app.getMessagesHandler)
+					r.Post("/messages", app.sendMessageHandler)
+					r.Put("/read", app.markConversationReadHandler)
+				})
+			})
 
-			r.Route("/{userId}", func(r chi.Router) {
-				r.Use(app.userContextMiddleware)
+			r.Route("/webhooks", func(r chi.Router) {
+				r.Use(app.IPRateLimitMiddleware)
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.requireRoleMiddleware("admin"))
+				r.Use(app.RateLimitMiddleware(RateLimitDefault))
+				r.Post("/", app.createWebhookHandler)
+				r.Get("/", app.getWebhooksHandler)
+
+				r.Route("/{webhookId}", func(r chi.Router) {
+					r.Use(app.webhookContextMiddleware)
+
+					r.Get("/", app.getWebhookHandler)
+					r.Patch("/", app.updateWebhookHandler)
+					r.Delete("/", app.deleteWebhookHandler)
+					r.Get("/deliveries", app.getWebhookDeliveriesHandler)
+				})
+			})
 
-				r.Get("/", app.getUserHandler)
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
+			r.Route("/jobs", func(r chi.Router) {
+				r.Use(app.IPRateLimitMiddleware)
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.requireRoleMiddleware("admin"))
+				r.Use(app.RateLimitMiddleware(RateLimitDefault))
+				r.Get("/", app.getJobsHandler)
+				r.Post("/{jobId}/retry", app.retryJobHandler)
 			})
 
-			r.Group(func(r chi.Router) {
-				r.Get("/feed", app.getUserFeedHandler)
+			r.Route("/emails", func(r chi.Router) {
+				r.Use(app.IPRateLimitMiddleware)
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.requireRoleMiddleware("admin"))
+				r.Use(app.RateLimitMiddleware(RateLimitDefault))
+				r.Get("/", app.getEmailsHandler)
 			})
-		})
 
-		r.Route("/auth", func(r chi.Router) {
-			r.Post("/user", app.registerUserHandler)
-			r.Post("/token", app.getTokenHandler)
-			r.Put("/user/activate", app.activateUserHandler)
+			r.Route("/auth", func(r chi.Router) {
+				r.Use(app.RateLimitMiddleware(RateLimitAuth))
+				r.Post("/user", app.registerUserHandler)
+				r.Post("/token", app.getTokenHandler)
+				r.Put("/user/activate", app.activateUserHandler)
+			})
 		})
 	})
 
@@ -158,18 +329,45 @@ func (app *Application) Run(mux http.Handler) error {
 		IdleTimeout:  time.Minute,
 	}
 
+	// Shutdown waits for the active connections, end the open event streams
+	srv.RegisterOnShutdown(app.Realtime.Close)
+
 	shutdown := make(chan error)
 	go func() {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 		s := <-quit
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
 		app.Logger.Infow("Signal caught", "signal", s.String())
 
-		shutdown <- srv.Shutdown(ctx)
+		// Every step gets its own timeout, so a slow one doesn't leave the
+		// next ones without time to drain
+		stops := []func(context.Context) error{
+			srv.Shutdown,
+			// Let the background workers finish the queued jobs
+			app.Timeline.Stop,
+			app.Notifications.Stop,
+			app.Events.Stop,
+			app.Webhooks.Stop,
+			app.Jobs.Stop,
+			app.Mailer.Stop,
+			app.Realtime.Stop,
+			app.Search.Close,
+		}
+
+		var errs []error
+		for _, stop := range stops {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			errs = append(errs, stop(ctx))
+			cancel()
+		}
+
+		// Closed here as main exits through logger.Fatal, skipping its defers
+		if app.RateLimiter != nil {
+			errs = append(errs, app.RateLimiter.Close())
+		}
+
+		shutdown <- errors.Join(errs...)
 	}()
 
 	app.Logger.Infow("starting server", "protocol", app.Config.Protocol, "addr", srv.Addr, "env", app.Config.Env)
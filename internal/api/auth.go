@@ -13,10 +13,11 @@ import (
 	"github.com/dottox/social/internal/store"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"golang.org/x/text/language"
 )
 
 // @Summary		Register a new user
-// @Description	Register a new user with the given information
+// @Description	Register a new user with the given information. The language of the emails is taken from the Accept-Language header when not given.
 // @Tags			auth
 // @Accept			json
 // @Produce		json
@@ -44,8 +45,13 @@ func (app *Application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 
 	// Create the new user if the payload had no errors
 	user := &model.User{
-		Username: payload.Username,
-		Email:    payload.Email,
+		Username:    payload.Username,
+		DisplayName: payload.DisplayName,
+		Email:       payload.Email,
+		Language:    payload.Language,
+	}
+	if user.Language == "" {
+		user.Language = preferredLanguage(r)
 	}
 
 	// Hash the user password and set the password to the user
@@ -61,46 +67,45 @@ func (app *Application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	hash := sha256.Sum256([]byte(plainToken))
 	hashToken := hex.EncodeToString(hash[:])
 
-	// Create the new user in the repository
-	if err := app.Store.Users.CreateAndInvite(ctx, user, hashToken, app.Config.Mail.Exp); err != nil {
+	vars := struct {
+		Username      string
+		ActivationURL string
+	}{
+		Username:      user.Username,
+		ActivationURL: fmt.Sprintf("%s/activate?token=%s", app.Config.FrontendURL, plainToken),
+	}
+
+	to := mailer.Recipient{
+		Name:   user.Username,
+		Email:  user.Email,
+		Locale: user.Language,
+	}
+
+	welcome, err := app.Mailer.Compose(mailer.UserWelcomeTemplate, to, vars, "")
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// Create the new user in the repository, queueing the welcome email
+	if err := app.Store.Users.CreateAndInvite(ctx, user, hashToken, app.Config.Mail.Exp, welcome); err != nil {
 		switch {
 		case errors.Is(err, store.ErrUsersDuplicateEmail) || errors.Is(err, store.ErrUsersDuplicateUsername):
 			app.resourceAlreadyExists(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
 		}
+		return
 	}
 
+	app.Mailer.Wake()
+
 	// Returning the user with the plain token for verification
 	userWithToken := &model.UserWithToken{
 		User:  user,
 		Token: plainToken,
 	}
 
-	activationURL := fmt.Sprintf("%s/activate?token=%s", app.Config.FrontendURL, plainToken)
-
-	isProdEnv := app.Config.Env == "production"
-	vars := struct {
-		Username      string
-		ActivationURL string
-	}{
-		Username:      user.Username,
-		ActivationURL: activationURL,
-	}
-
-	// Send the welcome email with the activation token
-	err := app.Mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProdEnv)
-	if err != nil {
-		app.Logger.Errorw("error sending welcome email", "error", err, "user_id", user.Id, "email", user.Email)
-
-		if err := app.Store.Users.DeleteById(ctx, user.Id); err != nil {
-			app.Logger.Errorw("error deleting user", "user_id", user.Id, "error", err)
-		}
-
-		app.internalServerError(w, r, err)
-		return
-	}
-
 	if err := app.jsonResponse(w, http.StatusCreated, userWithToken); err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -210,3 +215,14 @@ func (app *Application) getTokenHandler(w http.ResponseWriter, r *http.Request)
 		app.internalServerError(w, r, err)
 	}
 }
+
+// Returns the language the client prefers the most in its Accept-Language
+// header, or the default language of the emails
+func preferredLanguage(r *http.Request) string {
+	tags, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if err != nil || len(tags) == 0 || tags[0] == language.Und {
+		return mailer.DefaultLocale
+	}
+
+	return tags[0].String()
+}
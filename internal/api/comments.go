@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/dottox/social/internal/entities"
 	"github.com/dottox/social/internal/model"
 	"github.com/dottox/social/internal/store"
 	"github.com/go-chi/chi/v5"
@@ -57,9 +58,10 @@ func (app *Application) createCommentHandler(w http.ResponseWriter, r *http.Requ
 
 	// Create the new comment if the payload had no errors
 	comment := &model.Comment{
-		Content: payload.Content,
-		PostId:  uint32(postId),
-		UserId:  user.Id,
+		Content:  payload.Content,
+		PostId:   uint32(postId),
+		UserId:   user.Id,
+		Entities: entities.Parse(payload.Content),
 	}
 
 	// Create the new comment in the repository
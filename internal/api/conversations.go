@@ -0,0 +1,456 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type conversationKey string
+
+const conversationCtx conversationKey = "conversation"
+
+// @Summary		Start a conversation
+// @Description	Start a direct conversation with one user, or a group conversation with up to 9 users. Two users share a single direct conversation, starting it again returns the existing one. Users blocking, or blocked by, the caller can't be added, nor users only accepting messages from the users they follow when they don't follow the caller.
+// @Tags			conversations
+// @Accept			json
+// @Produce		json
+// @Param			conversation	body		model.CreateConversationPayload	true	"Conversation payload"
+// @Success		200				{object}	model.Conversation	"Existing direct conversation"
+// @Success		201				{object}	model.Conversation
+// @Failure		400				{object}	error
+// @Failure		403				{object}	error
+// @Failure		404				{object}	error
+// @Failure		500				{object}	error
+// @Security		BearerAuth
+// @Router			/conversations [post]
+func (app *Application) createConversationHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	var payload model.CreateConversationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getAuthUserFromCtx(ctx)
+
+	memberIds := []uint32{}
+	for _, id := range payload.UserIds {
+		if id != user.Id && !slices.Contains(memberIds, id) {
+			memberIds = append(memberIds, id)
+		}
+	}
+	if len(memberIds) == 0 {
+		app.badRequestError(w, r, errors.New("cannot start a conversation with yourself"))
+		return
+	}
+
+	if err := app.Store.Conversations.CanMessage(ctx, user.Id, memberIds); err != nil {
+		switch {
+		case errors.Is(err, store.ErrResourceNotFound):
+			app.resourceNotFoundError(w, r, err)
+			return
+		case errors.Is(err, store.ErrMessagingNotAllowed):
+			app.forbiddenError(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	conversation := &model.Conversation{
+		CreatorId: user.Id,
+		IsGroup:   len(memberIds) > 1,
+	}
+	// Direct conversations are named after the other user by the clients
+	if conversation.IsGroup {
+		conversation.Title = payload.Title
+	}
+
+	status := http.StatusCreated
+	if err := app.Store.Conversations.Create(ctx, conversation, memberIds); err != nil {
+		switch {
+		case errors.Is(err, store.ErrResourceAlreadyExists):
+			status = http.StatusOK
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	conversation, err := app.Store.Conversations.GetById(ctx, conversation.Id, user.Id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, status, conversation); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		List conversations
+// @Description	Get the conversations of the authenticated user, the ones with the most recent messages first, with their members, last message and unread count, and the unread messages count across all of them
+// @Tags			conversations
+// @Produce		json
+// @Param			limit	query		int	false	"Number of conversations to return"	minimum(1)	maximum(50)	default(20)
+// @Param			offset	query		int	false	"Number of conversations to skip"	minimum(0)	default(0)
+// @Success		200		{object}	model.ConversationList
+// @Failure		400		{object}	error
+// @Failure		500		{object}	error
+// @Security		BearerAuth
+// @Router			/conversations [get]
+func (app *Application) getConversationsHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	cq := store.ConversationQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+
+	cq, err := cq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getAuthUserFromCtx(ctx)
+
+	list, err := app.Store.Conversations.GetByUser(ctx, user.Id, cq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, list); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Count unread messages
+// @Description	Get the number of unread messages of the authenticated user across every conversation
+// @Tags			conversations
+// @Produce		json
+// @Success		200	{object}	unreadCountResponse
+// @Failure		500	{object}	error
+// @Security		BearerAuth
+// @Router			/conversations/unread_count [get]
+func (app *Application) getUnreadMessagesCountHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	user := app.getAuthUserFromCtx(ctx)
+
+	count, err := app.Store.Conversations.CountUnread(ctx, user.Id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, unreadCountResponse{Count: count}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Get messaging settings
+// @Description	Get the messaging settings of the authenticated user
+// @Tags			conversations
+// @Produce		json
+// @Success		200	{object}	model.MessagingSettings
+// @Failure		500	{object}	error
+// @Security		BearerAuth
+// @Router			/conversations/settings [get]
+func (app *Application) getMessagingSettingsHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	user := app.getAuthUserFromCtx(ctx)
+
+	settings, err := app.Store.Conversations.GetSettings(ctx, user.Id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, settings); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Update messaging settings
+// @Description	Update the messaging settings of the authenticated user. With following_only, only the users they follow can start a conversation with them or message them directly.
+// @Tags			conversations
+// @Accept			json
+// @Produce		json
+// @Param			settings	body		model.MessagingSettings	true	"Messaging settings"
+// @Success		200			{object}	model.MessagingSettings
+// @Failure		400			{object}	error
+// @Failure		500			{object}	error
+// @Security		BearerAuth
+// @Router			/conversations/settings [put]
+func (app *Application) updateMessagingSettingsHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	var settings model.MessagingSettings
+	if err := readJSON(w, r, &settings); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getAuthUserFromCtx(ctx)
+
+	if err := app.Store.Conversations.UpdateSettings(ctx, user.Id, &settings); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, settings); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Get a conversation
+// @Description	Get a conversation of the authenticated user with its members and their read receipts
+// @Tags			conversations
+// @Produce		json
+// @Param			conversationId	path		int	true	"Conversation ID"
+// @Success		200				{object}	model.Conversation
+// @Failure		400				{object}	error
+// @Failure		404				{object}	error
+// @Failure		500				{object}	error
+// @Security		BearerAuth
+// @Router			/conversations/{conversationId} [get]
+func (app *Application) getConversationHandler(w http.ResponseWriter, r *http.Request) {
+
+	conversation := app.getConversationFromCtx(r.Context())
+
+	if err := app.jsonResponse(w, http.StatusOK, conversation); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		List messages
+// @Description	Get the messages of a conversation from the newest. Pass the id of the oldest message received as before to get the previous page. Messages of users blocking, or blocked by, the caller are left out.
+// @Tags			conversations
+// @Produce		json
+// @Param			conversationId	path		int	true	"Conversation ID"
+// @Param			limit			query		int	false	"Number of messages to return"	minimum(1)	maximum(100)	default(50)
+// @Param			before			query		int	false	"Return the messages older than this one"
+// @Success		200				{array}		model.Message
+// @Failure		400				{object}	error
+// @Failure		404				{object}	error
+// @Failure		500				{object}	error
+// @Security		BearerAuth
+// @Router			/conversations/{conversationId}/messages [get]
+func (app *Application) getMessagesHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	mq := store.MessageQuery{
+		Limit: 50,
+	}
+
+	mq, err := mq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(mq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getAuthUserFromCtx(ctx)
+	conversation := app.getConversationFromCtx(ctx)
+
+	messages, err := app.Store.Conversations.GetMessages(ctx, conversation.Id, user.Id, mq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, messages); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Send a message
+// @Description	Send a message to a conversation. The blocks and messaging settings of the other user of a direct conversation apply to every message.
+// @Tags			conversations
+// @Accept			json
+// @Produce		json
+// @Param			conversationId	path		int							true	"Conversation ID"
+// @Param			message			body		model.SendMessagePayload	true	"Message payload"
+// @Success		201				{object}	model.Message
+// @Failure		400				{object}	error
+// @Failure		403				{object}	error
+// @Failure		404				{object}	error
+// @Failure		500				{object}	error
+// @Security		BearerAuth
+// @Router			/conversations/{conversationId}/messages [post]
+func (app *Application) sendMessageHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	var payload model.SendMessagePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getAuthUserFromCtx(ctx)
+	conversation := app.getConversationFromCtx(ctx)
+
+	if !conversation.IsGroup {
+		recipientIds := []uint32{}
+		for _, member := range conversation.Members {
+			if member.UserId != user.Id {
+				recipientIds = append(recipientIds, member.UserId)
+			}
+		}
+
+		if err := app.Store.Conversations.CanMessage(ctx, user.Id, recipientIds); err != nil {
+			switch {
+			case errors.Is(err, store.ErrMessagingNotAllowed), errors.Is(err, store.ErrResourceNotFound):
+				app.forbiddenError(w, r, store.ErrMessagingNotAllowed)
+				return
+			default:
+				app.internalServerError(w, r, err)
+				return
+			}
+		}
+	}
+
+	message := &model.Message{
+		ConversationId: conversation.Id,
+		SenderId:       user.Id,
+		Content:        payload.Content,
+	}
+
+	if err := app.Store.Conversations.AddMessage(ctx, message); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.Realtime.MessageCreated(message, conversation)
+
+	if err := app.jsonResponse(w, http.StatusCreated, message); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Mark a conversation as read
+// @Description	Mark every message of the conversation as read by the authenticated user. The other members receive the read receipt.
+// @Tags			conversations
+// @Produce		json
+// @Param			conversationId	path		int	true	"Conversation ID"
+// @Success		200				{object}	model.ReadReceipt
+// @Failure		400				{object}	error
+// @Failure		404				{object}	error
+// @Failure		500				{object}	error
+// @Security		BearerAuth
+// @Router			/conversations/{conversationId}/read [put]
+func (app *Application) markConversationReadHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	user := app.getAuthUserFromCtx(ctx)
+	conversation := app.getConversationFromCtx(ctx)
+
+	lastReadId, err := app.Store.Conversations.MarkRead(ctx, conversation.Id, user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrResourceNotFound):
+			app.resourceNotFoundError(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	receipt := &model.ReadReceipt{
+		ConversationId:    conversation.Id,
+		UserId:            user.Id,
+		LastReadMessageId: lastReadId,
+	}
+	app.Realtime.ConversationRead(receipt, conversation)
+
+	if err := app.jsonResponse(w, http.StatusOK, receipt); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// Loads the conversation of the path. Conversations the authenticated user
+// isn't a member of are not found.
+func (app *Application) conversationContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		ctx := r.Context()
+
+		idParam := chi.URLParam(r, "conversationId")
+		id, err := strconv.ParseUint(idParam, 10, 32)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+
+		user := app.getAuthUserFromCtx(ctx)
+
+		conversation, err := app.Store.Conversations.GetById(ctx, uint32(id), user.Id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrResourceNotFound):
+				app.resourceNotFoundError(w, r, err)
+				return
+			default:
+				app.internalServerError(w, r, err)
+				return
+			}
+		}
+
+		ctx = context.WithValue(ctx, conversationCtx, conversation)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (app *Application) getConversationFromCtx(ctx context.Context) *model.Conversation {
+	conversation, _ := ctx.Value(conversationCtx).(*model.Conversation)
+	return conversation
+}
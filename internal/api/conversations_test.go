@@ -0,0 +1,175 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dottox/social/internal/realtime"
+)
+
+func TestConversations(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.Mount()
+
+	testToken, _ := app.Authenticator.GenerateToken(nil)
+
+	t.Run("should start a conversation", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/v1/conversations", strings.NewReader(`{"user_ids":[2,3],"title":"gophers"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("should not start a conversation with yourself", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/v1/conversations", strings.NewReader(`{"user_ids":[24]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should return 400 for too many members", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/v1/conversations", strings.NewReader(`{"user_ids":[1,2,3,4,5,6,7,8,9,10]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should list the conversations", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/conversations?limit=10", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should return 404 for a conversation of other users", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/conversations/0", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should send a message to the members", func(t *testing.T) {
+		sub := app.Realtime.Subscribe([]string{realtime.UserTopic(25)}, 0)
+		defer app.Realtime.Unsubscribe(sub)
+
+		req, err := http.NewRequest("POST", "/v1/conversations/1/messages", strings.NewReader(`{"content":"hello"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		select {
+		case event := <-sub.C:
+			if event.Kind != realtime.KindMessageCreated {
+				t.Errorf("expected a message event; got %s", event.Kind)
+			}
+		default:
+			t.Error("expected the other member to receive the message")
+		}
+	})
+
+	t.Run("should return 400 for an empty message", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/v1/conversations/1/messages", strings.NewReader(`{"content":""}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should page through the messages", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/conversations/1/messages?limit=20&before=100", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should return 400 for an invalid messages limit", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/conversations/1/messages?limit=500", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should mark the conversation as read", func(t *testing.T) {
+		req, err := http.NewRequest("PUT", "/v1/conversations/1/read", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should update the messaging settings", func(t *testing.T) {
+		req, err := http.NewRequest("PUT", "/v1/conversations/settings", strings.NewReader(`{"following_only":true}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		if body := rr.Body.String(); body != `{"data":{"following_only":true}}`+"\n" {
+			t.Errorf("unexpected body %s", body)
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/store"
+)
+
+var errInvalidUnsubscribeToken = errors.New("invalid unsubscribe token")
+
+// Scopes of the unsubscribe links: a kind of notification for the emails of
+// a single notification, a frequency for the digests
+var unsubscribeScopes = map[string]bool{
+	model.NotificationFollow:   true,
+	model.NotificationComment:  true,
+	model.NotificationMention:  true,
+	model.NotificationReaction: true,
+	model.EmailDaily:           true,
+	model.EmailWeekly:          true,
+}
+
+// @Summary		Get the email preferences
+// @Description	Get how often each kind of notification is emailed to the authenticated user: immediately, in a daily or weekly digest, or never
+// @Tags			notifications
+// @Produce		json
+// @Success		200	{object}	model.EmailPreferences
+// @Failure		404	{object}	error
+// @Failure		500	{object}	error
+// @Security		BearerAuth
+// @Router			/notifications/email [get]
+func (app *Application) getEmailPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+	user := app.getAuthUserFromCtx(ctx)
+
+	prefs, err := app.Store.Notifications.GetEmailPreferences(ctx, user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrResourceNotFound):
+			app.resourceNotFoundError(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Update the email preferences
+// @Description	Set how often each kind of notification is emailed to the authenticated user
+// @Tags			notifications
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		model.EmailPreferences	true	"Email preferences"
+// @Success		200		{object}	model.EmailPreferences
+// @Failure		400		{object}	error
+// @Failure		404		{object}	error
+// @Failure		500		{object}	error
+// @Security		BearerAuth
+// @Router			/notifications/email [put]
+func (app *Application) updateEmailPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	var prefs model.EmailPreferences
+	if err := readJSON(w, r, &prefs); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(prefs); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getAuthUserFromCtx(ctx)
+
+	if err := app.Store.Notifications.UpdateEmailPreferences(ctx, user.Id, &prefs); err != nil {
+		switch {
+		case errors.Is(err, store.ErrResourceNotFound):
+			app.resourceNotFoundError(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Unsubscribe from notification emails
+// @Description	Stop the emails of the unsubscribe link, which covers a kind of notification or a digest. Doesn't need authentication, the link is signed.
+// @Tags			notifications
+// @Param			token	query	string	true	"Unsubscribe token of the email"
+// @Success		204
+// @Failure		400	{object}	error
+// @Failure		404	{object}	error
+// @Failure		500	{object}	error
+// @Router			/notifications/unsubscribe [post]
+func (app *Application) unsubscribeEmailsHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	userId, scope, err := app.parseUnsubscribeToken(r.URL.Query().Get("token"))
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := app.Store.Notifications.UnsubscribeEmails(ctx, userId, scope); err != nil {
+		switch {
+		case errors.Is(err, store.ErrResourceNotFound):
+			app.resourceNotFoundError(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	app.Logger.Infow("user unsubscribed from emails", "user_id", userId, "scope", scope)
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// Returns the link that unsubscribes the user from the emails of the scope.
+// The token doesn't expire, so the links of old emails keep working.
+func (app *Application) unsubscribeURL(userId uint32, scope string) string {
+	payload := base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d:%s", userId, scope))
+	token := payload + "." + app.signUnsubscribePayload(payload)
+
+	return fmt.Sprintf("%s/unsubscribe?token=%s", app.Config.FrontendURL, token)
+}
+
+// Returns the user and the scope of the unsubscribe token, checking its
+// signature
+func (app *Application) parseUnsubscribeToken(token string) (uint32, string, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(app.signUnsubscribePayload(payload))) {
+		return 0, "", errInvalidUnsubscribeToken
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return 0, "", errInvalidUnsubscribeToken
+	}
+
+	id, scope, ok := strings.Cut(string(decoded), ":")
+	if !ok || !unsubscribeScopes[scope] {
+		return 0, "", errInvalidUnsubscribeToken
+	}
+
+	userId, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return 0, "", errInvalidUnsubscribeToken
+	}
+
+	return uint32(userId), scope, nil
+}
+
+func (app *Application) signUnsubscribePayload(payload string) string {
+	// Prefixed so the signatures are of no use for anything else with the key
+	mac := hmac.New(sha256.New, []byte(app.Config.Mail.UnsubscribeSecret))
+	mac.Write([]byte("unsubscribe:" + payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dottox/social/internal/mailer"
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/store"
+)
+
+type digestNotificationStore struct {
+	store.MockNotificationStore
+	sent   []uint32
+	emails []*model.Email
+}
+
+func (s *digestNotificationStore) GetDigestRecipients(ctx context.Context, dq store.DigestQuery, afterUserId uint32, limit int) ([]uint32, error) {
+	if afterUserId > 0 {
+		return []uint32{}, nil
+	}
+	return []uint32{1, 2}, nil
+}
+
+func (s *digestNotificationStore) GetDigest(ctx context.Context, userId uint32, dq store.DigestQuery) ([]*model.Notification, error) {
+	if userId == 2 {
+		return []*model.Notification{}, nil
+	}
+
+	n := &model.Notification{Kind: model.NotificationReaction, ActorsCount: 4}
+	n.SetSummary([]string{"alice", "bob", "carol"})
+	return []*model.Notification{n}, nil
+}
+
+func (s *digestNotificationStore) QueueDigest(ctx context.Context, userId uint32, dq store.DigestQuery, email *model.Email) (bool, error) {
+	s.sent = append(s.sent, userId)
+	s.emails = append(s.emails, email)
+	return true, nil
+}
+
+func TestEmailPreferences(t *testing.T) {
+	app := newTestApplication(t)
+	app.Config.FrontendURL = "http://localhost:4000"
+	app.Config.Mail.UnsubscribeSecret = "secret"
+	mux := app.Mount()
+
+	testToken, _ := app.Authenticator.GenerateToken(nil)
+
+	t.Run("should get the email preferences", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/notifications/email", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should update the email preferences", func(t *testing.T) {
+		body := `{"follow":"off","comment":"immediate","mention":"immediate","reaction":"daily"}`
+		req, err := http.NewRequest("PUT", "/v1/notifications/email", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should return 400 for an unknown frequency", func(t *testing.T) {
+		body := `{"follow":"hourly","comment":"immediate","mention":"immediate","reaction":"daily"}`
+		req, err := http.NewRequest("PUT", "/v1/notifications/email", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should unsubscribe with the token of the link", func(t *testing.T) {
+		link, err := url.Parse(app.unsubscribeURL(1, model.EmailWeekly))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// No authentication, the token is enough
+		req, err := http.NewRequest("POST", "/v1/notifications/unsubscribe?token="+link.Query().Get("token"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNoContent, rr.Code)
+	})
+
+	t.Run("should return 400 for a tampered token", func(t *testing.T) {
+		link, err := url.Parse(app.unsubscribeURL(1, model.EmailWeekly))
+		if err != nil {
+			t.Fatal(err)
+		}
+		token := link.Query().Get("token")
+
+		// The same signature for another user
+		_, signature, _ := strings.Cut(token, ".")
+		other, _, _ := strings.Cut(strings.TrimPrefix(app.unsubscribeURL(2, model.EmailWeekly), "http://localhost:4000/unsubscribe?token="), ".")
+
+		for _, token := range []string{"", "abc", other + "." + signature, token + "x"} {
+			req, err := http.NewRequest("POST", "/v1/notifications/unsubscribe?token="+token, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should reject the tokens signed with another secret", func(t *testing.T) {
+		other := newTestApplication(t)
+		other.Config.Mail.UnsubscribeSecret = "other"
+
+		link, err := url.Parse(other.unsubscribeURL(1, model.EmailDaily))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := app.parseUnsubscribeToken(link.Query().Get("token")); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestNotificationDigests(t *testing.T) {
+	app := newTestApplication(t)
+	app.Config.FrontendURL = "http://localhost:4000"
+
+	notifications := &digestNotificationStore{}
+	app.Store.Notifications = notifications
+
+	// The digests are queued by the notification store
+	templates, err := mailer.ParseTemplates(mailer.FS, mailer.DefaultLocale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Mailer = mailer.NewQueue(mailer.Config{}, mailer.NewMockClient(), templates, app.Store, app.Logger)
+
+	err = app.sendDigests(context.Background(), store.DigestQuery{
+		Frequency: model.EmailDaily,
+		Window:    time.Hour * 24,
+		Until:     time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The user without notifications gets no digest
+	if len(notifications.emails) != 1 || len(notifications.sent) != 1 || notifications.sent[0] != 1 {
+		t.Fatalf("expected the digest of user 1; got %d emails for %v", len(notifications.emails), notifications.sent)
+	}
+
+	email := notifications.emails[0]
+	if email.DedupKey == nil || !strings.HasPrefix(*email.DedupKey, "digest:daily:1:") {
+		t.Errorf("expected the dedup key of the digest; got %v", email.DedupKey)
+	}
+	if !strings.Contains(email.TextBody, "- alice and 3 others reacted to your post") {
+		t.Errorf("unexpected text %q", email.TextBody)
+	}
+	if !strings.HasPrefix(email.UnsubscribeURL, "http://localhost:4000/unsubscribe?token=") {
+		t.Errorf("unexpected unsubscribe link %q", email.UnsubscribeURL)
+	}
+}
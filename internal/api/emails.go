@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/dottox/social/internal/store"
+)
+
+// @Summary		List emails
+// @Description	Get the emails queued by the platform, most recent first, with their delivery status. Filter by the failed status to get the emails that ran out of attempts. Admins only.
+// @Tags			emails
+// @Produce		json
+// @Param			limit	query		int		false	"Number of emails to return"		minimum(1)	maximum(100)	default(20)
+// @Param			offset	query		int		false	"Number of emails to skip"			minimum(0)	default(0)
+// @Param			status	query		string	false	"Only emails with the status"	Enums(queued, sending, sent, failed)
+// @Success		200		{array}		model.Email
+// @Failure		400		{object}	error
+// @Failure		403		{object}	error
+// @Failure		500		{object}	error
+// @Security		BearerAuth
+// @Router			/emails [get]
+func (app *Application) getEmailsHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	eq := store.EmailQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+
+	eq, err := eq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(eq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	emails, err := app.Store.Emails.GetAll(ctx, eq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, emails); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
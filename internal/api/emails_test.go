@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEmails(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.Mount()
+
+	testToken, _ := app.Authenticator.GenerateToken(nil)
+
+	t.Run("should forbid the users that aren't admins", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/emails", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+
+	admin := newTestApplication(t)
+	admin.Store.Users = &adminUserStore{}
+	adminMux := admin.Mount()
+
+	t.Run("should list the failed emails", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/emails?status=failed", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, adminMux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should return 400 for an unknown status", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/emails?status=lost", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, adminMux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+}
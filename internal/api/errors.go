@@ -21,6 +21,13 @@ func (app *Application) badRequestError(w http.ResponseWriter, r *http.Request,
 	writeJSONError(w, http.StatusBadRequest, "bad request")
 }
 
+// Responds with the message of the error, for the errors meant for the client
+func (app *Application) badRequestErrorMessage(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError("bad request error", r, err)
+
+	writeJSONError(w, http.StatusBadRequest, err.Error())
+}
+
 func (app *Application) resourceNotFoundError(w http.ResponseWriter, r *http.Request, err error) {
 	app.logError("resource not found", r, err)
 
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dottox/social/internal/events"
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/store"
+)
+
+// Subscribes the side effects of the domain events, run by the event
+// dispatcher once the change that caused them is committed
+func (app *Application) SubscribeEvents() {
+	for _, kind := range []string{
+		model.EventUserRegistered,
+		model.EventPostCreated,
+		model.EventCommentCreated,
+		model.EventUserFollowed,
+	} {
+		app.Events.Subscribe(kind, "webhooks", app.publishWebhookEvent)
+	}
+
+	app.Events.Subscribe(model.EventPostCreated, "timeline", app.updateTimelines)
+	app.Events.Subscribe(model.EventUserFollowed, "timeline", app.updateTimelines)
+
+	for _, kind := range []string{
+		model.EventPostCreated,
+		model.EventPostUpdated,
+		model.EventPostDeleted,
+		model.EventCommentCreated,
+	} {
+		app.Events.Subscribe(kind, "search", app.indexSearchEvent)
+	}
+
+	for _, kind := range []string{
+		model.EventPostCreated,
+		model.EventPostUpdated,
+		model.EventCommentCreated,
+		model.EventUserFollowed,
+		model.EventPostReacted,
+	} {
+		app.Events.Subscribe(kind, "notifications", app.notifyEvent)
+	}
+
+	app.Events.Subscribe(model.EventPostCreated, "realtime", app.publishRealtimeEvent)
+	app.Events.Subscribe(model.EventCommentCreated, "realtime", app.publishRealtimeEvent)
+}
+
+// Copies the new posts and the posts of the followed users into the timelines
+func (app *Application) updateTimelines(ctx context.Context, event *model.DomainEvent) error {
+	switch event.Kind {
+	case model.EventPostCreated:
+		var created model.PostCreated
+		if err := events.Decode(event, &created); err != nil {
+			return err
+		}
+		app.Timeline.PostCreated(created.Post)
+	case model.EventUserFollowed:
+		var followed model.UserFollowed
+		if err := events.Decode(event, &followed); err != nil {
+			return err
+		}
+		app.Timeline.UserFollowed(followed.Follow)
+	}
+
+	return nil
+}
+
+// Indexes the saved posts and comments in the search backend, and removes
+// the deleted posts
+func (app *Application) indexSearchEvent(ctx context.Context, event *model.DomainEvent) error {
+	switch event.Kind {
+	case model.EventPostCreated:
+		var created model.PostCreated
+		if err := events.Decode(event, &created); err != nil {
+			return err
+		}
+		app.Search.PostSaved(created.Post)
+	case model.EventPostUpdated:
+		var updated model.PostUpdated
+		if err := events.Decode(event, &updated); err != nil {
+			return err
+		}
+		app.Search.PostSaved(updated.Post)
+	case model.EventPostDeleted:
+		var deleted model.PostDeleted
+		if err := events.Decode(event, &deleted); err != nil {
+			return err
+		}
+		app.Search.PostDeleted(deleted.PostId)
+	case model.EventCommentCreated:
+		var created model.CommentCreated
+		if err := events.Decode(event, &created); err != nil {
+			return err
+		}
+
+		post, err := app.eventPost(ctx, created.Comment.PostId)
+		if post == nil {
+			return err
+		}
+		app.Search.CommentSaved(created.Comment, post)
+	}
+
+	return nil
+}
+
+// Notifies the users followed, mentioned, commented on or reacted to
+func (app *Application) notifyEvent(ctx context.Context, event *model.DomainEvent) error {
+	switch event.Kind {
+	case model.EventPostCreated:
+		var created model.PostCreated
+		if err := events.Decode(event, &created); err != nil {
+			return err
+		}
+		app.Notifications.PostCreated(created.Post)
+	case model.EventPostUpdated:
+		var updated model.PostUpdated
+		if err := events.Decode(event, &updated); err != nil {
+			return err
+		}
+		app.Notifications.PostUpdated(updated.Post, updated.Previous)
+	case model.EventCommentCreated:
+		var created model.CommentCreated
+		if err := events.Decode(event, &created); err != nil {
+			return err
+		}
+
+		post, err := app.eventPost(ctx, created.Comment.PostId)
+		if post == nil {
+			return err
+		}
+		app.Notifications.CommentCreated(created.Comment, post)
+	case model.EventUserFollowed:
+		var followed model.UserFollowed
+		if err := events.Decode(event, &followed); err != nil {
+			return err
+		}
+		app.Notifications.UserFollowed(followed.Follow)
+	case model.EventPostReacted:
+		var reacted model.PostReacted
+		if err := events.Decode(event, &reacted); err != nil {
+			return err
+		}
+
+		post, err := app.eventPost(ctx, reacted.Reaction.PostId)
+		if post == nil {
+			return err
+		}
+		app.Notifications.PostReacted(reacted.Reaction, post)
+	}
+
+	return nil
+}
+
+// Publishes the new posts and comments to the connected clients
+func (app *Application) publishRealtimeEvent(ctx context.Context, event *model.DomainEvent) error {
+	switch event.Kind {
+	case model.EventPostCreated:
+		var created model.PostCreated
+		if err := events.Decode(event, &created); err != nil {
+			return err
+		}
+		app.Realtime.PostCreated(created.Post)
+	case model.EventCommentCreated:
+		var created model.CommentCreated
+		if err := events.Decode(event, &created); err != nil {
+			return err
+		}
+		app.Realtime.CommentCreated(created.Comment)
+	}
+
+	return nil
+}
+
+// Gets the post an event refers to. A post deleted since the event returns
+// no post and no error, so the event is skipped instead of retried.
+func (app *Application) eventPost(ctx context.Context, postId uint32) (*model.Post, error) {
+	post, err := app.Store.Posts.GetById(ctx, postId)
+	if errors.Is(err, store.ErrResourceNotFound) {
+		return nil, nil
+	}
+
+	return post, err
+}
+
+// Queues the deliveries of the event to the subscribed webhooks
+func (app *Application) publishWebhookEvent(ctx context.Context, event *model.DomainEvent) error {
+	var data any
+	switch event.Kind {
+	case model.EventUserRegistered:
+		// The email and the settings of the user are private
+		var registered model.UserRegistered
+		if err := events.Decode(event, &registered); err != nil {
+			return err
+		}
+		data = &model.WebhookUser{
+			Id:        registered.User.Id,
+			Username:  registered.User.Username,
+			CreatedAt: registered.User.CreatedAt,
+		}
+	case model.EventPostCreated:
+		var created model.PostCreated
+		if err := events.Decode(event, &created); err != nil {
+			return err
+		}
+		data = created.Post
+	case model.EventCommentCreated:
+		var created model.CommentCreated
+		if err := events.Decode(event, &created); err != nil {
+			return err
+		}
+		data = created.Comment
+	case model.EventUserFollowed:
+		var followed model.UserFollowed
+		if err := events.Decode(event, &followed); err != nil {
+			return err
+		}
+		data = followed.Follow
+	}
+
+	return app.Webhooks.Publish(ctx, &model.WebhookEvent{
+		Event:      event.Kind,
+		OccurredAt: event.CreatedAt,
+		Data:       data,
+	})
+}
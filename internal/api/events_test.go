@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/notifications"
+	"github.com/dottox/social/internal/search"
+	"github.com/dottox/social/internal/store"
+)
+
+type recordingNotificationStore struct {
+	store.MockNotificationStore
+	added []*model.NotificationEvent
+}
+
+func (m *recordingNotificationStore) Add(ctx context.Context, event *model.NotificationEvent) (bool, error) {
+	m.added = append(m.added, event)
+	return true, nil
+}
+
+type authoredPostStore struct {
+	store.MockPostStore
+}
+
+func (m *authoredPostStore) GetById(ctx context.Context, id uint32) (*model.Post, error) {
+	post, err := m.MockPostStore.GetById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	post.UserId = 3
+	return post, nil
+}
+
+func newDomainEvent(t *testing.T, kind string, payload any) *model.DomainEvent {
+	t.Helper()
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &model.DomainEvent{Id: 1, Kind: kind, Payload: data}
+}
+
+func TestNotifyEvent(t *testing.T) {
+	newApp := func(t *testing.T) (*Application, *recordingNotificationStore) {
+		app := newTestApplication(t)
+
+		notificationStore := &recordingNotificationStore{}
+		app.Store.Notifications = notificationStore
+		app.Store.Posts = &authoredPostStore{}
+		app.Notifications = notifications.NewService(notifications.Config{}, app.Store, app.Logger)
+
+		// Stopped, so the notifications are recorded inline
+		if err := app.Notifications.Stop(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		return app, notificationStore
+	}
+
+	t.Run("should notify the author of the commented post", func(t *testing.T) {
+		app, notificationStore := newApp(t)
+
+		event := newDomainEvent(t, model.EventCommentCreated, &model.CommentCreated{
+			Comment: &model.Comment{Id: 1, PostId: 7, UserId: 2},
+		})
+		if err := app.notifyEvent(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(notificationStore.added) != 1 {
+			t.Fatalf("expected 1 notification; got %d", len(notificationStore.added))
+		}
+		if added := notificationStore.added[0]; added.UserId != 3 || added.Kind != model.NotificationComment {
+			t.Errorf("expected a comment notification for the author; got %+v", added)
+		}
+	})
+
+	t.Run("should skip the reactions to a deleted post", func(t *testing.T) {
+		app, notificationStore := newApp(t)
+
+		event := newDomainEvent(t, model.EventPostReacted, &model.PostReacted{
+			Reaction: &model.Reaction{PostId: 0, UserId: 2},
+		})
+		if err := app.notifyEvent(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(notificationStore.added) != 0 {
+			t.Errorf("expected no notifications; got %d", len(notificationStore.added))
+		}
+	})
+}
+
+type recordingSearchBackend struct {
+	search.Backend
+	calls []string
+}
+
+func (b *recordingSearchBackend) PostSaved(post *model.Post) {
+	b.calls = append(b.calls, fmt.Sprintf("saved %d", post.Id))
+}
+
+func (b *recordingSearchBackend) PostDeleted(postId uint32) {
+	b.calls = append(b.calls, fmt.Sprintf("deleted %d", postId))
+}
+
+func TestIndexSearchEvent(t *testing.T) {
+	app := newTestApplication(t)
+
+	backend := &recordingSearchBackend{Backend: app.Search}
+	app.Search = backend
+
+	for _, event := range []*model.DomainEvent{
+		newDomainEvent(t, model.EventPostCreated, &model.PostCreated{Post: &model.Post{Id: 7}}),
+		newDomainEvent(t, model.EventPostUpdated, &model.PostUpdated{Post: &model.Post{Id: 7}}),
+		newDomainEvent(t, model.EventPostDeleted, &model.PostDeleted{PostId: 7}),
+	} {
+		if err := app.indexSearchEvent(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := strings.Join(backend.calls, ","); got != "saved 7,saved 7,deleted 7" {
+		t.Errorf("expected the post to be indexed, reindexed and removed; got %s", got)
+	}
+}
@@ -1,11 +1,20 @@
 package api
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/dottox/social/internal/entities"
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/ranking"
 	"github.com/dottox/social/internal/store"
 )
 
+// Number of recent posts from the user's network that are scored by the ranked feed
+const rankingCandidates = 200
+
 // @Summary		Get user feed
 // @Description	Get the feed for the authenticated user
 // @Tags			feed
@@ -16,8 +25,9 @@ import (
 // @Param			sort	query		string	false	"Sort order: asc or desc"	enum(asc, desc)	default(desc)
 // @Param			tags	query		string	false	"Comma-separated list of tags to filter by"
 // @Param			search	query		string	false	"Search term to filter posts by title or content"
-// @Param			since	query		string	false	"ISO 8601 date to filter posts created after this date"
-// @Param			until	query		string	false	"ISO 8601 date to filter posts created before this date"
+// @Param			since	query		string	false	"RFC 3339 timestamp (or YYYY-MM-DD) to filter posts created at or after this date"
+// @Param			until	query		string	false	"RFC 3339 timestamp (or YYYY-MM-DD) to filter posts created at or before this date"
+// @Param			ranking	query		string	false	"Ranking mode: chronological, or for_you to rank by recency, engagement, affinity and tags"	enum(chronological, for_you)	default(chronological)
 // @Success		200		{array}		model.Post
 // @Failure		400		{object}	error
 // @Failure		500		{object}	error
@@ -27,31 +37,28 @@ func (app *Application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 
 	ctx := r.Context()
 
-	fq := store.PaginatedFeedQuery{
-		Limit:  20,
-		Offset: 0,
-		Sort:   "desc",
-		Tags:   []string{},
-		Search: "",
-		Since:  "",
-		Until:  "",
-	}
-
-	fq, err := fq.Parse(r)
+	fq, err := parseFeedQuery(r)
 	if err != nil {
 		app.badRequestError(w, r, err)
 		return
 	}
 
-	if err := Validate.Struct(fq); err != nil {
-		app.badRequestError(w, r, err)
+	// The ranked feed only scores the most recent posts, the error names the
+	// limit so clients stop paging instead of reading an empty page
+	if fq.Ranking == "for_you" && fq.Offset >= rankingCandidates {
+		app.badRequestErrorMessage(w, r, fmt.Errorf("the for_you ranking only covers the %d most recent posts, offset must be lower", rankingCandidates))
 		return
 	}
 
 	// Get the authenticated user from the context
 	user := app.getAuthUserFromCtx(ctx)
 
-	feed, err := app.Store.Posts.GetUserFeed(ctx, user.Id, fq)
+	var feed []*model.Post
+	if fq.Ranking == "for_you" {
+		feed, err = app.getRankedFeed(ctx, user.Id, fq)
+	} else {
+		feed, err = app.Timeline.Feed(ctx, user.Id, fq)
+	}
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -62,3 +69,71 @@ func (app *Application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 }
+
+// Parses and validates the pagination and filters shared by the feed endpoints
+func parseFeedQuery(r *http.Request) (store.PaginatedFeedQuery, error) {
+	fq := store.PaginatedFeedQuery{
+		Limit:   20,
+		Offset:  0,
+		Sort:    "desc",
+		Tags:    []string{},
+		Search:  "",
+		Since:   "",
+		Until:   "",
+		Ranking: "chronological",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		return fq, err
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		return fq, err
+	}
+
+	// Stored tags are normalised
+	for i, tag := range fq.Tags {
+		fq.Tags[i] = entities.NormalizeTag(tag)
+	}
+
+	return fq, nil
+}
+
+// Scores the most recent posts of the user's network and returns the
+// requested page of the ranked result
+func (app *Application) getRankedFeed(ctx context.Context, userId uint32, fq store.PaginatedFeedQuery) ([]*model.Post, error) {
+	candidatesQuery := fq
+	candidatesQuery.Limit = rankingCandidates
+	candidatesQuery.Offset = 0
+	candidatesQuery.Sort = "desc"
+
+	candidates, err := app.Timeline.Feed(ctx, userId, candidatesQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	affinities, err := app.Store.Reactions.GetAuthorAffinities(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	interests, err := app.Store.Reactions.GetTagInterests(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	ranked := app.Ranker.Rank(candidates, ranking.Signals{
+		Now:            time.Now(),
+		AuthorAffinity: affinities,
+		TagInterests:   interests,
+	})
+
+	if fq.Offset >= len(ranked) {
+		return []*model.Post{}, nil
+	}
+
+	end := min(fq.Offset+fq.Limit, len(ranked))
+
+	return ranked[fq.Offset:end], nil
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/store"
+)
+
+func TestGetUserFeed(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.Mount()
+
+	testToken, _ := app.Authenticator.GenerateToken(nil)
+
+	t.Run("should accept RFC 3339 bounds", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/users/feed?since=2024-01-01T00:00:00Z&until=2024-01-02T00:00:00%2B01:00", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should return 400 for an invalid since", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/users/feed?since=2024-01-01%2000:00:00", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should return 400 when since is after until", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/users/feed?since=2024-01-02T00:00:00Z&until=2024-01-01T00:00:00Z", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should accept the for_you ranking", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/users/feed?ranking=for_you", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should return 400 for an offset past the ranked posts", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/users/feed?ranking=for_you&offset=200", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+		if !strings.Contains(rr.Body.String(), "200") {
+			t.Errorf("expected the error to name the limit; got %s", rr.Body.String())
+		}
+	})
+
+	t.Run("should return 400 for an unknown ranking", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/users/feed?ranking=popular", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestGetTagPosts(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.Mount()
+
+	testToken, _ := app.Authenticator.GenerateToken(nil)
+
+	t.Run("should not allow unauth requests", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/tags/golang/posts", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should return the tag timeline", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/tags/golang/posts?limit=5", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+}
+
+func TestGetTrending(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.Mount()
+
+	testToken, _ := app.Authenticator.GenerateToken(nil)
+
+	t.Run("should return the latest snapshot of the window", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/trending?window=1h", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should return 400 for an unknown window", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/trending?window=2h", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestGetMentions(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.Mount()
+
+	testToken, _ := app.Authenticator.GenerateToken(nil)
+
+	t.Run("should return the posts mentioning the user", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/users/mentions?limit=10", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should return 401 without a token", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/users/mentions", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+type exploreStore struct {
+	store.MockPostStore
+	viewerId uint32
+	fq       store.PaginatedFeedQuery
+}
+
+func (s *exploreStore) GetExplore(ctx context.Context, viewerId uint32, fq store.PaginatedFeedQuery) ([]*model.Post, error) {
+	s.viewerId = viewerId
+	s.fq = fq
+	return []*model.Post{{Id: 1, UserId: 2}}, nil
+}
+
+func TestGetExplore(t *testing.T) {
+	app := newTestApplication(t)
+	posts := &exploreStore{}
+	app.Store.Posts = posts
+	mux := app.Mount()
+
+	testToken, _ := app.Authenticator.GenerateToken(nil)
+
+	t.Run("should not allow unauth requests", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/explore", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should return the posts visible to the user", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/explore?limit=5&tags=go&since=2024-03-10", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		// The store hides the blocked users of the viewer
+		if posts.viewerId != 24 {
+			t.Errorf("expected the posts visible to user 24; got %d", posts.viewerId)
+		}
+		if posts.fq.Limit != 5 || len(posts.fq.Tags) != 1 || posts.fq.Since != "2024-03-10T00:00:00Z" {
+			t.Errorf("unexpected feed query %+v", posts.fq)
+		}
+		if !strings.Contains(rr.Body.String(), `"id":1`) {
+			t.Errorf("unexpected body %s", rr.Body.String())
+		}
+	})
+
+	t.Run("should return 400 for invalid filters", func(t *testing.T) {
+		for _, rawQuery := range []string{"limit=26", "sort=random", "since=yesterday"} {
+			req, err := http.NewRequest("GET", "/v1/explore?"+rawQuery, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status 400; got %d", rawQuery, rr.Code)
+			}
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/dottox/social/internal/jobs"
+	"github.com/dottox/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// Deletes the expired user invitations
+type cleanupInvitationsJob struct{}
+
+func (cleanupInvitationsJob) Kind() string { return "cleanup_invitations" }
+
+// Deletes the dispatched events, the finished webhook deliveries, the
+// succeeded jobs and the sent emails older than the retention
+type pruneHistoryJob struct{}
+
+func (pruneHistoryJob) Kind() string { return "prune_history" }
+
+// Computes the trending snapshots of every window
+type refreshTrendingJob struct{}
+
+func (refreshTrendingJob) Kind() string { return "refresh_trending" }
+
+// Registers the handlers of the background jobs and the recurring ones
+func (app *Application) RegisterJobs() error {
+	jobs.Register(app.Jobs, app.cleanupInvitations)
+	jobs.Register(app.Jobs, app.pruneHistory)
+	jobs.Register(app.Jobs, app.refreshTrending)
+	jobs.Register(app.Jobs, app.sendNotificationEmail)
+	jobs.Register(app.Jobs, app.sendDailyDigests)
+	jobs.Register(app.Jobs, app.sendWeeklyDigests)
+
+	if err := app.Jobs.Schedule(app.Config.Cleanup.InvitationsSchedule, cleanupInvitationsJob{}); err != nil {
+		return err
+	}
+	if err := app.Jobs.Schedule(app.Config.Trending.Schedule, refreshTrendingJob{}); err != nil {
+		return err
+	}
+	if err := app.Jobs.Schedule(app.Config.Digest.DailySchedule, dailyDigestJob{}); err != nil {
+		return err
+	}
+	if err := app.Jobs.Schedule(app.Config.Digest.WeeklySchedule, weeklyDigestJob{}); err != nil {
+		return err
+	}
+
+	return app.Jobs.Schedule(app.Config.Cleanup.HistorySchedule, pruneHistoryJob{})
+}
+
+func (app *Application) cleanupInvitations(ctx context.Context, job cleanupInvitationsJob) error {
+	deleted, err := app.Store.Users.DeleteExpiredInvitations(ctx)
+	if err != nil {
+		return err
+	}
+
+	app.Logger.Infow("expired invitations deleted", "count", deleted)
+	return nil
+}
+
+func (app *Application) pruneHistory(ctx context.Context, job pruneHistoryJob) error {
+	retention := app.Config.Cleanup.Retention
+
+	if err := app.Store.Outbox.Prune(ctx, retention); err != nil {
+		return err
+	}
+	if err := app.Store.Webhooks.PruneDeliveries(ctx, retention); err != nil {
+		return err
+	}
+
+	if err := app.Store.Jobs.Prune(ctx, retention); err != nil {
+		return err
+	}
+
+	return app.Store.Emails.Prune(ctx, retention)
+}
+
+func (app *Application) refreshTrending(ctx context.Context, job refreshTrendingJob) error {
+	return app.Trending.RefreshAll(ctx)
+}
+
+// @Summary		List jobs
+// @Description	Get the background jobs, most recent first. Filter by the dead status to get the jobs that ran out of attempts. Admins only.
+// @Tags			jobs
+// @Produce		json
+// @Param			limit	query		int		false	"Number of jobs to return"		minimum(1)	maximum(100)	default(20)
+// @Param			offset	query		int		false	"Number of jobs to skip"		minimum(0)	default(0)
+// @Param			status	query		string	false	"Only jobs with the status"	Enums(queued, running, succeeded, dead)
+// @Success		200		{array}		model.Job
+// @Failure		400		{object}	error
+// @Failure		403		{object}	error
+// @Failure		500		{object}	error
+// @Security		BearerAuth
+// @Router			/jobs [get]
+func (app *Application) getJobsHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	jq := store.JobQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+
+	jq, err := jq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(jq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	jobs, err := app.Store.Jobs.GetAll(ctx, jq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, jobs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Retry a dead job
+// @Description	Queue a job that ran out of attempts again, with all its attempts. Admins only.
+// @Tags			jobs
+// @Produce		json
+// @Param			jobId	path		int	true	"Job ID"
+// @Success		200		{object}	model.Job
+// @Failure		400		{object}	error
+// @Failure		403		{object}	error
+// @Failure		404		{object}	error
+// @Failure		500		{object}	error
+// @Security		BearerAuth
+// @Router			/jobs/{jobId}/retry [post]
+func (app *Application) retryJobHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "jobId"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	job, err := app.Store.Jobs.Retry(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrResourceNotFound):
+			app.resourceNotFoundError(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, job); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
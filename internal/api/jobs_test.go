@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestJobs(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.Mount()
+
+	testToken, _ := app.Authenticator.GenerateToken(nil)
+
+	t.Run("should forbid the users that aren't admins", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/jobs", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+
+	admin := newTestApplication(t)
+	admin.Store.Users = &adminUserStore{}
+	adminMux := admin.Mount()
+
+	t.Run("should list the dead jobs", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/jobs?status=dead", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, adminMux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should return 400 for an unknown status", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/jobs?status=lost", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, adminMux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should retry a job", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/v1/jobs/7/retry", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, adminMux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should return 404 for a job that isn't dead", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/v1/jobs/0/retry", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, adminMux)
+
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+	})
+}
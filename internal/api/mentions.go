@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+)
+
+// @Summary		Get posts mentioning me
+// @Description	Get a paginated list of the posts that mention the authenticated user, excluding blocked users
+// @Tags			feed
+// @Produce		json
+// @Param			limit	query		int		false	"Number of posts to return"	minimum(1)		maximum(25)	default(20)
+// @Param			offset	query		int		false	"Number of posts to skip"	minimum(0)		default(0)
+// @Param			sort	query		string	false	"Sort order: asc or desc"	enum(asc, desc)	default(desc)
+// @Param			tags	query		string	false	"Comma-separated list of tags to filter by"
+// @Param			search	query		string	false	"Search term to filter posts by title or content"
+// @Param			since	query		string	false	"RFC 3339 timestamp (or YYYY-MM-DD) to filter posts created at or after this date"
+// @Param			until	query		string	false	"RFC 3339 timestamp (or YYYY-MM-DD) to filter posts created at or before this date"
+// @Success		200		{array}		model.Post
+// @Failure		400		{object}	error
+// @Failure		500		{object}	error
+// @Security		BearerAuth
+// @Router			/users/mentions [get]
+func (app *Application) getMentionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	fq, err := parseFeedQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getAuthUserFromCtx(ctx)
+
+	posts, err := app.Store.Posts.GetMentioning(ctx, user.Id, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
 
@@ -136,14 +138,147 @@ func (app *Application) checkRolePrecedence(ctx context.Context, user *model.Use
 	return user.Role.Level >= role.Level, nil
 }
 
-func (app *Application) RateLimitMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if app.Config.RateLimiter.Enabled {
-			if allow, retryAfter := app.RateLimiter.Allow(r.RemoteAddr); !allow {
-				app.rateLimitExceededError(w, r, retryAfter.String())
-				return
+// Rate limit policies of the routes
+const (
+	// Every request before the authentication, by client IP, so the requests
+	// with invalid or forged tokens are counted too
+	RateLimitIP = "ip"
+	// Login, registration and the other endpoints without authentication
+	RateLimitAuth = "auth"
+	// Feeds, searches and the other reads
+	RateLimitRead = "read"
+	// Everything else
+	RateLimitDefault = "default"
+)
+
+// Limits the requests to the routes with the policy. Authenticated users are
+// limited by their id, so it must come after the authentication, and the
+// other clients by their IP.
+func (app *Application) RateLimitMiddleware(policy string) func(http.Handler) http.Handler {
+	return app.limitRequests(policy, app.rateLimitClient)
+}
+
+// Limits the requests by client IP with the ip policy, it must come before
+// the authentication
+func (app *Application) IPRateLimitMiddleware(next http.Handler) http.Handler {
+	return app.limitRequests(RateLimitIP, func(r *http.Request) string {
+		return "ip:" + remoteIP(r)
+	})(next)
+}
+
+func (app *Application) limitRequests(policy string, client func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if app.Config.RateLimiter.Enabled {
+				if allow, retryAfter := app.RateLimiter.Allow(policy, client(r)); !allow {
+					app.rateLimitExceededError(w, r, retryAfter.String())
+					return
+				}
 			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Returns the key the requests of the client are counted by
+func (app *Application) rateLimitClient(r *http.Request) string {
+	if user := app.getAuthUserFromCtx(r.Context()); user != nil {
+		return fmt.Sprintf("user:%d", user.Id)
+	}
+
+	return "ip:" + remoteIP(r)
+}
+
+// Returns the IP of the remote address, without the port
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// Sets the remote address of the requests of the trusted proxies to the
+// client IP they forwarded. The headers of the other requests are ignored,
+// as any client can set them.
+func (app *Application) RealIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip, ok := app.forwardedIP(r); ok {
+			r.RemoteAddr = ip.String()
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+func (app *Application) forwardedIP(r *http.Request) (netip.Addr, bool) {
+	if !app.isTrustedProxy(remoteIP(r)) {
+		return netip.Addr{}, false
+	}
+
+	// Every proxy appends the address it got the request from, the client
+	// is the last one that isn't a trusted proxy
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			ip, err := netip.ParseAddr(hop)
+			if err != nil {
+				return netip.Addr{}, false
+			}
+			if i == 0 || !app.isTrustedProxy(hop) {
+				return ip.Unmap(), true
+			}
+		}
+	}
+
+	ip, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
+func (app *Application) isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, proxy := range app.Config.RateLimiter.TrustedProxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses the comma-separated addresses and CIDR ranges of the trusted
+// proxies, e.g. "10.0.0.0/8,192.168.1.10"
+func ParseTrustedProxies(spec string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+
+		ip, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		ip = ip.Unmap()
+		proxies = append(proxies, netip.PrefixFrom(ip, ip.BitLen()))
+	}
+
+	return proxies, nil
+}
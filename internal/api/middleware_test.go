@@ -0,0 +1,201 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dottox/social/internal/ratelimiter"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	app := newTestApplication(t)
+
+	limit := func(requests int) ratelimiter.Config {
+		return ratelimiter.Config{RequestsPerTimeFrame: requests, TimeFrame: time.Minute, Enabled: true}
+	}
+	app.Config.RateLimiter = RateLimitConfig{
+		Enabled: true,
+		Policies: map[string]ratelimiter.Config{
+			RateLimitAuth:    limit(1),
+			RateLimitRead:    limit(2),
+			RateLimitDefault: limit(2),
+		},
+	}
+
+	policies, err := ratelimiter.NewPolicies(app.Config.RateLimiter.Policies, app.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer policies.Close()
+	app.RateLimiter = policies
+
+	mux := app.Mount()
+
+	testToken, _ := app.Authenticator.GenerateToken(nil)
+
+	request := func(t *testing.T, method, path, remoteAddr string, auth bool) int {
+		t.Helper()
+
+		req, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RemoteAddr = remoteAddr
+		if auth {
+			req.Header.Set("Authorization", "Bearer "+testToken)
+		}
+
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should limit the users by id across addresses", func(t *testing.T) {
+		for _, addr := range []string{"10.0.0.1:1000", "10.0.0.2:1000"} {
+			if code := request(t, "GET", "/v1/explore", addr, true); code == http.StatusTooManyRequests {
+				t.Fatalf("expected the request from %s to be allowed", addr)
+			}
+		}
+
+		code := request(t, "GET", "/v1/trending", "10.0.0.3:1000", true)
+		checkResponseCode(t, http.StatusTooManyRequests, code)
+	})
+
+	t.Run("should limit each policy separately", func(t *testing.T) {
+		if code := request(t, "GET", "/v1/notifications/unread_count", "10.0.0.1:1000", true); code == http.StatusTooManyRequests {
+			t.Error("expected the request of the default policy to be allowed")
+		}
+	})
+
+	t.Run("should limit the anonymous clients by IP without the port", func(t *testing.T) {
+		if code := request(t, "POST", "/v1/auth/token", "10.0.0.1:1000", false); code == http.StatusTooManyRequests {
+			t.Fatal("expected the first request to be allowed")
+		}
+
+		code := request(t, "POST", "/v1/auth/token", "10.0.0.1:2000", false)
+		checkResponseCode(t, http.StatusTooManyRequests, code)
+
+		if code := request(t, "POST", "/v1/auth/token", "10.0.0.2:1000", false); code == http.StatusTooManyRequests {
+			t.Error("expected the request of another IP to be allowed")
+		}
+	})
+
+	t.Run("should not limit the health checks", func(t *testing.T) {
+		for range 5 {
+			code := request(t, "GET", "/v1/health", "10.0.0.1:1000", false)
+			checkResponseCode(t, http.StatusOK, code)
+		}
+	})
+}
+
+func TestIPRateLimitMiddleware(t *testing.T) {
+	app := newTestApplication(t)
+
+	app.Config.RateLimiter = RateLimitConfig{
+		Enabled: true,
+		Policies: map[string]ratelimiter.Config{
+			RateLimitIP: {RequestsPerTimeFrame: 2, TimeFrame: time.Minute, Enabled: true},
+		},
+	}
+
+	policies, err := ratelimiter.NewPolicies(app.Config.RateLimiter.Policies, app.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer policies.Close()
+	app.RateLimiter = policies
+
+	mux := app.Mount()
+
+	t.Run("should count the requests with forged tokens", func(t *testing.T) {
+		codes := []int{}
+		for range 3 {
+			req, err := http.NewRequest("GET", "/v1/explore", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.RemoteAddr = "10.0.0.1:1000"
+			req.Header.Set("Authorization", "Bearer forged")
+
+			codes = append(codes, executeRequest(req, mux).Code)
+		}
+
+		if codes[0] != http.StatusUnauthorized || codes[1] != http.StatusUnauthorized || codes[2] != http.StatusTooManyRequests {
+			t.Errorf("expected the third request to be limited; got %v", codes)
+		}
+	})
+}
+
+func TestRealIPMiddleware(t *testing.T) {
+	app := newTestApplication(t)
+
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Config.RateLimiter.TrustedProxies = proxies
+
+	var remoteAddr string
+	handler := app.RealIPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddr = r.RemoteAddr
+	}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{
+			name:       "should ignore the headers of untrusted clients",
+			remoteAddr: "203.0.113.7:1000",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Real-IP": "1.2.3.4"},
+			expected:   "203.0.113.7:1000",
+		},
+		{
+			name:       "should use the last hop that isn't a trusted proxy",
+			remoteAddr: "10.0.0.1:1000",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4, 203.0.113.7, 192.168.1.10"},
+			expected:   "203.0.113.7",
+		},
+		{
+			name:       "should use the real IP of a trusted proxy",
+			remoteAddr: "192.168.1.10:1000",
+			headers:    map[string]string{"X-Real-IP": "203.0.113.7"},
+			expected:   "203.0.113.7",
+		},
+		{
+			name:       "should keep the address of invalid forwarded IPs",
+			remoteAddr: "10.0.0.1:1000",
+			headers:    map[string]string{"X-Forwarded-For": "unknown"},
+			expected:   "10.0.0.1:1000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for header, value := range tt.headers {
+				req.Header.Set(header, value)
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if remoteAddr != tt.expected {
+				t.Errorf("expected the address %q; got %q", tt.expected, remoteAddr)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	if _, err := ParseTrustedProxies("10.0.0.0/8,proxy"); err == nil {
+		t.Error("expected an error for an invalid proxy")
+	}
+
+	proxies, err := ParseTrustedProxies("")
+	if err != nil || len(proxies) != 0 {
+		t.Errorf("expected no trusted proxies; got %v, %v", proxies, err)
+	}
+}
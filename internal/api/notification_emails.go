@@ -0,0 +1,221 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dottox/social/internal/mailer"
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/store"
+)
+
+// Users whose digest is sent by each query of the digest jobs
+const digestBatchSize = 100
+
+// Emails a notification to the user, for the kinds they want immediately
+type notificationEmailJob struct {
+	Event model.NotificationEvent `json:"event"`
+}
+
+func (notificationEmailJob) Kind() string { return "notification_email" }
+
+// Emails the users the summary of their unread daily notifications
+type dailyDigestJob struct{}
+
+func (dailyDigestJob) Kind() string { return "daily_digest" }
+
+// Emails the users the summary of their unread weekly notifications
+type weeklyDigestJob struct{}
+
+func (weeklyDigestJob) Kind() string { return "weekly_digest" }
+
+// notificationItem is a line about a notification in the emails, like
+// "alice and 3 others reacted to your post"
+type notificationItem struct {
+	Kind  string
+	Actor string
+	// Number of actors besides Actor
+	Others int
+}
+
+// Queues the email of the recorded notification when the user wants its
+// kind emailed immediately. Used as a publisher of the notifications.
+func (app *Application) EmailNotification(event *model.NotificationEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), store.QueryTimeoutDuration)
+	defer cancel()
+
+	prefs, err := app.Store.Notifications.GetEmailPreferences(ctx, event.UserId)
+	if err != nil {
+		if !errors.Is(err, store.ErrResourceNotFound) {
+			app.Logger.Errorw("error getting email preferences", "user_id", event.UserId, "error", err)
+		}
+		return
+	}
+
+	if prefs.Frequency(event.Kind) != model.EmailImmediate {
+		return
+	}
+
+	if _, err := app.Jobs.Enqueue(ctx, notificationEmailJob{Event: *event}); err != nil {
+		app.Logger.Errorw("error queueing notification email", "user_id", event.UserId, "kind", event.Kind, "error", err)
+	}
+}
+
+func (app *Application) sendNotificationEmail(ctx context.Context, job notificationEmailJob) error {
+	event := job.Event
+
+	user, err := app.Store.Users.GetById(ctx, event.UserId)
+	if err != nil {
+		// The user was deleted or deactivated since
+		if errors.Is(err, store.ErrResourceNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	item := notificationItem{Kind: event.Kind}
+	actor, err := app.Store.Users.GetById(ctx, event.ActorId)
+	switch {
+	case err == nil:
+		item.Actor = actor.Username
+	case !errors.Is(err, store.ErrResourceNotFound):
+		return err
+	}
+
+	vars := struct {
+		Username       string
+		Item           notificationItem
+		UnsubscribeURL string
+	}{
+		Username:       user.Username,
+		Item:           item,
+		UnsubscribeURL: app.unsubscribeURL(user.Id, event.Kind),
+	}
+
+	to := mailer.Recipient{
+		Name:           user.Username,
+		Email:          user.Email,
+		Locale:         user.Language,
+		UnsubscribeURL: vars.UnsubscribeURL,
+	}
+
+	_, err = app.Mailer.Enqueue(ctx, mailer.NotificationTemplate, to, vars, "")
+	return err
+}
+
+func (app *Application) sendDailyDigests(ctx context.Context, job dailyDigestJob) error {
+	return app.sendDigests(ctx, store.DigestQuery{
+		Frequency: model.EmailDaily,
+		Window:    time.Hour * 24,
+		Until:     time.Now(),
+	})
+}
+
+func (app *Application) sendWeeklyDigests(ctx context.Context, job weeklyDigestJob) error {
+	return app.sendDigests(ctx, store.DigestQuery{
+		Frequency: model.EmailWeekly,
+		Window:    time.Hour * 24 * 7,
+		Until:     time.Now(),
+	})
+}
+
+// Queues the digest of every user with unread notifications of the
+// frequency. A retried job skips the users whose digest was already queued.
+func (app *Application) sendDigests(ctx context.Context, dq store.DigestQuery) error {
+	sent := 0
+
+	var after uint32
+	for {
+		ids, err := app.Store.Notifications.GetDigestRecipients(ctx, dq, after, digestBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			queued, err := app.sendDigest(ctx, id, dq)
+			if err != nil {
+				return fmt.Errorf("sending the %s digest of user %d: %w", dq.Frequency, id, err)
+			}
+			if queued {
+				sent++
+			}
+		}
+
+		if len(ids) < digestBatchSize {
+			break
+		}
+		after = ids[len(ids)-1]
+	}
+
+	app.Logger.Infow("notification digests queued", "frequency", dq.Frequency, "count", sent)
+	return nil
+}
+
+func (app *Application) sendDigest(ctx context.Context, userId uint32, dq store.DigestQuery) (bool, error) {
+	user, err := app.Store.Users.GetById(ctx, userId)
+	if err != nil {
+		// Inactive users get no digest
+		if errors.Is(err, store.ErrResourceNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	notifications, err := app.Store.Notifications.GetDigest(ctx, userId, dq)
+	if err != nil {
+		return false, err
+	}
+	if len(notifications) == 0 {
+		return false, nil
+	}
+
+	items := make([]notificationItem, len(notifications))
+	for i, n := range notifications {
+		items[i] = notificationItem{Kind: n.Kind, Others: max(n.ActorsCount-1, 0)}
+		if len(n.ActorNames) > 0 {
+			items[i].Actor = n.ActorNames[0]
+		}
+	}
+
+	vars := struct {
+		Username       string
+		Frequency      string
+		Items          []notificationItem
+		UnsubscribeURL string
+	}{
+		Username:       user.Username,
+		Frequency:      dq.Frequency,
+		Items:          items,
+		UnsubscribeURL: app.unsubscribeURL(user.Id, dq.Frequency),
+	}
+
+	to := mailer.Recipient{
+		Name:           user.Username,
+		Email:          user.Email,
+		Locale:         user.Language,
+		UnsubscribeURL: vars.UnsubscribeURL,
+	}
+
+	// A user gets a single digest of each frequency per run
+	key := fmt.Sprintf("digest:%s:%d:%d", dq.Frequency, user.Id, dq.Until.Unix())
+
+	digest, err := app.Mailer.Compose(mailer.DigestTemplate, to, vars, key)
+	if err != nil {
+		return false, err
+	}
+
+	// The email is queued with the end of the digest, so a retried job
+	// doesn't send it again
+	queued, err := app.Store.Notifications.QueueDigest(ctx, userId, dq, digest)
+	if err != nil {
+		return false, err
+	}
+
+	if queued {
+		app.Mailer.Wake()
+	}
+
+	return queued, nil
+}
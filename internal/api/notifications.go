@@ -0,0 +1,148 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/dottox/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type unreadCountResponse struct {
+	Count int `json:"count"`
+}
+
+// @Summary		List notifications
+// @Description	Get the notifications of the authenticated user, most recently updated first, with the number of unread notifications. Similar unread notifications are grouped.
+// @Tags			notifications
+// @Produce		json
+// @Param			limit	query		int		false	"Number of notifications to return"	minimum(1)	maximum(50)	default(20)
+// @Param			offset	query		int		false	"Number of notifications to skip"	minimum(0)	default(0)
+// @Param			unread	query		bool	false	"Only unread notifications"			default(false)
+// @Success		200		{object}	model.NotificationList
+// @Failure		400		{object}	error
+// @Failure		500		{object}	error
+// @Security		BearerAuth
+// @Router			/notifications [get]
+func (app *Application) getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	nq := store.NotificationQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+
+	nq, err := nq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(nq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getAuthUserFromCtx(ctx)
+
+	list, err := app.Store.Notifications.GetByUser(ctx, user.Id, nq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, list); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Count unread notifications
+// @Description	Get the number of unread notifications of the authenticated user
+// @Tags			notifications
+// @Produce		json
+// @Success		200	{object}	unreadCountResponse
+// @Failure		500	{object}	error
+// @Security		BearerAuth
+// @Router			/notifications/unread_count [get]
+func (app *Application) getUnreadNotificationsCountHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+	user := app.getAuthUserFromCtx(ctx)
+
+	count, err := app.Store.Notifications.CountUnread(ctx, user.Id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, unreadCountResponse{Count: count}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Mark a notification as read
+// @Description	Mark a notification of the authenticated user as read
+// @Tags			notifications
+// @Param			notificationId	path	int	true	"Notification ID"
+// @Success		204
+// @Failure		400	{object}	error
+// @Failure		404	{object}	error
+// @Failure		500	{object}	error
+// @Security		BearerAuth
+// @Router			/notifications/{notificationId}/read [put]
+func (app *Application) markNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "notificationId"), 10, 32)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getAuthUserFromCtx(ctx)
+
+	err = app.Store.Notifications.MarkRead(ctx, user.Id, uint32(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrResourceNotFound):
+			app.resourceNotFoundError(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Mark all notifications as read
+// @Description	Mark every notification of the authenticated user as read
+// @Tags			notifications
+// @Success		204
+// @Failure		500	{object}	error
+// @Security		BearerAuth
+// @Router			/notifications/read [put]
+func (app *Application) markAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+	user := app.getAuthUserFromCtx(ctx)
+
+	if err := app.Store.Notifications.MarkAllRead(ctx, user.Id); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNotifications(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.Mount()
+
+	testToken, _ := app.Authenticator.GenerateToken(nil)
+
+	t.Run("should list the notifications", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/notifications?unread=true&limit=10", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should return 400 for an invalid unread filter", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/notifications?unread=maybe", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should return the unread count", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/notifications/unread_count", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		if body := rr.Body.String(); body != `{"data":{"count":0}}`+"\n" {
+			t.Errorf("unexpected body %s", body)
+		}
+	})
+
+	t.Run("should mark a notification as read", func(t *testing.T) {
+		req, err := http.NewRequest("PUT", "/v1/notifications/1/read", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNoContent, rr.Code)
+	})
+
+	t.Run("should return 404 for an unknown notification", func(t *testing.T) {
+		req, err := http.NewRequest("PUT", "/v1/notifications/0/read", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should mark all notifications as read", func(t *testing.T) {
+		req, err := http.NewRequest("PUT", "/v1/notifications/read", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNoContent, rr.Code)
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/dottox/social/internal/entities"
 	"github.com/dottox/social/internal/model"
 	"github.com/dottox/social/internal/store"
 	"github.com/go-chi/chi/v5"
@@ -54,11 +55,16 @@ func (app *Application) createPostHandler(w http.ResponseWriter, r *http.Request
 	user := app.getAuthUserFromCtx(ctx)
 
 	// Create the new post if the payload had no errors
+	// Hashtags in the content are added to the explicit tags
+	contentEntities := entities.Parse(payload.Content)
+
 	post := &model.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		Tags:    payload.Tags,
-		UserId:  user.Id,
+		Title:    payload.Title,
+		Content:  payload.Content,
+		Tags:     entities.MergeTags(payload.Tags, contentEntities),
+		UserId:   user.Id,
+		Language: payload.Language,
+		Entities: contentEntities,
 	}
 
 	// Create the new post in the repository
@@ -144,12 +150,16 @@ func (app *Application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	previousEntities := post.Entities
+
 	// Update the post fields if they are provided in the payload
 	if payload.Title != nil {
 		post.Title = *payload.Title
 	}
 	if payload.Content != nil {
 		post.Content = *payload.Content
+		post.Entities = entities.Parse(post.Content)
+		post.Tags = entities.RebuildTags(post.Tags, previousEntities, post.Entities)
 	}
 
 	// Update the Post by Id in the repository
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/store"
+)
+
+// Handler to react to a post
+//
+//	@Summary		React to a post
+//	@Description	Set the reaction of the authenticated user on a post, replacing any previous one
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			postId		path		int						true	"Post ID"
+//	@Param			reaction	body		model.ReactionPayload	true	"Reaction payload"
+//	@Success		200			{object}	model.Reaction
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		BearerAuth
+//	@Router			/posts/{postId}/reactions [put]
+func (app *Application) reactToPostHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+	post := app.getPostFromCtx(ctx)
+	user := app.getAuthUserFromCtx(ctx)
+
+	var payload model.ReactionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	reaction := &model.Reaction{
+		PostId: post.Id,
+		UserId: user.Id,
+		Kind:   payload.Kind,
+	}
+
+	if err := app.Store.Reactions.React(ctx, reaction); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, reaction); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// Handler to remove a reaction from a post
+//
+//	@Summary		Remove a reaction from a post
+//	@Description	Remove the reaction of the authenticated user from a post
+//	@Tags			posts
+//	@Param			postId	path	int	true	"Post ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		BearerAuth
+//	@Router			/posts/{postId}/reactions [delete]
+func (app *Application) removeReactionHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+	post := app.getPostFromCtx(ctx)
+	user := app.getAuthUserFromCtx(ctx)
+
+	err := app.Store.Reactions.Unreact(ctx, post.Id, user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrResourceNotFound):
+			app.resourceNotFoundError(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/dottox/social/internal/entities"
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/store"
+)
+
+// @Summary		Search posts, comments and users
+// @Description	Full-text search with stemming, ranking and highlighted snippets. Snippets are HTML escaped and mark the matches with <mark>.
+// @Tags			search
+// @Produce		json
+// @Param			q		query		string	true	"Search terms, supports quotes, OR and -exclusions"
+// @Param			type	query		string	false	"Result type"									enum(all, posts, comments, users)						default(all)
+// @Param			lang	query		string	false	"Language used to stem the search terms"		enum(english, spanish, french, german, italian, portuguese, simple)	default(english)
+// @Param			author	query		int		false	"Only posts and comments written by this user ID"
+// @Param			tag		query		string	false	"Only posts, and comments on posts, with this tag"
+// @Param			since	query		string	false	"RFC 3339 timestamp (or YYYY-MM-DD) to filter results created at or after this date"
+// @Param			until	query		string	false	"RFC 3339 timestamp (or YYYY-MM-DD) to filter results created at or before this date"
+// @Param			limit	query		int		false	"Number of results of each type to return"	minimum(1)	maximum(25)	default(10)
+// @Param			offset	query		int		false	"Number of results of each type to skip"		minimum(0)	default(0)
+// @Success		200		{object}	model.SearchResults
+// @Failure		400		{object}	error
+// @Failure		500		{object}	error
+// @Security		BearerAuth
+// @Router			/search [get]
+func (app *Application) searchHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	sq := store.SearchQuery{
+		Type:     "all",
+		Language: "english",
+		Limit:    10,
+		Offset:   0,
+	}
+
+	sq, err := sq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(sq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	sq.Tag = entities.NormalizeTag(sq.Tag)
+
+	user := app.getAuthUserFromCtx(ctx)
+	results := &model.SearchResults{}
+
+	if sq.Type == "all" || sq.Type == "posts" {
+		results.Posts, err = app.Search.SearchPosts(ctx, user.Id, sq)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if sq.Type == "all" || sq.Type == "comments" {
+		results.Comments, err = app.Search.SearchComments(ctx, user.Id, sq)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	// Users have no author, tag or date, so those filters exclude them
+	filtered := sq.AuthorId != 0 || sq.Tag != "" || sq.Since != "" || sq.Until != ""
+	if sq.Type == "users" || (sq.Type == "all" && !filtered) {
+		results.Users, err = app.Search.SearchUsers(ctx, user.Id, sq)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/search"
+	"github.com/dottox/social/internal/store"
+)
+
+type recordingSearchStore struct {
+	store.MockSearchStore
+	searched []string
+	query    store.SearchQuery
+}
+
+func (s *recordingSearchStore) SearchPosts(ctx context.Context, viewerId uint32, sq store.SearchQuery) ([]*model.PostSearchResult, error) {
+	s.searched = append(s.searched, "posts")
+	s.query = sq
+	return []*model.PostSearchResult{}, nil
+}
+
+func (s *recordingSearchStore) SearchComments(ctx context.Context, viewerId uint32, sq store.SearchQuery) ([]*model.CommentSearchResult, error) {
+	s.searched = append(s.searched, "comments")
+	return []*model.CommentSearchResult{}, nil
+}
+
+func (s *recordingSearchStore) SearchUsers(ctx context.Context, viewerId uint32, sq store.SearchQuery) ([]*model.UserSearchResult, error) {
+	s.searched = append(s.searched, "users")
+	return []*model.UserSearchResult{}, nil
+}
+
+func TestSearch(t *testing.T) {
+	app := newTestApplication(t)
+	searchStore := &recordingSearchStore{}
+	app.Store.Search = searchStore
+	app.Search = search.NewPostgresBackend(app.Store)
+	mux := app.Mount()
+
+	testToken, _ := app.Authenticator.GenerateToken(nil)
+
+	get := func(t *testing.T, rawQuery string) int {
+		t.Helper()
+
+		req, err := http.NewRequest("GET", "/v1/search?"+rawQuery, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		searchStore.searched = nil
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should search every type", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, get(t, "q=gopher"))
+
+		if len(searchStore.searched) != 3 {
+			t.Errorf("expected posts, comments and users to be searched; got %v", searchStore.searched)
+		}
+	})
+
+	t.Run("should search only the type", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, get(t, "q=gopher&type=posts&tag=%23GoLang"))
+
+		if len(searchStore.searched) != 1 || searchStore.searched[0] != "posts" {
+			t.Errorf("expected only posts to be searched; got %v", searchStore.searched)
+		}
+		if searchStore.query.Tag != "golang" {
+			t.Errorf("expected the tag to be normalised; got %q", searchStore.query.Tag)
+		}
+	})
+
+	t.Run("should not search users with post filters", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, get(t, "q=gopher&author=1"))
+
+		for _, searched := range searchStore.searched {
+			if searched == "users" {
+				t.Errorf("expected users not to be searched; got %v", searchStore.searched)
+			}
+		}
+	})
+
+	t.Run("should return 400 for invalid queries", func(t *testing.T) {
+		for _, rawQuery := range []string{
+			"",
+			"q=gopher&type=tags",
+			"q=gopher&lang=klingon",
+			"q=gopher&limit=26",
+			"q=gopher&offset=-1",
+			"q=gopher&since=2024-03-11&until=2024-03-10",
+		} {
+			if code := get(t, rawQuery); code != http.StatusBadRequest {
+				t.Errorf("%q: expected status 400; got %d", rawQuery, code)
+			}
+		}
+	})
+}
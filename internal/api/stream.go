@@ -0,0 +1,184 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dottox/social/internal/realtime"
+)
+
+// Max number of posts a stream can watch for comments
+const maxStreamPosts = 20
+
+// Time allowed to write a single event before the connection is dropped
+const streamWriteTimeout = 10 * time.Second
+
+// @Summary		Stream real-time events
+// @Description	Stream the new posts of the followed users and tags, the notifications of the authenticated user and the new comments of the watched posts as Server-Sent Events. Events have an id, resume a dropped stream with the Last-Event-ID header or the last_event_id parameter. A reset event means the missed events are gone and the client should reload.
+// @Tags			stream
+// @Produce		text/event-stream
+// @Param			posts			query		string	false	"Comma separated ids of the posts to watch for comments"	maxLength(200)
+// @Param			last_event_id	query		int		false	"Id of the last received event"
+// @Param			Last-Event-ID	header		int		false	"Id of the last received event"
+// @Success		200				{string}	string	"event stream"
+// @Failure		400				{object}	error
+// @Failure		401				{object}	error
+// @Failure		500				{object}	error
+// @Security		BearerAuth
+// @Router			/stream [get]
+func (app *Application) streamHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	postIds, err := parseStreamPosts(r.URL.Query().Get("posts"))
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	lastEventId, err := parseLastEventId(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getAuthUserFromCtx(ctx)
+
+	following, err := app.Store.Followers.GetFollowingIds(ctx, user.Id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	tags, err := app.Store.Tags.GetFollowedNames(ctx, user.Id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	blockedIds, err := app.Store.Blocks.GetBlockedIds(ctx, user.Id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	blocked := make(map[uint32]bool, len(blockedIds))
+	for _, id := range blockedIds {
+		blocked[id] = true
+	}
+
+	// The follows are read once, clients reconnect to pick up the changes
+	topics := []string{realtime.UserTopic(user.Id), realtime.AuthorTopic(user.Id)}
+	for _, id := range following {
+		topics = append(topics, realtime.AuthorTopic(id))
+	}
+	for _, tag := range tags {
+		topics = append(topics, realtime.TagTopic(tag))
+	}
+	for _, id := range postIds {
+		topics = append(topics, realtime.PostTopic(id))
+	}
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sub := app.Realtime.Subscribe(topics, lastEventId)
+	defer app.Realtime.Unsubscribe(sub)
+
+	// Flushes the frame, extending the server write timeout for long lived
+	// streams. Writers without deadlines (e.g. in tests) are fine.
+	write := func(frame string) error {
+		if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		if _, err := fmt.Fprint(w, frame); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	if err := write(": connected\n\n"); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(app.Realtime.Config().Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-heartbeat.C:
+			if err := write(": ping\n\n"); err != nil {
+				return
+			}
+
+		case event, ok := <-sub.C:
+			if !ok {
+				if sub.Lagging() {
+					app.Logger.Warnw("stream dropped, client too slow", "user_id", user.Id)
+				}
+				return
+			}
+
+			if blocked[event.ActorId] {
+				continue
+			}
+
+			frame := fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Kind, event.Data)
+			if err := write(frame); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func parseStreamPosts(param string) ([]uint32, error) {
+	if param == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(param, ",")
+	if len(parts) > maxStreamPosts {
+		return nil, fmt.Errorf("at most %d posts can be watched", maxStreamPosts)
+	}
+
+	ids := make([]uint32, 0, len(parts))
+	for _, part := range parts {
+		id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid post id %q", part)
+		}
+		ids = append(ids, uint32(id))
+	}
+
+	return ids, nil
+}
+
+// Reads the id of the last received event from the Last-Event-ID header sent
+// by EventSource on reconnection, or from the last_event_id parameter
+func parseLastEventId(r *http.Request) (uint64, error) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	if value == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid last event id %q", value)
+	}
+
+	return id, nil
+}
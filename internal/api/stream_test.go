@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/realtime"
+)
+
+func TestStream(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.Mount()
+
+	testToken, _ := app.Authenticator.GenerateToken(nil)
+
+	t.Run("should not allow unauthenticated requests", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/stream", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should return 400 for invalid post ids", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/stream?posts=1,abc", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should return 400 for an invalid last event id", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/stream", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		req.Header.Set("Last-Event-ID", "last")
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should resume the stream after the last event id", func(t *testing.T) {
+		app := newTestApplication(t)
+		mux := app.Mount()
+
+		app.Realtime.CommentCreated(&model.Comment{Id: 1, PostId: 7, UserId: 2})
+		app.Realtime.CommentCreated(&model.Comment{Id: 2, PostId: 8, UserId: 2})
+
+		sub := app.Realtime.Subscribe([]string{realtime.PostTopic(8)}, 0)
+		app.Realtime.CommentCreated(&model.Comment{Id: 3, PostId: 8, UserId: 2})
+		last := (<-sub.C).Id
+
+		// Closing the hub ends the stream once the missed events are sent
+		app.Realtime.Close()
+
+		req, err := http.NewRequest("GET", "/v1/stream?posts=8", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(last-3, 10))
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		if ct := rr.Header().Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("expected an event stream; got %s", ct)
+		}
+
+		body := rr.Body.String()
+		if strings.Count(body, "event: "+realtime.KindCommentCreated) != 2 {
+			t.Errorf("expected the 2 comments of post 8; got %s", body)
+		}
+		if !strings.Contains(body, "id: "+strconv.FormatUint(last, 10)+"\n") {
+			t.Errorf("expected event %d; got %s", last, body)
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/dottox/social/internal/entities"
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// @Summary		Get a tag
+// @Description	Get the number of posts and followers of a tag. Tags are case insensitive.
+// @Tags			tags
+// @Produce		json
+// @Param			tag	path		string	true	"Tag"
+// @Success		200	{object}	model.TagStats
+// @Failure		400	{object}	error
+// @Failure		500	{object}	error
+// @Security		BearerAuth
+// @Router			/tags/{tag} [get]
+func (app *Application) getTagHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	tag, err := parseTagParam(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getAuthUserFromCtx(ctx)
+
+	stats, err := app.Store.Tags.GetStats(ctx, user.Id, tag)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, stats); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Follow a tag
+// @Description	Follow a tag, so the posts with the tag appear in the feed
+// @Tags			tags
+// @Param			tag	path	string	true	"Tag"
+// @Success		204
+// @Failure		400	{object}	error
+// @Failure		409	{object}	error
+// @Failure		500	{object}	error
+// @Security		BearerAuth
+// @Router			/tags/{tag}/follow [put]
+func (app *Application) followTagHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	tag, err := parseTagParam(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getAuthUserFromCtx(ctx)
+
+	err = app.Store.Tags.Follow(ctx, &model.TagFollow{UserId: user.Id, Tag: tag})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrResourceAlreadyExists):
+			app.resourceAlreadyExists(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Unfollow a tag
+// @Description	Unfollow a tag
+// @Tags			tags
+// @Param			tag	path	string	true	"Tag"
+// @Success		204
+// @Failure		400	{object}	error
+// @Failure		404	{object}	error
+// @Failure		500	{object}	error
+// @Security		BearerAuth
+// @Router			/tags/{tag}/unfollow [put]
+func (app *Application) unfollowTagHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	tag, err := parseTagParam(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getAuthUserFromCtx(ctx)
+
+	err = app.Store.Tags.Unfollow(ctx, &model.TagFollow{UserId: user.Id, Tag: tag})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrResourceNotFound):
+			app.resourceNotFoundError(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Get followed tags
+// @Description	Get the tags followed by the authenticated user with their counts
+// @Tags			tags
+// @Produce		json
+// @Success		200	{array}		model.TagStats
+// @Failure		500	{object}	error
+// @Security		BearerAuth
+// @Router			/users/tags [get]
+func (app *Application) getFollowedTagsHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+	user := app.getAuthUserFromCtx(ctx)
+
+	tags, err := app.Store.Tags.GetFollowed(ctx, user.Id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// Reads the normalised {tag} URL parameter
+func parseTagParam(r *http.Request) (string, error) {
+	tag, err := url.PathUnescape(chi.URLParam(r, "tag"))
+	if err != nil {
+		return "", err
+	}
+
+	tag = entities.NormalizeTag(tag)
+	if tag == "" || len(tag) > entities.MaxTagLength {
+		return "", errors.New("invalid tag")
+	}
+
+	return tag, nil
+}
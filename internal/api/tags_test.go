@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTags(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.Mount()
+
+	testToken, _ := app.Authenticator.GenerateToken(nil)
+
+	t.Run("should return the tag counts", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/tags/%23GoLang", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		if body := rr.Body.String(); body != `{"data":{"tag":"golang","posts_count":0,"followers_count":0,"following":false}}`+"\n" {
+			t.Errorf("unexpected body %s", body)
+		}
+	})
+
+	t.Run("should follow a tag", func(t *testing.T) {
+		req, err := http.NewRequest("PUT", "/v1/tags/go/follow", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNoContent, rr.Code)
+	})
+
+	t.Run("should return 400 for an empty tag", func(t *testing.T) {
+		req, err := http.NewRequest("PUT", "/v1/tags/%23/follow", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should list the followed tags", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/users/tags", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+}
@@ -4,9 +4,20 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/dottox/social/internal/auth"
+	"github.com/dottox/social/internal/events"
+	"github.com/dottox/social/internal/jobs"
+	"github.com/dottox/social/internal/mailer"
+	"github.com/dottox/social/internal/notifications"
+	"github.com/dottox/social/internal/ranking"
+	"github.com/dottox/social/internal/realtime"
+	"github.com/dottox/social/internal/search"
 	"github.com/dottox/social/internal/store"
+	"github.com/dottox/social/internal/timeline"
+	"github.com/dottox/social/internal/trending"
+	"github.com/dottox/social/internal/webhooks"
 	"go.uber.org/zap"
 )
 
@@ -17,10 +28,30 @@ func newTestApplication(t *testing.T) *Application {
 	mockStore := store.NewMockStore()
 	mockAuthenticator := auth.NewMockAuthenticator()
 
+	timelineService, err := timeline.NewService(timeline.Config{Mode: timeline.ModeRead}, *mockStore, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mailTemplates, err := mailer.ParseTemplates(mailer.FS, mailer.DefaultLocale)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	return &Application{
 		Logger:        logger,
 		Store:         *mockStore,
 		Authenticator: mockAuthenticator,
+		Timeline:      timelineService,
+		Ranker:        ranking.NewRanker(ranking.Config{HalfLife: time.Hour, RecencyWeight: 1, Deterministic: true}),
+		Trending:      trending.NewWorker(trending.Config{}, *mockStore, logger),
+		Search:        search.NewPostgresBackend(*mockStore),
+		Notifications: notifications.NewService(notifications.Config{}, *mockStore, logger),
+		Realtime:      realtime.NewHub(realtime.Config{BufferSize: 16, HistorySize: 16}, logger),
+		Webhooks:      webhooks.NewDispatcher(webhooks.Config{}, *mockStore, logger),
+		Events:        events.NewDispatcher(events.Config{}, *mockStore, logger),
+		Jobs:          jobs.NewQueue(jobs.Config{}, *mockStore, logger),
+		Mailer:        mailer.NewQueue(mailer.Config{}, mailer.NewMockClient(), mailTemplates, *mockStore, logger),
 	}
 }
 
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dottox/social/internal/store"
+)
+
+// @Summary		Get trending tags and posts
+// @Description	Get the latest trending snapshot for a time window, computed periodically from new posts, comments and reactions
+// @Tags			feed
+// @Produce		json
+// @Param			window	query		string	false	"Time window"	enum(1h, 24h, 7d)	default(24h)
+// @Success		200		{object}	model.TrendingSnapshot
+// @Failure		400		{object}	error
+// @Failure		404		{object}	error
+// @Failure		500		{object}	error
+// @Security		BearerAuth
+// @Router			/trending [get]
+func (app *Application) getTrendingHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = "24h"
+	}
+
+	if _, ok := app.Trending.Window(window); !ok {
+		app.badRequestError(w, r, fmt.Errorf("unknown trending window %q", window))
+		return
+	}
+
+	snapshot, err := app.Store.Trending.GetLatest(ctx, window)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrResourceNotFound):
+			app.resourceNotFoundError(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, snapshot); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -44,6 +44,7 @@ func (app *Application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 // @Param			userId	path	int	true	"User ID"
 // @Success		204
 // @Failure		400	{object}	error
+// @Failure		403	{object}	error
 // @Failure		404	{object}	error
 // @Failure		409	{object}	error
 // @Failure		500	{object}	error
@@ -69,6 +70,9 @@ func (app *Application) followUserHandler(w http.ResponseWriter, r *http.Request
 		case errors.Is(err, store.ErrResourceAlreadyExists):
 			app.resourceAlreadyExists(w, r, err)
 			return
+		case errors.Is(err, store.ErrFollowNotAllowed):
+			app.forbiddenError(w, r, err)
+			return
 		default:
 			app.internalServerError(w, r, err)
 			return
@@ -114,12 +118,146 @@ func (app *Application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
+	app.Timeline.UserUnfollowed(followAction)
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Block a user
+// @Description	Block a user by their ID, removing the follow relationship in both directions
+// @Tags			users
+// @Param			userId	path	int	true	"User ID"
+// @Success		204
+// @Failure		400	{object}	error
+// @Failure		404	{object}	error
+// @Failure		409	{object}	error
+// @Failure		500	{object}	error
+// @Security		BearerAuth
+// @Router			/users/{userId}/block [put]
+func (app *Application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+	targetUser := app.getParamUserFromCtx(ctx)
+	blockerUser := app.getAuthUserFromCtx(ctx)
+
+	if targetUser.Id == blockerUser.Id {
+		app.badRequestError(w, r, errors.New("users cannot block themselves"))
+		return
+	}
+
+	block := &model.Block{
+		BlockerId: blockerUser.Id,
+		BlockedId: targetUser.Id,
+	}
+
+	err := app.Store.Blocks.Block(ctx, block)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrResourceAlreadyExists):
+			app.resourceAlreadyExists(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	// Remove each other's posts from the timelines
+	app.Timeline.UserUnfollowed(&model.FollowAction{TargetUserId: targetUser.Id, SenderUserId: blockerUser.Id})
+	app.Timeline.UserUnfollowed(&model.FollowAction{TargetUserId: blockerUser.Id, SenderUserId: targetUser.Id})
+
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
 
+// @Summary		Unblock a user
+// @Description	Unblock a user by their ID
+// @Tags			users
+// @Param			userId	path	int	true	"User ID"
+// @Success		204
+// @Failure		400	{object}	error
+// @Failure		404	{object}	error
+// @Failure		500	{object}	error
+// @Security		BearerAuth
+// @Router			/users/{userId}/unblock [put]
+func (app *Application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+	targetUser := app.getParamUserFromCtx(ctx)
+	blockerUser := app.getAuthUserFromCtx(ctx)
+
+	block := &model.Block{
+		BlockerId: blockerUser.Id,
+		BlockedId: targetUser.Id,
+	}
+
+	err := app.Store.Blocks.Unblock(ctx, block)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrResourceNotFound):
+			app.resourceNotFoundError(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Search users
+// @Description	Prefix and fuzzy match on username and display name, for typeahead. Ranked by match quality, relationship to the caller and follower count.
+// @Tags			users
+// @Produce		json
+// @Param			q		query	string	true	"Start of, or approximate, username or display name"
+// @Param			limit	query	int		false	"Number of users to return"	minimum(1)	maximum(20)	default(10)
+// @Success		200		{array}	model.UserSuggestion
+// @Failure		400		{object}	error
+// @Failure		500		{object}	error
+// @Security		BearerAuth
+// @Router			/users/search [get]
+func (app *Application) searchUsersHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	uq := store.UserSearchQuery{
+		Limit: 10,
+	}
+
+	uq, err := uq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(uq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getAuthUserFromCtx(ctx)
+
+	users, err := app.Store.Users.Search(ctx, user.Id, uq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, users); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
 func (app *Application) userContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
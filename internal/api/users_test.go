@@ -1,9 +1,13 @@
 package api
 
 import (
+	"context"
 	"net/http"
 	"strings"
 	"testing"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/store"
 )
 
 func TestGetUser(t *testing.T) {
@@ -69,3 +73,95 @@ func TestGetUser(t *testing.T) {
 
 	})
 }
+
+func TestSearchUsers(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.Mount()
+
+	testToken, _ := app.Authenticator.GenerateToken(nil)
+
+	t.Run("should return the matching users", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/users/search?q=gop&limit=5", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should return 400 without a query", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/users/search?q=%20", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should return 400 for a limit over 20", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/users/search?q=gop&limit=50", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+// Users 2 and 24 blocked each other
+type blockingFollowerStore struct {
+	store.MockFollowerStore
+}
+
+func (s *blockingFollowerStore) Follow(ctx context.Context, follow *model.FollowAction) error {
+	if follow.TargetUserId == 2 {
+		return store.ErrFollowNotAllowed
+	}
+	return nil
+}
+
+func TestFollowUser(t *testing.T) {
+	app := newTestApplication(t)
+	app.Store.Followers = &blockingFollowerStore{}
+	mux := app.Mount()
+
+	testToken, _ := app.Authenticator.GenerateToken(nil)
+
+	t.Run("should follow the user", func(t *testing.T) {
+		req, err := http.NewRequest("PUT", "/v1/users/1/follow", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNoContent, rr.Code)
+	})
+
+	t.Run("should return 403 when either user blocked the other", func(t *testing.T) {
+		req, err := http.NewRequest("PUT", "/v1/users/2/follow", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+}
@@ -0,0 +1,373 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type webhookKey string
+
+const webhookCtx webhookKey = "webhook"
+
+// @Summary		Create a webhook
+// @Description	Subscribe an URL to the platform events, every event when no events are given. The deliveries are signed with the secret, generated when not given, which is only returned here. Admins only.
+// @Tags			webhooks
+// @Accept			json
+// @Produce		json
+// @Param			webhook	body		model.CreateWebhookPayload	true	"Webhook payload"
+// @Success		201		{object}	model.Webhook
+// @Failure		400		{object}	error
+// @Failure		403		{object}	error
+// @Failure		500		{object}	error
+// @Security		BearerAuth
+// @Router			/webhooks [post]
+func (app *Application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	var payload model.CreateWebhookPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := validateWebhookURL(payload.URL); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if payload.Events == nil {
+		payload.Events = []string{}
+	}
+
+	if payload.Secret == "" {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		payload.Secret = secret
+	}
+
+	user := app.getAuthUserFromCtx(ctx)
+
+	webhook := &model.Webhook{
+		URL:       payload.URL,
+		Events:    payload.Events,
+		Secret:    payload.Secret,
+		Active:    true,
+		CreatedBy: &user.Id,
+	}
+
+	if err := app.Store.Webhooks.Create(ctx, webhook); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, webhook); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		List webhooks
+// @Description	Get every webhook, without their secrets. Admins only.
+// @Tags			webhooks
+// @Produce		json
+// @Success		200	{array}		model.Webhook
+// @Failure		403	{object}	error
+// @Failure		500	{object}	error
+// @Security		BearerAuth
+// @Router			/webhooks [get]
+func (app *Application) getWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	webhooks, err := app.Store.Webhooks.GetAll(ctx)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, webhooks); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Get a webhook
+// @Description	Get a webhook by its ID, without its secret. Admins only.
+// @Tags			webhooks
+// @Produce		json
+// @Param			webhookId	path		int	true	"Webhook ID"
+// @Success		200			{object}	model.Webhook
+// @Failure		400			{object}	error
+// @Failure		403			{object}	error
+// @Failure		404			{object}	error
+// @Failure		500			{object}	error
+// @Security		BearerAuth
+// @Router			/webhooks/{webhookId} [get]
+func (app *Application) getWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	webhook := app.getWebhookFromCtx(r.Context())
+	webhook.Secret = ""
+
+	if err := app.jsonResponse(w, http.StatusOK, webhook); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Update a webhook
+// @Description	Update the URL, events, secret or state of a webhook. Enabling a webhook disabled after repeated failures resets its failures, and its pending deliveries are sent again. Admins only.
+// @Tags			webhooks
+// @Accept			json
+// @Produce		json
+// @Param			webhookId	path		int							true	"Webhook ID"
+// @Param			webhook		body		model.UpdateWebhookPayload	true	"Webhook payload"
+// @Success		200			{object}	model.Webhook
+// @Failure		400			{object}	error
+// @Failure		403			{object}	error
+// @Failure		404			{object}	error
+// @Failure		500			{object}	error
+// @Security		BearerAuth
+// @Router			/webhooks/{webhookId} [patch]
+func (app *Application) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+	webhook := app.getWebhookFromCtx(ctx)
+
+	var payload model.UpdateWebhookPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if payload.URL == nil && payload.Events == nil && payload.Secret == nil && payload.Active == nil {
+		app.badRequestError(w, r, errors.New("at least one field must be provided to update the webhook"))
+		return
+	}
+
+	if payload.URL != nil {
+		if err := validateWebhookURL(*payload.URL); err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		webhook.URL = *payload.URL
+	}
+	if payload.Events != nil {
+		webhook.Events = *payload.Events
+		if webhook.Events == nil {
+			webhook.Events = []string{}
+		}
+	}
+	if payload.Secret != nil {
+		webhook.Secret = *payload.Secret
+	}
+	if payload.Active != nil {
+		webhook.Active = *payload.Active
+	}
+
+	if err := app.Store.Webhooks.Update(ctx, webhook); err != nil {
+		switch {
+		case errors.Is(err, store.ErrResourceNotFound):
+			app.resourceNotFoundError(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	webhook.Secret = ""
+
+	if err := app.jsonResponse(w, http.StatusOK, webhook); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		Delete a webhook
+// @Description	Delete a webhook with its deliveries. Admins only.
+// @Tags			webhooks
+// @Param			webhookId	path	int	true	"Webhook ID"
+// @Success		204
+// @Failure		400	{object}	error
+// @Failure		403	{object}	error
+// @Failure		404	{object}	error
+// @Failure		500	{object}	error
+// @Security		BearerAuth
+// @Router			/webhooks/{webhookId} [delete]
+func (app *Application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+	webhook := app.getWebhookFromCtx(ctx)
+
+	if err := app.Store.Webhooks.DeleteById(ctx, webhook.Id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrResourceNotFound):
+			app.resourceNotFoundError(w, r, err)
+			return
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// @Summary		List webhook deliveries
+// @Description	Get the delivery log of a webhook, most recent first, with the outcome of the last attempt of each delivery. Admins only.
+// @Tags			webhooks
+// @Produce		json
+// @Param			webhookId	path		int		true	"Webhook ID"
+// @Param			limit		query		int		false	"Number of deliveries to return"	minimum(1)	maximum(100)	default(20)
+// @Param			offset		query		int		false	"Number of deliveries to skip"		minimum(0)	default(0)
+// @Param			status		query		string	false	"Only deliveries with the status"	Enums(pending, succeeded, failed)
+// @Success		200			{array}		model.WebhookDelivery
+// @Failure		400			{object}	error
+// @Failure		403			{object}	error
+// @Failure		404			{object}	error
+// @Failure		500			{object}	error
+// @Security		BearerAuth
+// @Router			/webhooks/{webhookId}/deliveries [get]
+func (app *Application) getWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	dq := store.WebhookDeliveryQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+
+	dq, err := dq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(dq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	webhook := app.getWebhookFromCtx(ctx)
+
+	deliveries, err := app.Store.Webhooks.GetDeliveries(ctx, webhook.Id, dq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, deliveries); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// Only lets through the users with at least the given role
+func (app *Application) requireRoleMiddleware(requiredRole string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			user := app.getAuthUserFromCtx(ctx)
+
+			allowed, err := app.checkRolePrecedence(ctx, user, requiredRole)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			if !allowed {
+				app.forbiddenError(w, r, fmt.Errorf("the %s role is required", requiredRole))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (app *Application) webhookContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		ctx := r.Context()
+
+		idParam := chi.URLParam(r, "webhookId")
+		id, err := strconv.ParseUint(idParam, 10, 32)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+
+		webhook, err := app.Store.Webhooks.GetById(ctx, uint32(id))
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrResourceNotFound):
+				app.resourceNotFoundError(w, r, err)
+				return
+			default:
+				app.internalServerError(w, r, err)
+				return
+			}
+		}
+
+		ctx = context.WithValue(ctx, webhookCtx, webhook)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (app *Application) getWebhookFromCtx(ctx context.Context) *model.Webhook {
+	webhook, _ := ctx.Value(webhookCtx).(*model.Webhook)
+	return webhook
+}
+
+// Only http and https URLs can receive the deliveries
+func validateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook url must be an absolute http or https url")
+	}
+
+	return nil
+}
+
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/store"
+	"github.com/dottox/social/internal/webhooks"
+)
+
+type adminUserStore struct {
+	store.MockUserStore
+}
+
+func (m *adminUserStore) GetById(ctx context.Context, id uint32) (*model.User, error) {
+	return &model.User{Id: id, Role: model.Role{Name: "admin", Level: 3}}, nil
+}
+
+func TestWebhooks(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.Mount()
+
+	testToken, _ := app.Authenticator.GenerateToken(nil)
+
+	t.Run("should forbid the users that aren't admins", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/webhooks", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+
+	admin := newTestApplication(t)
+	admin.Store.Users = &adminUserStore{}
+	adminMux := admin.Mount()
+
+	t.Run("should create a webhook with a generated secret", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/v1/webhooks", strings.NewReader(`{"url":"http://localhost:9000/hook","events":["post.created"]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, adminMux)
+
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		if !strings.Contains(rr.Body.String(), `"secret":"`) {
+			t.Errorf("expected the secret in %s", rr.Body.String())
+		}
+	})
+
+	t.Run("should return 400 for an unknown event", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/v1/webhooks", strings.NewReader(`{"url":"http://localhost:9000/hook","events":["post.deleted"]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, adminMux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should return 400 for a non http url", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/v1/webhooks", strings.NewReader(`{"url":"ftp://localhost/hook"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, adminMux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should hide the secret of a webhook", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/webhooks/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, adminMux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		if strings.Contains(rr.Body.String(), `"secret"`) {
+			t.Errorf("unexpected secret in %s", rr.Body.String())
+		}
+	})
+
+	t.Run("should enable a webhook", func(t *testing.T) {
+		req, err := http.NewRequest("PATCH", "/v1/webhooks/1", strings.NewReader(`{"active":true}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, adminMux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should return 400 for an unknown event on update", func(t *testing.T) {
+		req, err := http.NewRequest("PATCH", "/v1/webhooks/1", strings.NewReader(`{"events":["user.deleted"]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, adminMux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should list the deliveries", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/v1/webhooks/1/deliveries?status=failed", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, adminMux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should return 404 for an unknown webhook", func(t *testing.T) {
+		req, err := http.NewRequest("DELETE", "/v1/webhooks/0", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, adminMux)
+
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+type recordingWebhookStore struct {
+	store.MockWebhookStore
+	payloads [][]byte
+}
+
+func (m *recordingWebhookStore) Enqueue(ctx context.Context, event string, payload []byte) (int, error) {
+	m.payloads = append(m.payloads, payload)
+	return 0, nil
+}
+
+func TestPublishWebhookEvent(t *testing.T) {
+	app := newTestApplication(t)
+
+	webhookStore := &recordingWebhookStore{}
+	app.Store.Webhooks = webhookStore
+	app.Webhooks = webhooks.NewDispatcher(webhooks.Config{}, app.Store, app.Logger)
+
+	t.Run("should only send the public fields of the registered user", func(t *testing.T) {
+		payload, err := json.Marshal(&model.UserRegistered{User: &model.User{
+			Id:        7,
+			Username:  "gopher",
+			Email:     "gopher@example.com",
+			Language:  "en",
+			CreatedAt: "2024-01-01T00:00:00Z",
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		event := &model.DomainEvent{Id: 1, Kind: model.EventUserRegistered, Payload: payload}
+		if err := app.publishWebhookEvent(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(webhookStore.payloads) != 1 {
+			t.Fatalf("expected 1 queued event; got %d", len(webhookStore.payloads))
+		}
+
+		var sent struct {
+			Data map[string]any `json:"data"`
+		}
+		if err := json.Unmarshal(webhookStore.payloads[0], &sent); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(sent.Data) != 3 || sent.Data["username"] != "gopher" || sent.Data["created_at"] == nil {
+			t.Errorf("expected only the id, username and creation date; got %v", sent.Data)
+		}
+	})
+}
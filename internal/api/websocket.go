@@ -0,0 +1,313 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/ratelimiter"
+	"github.com/dottox/social/internal/realtime"
+	"github.com/dottox/social/internal/store"
+	"golang.org/x/net/websocket"
+)
+
+// Max size of a client message
+const maxWebSocketMessage = 4096
+
+// Client message types
+const (
+	wsSubscribe   = "subscribe"
+	wsUnsubscribe = "unsubscribe"
+	wsTyping      = "typing"
+	wsPing        = "ping"
+)
+
+// Server message types, besides wsPing used for the heartbeat
+const (
+	wsEvent        = "event"
+	wsSubscribed   = "subscribed"
+	wsUnsubscribed = "unsubscribed"
+	wsPong         = "pong"
+	wsError        = "error"
+)
+
+type wsClientMessage struct {
+	Type  string `json:"type"`
+	Topic string `json:"topic"`
+}
+
+type wsServerMessage struct {
+	Type  string          `json:"type"`
+	Id    uint64          `json:"id,omitempty"`
+	Kind  string          `json:"kind,omitempty"`
+	Topic string          `json:"topic,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+type typingEvent struct {
+	PostId   uint32 `json:"post_id"`
+	UserId   uint32 `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// Browsers can't set headers on WebSocket connections, so the token may be
+// sent in the access_token parameter instead of the Authorization header
+func (app *Application) webSocketAuthMiddleware(next http.Handler) http.Handler {
+	authenticated := app.AuthTokenMiddleware(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		authenticated.ServeHTTP(w, r)
+	})
+}
+
+// @Summary		Open a WebSocket connection
+// @Description	Upgrade to a WebSocket carrying JSON messages. Clients send {"type":"subscribe","topic":"post:1"} to receive the events of a topic, unsubscribe to stop, typing to tell the other subscribers of a post topic they are writing a comment, and ping. The topics are post:{id} for the comments and typing of a post and user:{id} for the notifications of the authenticated user. The server sends event, subscribed, unsubscribed, pong, ping and error messages. Client messages are rate limited per connection.
+// @Tags			stream
+// @Param			access_token	query		string	false	"Token, when the Authorization header can't be set"
+// @Success		101				{string}	string	"switching protocols"
+// @Failure		401				{object}	error
+// @Failure		500				{object}	error
+// @Security		BearerAuth
+// @Router			/ws [get]
+func (app *Application) webSocketHandler(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	user := app.getAuthUserFromCtx(ctx)
+
+	blockedIds, err := app.Store.Blocks.GetBlockedIds(ctx, user.Id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	blocked := make(map[uint32]bool, len(blockedIds))
+	for _, id := range blockedIds {
+		blocked[id] = true
+	}
+
+	server := websocket.Server{
+		// The connection is authenticated by the token and not by cookies,
+		// so any origin is accepted
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			ws.MaxPayloadBytes = maxWebSocketMessage
+			app.serveWebSocket(ctx, ws, user, blocked)
+		},
+	}
+
+	server.ServeHTTP(w, r)
+}
+
+// Serves the connection until the client leaves, falls behind or the hub is
+// closed. Client messages are handled by a reader goroutine, the replies and
+// the events are written by this one.
+func (app *Application) serveWebSocket(ctx context.Context, ws *websocket.Conn, user *model.User, blocked map[uint32]bool) {
+	defer ws.Close()
+
+	// Clear the deadlines of the server timeouts, writes set their own
+	if err := ws.SetDeadline(time.Time{}); err != nil {
+		return
+	}
+
+	sub := app.Realtime.Subscribe(nil, 0)
+	defer app.Realtime.Unsubscribe(sub)
+
+	replies := make(chan wsServerMessage, 16)
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	reply := func(msg wsServerMessage) bool {
+		select {
+		case replies <- msg:
+			return true
+		case <-stopped:
+			return false
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		var limiter ratelimiter.Limiter
+		if app.Config.WebSocket.RateLimiter.Enabled {
+			var err error
+			limiter, err = ratelimiter.New(app.Config.WebSocket.RateLimiter, app.Logger)
+			if err != nil {
+				app.Logger.Errorw("error creating the websocket rate limiter", "error", err)
+				return
+			}
+			defer limiter.Close()
+		}
+
+		for {
+			var msg wsClientMessage
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				return
+			}
+
+			if limiter != nil {
+				if allow, retryAfter := limiter.Allow(ws.Request().RemoteAddr); !allow {
+					if !reply(wsServerMessage{Type: wsError, Error: "rate limit exceeded, retry after: " + retryAfter.String()}) {
+						return
+					}
+					continue
+				}
+			}
+
+			response := app.handleWebSocketMessage(ctx, sub, user, msg)
+			if response != nil && !reply(*response) {
+				return
+			}
+		}
+	}()
+
+	write := func(msg wsServerMessage) error {
+		if err := ws.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+			return err
+		}
+		return websocket.JSON.Send(ws, msg)
+	}
+
+	heartbeat := time.NewTicker(app.Realtime.Config().Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+
+		case msg := <-replies:
+			if err := write(msg); err != nil {
+				return
+			}
+
+		case <-heartbeat.C:
+			if err := write(wsServerMessage{Type: wsPing}); err != nil {
+				return
+			}
+
+		case event, ok := <-sub.C:
+			if !ok {
+				if sub.Lagging() {
+					app.Logger.Warnw("websocket dropped, client too slow", "user_id", user.Id)
+				}
+				return
+			}
+
+			if blocked[event.ActorId] {
+				continue
+			}
+			// The typing user already knows
+			if event.Kind == realtime.KindTyping && event.ActorId == user.Id {
+				continue
+			}
+
+			msg := wsServerMessage{Type: wsEvent, Id: event.Id, Kind: event.Kind, Data: event.Data}
+			if err := write(msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Handles the client message, returning the reply if any
+func (app *Application) handleWebSocketMessage(ctx context.Context, sub *realtime.Subscription, user *model.User, msg wsClientMessage) *wsServerMessage {
+	switch msg.Type {
+	case wsPing:
+		return &wsServerMessage{Type: wsPong}
+
+	case wsSubscribe:
+		if err := app.authorizeTopic(ctx, user, msg.Topic); err != nil {
+			return &wsServerMessage{Type: wsError, Topic: msg.Topic, Error: err.Error()}
+		}
+
+		app.Realtime.Join(sub, msg.Topic)
+		return &wsServerMessage{Type: wsSubscribed, Topic: msg.Topic}
+
+	case wsUnsubscribe:
+		app.Realtime.Leave(sub, msg.Topic)
+		return &wsServerMessage{Type: wsUnsubscribed, Topic: msg.Topic}
+
+	case wsTyping:
+		prefix, postId, err := parseTopic(msg.Topic)
+		if err != nil || prefix != "post" || !app.Realtime.Joined(sub, msg.Topic) {
+			return &wsServerMessage{Type: wsError, Topic: msg.Topic, Error: "subscribe to the post topic before typing"}
+		}
+
+		typing := typingEvent{PostId: postId, UserId: user.Id, Username: user.Username}
+		if err := app.Realtime.Publish(realtime.KindTyping, []string{msg.Topic}, user.Id, typing); err != nil {
+			app.Logger.Errorw("error publishing typing event", "user_id", user.Id, "error", err)
+		}
+		return nil
+
+	default:
+		return &wsServerMessage{Type: wsError, Error: fmt.Sprintf("unknown message type %q", msg.Type)}
+	}
+}
+
+// Checks the user can receive the events of the topic. Users only receive
+// their own notifications, and the comments of the posts they can see.
+func (app *Application) authorizeTopic(ctx context.Context, user *model.User, topic string) error {
+	prefix, id, err := parseTopic(topic)
+	if err != nil {
+		return err
+	}
+
+	switch prefix {
+	case "user":
+		if id != user.Id {
+			return errors.New("cannot subscribe to the events of other users")
+		}
+		return nil
+
+	case "post":
+		post, err := app.Store.Posts.GetById(ctx, id)
+		if err != nil {
+			if errors.Is(err, store.ErrResourceNotFound) {
+				return errors.New("post not found")
+			}
+			app.Logger.Errorw("error authorizing topic", "topic", topic, "error", err)
+			return errors.New("internal server error")
+		}
+
+		isBlocked, err := app.Store.Blocks.IsBlocked(ctx, user.Id, post.UserId)
+		if err != nil {
+			app.Logger.Errorw("error authorizing topic", "topic", topic, "error", err)
+			return errors.New("internal server error")
+		}
+		if isBlocked {
+			return errors.New("post not found")
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown topic %q", topic)
+	}
+}
+
+// Splits a topic like "post:1" into its prefix and id
+func parseTopic(topic string) (string, uint32, error) {
+	prefix, value, ok := strings.Cut(topic, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("invalid topic %q", topic)
+	}
+
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid topic %q", topic)
+	}
+
+	return prefix, uint32(id), nil
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/ratelimiter"
+	"github.com/dottox/social/internal/realtime"
+	"golang.org/x/net/websocket"
+)
+
+func dialWebSocket(t *testing.T, srv *httptest.Server, token string) *websocket.Conn {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/v1/ws?access_token=" + token
+	ws, err := websocket.Dial(url, "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+
+	return ws
+}
+
+func send(t *testing.T, ws *websocket.Conn, msg wsClientMessage) wsServerMessage {
+	t.Helper()
+
+	if err := websocket.JSON.Send(ws, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	return receiveMessage(t, ws)
+}
+
+func receiveMessage(t *testing.T, ws *websocket.Conn) wsServerMessage {
+	t.Helper()
+
+	if err := ws.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	var msg wsServerMessage
+	if err := websocket.JSON.Receive(ws, &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	return msg
+}
+
+func TestWebSocket(t *testing.T) {
+	app := newTestApplication(t)
+	srv := httptest.NewServer(app.Mount())
+	defer srv.Close()
+
+	testToken, _ := app.Authenticator.GenerateToken(nil)
+
+	t.Run("should not allow unauthenticated connections", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/v1/ws")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		checkResponseCode(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("should deliver the events of the subscribed topics", func(t *testing.T) {
+		ws := dialWebSocket(t, srv, testToken)
+
+		msg := send(t, ws, wsClientMessage{Type: wsSubscribe, Topic: "post:7"})
+		if msg.Type != wsSubscribed || msg.Topic != "post:7" {
+			t.Fatalf("expected subscribed; got %+v", msg)
+		}
+
+		app.Realtime.CommentCreated(&model.Comment{Id: 1, PostId: 8, UserId: 2})
+		app.Realtime.CommentCreated(&model.Comment{Id: 2, PostId: 7, UserId: 2})
+
+		msg = receiveMessage(t, ws)
+		if msg.Type != wsEvent || msg.Kind != realtime.KindCommentCreated || !strings.Contains(string(msg.Data), `"id":2`) {
+			t.Errorf("expected comment 2; got %+v", msg)
+		}
+	})
+
+	t.Run("should only allow the notifications of the user", func(t *testing.T) {
+		ws := dialWebSocket(t, srv, testToken)
+
+		if msg := send(t, ws, wsClientMessage{Type: wsSubscribe, Topic: "user:24"}); msg.Type != wsSubscribed {
+			t.Errorf("expected subscribed; got %+v", msg)
+		}
+		if msg := send(t, ws, wsClientMessage{Type: wsSubscribe, Topic: "user:25"}); msg.Type != wsError {
+			t.Errorf("expected an error; got %+v", msg)
+		}
+		if msg := send(t, ws, wsClientMessage{Type: wsSubscribe, Topic: "post:0"}); msg.Type != wsError {
+			t.Errorf("expected an error for a missing post; got %+v", msg)
+		}
+	})
+
+	t.Run("should send typing events to the other subscribers", func(t *testing.T) {
+		ws := dialWebSocket(t, srv, testToken)
+
+		if msg := send(t, ws, wsClientMessage{Type: wsTyping, Topic: "post:3"}); msg.Type != wsError {
+			t.Errorf("expected an error before subscribing; got %+v", msg)
+		}
+
+		other := app.Realtime.Subscribe([]string{realtime.PostTopic(3)}, 0)
+		defer app.Realtime.Unsubscribe(other)
+
+		send(t, ws, wsClientMessage{Type: wsSubscribe, Topic: "post:3"})
+		if err := websocket.JSON.Send(ws, wsClientMessage{Type: wsTyping, Topic: "post:3"}); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case event := <-other.C:
+			if event.Kind != realtime.KindTyping || event.ActorId != 24 {
+				t.Errorf("expected a typing event of user 24; got %+v", event)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected a typing event")
+		}
+
+		// The typist doesn't receive its own event
+		if msg := send(t, ws, wsClientMessage{Type: wsPing}); msg.Type != wsPong {
+			t.Errorf("expected pong; got %+v", msg)
+		}
+	})
+
+	t.Run("should rate limit the messages of a connection", func(t *testing.T) {
+		app := newTestApplication(t)
+		app.Config.WebSocket.RateLimiter = ratelimiter.Config{
+			RequestsPerTimeFrame: 2,
+			TimeFrame:            time.Minute,
+			Enabled:              true,
+		}
+		srv := httptest.NewServer(app.Mount())
+		defer srv.Close()
+
+		ws := dialWebSocket(t, srv, testToken)
+
+		for range 2 {
+			if msg := send(t, ws, wsClientMessage{Type: wsPing}); msg.Type != wsPong {
+				t.Fatalf("expected pong; got %+v", msg)
+			}
+		}
+		if msg := send(t, ws, wsClientMessage{Type: wsPing}); msg.Type != wsError {
+			t.Errorf("expected a rate limit error; got %+v", msg)
+		}
+
+		// Other connections have their own limit
+		other := dialWebSocket(t, srv, testToken)
+		if msg := send(t, other, wsClientMessage{Type: wsPing}); msg.Type != wsPong {
+			t.Errorf("expected pong; got %+v", msg)
+		}
+	})
+
+	t.Run("should close the connections when the hub closes", func(t *testing.T) {
+		app := newTestApplication(t)
+		srv := httptest.NewServer(app.Mount())
+		defer srv.Close()
+
+		ws := dialWebSocket(t, srv, testToken)
+		send(t, ws, wsClientMessage{Type: wsPing})
+
+		app.Realtime.Close()
+
+		if err := ws.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		var msg wsServerMessage
+		if err := websocket.JSON.Receive(ws, &msg); err == nil {
+			t.Errorf("expected the connection to be closed; got %+v", msg)
+		}
+	})
+}
@@ -88,6 +88,7 @@ func generateUsers(count int) []*model.User {
 		users[i] = &model.User{
 			Username: generateRandomString(8),
 			Email:    generateRandomEmail(),
+			Language: "en",
 		}
 	}
 	return users
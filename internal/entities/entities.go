@@ -0,0 +1,140 @@
+package entities
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/dottox/social/internal/model"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Longest username accepted at registration
+const maxUsernameLength = 100
+
+// Longest tag stored in posts.tags
+const MaxTagLength = 255
+
+// Parses the @mentions and #hashtags of the text. The mentioned user ids are
+// resolved by the store, mentions of unknown users are dropped there.
+//
+// A mention is an @ at the start of the text or after a character that can't
+// be part of a username (so emails aren't mentions), followed by letters,
+// digits, '_', '.' or '-'. Trailing '.' and '-' are punctuation, not part of
+// the username.
+//
+// A hashtag is a # in the same position followed by letters, digits and '_',
+// with at least one letter so "#1" is not a tag. Its text is the normalised tag.
+func Parse(text string) model.Entities {
+	runes := []rune(text)
+	entities := model.Entities{}
+
+	for i := 0; i < len(runes); i++ {
+		if i > 0 && (isUsernameRune(runes[i-1]) || runes[i-1] == '@' || runes[i-1] == '#') {
+			continue
+		}
+
+		switch runes[i] {
+		case '@':
+			end := i + 1
+			for end < len(runes) && isUsernameRune(runes[end]) {
+				end++
+			}
+			for end > i+1 && (runes[end-1] == '.' || runes[end-1] == '-') {
+				end--
+			}
+
+			username := runes[i+1 : end]
+			if len(username) > 0 && len(username) <= maxUsernameLength {
+				entities = append(entities, model.Entity{
+					Type:  model.EntityMention,
+					Start: i,
+					End:   end,
+					Text:  string(username),
+				})
+			}
+			i = end - 1
+		case '#':
+			end := i + 1
+			for end < len(runes) && isTagRune(runes[end]) {
+				end++
+			}
+
+			tag := NormalizeTag(string(runes[i+1 : end]))
+			if slices.ContainsFunc([]rune(tag), unicode.IsLetter) && len(tag) <= MaxTagLength {
+				entities = append(entities, model.Entity{
+					Type:  model.EntityHashtag,
+					Start: i,
+					End:   end,
+					Text:  tag,
+				})
+			}
+			i = end - 1
+		}
+	}
+
+	return entities
+}
+
+// Normalises a tag so "#Café", "café" and "CAFÉ" are the same tag: the
+// leading #s and spaces are removed, like the migration of the stored tags, compatibility characters are folded
+// (NFKC) and letters are lowercased
+func NormalizeTag(tag string) string {
+	tag = strings.TrimSpace(tag)
+	tag = strings.TrimLeft(tag, "#")
+	tag = strings.ToLower(norm.NFKC.String(tag))
+
+	return norm.NFC.String(strings.TrimSpace(tag))
+}
+
+// Returns the normalised explicit tags followed by the hashtags of the
+// entities, without duplicates or empty tags
+func MergeTags(explicit []string, entities model.Entities) []string {
+	tags := []string{}
+	add := func(tag string) {
+		if tag != "" && len(tag) <= MaxTagLength && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	for _, tag := range explicit {
+		add(NormalizeTag(tag))
+	}
+	for _, entity := range entities {
+		if entity.Type == model.EntityHashtag {
+			add(entity.Text)
+		}
+	}
+
+	return tags
+}
+
+// Returns the tags of edited content: the tags of the hashtags removed from
+// the content are dropped, the other tags are kept as explicit tags and the
+// hashtags of the current content are added. A tag both set explicitly and
+// written as a removed hashtag is dropped too, as they can't be told apart.
+func RebuildTags(tags []string, previous, current model.Entities) []string {
+	removed := map[string]bool{}
+	for _, entity := range previous {
+		if entity.Type == model.EntityHashtag {
+			removed[entity.Text] = true
+		}
+	}
+
+	explicit := []string{}
+	for _, tag := range tags {
+		if !removed[NormalizeTag(tag)] {
+			explicit = append(explicit, tag)
+		}
+	}
+
+	return MergeTags(explicit, current)
+}
+
+func isUsernameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '-'
+}
+
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) || r == '_'
+}
@@ -0,0 +1,132 @@
+package entities
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dottox/social/internal/model"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want model.Entities
+	}{
+		{
+			name: "mention at the start",
+			text: "@gopher hello",
+			want: model.Entities{{Type: model.EntityMention, Start: 0, End: 7, Text: "gopher"}},
+		},
+		{
+			name: "trailing punctuation is not part of the username",
+			text: "thanks @john.doe.",
+			want: model.Entities{{Type: model.EntityMention, Start: 7, End: 16, Text: "john.doe"}},
+		},
+		{
+			name: "offsets are in code points",
+			text: "¡hola @josé!",
+			want: model.Entities{{Type: model.EntityMention, Start: 6, End: 11, Text: "josé"}},
+		},
+		{
+			name: "emails are not mentions",
+			text: "write to me@example.com",
+			want: model.Entities{},
+		},
+		{
+			name: "lone and double @ are ignored",
+			text: "@ and @@gopher",
+			want: model.Entities{},
+		},
+		{
+			name: "several mentions",
+			text: "@a, @b_c",
+			want: model.Entities{
+				{Type: model.EntityMention, Start: 0, End: 2, Text: "a"},
+				{Type: model.EntityMention, Start: 4, End: 8, Text: "b_c"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHashtags(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want model.Entities
+	}{
+		{
+			name: "hashtags are normalised",
+			text: "Learning #GoLang today",
+			want: model.Entities{{Type: model.EntityHashtag, Start: 9, End: 16, Text: "golang"}},
+		},
+		{
+			name: "unicode hashtags",
+			text: "#Cafe\u0301 and #ｇｏ",
+			want: model.Entities{
+				{Type: model.EntityHashtag, Start: 0, End: 6, Text: "café"},
+				{Type: model.EntityHashtag, Start: 11, End: 14, Text: "go"},
+			},
+		},
+		{
+			name: "numbers and words with a # inside are not hashtags",
+			text: "issue #1 in C#",
+			want: model.Entities{},
+		},
+		{
+			name: "mentions and hashtags",
+			text: "@gopher loves #go_lang!",
+			want: model.Entities{
+				{Type: model.EntityMention, Start: 0, End: 7, Text: "gopher"},
+				{Type: model.EntityHashtag, Start: 14, End: 22, Text: "go_lang"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	got := MergeTags([]string{" Go ", "#Web", "go", ""}, Parse("#golang and #GO"))
+	want := []string{"go", "web", "golang"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestNormalizeTag(t *testing.T) {
+	for tag, want := range map[string]string{"#Go": "go", "##Go": "go", " # Café ": "café", "ＧＯ": "go"} {
+		if got := NormalizeTag(tag); got != want {
+			t.Errorf("%q: got %q, want %q", tag, got, want)
+		}
+	}
+}
+
+func TestRebuildTags(t *testing.T) {
+	previous := Parse("learning #golang and #web")
+	current := Parse("learning #golang and #rust")
+
+	got := RebuildTags([]string{"go", "golang", "web"}, previous, current)
+	want := []string{"go", "golang", "rust"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
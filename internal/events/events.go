@@ -0,0 +1,202 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/retry"
+	"github.com/dottox/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// Handler handles a domain event. Events are delivered at least once, so
+// handlers must tolerate receiving the same event again.
+type Handler func(ctx context.Context, event *model.DomainEvent) error
+
+type Config struct {
+	// Interval between the checks for new events
+	PollInterval time.Duration
+	// Events claimed at once
+	BatchSize int
+	// Max time a handler is allowed to run
+	Timeout time.Duration
+	// Attempts of an event before it's given up on, and the delay between them
+	Retry retry.Config
+}
+
+type subscriber struct {
+	name    string
+	handler Handler
+}
+
+// Dispatcher delivers the domain events recorded in the outbox to the
+// in-process subscribers of their kind. An event is retried until every
+// subscriber handled it, the ones that already did are skipped.
+type Dispatcher struct {
+	cfg         Config
+	store       store.Storage
+	logger      *zap.SugaredLogger
+	subscribers map[string][]subscriber
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+func NewDispatcher(cfg Config, store store.Storage, logger *zap.SugaredLogger) *Dispatcher {
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 1
+	}
+	cfg.Retry = cfg.Retry.Normalize()
+
+	return &Dispatcher{
+		cfg:         cfg,
+		store:       store,
+		logger:      logger,
+		subscribers: map[string][]subscriber{},
+	}
+}
+
+// Subscribes the handler to the events of the kind. The name identifies the
+// subscriber across restarts, so it must be unique and stable. Subscribers
+// must be added before the dispatcher is started.
+func (d *Dispatcher) Subscribe(kind, name string, handler Handler) {
+	d.subscribers[kind] = append(d.subscribers[kind], subscriber{name, handler})
+}
+
+// Starts dispatching the events every poll interval
+func (d *Dispatcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.done = make(chan struct{})
+
+	go func() {
+		defer close(d.done)
+
+		ticker := time.NewTicker(d.cfg.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			// The handlers aren't cancelled on stop, they are bounded by the
+			// timeout. Keep going while there are events left.
+			if d.DispatchDue(context.Background()) > 0 && ctx.Err() == nil {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stops the dispatcher, waiting for the current batch or until ctx expires
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	if d.cancel == nil {
+		return nil
+	}
+	d.cancel()
+
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("event dispatcher did not stop: %w", ctx.Err())
+	}
+}
+
+// Dispatches a batch of the due events in order, returning how many were
+// claimed
+func (d *Dispatcher) DispatchDue(ctx context.Context) int {
+	// Events not recorded within the lease are dispatched again. The batch is
+	// handled in order, so the lease covers every handler of every event.
+	handlers := 0
+	for _, subs := range d.subscribers {
+		handlers = max(handlers, len(subs))
+	}
+	lease := d.cfg.Timeout*time.Duration(d.cfg.BatchSize*handlers) + time.Minute
+
+	events, err := d.store.Outbox.Claim(ctx, d.cfg.BatchSize, lease)
+	if err != nil {
+		d.logger.Errorw("error claiming domain events", "error", err)
+		return 0
+	}
+
+	for _, event := range events {
+		d.dispatch(ctx, event)
+	}
+
+	return len(events)
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, event *model.DomainEvent) {
+	errs := []error{}
+	for _, sub := range d.subscribers[event.Kind] {
+		if slices.Contains(event.Handled, sub.name) {
+			continue
+		}
+
+		if err := d.handle(ctx, sub, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sub.name, err))
+			continue
+		}
+		event.Handled = append(event.Handled, sub.name)
+	}
+
+	recordCtx, cancel := context.WithTimeout(context.Background(), store.QueryTimeoutDuration)
+	defer cancel()
+
+	if len(errs) == 0 {
+		if err := d.store.Outbox.MarkDispatched(recordCtx, event.Id); err != nil {
+			d.logger.Errorw("error recording dispatched event", "event_id", event.Id, "error", err)
+		}
+		return
+	}
+
+	event.LastError = errors.Join(errs...).Error()
+	attempts := event.Attempts + 1
+	final := attempts >= d.cfg.Retry.MaxAttempts
+	retryIn := d.cfg.Retry.Backoff(attempts)
+
+	if err := d.store.Outbox.MarkFailed(recordCtx, event, retryIn, final); err != nil {
+		d.logger.Errorw("error recording failed event", "event_id", event.Id, "error", err)
+		return
+	}
+
+	if final {
+		d.logger.Errorw("giving up on domain event", "event_id", event.Id, "kind", event.Kind, "attempts", attempts, "error", event.LastError)
+	} else {
+		d.logger.Warnw("domain event failed, retrying", "event_id", event.Id, "kind", event.Kind, "attempt", attempts, "retry_in", retryIn.String(), "error", event.LastError)
+	}
+}
+
+// Runs the handler with the timeout, turning its panics into errors
+func (d *Dispatcher) handle(ctx context.Context, sub subscriber, event *model.DomainEvent) (err error) {
+	if d.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.cfg.Timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return sub.handler(ctx, event)
+}
+
+// Decodes the payload of the event into v
+func Decode(event *model.DomainEvent, v any) error {
+	if err := json.Unmarshal(event.Payload, v); err != nil {
+		return fmt.Errorf("decoding %s event %d: %w", event.Kind, event.Id, err)
+	}
+
+	return nil
+}
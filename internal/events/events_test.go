@@ -0,0 +1,136 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/retry"
+	"github.com/dottox/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// fakeOutboxStore hands out the due events once and records their outcome
+type fakeOutboxStore struct {
+	store.MockOutboxStore
+
+	due        []*model.DomainEvent
+	dispatched []uint64
+	failed     []*model.DomainEvent
+	retryIn    time.Duration
+	final      bool
+}
+
+func (f *fakeOutboxStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]*model.DomainEvent, error) {
+	due := f.due
+	f.due = nil
+	return due, nil
+}
+
+func (f *fakeOutboxStore) MarkDispatched(ctx context.Context, id uint64) error {
+	f.dispatched = append(f.dispatched, id)
+	return nil
+}
+
+func (f *fakeOutboxStore) MarkFailed(ctx context.Context, event *model.DomainEvent, retryIn time.Duration, final bool) error {
+	f.failed = append(f.failed, event)
+	f.retryIn = retryIn
+	f.final = final
+	return nil
+}
+
+func newTestDispatcher(due ...*model.DomainEvent) (*Dispatcher, *fakeOutboxStore) {
+	fake := &fakeOutboxStore{due: due}
+	cfg := Config{
+		Retry: retry.Config{MaxAttempts: 3, BackoffBase: time.Second, BackoffMax: time.Minute},
+	}
+
+	return NewDispatcher(cfg, store.Storage{Outbox: fake}, zap.NewNop().Sugar()), fake
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Run("should deliver the events to the subscribers of their kind", func(t *testing.T) {
+		d, fake := newTestDispatcher(&model.DomainEvent{
+			Id:      1,
+			Kind:    model.EventPostCreated,
+			Payload: []byte(`{"post":{"id":7}}`),
+		})
+
+		var got model.PostCreated
+		d.Subscribe(model.EventPostCreated, "test", func(ctx context.Context, event *model.DomainEvent) error {
+			return Decode(event, &got)
+		})
+		d.Subscribe(model.EventUserFollowed, "other", func(ctx context.Context, event *model.DomainEvent) error {
+			t.Errorf("unexpected %s event", event.Kind)
+			return nil
+		})
+
+		if claimed := d.DispatchDue(context.Background()); claimed != 1 {
+			t.Fatalf("expected 1 event; got %d", claimed)
+		}
+
+		if got.Post == nil || got.Post.Id != 7 {
+			t.Errorf("unexpected payload %+v", got)
+		}
+		if len(fake.dispatched) != 1 || fake.dispatched[0] != 1 {
+			t.Errorf("expected the event to be dispatched; got %v", fake.dispatched)
+		}
+	})
+
+	t.Run("should retry only the failed subscribers", func(t *testing.T) {
+		d, fake := newTestDispatcher(&model.DomainEvent{
+			Id:       1,
+			Kind:     model.EventUserFollowed,
+			Attempts: 1,
+			Handled:  []string{"done"},
+		})
+
+		d.Subscribe(model.EventUserFollowed, "done", func(ctx context.Context, event *model.DomainEvent) error {
+			t.Errorf("handled subscriber called again")
+			return nil
+		})
+		d.Subscribe(model.EventUserFollowed, "ok", func(ctx context.Context, event *model.DomainEvent) error {
+			return nil
+		})
+		d.Subscribe(model.EventUserFollowed, "failing", func(ctx context.Context, event *model.DomainEvent) error {
+			return errors.New("unavailable")
+		})
+
+		d.DispatchDue(context.Background())
+
+		if len(fake.failed) != 1 {
+			t.Fatalf("expected the event to fail; got %d failures", len(fake.failed))
+		}
+
+		event := fake.failed[0]
+		if len(event.Handled) != 2 || event.Handled[1] != "ok" {
+			t.Errorf("unexpected handled subscribers %v", event.Handled)
+		}
+		if event.LastError != "failing: unavailable" {
+			t.Errorf("unexpected error %q", event.LastError)
+		}
+		if fake.retryIn != 2*time.Second || fake.final {
+			t.Errorf("expected a retry in 2s; got %s final %t", fake.retryIn, fake.final)
+		}
+	})
+
+	t.Run("should give up on the events out of attempts", func(t *testing.T) {
+		d, fake := newTestDispatcher(&model.DomainEvent{
+			Id:       1,
+			Kind:     model.EventUserRegistered,
+			Attempts: 2,
+		})
+
+		d.Subscribe(model.EventUserRegistered, "panicking", func(ctx context.Context, event *model.DomainEvent) error {
+			panic("boom")
+		})
+
+		d.DispatchDue(context.Background())
+
+		if !fake.final || fake.failed[0].LastError != "panicking: panic: boom" {
+			t.Errorf("expected a final failure; got %+v", fake.failed)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed cron expression with the five standard fields: minute,
+// hour, day of month, month and day of week. Fields accept "*", values,
+// ranges ("1-5"), steps ("*/15", "0-30/10") and lists of them ("1,15").
+// The @hourly, @daily, @weekly and @monthly shorthands are also accepted.
+type Cron struct {
+	minute, hour, dom, month, dow uint64 // bit i set when value i matches
+	// Whether the day fields were restricted, when both are a day matches
+	// if either does, like in the standard cron
+	domAny, dowAny bool
+}
+
+var cronShorthands = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+type cronField struct {
+	min, max int
+}
+
+var cronFields = []cronField{
+	{0, 59}, // minute
+	{0, 23}, // hour
+	{1, 31}, // day of month
+	{1, 12}, // month
+	{0, 6},  // day of week, 0 is sunday
+}
+
+func ParseCron(spec string) (*Cron, error) {
+	if expanded, ok := cronShorthands[spec]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron %q: expected %d fields, got %d", spec, len(cronFields), len(fields))
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		b, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %w", spec, err)
+		}
+		bits[i] = b
+	}
+
+	return &Cron{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: strings.HasPrefix(fields[2], "*"),
+		dowAny: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+func parseCronField(field string, limits cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			s, err := strconv.Atoi(stepPart)
+			if err != nil || s < 1 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+			step = s
+		}
+
+		start, end := limits.min, limits.max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+
+			var err error
+			start, err = strconv.Atoi(from)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			end = start
+			if isRange {
+				end, err = strconv.Atoi(to)
+				if err != nil {
+					return 0, fmt.Errorf("invalid range %q", part)
+				}
+			} else if hasStep {
+				// "5/15" runs from 5 to the end of the field
+				end = limits.max
+			}
+		}
+
+		if start < limits.min || end > limits.max || start > end {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, limits.min, limits.max)
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func (c *Cron) matchesDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// Returns the first time after t matching the expression, or the zero time
+// when there is none within five years
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCron(t *testing.T) {
+	base := time.Date(2026, time.March, 14, 10, 7, 30, 0, time.UTC) // a saturday
+
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2026, time.March, 14, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, time.March, 14, 10, 15, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, time.March, 14, 11, 0, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2026, time.March, 15, 3, 0, 0, 0, time.UTC)},
+		{"30 9-17 * * 1-5", time.Date(2026, time.March, 16, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2026, time.March, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2026, time.March, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		// Restricted day of month and day of week match either
+		{"0 12 20 * 0", time.Date(2026, time.March, 15, 12, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		cron, err := ParseCron(tt.spec)
+		if err != nil {
+			t.Errorf("%s: %v", tt.spec, err)
+			continue
+		}
+
+		if got := cron.Next(base); !got.Equal(tt.expected) {
+			t.Errorf("%s: expected %s; got %s", tt.spec, tt.expected, got)
+		}
+	}
+
+	t.Run("should reject invalid expressions", func(t *testing.T) {
+		for _, spec := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "0 0 0 * *"} {
+			if _, err := ParseCron(spec); err == nil {
+				t.Errorf("%s: expected an error", spec)
+			}
+		}
+	})
+}
@@ -0,0 +1,324 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/retry"
+	"github.com/dottox/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// Job is the payload of a kind of background job, encoded as JSON
+type Job interface {
+	Kind() string
+}
+
+type Config struct {
+	// Jobs run at once by the instance
+	Workers int
+	// Interval between the checks for due jobs when idle
+	PollInterval time.Duration
+	// Max time a job is allowed to run
+	Timeout time.Duration
+	// Attempts of a job before it's moved to the dead jobs, unless the job
+	// was queued with its own, and the delay between them
+	Retry retry.Config
+}
+
+type handlerFunc func(ctx context.Context, payload json.RawMessage) error
+
+type schedule struct {
+	cron *Cron
+	job  Job
+	next time.Time
+}
+
+// Queue runs the background jobs stored in Postgres with a pool of workers.
+// Every instance can run the workers, a job is only claimed by one of them.
+// Failed jobs are retried with exponential backoff and moved to the dead
+// jobs once they run out of attempts.
+type Queue struct {
+	cfg       Config
+	store     store.Storage
+	logger    *zap.SugaredLogger
+	handlers  map[string]handlerFunc
+	schedules []*schedule
+	wake      chan struct{}
+	wg        sync.WaitGroup
+
+	// Cancelled to stop claiming jobs
+	cancel context.CancelFunc
+	// Cancelled when the running jobs didn't drain in time
+	abort  context.CancelFunc
+	runCtx context.Context
+}
+
+func NewQueue(cfg Config, store store.Storage, logger *zap.SugaredLogger) *Queue {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	cfg.Retry = cfg.Retry.Normalize()
+
+	runCtx, abort := context.WithCancel(context.Background())
+
+	return &Queue{
+		cfg:      cfg,
+		store:    store,
+		logger:   logger,
+		handlers: map[string]handlerFunc{},
+		wake:     make(chan struct{}, cfg.Workers),
+		runCtx:   runCtx,
+		abort:    abort,
+	}
+}
+
+// Registers the handler of the jobs of kind T. Handlers must be registered
+// before the queue is started.
+func Register[T Job](q *Queue, handler func(context.Context, T) error) {
+	var zero T
+
+	q.handlers[zero.Kind()] = func(ctx context.Context, payload json.RawMessage) error {
+		var job T
+		if err := json.Unmarshal(payload, &job); err != nil {
+			return fmt.Errorf("decoding %s job: %w", zero.Kind(), err)
+		}
+
+		return handler(ctx, job)
+	}
+}
+
+type Option func(*enqueueOptions)
+
+type enqueueOptions struct {
+	delay       time.Duration
+	maxAttempts int
+	uniqueKey   *string
+}
+
+// Runs the job after the delay
+func WithDelay(delay time.Duration) Option {
+	return func(o *enqueueOptions) { o.delay = delay }
+}
+
+func WithMaxAttempts(attempts int) Option {
+	return func(o *enqueueOptions) { o.maxAttempts = attempts }
+}
+
+// Queues the job only if no job with the same key was queued before
+func WithUniqueKey(key string) Option {
+	return func(o *enqueueOptions) { o.uniqueKey = &key }
+}
+
+// Queues the job, reporting false when a job with the same unique key exists
+func (q *Queue) Enqueue(ctx context.Context, job Job, opts ...Option) (bool, error) {
+	options := enqueueOptions{maxAttempts: q.cfg.Retry.MaxAttempts}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return false, err
+	}
+
+	queued, err := q.store.Jobs.Enqueue(ctx, &model.Job{
+		Kind:        job.Kind(),
+		Payload:     payload,
+		MaxAttempts: max(options.maxAttempts, 1),
+		UniqueKey:   options.uniqueKey,
+	}, options.delay)
+	if err != nil {
+		return false, err
+	}
+
+	if queued && options.delay <= 0 {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return queued, nil
+}
+
+// Queues the job on the cron schedule, e.g. "*/5 * * * *". Runs are queued
+// once across all the instances. Schedules must be added before the queue is
+// started.
+func (q *Queue) Schedule(spec string, job Job) error {
+	cron, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+
+	q.schedules = append(q.schedules, &schedule{cron: cron, job: job})
+	return nil
+}
+
+// Starts the workers and the scheduler
+func (q *Queue) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+
+	for i := 0; i < q.cfg.Workers; i++ {
+		q.wg.Add(1)
+		go q.worker(ctx)
+	}
+
+	if len(q.schedules) > 0 {
+		q.wg.Add(1)
+		go q.scheduler(ctx)
+	}
+}
+
+// Stops claiming jobs and waits for the running ones to finish. When ctx
+// expires first the running jobs are cancelled, their attempts are retried
+// once their lease expires.
+func (q *Queue) Stop(ctx context.Context) error {
+	if q.cancel == nil {
+		return nil
+	}
+	q.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		q.abort()
+		return fmt.Errorf("job workers did not drain: %w", ctx.Err())
+	}
+}
+
+// Runs the next due job, reporting whether there was one
+func (q *Queue) RunNext(ctx context.Context) bool {
+	// Jobs not finished within the lease are claimed again
+	lease := q.cfg.Timeout + time.Minute
+
+	job, err := q.store.Jobs.Claim(ctx, lease)
+	if err != nil {
+		if !errors.Is(err, store.ErrResourceNotFound) {
+			q.logger.Errorw("error claiming job", "error", err)
+		}
+		return false
+	}
+
+	start := time.Now()
+	err = q.run(job)
+
+	recordCtx, cancel := context.WithTimeout(context.Background(), store.QueryTimeoutDuration)
+	defer cancel()
+
+	if err == nil {
+		if err := q.store.Jobs.Complete(recordCtx, job.Id); err != nil {
+			q.logger.Errorw("error completing job", "job_id", job.Id, "kind", job.Kind, "error", err)
+		}
+		q.logger.Infow("job succeeded", "job_id", job.Id, "kind", job.Kind, "took", time.Since(start).String())
+		return true
+	}
+
+	job.LastError = err.Error()
+	dead := job.Attempts >= job.MaxAttempts
+	retryIn := q.cfg.Retry.Backoff(job.Attempts)
+
+	if err := q.store.Jobs.Fail(recordCtx, job, retryIn, dead); err != nil {
+		q.logger.Errorw("error recording failed job", "job_id", job.Id, "kind", job.Kind, "error", err)
+		return true
+	}
+
+	if dead {
+		q.logger.Errorw("job is dead", "job_id", job.Id, "kind", job.Kind, "attempts", job.Attempts, "error", job.LastError)
+	} else {
+		q.logger.Warnw("job failed, retrying", "job_id", job.Id, "kind", job.Kind, "attempt", job.Attempts, "retry_in", retryIn.String(), "error", job.LastError)
+	}
+
+	return true
+}
+
+// Runs the handler of the job with the timeout, turning its panics into errors
+func (q *Queue) run(job *model.Job) (err error) {
+	handler, ok := q.handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("no handler for %s jobs", job.Kind)
+	}
+
+	ctx := q.runCtx
+	if q.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.cfg.Timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return handler(ctx, job.Payload)
+}
+
+func (q *Queue) worker(ctx context.Context) {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if ctx.Err() == nil && q.RunNext(ctx) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+func (q *Queue) scheduler(ctx context.Context) {
+	defer q.wg.Done()
+
+	now := time.Now()
+	for _, s := range q.schedules {
+		s.next = s.cron.Next(now)
+	}
+
+	ticker := time.NewTicker(time.Second * 15)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C:
+		}
+
+		for _, s := range q.schedules {
+			if s.next.IsZero() || now.Before(s.next) {
+				continue
+			}
+
+			// Every instance tries to queue the run, the key lets one through
+			key := fmt.Sprintf("schedule:%s:%d", s.job.Kind(), s.next.Unix())
+			if _, err := q.Enqueue(ctx, s.job, WithUniqueKey(key)); err != nil {
+				q.logger.Errorw("error queueing scheduled job", "kind", s.job.Kind(), "error", err)
+				continue
+			}
+
+			s.next = s.cron.Next(now)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/retry"
+	"github.com/dottox/social/internal/store"
+	"go.uber.org/zap"
+)
+
+type greetJob struct {
+	Name string `json:"name"`
+}
+
+func (greetJob) Kind() string { return "greet" }
+
+// fakeJobStore stores the queued jobs in memory and records their outcome
+type fakeJobStore struct {
+	store.MockJobStore
+
+	queued    []*model.Job
+	completed []uint64
+	failed    []*model.Job
+	retryIn   time.Duration
+	dead      bool
+}
+
+func (f *fakeJobStore) Enqueue(ctx context.Context, job *model.Job, delay time.Duration) (bool, error) {
+	job.Id = uint64(len(f.queued) + 1)
+	f.queued = append(f.queued, job)
+	return true, nil
+}
+
+func (f *fakeJobStore) Claim(ctx context.Context, lease time.Duration) (*model.Job, error) {
+	if len(f.queued) == 0 {
+		return nil, store.ErrResourceNotFound
+	}
+
+	job := f.queued[0]
+	f.queued = f.queued[1:]
+	job.Attempts++
+	return job, nil
+}
+
+func (f *fakeJobStore) Complete(ctx context.Context, id uint64) error {
+	f.completed = append(f.completed, id)
+	return nil
+}
+
+func (f *fakeJobStore) Fail(ctx context.Context, job *model.Job, retryIn time.Duration, dead bool) error {
+	f.failed = append(f.failed, job)
+	f.retryIn = retryIn
+	f.dead = dead
+	return nil
+}
+
+func newTestQueue() (*Queue, *fakeJobStore) {
+	fake := &fakeJobStore{}
+	cfg := Config{
+		Retry: retry.Config{MaxAttempts: 3, BackoffBase: time.Second, BackoffMax: time.Minute},
+	}
+
+	return NewQueue(cfg, store.Storage{Jobs: fake}, zap.NewNop().Sugar()), fake
+}
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should run the jobs with their typed handler", func(t *testing.T) {
+		q, fake := newTestQueue()
+
+		var got greetJob
+		Register(q, func(ctx context.Context, job greetJob) error {
+			got = job
+			return nil
+		})
+
+		if _, err := q.Enqueue(ctx, greetJob{Name: "gopher"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if !q.RunNext(ctx) {
+			t.Fatal("expected a job to run")
+		}
+		if q.RunNext(ctx) {
+			t.Error("expected no job left")
+		}
+
+		if got.Name != "gopher" {
+			t.Errorf("unexpected job %+v", got)
+		}
+		if len(fake.completed) != 1 {
+			t.Errorf("expected the job to complete; got %v", fake.completed)
+		}
+	})
+
+	t.Run("should retry the failed jobs with backoff", func(t *testing.T) {
+		q, fake := newTestQueue()
+
+		Register(q, func(ctx context.Context, job greetJob) error {
+			return errors.New("unavailable")
+		})
+
+		q.Enqueue(ctx, greetJob{})
+		fake.queued[0].Attempts = 1
+		q.RunNext(ctx)
+
+		if len(fake.failed) != 1 || fake.dead || fake.retryIn != 2*time.Second {
+			t.Errorf("expected a retry in 2s; got %s dead %t", fake.retryIn, fake.dead)
+		}
+		if fake.failed[0].LastError != "unavailable" {
+			t.Errorf("unexpected error %q", fake.failed[0].LastError)
+		}
+	})
+
+	t.Run("should move the jobs out of attempts to the dead jobs", func(t *testing.T) {
+		q, fake := newTestQueue()
+
+		Register(q, func(ctx context.Context, job greetJob) error {
+			panic("boom")
+		})
+
+		q.Enqueue(ctx, greetJob{}, WithMaxAttempts(1))
+		q.RunNext(ctx)
+
+		if !fake.dead || fake.failed[0].LastError != "panic: boom" {
+			t.Errorf("expected a dead job; got %+v", fake.failed)
+		}
+	})
+
+	t.Run("should fail the jobs without handler", func(t *testing.T) {
+		q, fake := newTestQueue()
+
+		q.Enqueue(ctx, greetJob{})
+		q.RunNext(ctx)
+
+		if len(fake.failed) != 1 {
+			t.Errorf("expected the job to fail")
+		}
+	})
+
+	t.Run("should drain the running jobs on stop", func(t *testing.T) {
+		q, fake := newTestQueue()
+		q.cfg.PollInterval = time.Millisecond
+
+		started := make(chan struct{})
+		Register(q, func(ctx context.Context, job greetJob) error {
+			close(started)
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		})
+
+		q.Enqueue(ctx, greetJob{})
+		q.Start()
+		<-started
+
+		if err := q.Stop(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if len(fake.completed) != 1 {
+			t.Errorf("expected the running job to complete")
+		}
+	})
+}
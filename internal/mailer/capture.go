@@ -0,0 +1,190 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+)
+
+// Names of the captured emails, the creation time in nanoseconds and the
+// email id, so they sort by age
+var capturedName = regexp.MustCompile(`^[0-9]+-[0-9]+$`)
+
+// CaptureMailer writes the emails to a directory as .eml files instead of
+// delivering them, for development. They can be opened with any mail client
+// or read through the inbox of the web app.
+type CaptureMailer struct {
+	dir       string
+	fromEmail string
+}
+
+func NewCaptureMailer(dir, fromEmail string) (*CaptureMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create capture directory: %w", err)
+	}
+
+	return &CaptureMailer{dir: dir, fromEmail: fromEmail}, nil
+}
+
+// Writes the message of the email to the capture directory
+func (m *CaptureMailer) Send(ctx context.Context, email *model.Email) error {
+	now := time.Now()
+
+	msg, err := buildMessage(FromName, m.fromEmail, email, now)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%019d-%d.eml", now.UnixNano(), email.Id)
+
+	// Written under a temporary name, so the inbox never reads half an email
+	tmp := filepath.Join(m.dir, "."+name)
+	if err := os.WriteFile(tmp, msg, 0o644); err != nil {
+		return fmt.Errorf("failed to capture email to %v: %w", email.ToEmail, err)
+	}
+
+	return os.Rename(tmp, filepath.Join(m.dir, name))
+}
+
+// CapturedEmail is an email read back from the capture directory
+type CapturedEmail struct {
+	Id      string
+	From    string
+	To      string
+	Subject string
+	Date    time.Time
+	Text    string
+	HTML    string
+}
+
+// Reads the emails in the capture directory, newest first. A missing
+// directory has no emails.
+func ReadCapturedEmails(dir string) ([]*CapturedEmail, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []*CapturedEmail{}, nil
+		}
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".eml")
+		if ok && capturedName.MatchString(id) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	slices.Reverse(ids)
+
+	emails := make([]*CapturedEmail, 0, len(ids))
+	for _, id := range ids {
+		email, err := ReadCapturedEmail(dir, id)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+
+	return emails, nil
+}
+
+// Reads the captured email with the id, returning os.ErrNotExist when there
+// is none
+func ReadCapturedEmail(dir, id string) (*CapturedEmail, error) {
+	// The id comes from the URL, it can't point outside the directory
+	if !capturedName.MatchString(id) {
+		return nil, os.ErrNotExist
+	}
+
+	f, err := os.Open(CapturedPath(dir, id))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	msg, err := mail.ReadMessage(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading captured email %s: %w", id, err)
+	}
+
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	date, _ := msg.Header.Date()
+
+	email := &CapturedEmail{
+		Id:      id,
+		From:    msg.Header.Get("From"),
+		To:      msg.Header.Get("To"),
+		Subject: subject,
+		Date:    date,
+	}
+
+	if err := readParts(email, msg.Header.Get("Content-Type"), msg.Body); err != nil {
+		return nil, fmt.Errorf("reading captured email %s: %w", id, err)
+	}
+
+	return email, nil
+}
+
+// Returns the path of the .eml file of the captured email
+func CapturedPath(dir, id string) string {
+	return filepath.Join(dir, id+".eml")
+}
+
+func readParts(email *CapturedEmail, contentType string, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		content, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		email.HTML = string(content)
+		return nil
+	}
+
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// The quoted-printable parts are decoded by the reader
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return err
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch partType {
+		case "text/plain":
+			email.Text = string(content)
+		case "text/html":
+			email.HTML = string(content)
+		}
+	}
+}
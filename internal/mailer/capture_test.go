@@ -0,0 +1,73 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dottox/social/internal/model"
+)
+
+func TestCaptureMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+
+	m, err := NewCaptureMailer(dir, "noreply@gophersocial.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for i, subject := range []string{"First", "Ünïcode second"} {
+		email := &model.Email{
+			Id:      uint64(i + 1),
+			ToName:  "Gopher",
+			ToEmail: "gopher@example.com",
+			Subject: subject,
+			Body:    `<p>Open <a href="http://localhost:4000/activate?token=abc">the link</a></p>`,
+		}
+
+		if err := m.Send(ctx, email); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("should read the captured emails newest first", func(t *testing.T) {
+		emails, err := ReadCapturedEmails(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(emails) != 2 {
+			t.Fatalf("expected 2 emails; got %d", len(emails))
+		}
+
+		email := emails[0]
+		if email.Subject != "Ünïcode second" || email.To != `"Gopher" <gopher@example.com>` {
+			t.Errorf("unexpected email %+v", email)
+		}
+		if !strings.Contains(email.HTML, `href="http://localhost:4000/activate?token=abc"`) {
+			t.Errorf("unexpected html %q", email.HTML)
+		}
+		if !strings.Contains(email.Text, "the link (http://localhost:4000/activate?token=abc)") {
+			t.Errorf("unexpected text %q", email.Text)
+		}
+	})
+
+	t.Run("should not read outside the directory", func(t *testing.T) {
+		for _, id := range []string{"../mail/1", "missing", "1-1"} {
+			if _, err := ReadCapturedEmail(dir, id); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("%s: expected not found; got %v", id, err)
+			}
+		}
+	})
+
+	t.Run("should have no emails without a directory", func(t *testing.T) {
+		emails, err := ReadCapturedEmails(filepath.Join(dir, "missing"))
+		if err != nil || len(emails) != 0 {
+			t.Errorf("expected no emails; got %d %v", len(emails), err)
+		}
+	})
+}
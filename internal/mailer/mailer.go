@@ -1,16 +1,73 @@
 package mailer
 
-import "embed"
+import (
+	"context"
+	"embed"
+	"fmt"
+
+	"github.com/dottox/social/internal/model"
+)
 
 const (
-	MAX_RETRIES         = 5
 	FromName            = "GopherSocial"
 	UserWelcomeTemplate = "user_invitation.tmpl"
+	// A single notification, for the kinds emailed immediately
+	NotificationTemplate = "notification.tmpl"
+	// The summary of the unread notifications, for the daily and weekly ones
+	DigestTemplate = "notification_digest.tmpl"
+)
+
+// Mail providers
+const (
+	ProviderSendGrid = "sendgrid"
+	ProviderSMTP     = "smtp"
+	// Writes the emails to disk, for development
+	ProviderCapture = "capture"
 )
 
 //go:embed "templates"
 var FS embed.FS
 
+// Client delivers a rendered email through a mail provider. Send makes a
+// single attempt, the retries are left to the mail queue.
 type Client interface {
-	Send(templateFile, username, email string, data any, isSandbox bool) error
+	Send(ctx context.Context, email *model.Email) error
+}
+
+type ClientConfig struct {
+	Provider  string
+	FromEmail string
+	SendGrid  SendGridConfig
+	SMTP      SMTPConfig
+	// Directory of the captured emails
+	CaptureDir string
+}
+
+type SendGridConfig struct {
+	APIKey string
+	// SendGrid only validates the emails, without delivering them
+	Sandbox bool
+}
+
+// Creates the client of the provider selected by the config
+func NewClient(cfg ClientConfig) (Client, error) {
+	switch cfg.Provider {
+	case ProviderSendGrid:
+		return NewSendGridMailer(cfg.SendGrid.APIKey, cfg.FromEmail, cfg.SendGrid.Sandbox), nil
+	case ProviderSMTP:
+		return NewSMTPMailer(cfg.SMTP, cfg.FromEmail)
+	case ProviderCapture:
+		return NewCaptureMailer(cfg.CaptureDir, cfg.FromEmail)
+	default:
+		return nil, fmt.Errorf("unknown mail provider %q", cfg.Provider)
+	}
+}
+
+// Returns the plain text part of the email, generated from the HTML body for
+// the emails queued without one
+func textBody(email *model.Email) string {
+	if email.TextBody != "" {
+		return email.TextBody
+	}
+	return PlainText(email.Body)
 }
@@ -0,0 +1,86 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+)
+
+// Builds the MIME message of the email, a multipart/alternative with the
+// plain text version first and the HTML body last, as preferred by clients
+func buildMessage(fromName, fromEmail string, email *model.Email, date time.Time) ([]byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	domain := "localhost"
+	if _, d, ok := strings.Cut(fromEmail, "@"); ok {
+		domain = d
+	}
+
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+
+	from := mail.Address{Name: fromName, Address: fromEmail}
+	to := mail.Address{Name: email.ToName, Address: email.ToEmail}
+
+	headers := []string{
+		"From: " + from.String(),
+		"To: " + to.String(),
+		"Subject: " + mime.QEncoding.Encode("utf-8", strings.TrimSpace(email.Subject)),
+		"Date: " + date.Format(time.RFC1123Z),
+		fmt.Sprintf("Message-ID: <%s@%s>", hex.EncodeToString(id), domain),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + mw.Boundary(),
+	}
+	if email.UnsubscribeURL != "" {
+		headers = append(headers,
+			"List-Unsubscribe: <"+email.UnsubscribeURL+">",
+			"List-Unsubscribe-Post: List-Unsubscribe=One-Click",
+		)
+	}
+	buf.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", textBody(email)},
+		{"text/html; charset=utf-8", email.Body},
+	}
+
+	for _, part := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dottox/social/internal/model"
+)
+
+// MockClient keeps the sent emails in memory
+type MockClient struct {
+	mu   sync.Mutex
+	Sent []*model.Email
+	// Returned by Send when set, nothing is kept
+	Err error
+}
+
+func NewMockClient() *MockClient {
+	return &MockClient{}
+}
+
+func (m *MockClient) Send(ctx context.Context, email *model.Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Err != nil {
+		return m.Err
+	}
+
+	m.Sent = append(m.Sent, email)
+	return nil
+}
@@ -0,0 +1,226 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/retry"
+	"github.com/dottox/social/internal/store"
+	"go.uber.org/zap"
+)
+
+type Config struct {
+	// Emails sent at once
+	Workers int
+	// Interval between the checks for due emails
+	PollInterval time.Duration
+	// Max time the provider has to accept an email
+	Timeout time.Duration
+	// Attempts of an email before it's marked as failed, and the delay between them
+	Retry retry.Config
+}
+
+// Queue renders the emails and stores them, so they survive restarts and are
+// shared by all the API instances, and sends them in the background through
+// the client. Failed emails are retried with exponential backoff until they
+// run out of attempts.
+type Queue struct {
+	cfg       Config
+	client    Client
+	templates *Templates
+	store     store.Storage
+	logger    *zap.SugaredLogger
+	wake      chan struct{}
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func NewQueue(cfg Config, client Client, templates *Templates, store store.Storage, logger *zap.SugaredLogger) *Queue {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	cfg.Retry = cfg.Retry.Normalize()
+
+	return &Queue{
+		cfg:       cfg,
+		client:    client,
+		templates: templates,
+		store:     store,
+		logger:    logger,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Recipient of an email, the locale picks the variant of the template
+type Recipient struct {
+	Name   string
+	Email  string
+	Locale string
+	// Sent as the one-click unsubscribe link of the email when set
+	UnsubscribeURL string
+}
+
+// Renders the template with the data and queues the email to the recipient.
+// Emails with the dedup key of an already queued email aren't queued again,
+// reporting false. An empty key doesn't deduplicate the email.
+func (q *Queue) Enqueue(ctx context.Context, templateName string, to Recipient, data any, dedupKey string) (bool, error) {
+	queued, err := q.Compose(templateName, to, data, dedupKey)
+	if err != nil {
+		return false, err
+	}
+
+	ok, err := q.store.Emails.Enqueue(ctx, queued)
+	if err != nil {
+		return false, err
+	}
+
+	if ok {
+		q.Wake()
+	}
+
+	return ok, nil
+}
+
+// Renders the template with the data into an email to the recipient, for
+// the stores that queue it in the transaction of the change that sends it
+func (q *Queue) Compose(templateName string, to Recipient, data any, dedupKey string) (*model.Email, error) {
+	rendered, err := q.templates.Render(templateName, to.Locale, data)
+	if err != nil {
+		return nil, err
+	}
+
+	email := &model.Email{
+		Template:    templateName,
+		ToName:      to.Name,
+		ToEmail:     to.Email,
+		Subject:     rendered.Subject,
+		Locale:      rendered.Locale,
+		Body:        rendered.HTML,
+		TextBody:    rendered.Text,
+		MaxAttempts: q.cfg.Retry.MaxAttempts,
+		// Mail clients POST to it to unsubscribe, as in RFC 8058
+		UnsubscribeURL: to.UnsubscribeURL,
+	}
+	if dedupKey != "" {
+		email.DedupKey = &dedupKey
+	}
+
+	return email, nil
+}
+
+// Sends the due emails right away, e.g. after a composed email is queued
+func (q *Queue) Wake() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Starts sending the due emails every poll interval, and right after new
+// emails are queued
+func (q *Queue) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+	q.done = make(chan struct{})
+
+	go func() {
+		defer close(q.done)
+
+		ticker := time.NewTicker(q.cfg.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			// In flight emails are bounded by the timeout, they aren't
+			// cancelled on stop. Keep going while there are emails left.
+			if q.SendDue(context.Background()) > 0 && ctx.Err() == nil {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-q.wake:
+			}
+		}
+	}()
+}
+
+// Stops sending the emails, waiting for the in flight ones or until ctx
+// expires. The queued emails are sent once the queue is started again.
+func (q *Queue) Stop(ctx context.Context) error {
+	if q.cancel == nil {
+		return nil
+	}
+	q.cancel()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("mail queue did not stop: %w", ctx.Err())
+	}
+}
+
+// Sends a batch of the due emails, returning how many were claimed
+func (q *Queue) SendDue(ctx context.Context) int {
+	// Emails not recorded within the lease are sent again
+	lease := 2*q.cfg.Timeout + time.Minute
+
+	emails, err := q.store.Emails.Claim(ctx, q.cfg.Workers, lease)
+	if err != nil {
+		q.logger.Errorw("error claiming emails", "error", err)
+		return 0
+	}
+
+	var wg sync.WaitGroup
+	for _, email := range emails {
+		wg.Add(1)
+		go func(email *model.Email) {
+			defer wg.Done()
+			q.send(ctx, email)
+		}(email)
+	}
+	wg.Wait()
+
+	return len(emails)
+}
+
+func (q *Queue) send(ctx context.Context, email *model.Email) {
+	if q.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.cfg.Timeout)
+		defer cancel()
+	}
+
+	err := q.client.Send(ctx, email)
+
+	recordCtx, cancel := context.WithTimeout(context.Background(), store.QueryTimeoutDuration)
+	defer cancel()
+
+	if err == nil {
+		if err := q.store.Emails.MarkSent(recordCtx, email.Id); err != nil {
+			q.logger.Errorw("error recording sent email", "email_id", email.Id, "error", err)
+		}
+		q.logger.Infow("email sent", "email_id", email.Id, "template", email.Template, "to", email.ToEmail)
+		return
+	}
+
+	email.LastError = err.Error()
+	final := email.Attempts >= email.MaxAttempts
+	retryIn := q.cfg.Retry.Backoff(email.Attempts)
+
+	if err := q.store.Emails.MarkFailed(recordCtx, email, retryIn, final); err != nil {
+		q.logger.Errorw("error recording failed email", "email_id", email.Id, "error", err)
+		return
+	}
+
+	if final {
+		q.logger.Errorw("giving up on email", "email_id", email.Id, "template", email.Template, "to", email.ToEmail, "attempts", email.Attempts, "error", email.LastError)
+	} else {
+		q.logger.Warnw("email failed, retrying", "email_id", email.Id, "template", email.Template, "attempt", email.Attempts, "retry_in", retryIn.String(), "error", email.LastError)
+	}
+}
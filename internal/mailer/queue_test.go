@@ -0,0 +1,159 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/retry"
+	"github.com/dottox/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// fakeEmailStore stores the queued emails in memory and records their outcome
+type fakeEmailStore struct {
+	store.MockEmailStore
+
+	queued  []*model.Email
+	keys    map[string]bool
+	sent    []uint64
+	failed  []*model.Email
+	retryIn time.Duration
+	final   bool
+}
+
+func (f *fakeEmailStore) Enqueue(ctx context.Context, email *model.Email) (bool, error) {
+	if email.DedupKey != nil {
+		if f.keys[*email.DedupKey] {
+			return false, nil
+		}
+		f.keys[*email.DedupKey] = true
+	}
+
+	email.Id = uint64(len(f.queued) + 1)
+	f.queued = append(f.queued, email)
+	return true, nil
+}
+
+func (f *fakeEmailStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]*model.Email, error) {
+	claimed := f.queued[:min(limit, len(f.queued))]
+	f.queued = f.queued[len(claimed):]
+
+	for _, email := range claimed {
+		email.Attempts++
+	}
+	return claimed, nil
+}
+
+func (f *fakeEmailStore) MarkSent(ctx context.Context, id uint64) error {
+	f.sent = append(f.sent, id)
+	return nil
+}
+
+func (f *fakeEmailStore) MarkFailed(ctx context.Context, email *model.Email, retryIn time.Duration, final bool) error {
+	f.failed = append(f.failed, email)
+	f.retryIn = retryIn
+	f.final = final
+	return nil
+}
+
+func newTestQueue(t *testing.T, maxAttempts int) (*Queue, *fakeEmailStore, *MockClient) {
+	t.Helper()
+
+	templates, err := ParseTemplates(FS, DefaultLocale)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeEmailStore{keys: map[string]bool{}}
+	client := NewMockClient()
+	cfg := Config{
+		Workers: 4,
+		Retry:   retry.Config{MaxAttempts: maxAttempts, BackoffBase: time.Second, BackoffMax: time.Minute},
+	}
+
+	return NewQueue(cfg, client, templates, store.Storage{Emails: fake}, zap.NewNop().Sugar()), fake, client
+}
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+	vars := struct {
+		Username      string
+		ActivationURL string
+	}{"gopher", "http://localhost:4000/confirm/token"}
+	gopher := Recipient{Name: "gopher", Email: "gopher@example.com"}
+
+	t.Run("should render and send the queued emails", func(t *testing.T) {
+		q, fake, client := newTestQueue(t, 3)
+
+		if _, err := q.Enqueue(ctx, UserWelcomeTemplate, gopher, vars, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		if sent := q.SendDue(ctx); sent != 1 {
+			t.Fatalf("expected 1 email claimed; got %d", sent)
+		}
+
+		if len(client.Sent) != 1 || len(fake.sent) != 1 {
+			t.Fatalf("expected the email to be sent")
+		}
+
+		email := client.Sent[0]
+		if email.ToEmail != "gopher@example.com" || !strings.Contains(email.Subject, "Gopher Social") || !strings.Contains(email.Body, vars.ActivationURL) {
+			t.Errorf("unexpected email %+v", email)
+		}
+	})
+
+	t.Run("should queue the emails with the same key once", func(t *testing.T) {
+		q, _, _ := newTestQueue(t, 3)
+
+		for i, expected := range []bool{true, false} {
+			queued, err := q.Enqueue(ctx, UserWelcomeTemplate, gopher, vars, "welcome:1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if queued != expected {
+				t.Errorf("enqueue %d: expected %t; got %t", i, expected, queued)
+			}
+		}
+	})
+
+	t.Run("should fail on an unknown template", func(t *testing.T) {
+		q, _, _ := newTestQueue(t, 3)
+
+		if _, err := q.Enqueue(ctx, "missing.tmpl", gopher, vars, ""); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("should retry the failed emails with backoff", func(t *testing.T) {
+		q, fake, client := newTestQueue(t, 3)
+		client.Err = errors.New("unavailable")
+
+		q.Enqueue(ctx, UserWelcomeTemplate, gopher, vars, "")
+		fake.queued[0].Attempts = 1
+		q.SendDue(ctx)
+
+		if len(fake.failed) != 1 || fake.final || fake.retryIn != 2*time.Second {
+			t.Errorf("expected a retry in 2s; got %s final %t", fake.retryIn, fake.final)
+		}
+		if fake.failed[0].LastError != "unavailable" {
+			t.Errorf("unexpected error %q", fake.failed[0].LastError)
+		}
+	})
+
+	t.Run("should give up on the emails out of attempts", func(t *testing.T) {
+		q, fake, client := newTestQueue(t, 1)
+		client.Err = errors.New("unavailable")
+
+		q.Enqueue(ctx, UserWelcomeTemplate, gopher, vars, "")
+		q.SendDue(ctx)
+
+		if !fake.final {
+			t.Error("expected the email to be failed")
+		}
+	})
+}
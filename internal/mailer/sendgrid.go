@@ -1,12 +1,10 @@
 package mailer
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"html/template"
-	"log"
-	"time"
 
+	"github.com/dottox/social/internal/model"
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 )
@@ -14,65 +12,46 @@ import (
 type SendGridMailer struct {
 	fromEmail string
 	apiKey    string
+	sandbox   bool
 	client    *sendgrid.Client
 }
 
-func NewSendGridMailer(apiKey, fromEmail string) *SendGridMailer {
+// Creates a SendGrid client. In sandbox mode SendGrid validates the emails
+// without delivering them.
+func NewSendGridMailer(apiKey, fromEmail string, sandbox bool) *SendGridMailer {
 	client := sendgrid.NewSendClient(apiKey)
 
 	return &SendGridMailer{
 		fromEmail: fromEmail,
 		apiKey:    apiKey,
+		sandbox:   sandbox,
 		client:    client,
 	}
 }
 
-// Sends an email using SendGrid with the specified template and data.
-// Data is used to populate the template.
-func (m *SendGridMailer) Send(templateFile, username, email string, data any, isSandbox bool) error {
+// Sends the email using SendGrid. Any response other than 2xx is an error.
+func (m *SendGridMailer) Send(ctx context.Context, email *model.Email) error {
 	from := mail.NewEmail(FromName, m.fromEmail)
-	to := mail.NewEmail(username, email)
+	to := mail.NewEmail(email.ToName, email.ToEmail)
 
-	fmt.Printf("Sending email to %s <%s> from %s using template %s\n", username, email, m.fromEmail, templateFile)
-
-	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
-	if err != nil {
-		return fmt.Errorf("failed to parse email template: %w", err)
-	}
-
-	subject := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(subject, "subject", data)
-	if err != nil {
-		return fmt.Errorf("failed to execute subject template: %w", err)
+	message := mail.NewSingleEmail(from, email.Subject, to, textBody(email), email.Body)
+	if email.UnsubscribeURL != "" {
+		message.Personalizations[0].SetHeader("List-Unsubscribe", "<"+email.UnsubscribeURL+">")
+		message.Personalizations[0].SetHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
 	}
 
-	body := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(body, "body", data)
-	if err != nil {
-		return fmt.Errorf("failed to execute body template: %w", err)
-	}
-
-	message := mail.NewSingleEmail(from, subject.String(), to, "", body.String())
-
 	message.SetMailSettings(&mail.MailSettings{
-		SandboxMode: &mail.Setting{Enable: &isSandbox},
+		SandboxMode: &mail.Setting{Enable: &m.sandbox},
 	})
 
-	for i := 0; i < MAX_RETRIES; i++ {
-		response, err := m.client.Send(message)
-		if err != nil {
-			log.Printf("Failed to send email to %v, attempt %d/%d: %v", email, i+1, MAX_RETRIES, err)
-			time.Sleep(time.Second * time.Duration(i+1))
-			continue
-		}
+	response, err := m.client.SendWithContext(ctx, message)
+	if err != nil {
+		return fmt.Errorf("failed to send email to %v: %w", email.ToEmail, err)
+	}
 
-		log.Printf("Email sent to %v with status code %d", email, response.StatusCode)
-		if response.StatusCode >= 200 && response.StatusCode < 300 {
-			return nil
-		} else {
-			return fmt.Errorf("failed to sent email to %v with status code %d", email, response.StatusCode)
-		}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("failed to send email to %v with status code %d: %s", email.ToEmail, response.StatusCode, response.Body)
 	}
 
-	return fmt.Errorf("failed to send email to %v after %d attempts", email, MAX_RETRIES)
+	return nil
 }
@@ -0,0 +1,206 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+)
+
+// Security of the connection to the SMTP server
+const (
+	// Upgrades the plain connection with STARTTLS, failing when the server
+	// doesn't support it
+	SMTPStartTLS = "starttls"
+	// Connects with TLS from the start, usually on port 465
+	SMTPTLS = "tls"
+	// Plain connection, only meant for local stand-ins like MailHog
+	SMTPNone = "none"
+)
+
+// Authentication mechanisms, no authentication when empty
+const (
+	SMTPAuthPlain = "plain"
+	SMTPAuthLogin = "login"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Security string
+	Auth     string
+	// Max time to connect and deliver the email when the context has no
+	// deadline
+	Timeout time.Duration
+}
+
+type SMTPMailer struct {
+	cfg       SMTPConfig
+	fromEmail string
+}
+
+func NewSMTPMailer(cfg SMTPConfig, fromEmail string) (*SMTPMailer, error) {
+	switch cfg.Security {
+	case SMTPStartTLS, SMTPTLS, SMTPNone:
+	default:
+		return nil, fmt.Errorf("unknown smtp security %q", cfg.Security)
+	}
+
+	switch cfg.Auth {
+	case "", SMTPAuthPlain, SMTPAuthLogin:
+	default:
+		return nil, fmt.Errorf("unknown smtp auth %q", cfg.Auth)
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+
+	return &SMTPMailer{cfg: cfg, fromEmail: fromEmail}, nil
+}
+
+// Sends the email to the SMTP server as a multipart message with the HTML
+// body and its plain text version
+func (m *SMTPMailer) Send(ctx context.Context, email *model.Email) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.cfg.Timeout)
+		defer cancel()
+	}
+
+	msg, err := buildMessage(FromName, m.fromEmail, email, time.Now())
+	if err != nil {
+		return err
+	}
+
+	client, err := m.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	defer client.Close()
+
+	if err := m.deliver(client, email.ToEmail, msg); err != nil {
+		return fmt.Errorf("failed to send email to %v: %w", email.ToEmail, err)
+	}
+
+	return nil
+}
+
+func (m *SMTPMailer) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: m.cfg.Host}
+
+	var conn net.Conn
+	var err error
+	if m.cfg.Security == SMTPTLS {
+		dialer := &tls.Dialer{Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		dialer := &net.Dialer{}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The whole conversation is bound by the context
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if m.cfg.Security == SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, errors.New("server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+func (m *SMTPMailer) deliver(client *smtp.Client, to string, msg []byte) error {
+	switch m.cfg.Auth {
+	case SMTPAuthPlain:
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return err
+		}
+	case SMTPAuthLogin:
+		if err := client.Auth(&loginAuth{m.cfg.Username, m.cfg.Password, m.cfg.Host}); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(m.fromEmail); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// loginAuth implements the LOGIN mechanism, which net/smtp doesn't provide.
+// Like PLAIN, credentials are only sent over TLS or to localhost.
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch string(fromServer) {
+	case "Username:", "User Name\x00":
+		return []byte(a.username), nil
+	case "Password:", "Password\x00":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge %q", fromServer)
+	}
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
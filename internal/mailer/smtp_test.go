@@ -0,0 +1,198 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+)
+
+// smtpStandIn is a minimal SMTP server keeping the credentials and the data
+// of the last email
+type smtpStandIn struct {
+	listener    net.Listener
+	credentials chan []string
+	data        chan string
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &smtpStandIn{
+		listener:    listener,
+		credentials: make(chan []string, 1),
+		data:        make(chan string, 1),
+	}
+	go s.serve()
+
+	return s
+}
+
+func (s *smtpStandIn) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStandIn) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	read := func() string {
+		line, _ := r.ReadString('\n')
+		return strings.TrimRight(line, "\r\n")
+	}
+	decode := func(s string) string {
+		b, _ := base64.StdEncoding.DecodeString(s)
+		return string(b)
+	}
+
+	reply("220 localhost ESMTP")
+	for {
+		line := read()
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250-localhost")
+			reply("250 AUTH PLAIN LOGIN")
+		case strings.HasPrefix(cmd, "AUTH PLAIN "):
+			s.credentials <- strings.Split(decode(line[len("AUTH PLAIN "):]), "\x00")
+			reply("235 2.7.0 Authentication successful")
+		case strings.HasPrefix(cmd, "AUTH LOGIN"):
+			reply("334 " + base64.StdEncoding.EncodeToString([]byte("Username:")))
+			username := decode(read())
+			reply("334 " + base64.StdEncoding.EncodeToString([]byte("Password:")))
+			s.credentials <- []string{username, decode(read())}
+			reply("235 2.7.0 Authentication successful")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for line := read(); line != "."; line = read() {
+				data.WriteString(line + "\n")
+			}
+			s.data <- data.String()
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 Bye")
+			return
+		case line == "":
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	email := &model.Email{
+		ToName:  "Gopher",
+		ToEmail: "gopher@example.com",
+		Subject: "Welcome to Gopher Social",
+		Body:    `<p>Hi Gopher,</p><p><a href="http://localhost:4000/confirm/token">Activate your account</a></p>`,
+
+		UnsubscribeURL: "http://localhost:4000/unsubscribe?token=abc",
+	}
+
+	for _, auth := range []string{SMTPAuthPlain, SMTPAuthLogin} {
+		t.Run("should send the email with "+auth+" auth", func(t *testing.T) {
+			server := newSMTPStandIn(t)
+
+			m, err := NewSMTPMailer(SMTPConfig{
+				Host:     "localhost",
+				Port:     server.port(),
+				Username: "user",
+				Password: "secret",
+				Security: SMTPNone,
+				Auth:     auth,
+			}, "noreply@gophersocial.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := m.Send(ctx, email); err != nil {
+				t.Fatal(err)
+			}
+
+			credentials := <-server.credentials
+			// PLAIN sends an empty identity first
+			if got := strings.TrimPrefix(strings.Join(credentials, ":"), ":"); got != "user:secret" {
+				t.Errorf("unexpected credentials %q", credentials)
+			}
+
+			data := <-server.data
+			for _, expected := range []string{
+				"To: \"Gopher\" <gopher@example.com>",
+				"Subject: Welcome to Gopher Social",
+				"Content-Type: multipart/alternative",
+				"Content-Type: text/plain; charset=utf-8",
+				"Activate your account (http://localhost:4000/confirm/token)",
+				"Content-Type: text/html; charset=utf-8",
+				"List-Unsubscribe: <http://localhost:4000/unsubscribe?token=abc>",
+				"List-Unsubscribe-Post: List-Unsubscribe=One-Click",
+			} {
+				if !strings.Contains(data, expected) {
+					t.Errorf("expected %q in the message:\n%s", expected, data)
+				}
+			}
+		})
+	}
+
+	t.Run("should refuse to send credentials over a plain connection to a remote host", func(t *testing.T) {
+		auth := &loginAuth{"user", "secret", "mail.example.com"}
+
+		if _, _, err := auth.Start(&smtp.ServerInfo{Name: "mail.example.com", TLS: false}); err == nil {
+			t.Error("expected an error")
+		}
+		if _, _, err := auth.Start(&smtp.ServerInfo{Name: "mail.example.com", TLS: true}); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("should reject an unknown security", func(t *testing.T) {
+		if _, err := NewSMTPMailer(SMTPConfig{Security: "ssl", Port: 25}, ""); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("should fail when the server doesn't support STARTTLS", func(t *testing.T) {
+		server := newSMTPStandIn(t)
+
+		m, _ := NewSMTPMailer(SMTPConfig{Host: "localhost", Port: server.port(), Security: SMTPStartTLS}, "noreply@gophersocial.com")
+		if err := m.Send(context.Background(), email); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+			t.Errorf("expected a STARTTLS error; got %v", err)
+		}
+	})
+}
+
+func TestPlainText(t *testing.T) {
+	body := `<!doctype html><html><head><title>Ignored</title><style>p { color: red }</style></head>
+	<body>
+		<p>Hi   gopher,</p>
+		<p>Click <a href="http://localhost/confirm">here</a> or open <a href="http://localhost/x">http://localhost/x</a></p>
+		<ul><li>one</li><li>two</li></ul>
+		<p>Best regards,<br>The Team</p>
+	</body></html>`
+
+	expected := "Hi gopher,\n\nClick here (http://localhost/confirm) or open http://localhost/x\n\n- one\n- two\n\nBest regards,\nThe Team\n"
+	if got := PlainText(body); got != expected {
+		t.Errorf("expected %q; got %q", expected, got)
+	}
+}
@@ -0,0 +1,173 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Locale of the templates used when there is none for the recipient's
+const DefaultLocale = "en"
+
+const layoutFile = "templates/layout.tmpl"
+
+// Templates holds the email templates, parsed once. Each locale has its own
+// directory under templates/ with a variant of the templates, e.g.
+// templates/es/user_invitation.tmpl. A template defines its "subject" and
+// the "body" of the shared layout, and optionally the "text" of the plain
+// text part, which is generated from the HTML otherwise.
+type Templates struct {
+	defaultLocale string
+	// Locale and then template name
+	sets map[string]map[string]*templateSet
+}
+
+type templateSet struct {
+	html *htmltemplate.Template
+	// Subject and text, which aren't HTML escaped
+	text *texttemplate.Template
+}
+
+// Rendered is a template rendered with its data
+type Rendered struct {
+	Locale  string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Parses the templates of every locale in the directory with the layout.
+// Every template must define its subject and body, and have a variant in the
+// default locale to fall back on.
+func ParseTemplates(fsys fs.FS, defaultLocale string) (*Templates, error) {
+	locales, err := fs.ReadDir(fsys, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	defaultLocale = normalizeLocale(defaultLocale)
+	t := &Templates{
+		defaultLocale: defaultLocale,
+		sets:          map[string]map[string]*templateSet{},
+	}
+
+	for _, locale := range locales {
+		if !locale.IsDir() {
+			continue
+		}
+
+		files, err := fs.Glob(fsys, path.Join("templates", locale.Name(), "*.tmpl"))
+		if err != nil {
+			return nil, err
+		}
+
+		sets := map[string]*templateSet{}
+		for _, file := range files {
+			set, err := parseTemplate(fsys, locale.Name(), file)
+			if err != nil {
+				return nil, err
+			}
+			sets[path.Base(file)] = set
+		}
+		t.sets[normalizeLocale(locale.Name())] = sets
+	}
+
+	defaults, ok := t.sets[defaultLocale]
+	if !ok {
+		return nil, fmt.Errorf("no templates for the default locale %q", defaultLocale)
+	}
+	for locale, sets := range t.sets {
+		for name := range sets {
+			if _, ok := defaults[name]; !ok {
+				return nil, fmt.Errorf("template %s/%s has no %s variant", locale, name, defaultLocale)
+			}
+		}
+	}
+
+	return t, nil
+}
+
+func parseTemplate(fsys fs.FS, locale, file string) (*templateSet, error) {
+	funcs := map[string]any{
+		"locale": func() string { return locale },
+	}
+
+	html, err := htmltemplate.New(path.Base(file)).Funcs(funcs).ParseFS(fsys, layoutFile, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email template %s: %w", file, err)
+	}
+
+	text, err := texttemplate.New(path.Base(file)).Funcs(funcs).ParseFS(fsys, layoutFile, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email template %s: %w", file, err)
+	}
+
+	for _, name := range []string{"subject", "body"} {
+		if html.Lookup(name) == nil {
+			return nil, fmt.Errorf("email template %s does not define %q", file, name)
+		}
+	}
+
+	return &templateSet{html: html, text: text}, nil
+}
+
+// Renders the template in the locale, or in the locale's language or the
+// default locale when there is no variant for it, e.g. es-AR falls back on
+// es and then on en.
+func (t *Templates) Render(name, locale string, data any) (*Rendered, error) {
+	locale = t.resolve(name, locale)
+	if locale == "" {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+	set := t.sets[locale][name]
+
+	subject := new(bytes.Buffer)
+	if err := set.text.ExecuteTemplate(subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to execute subject template: %w", err)
+	}
+
+	body := new(bytes.Buffer)
+	if err := set.html.ExecuteTemplate(body, "layout", data); err != nil {
+		return nil, fmt.Errorf("failed to execute body template: %w", err)
+	}
+
+	text := new(bytes.Buffer)
+	if set.text.Lookup("text") != nil {
+		if err := set.text.ExecuteTemplate(text, "layout_text", data); err != nil {
+			return nil, fmt.Errorf("failed to execute text template: %w", err)
+		}
+	} else {
+		text.WriteString(PlainText(body.String()))
+	}
+
+	return &Rendered{
+		Locale:  locale,
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    body.String(),
+		Text:    text.String(),
+	}, nil
+}
+
+// Returns the locale with a variant of the template to render, empty when
+// there is no such template
+func (t *Templates) resolve(name, locale string) string {
+	locale = normalizeLocale(locale)
+	language, _, _ := strings.Cut(locale, "-")
+
+	for _, l := range []string{locale, language, t.defaultLocale} {
+		if _, ok := t.sets[l][name]; ok {
+			return l
+		}
+	}
+
+	return ""
+}
+
+// Lowercases the locale and separates its parts with "-", e.g. es_AR is es-ar
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
@@ -0,0 +1,161 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestTemplates(t *testing.T) {
+	templates, err := ParseTemplates(FS, DefaultLocale)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := struct {
+		Username      string
+		ActivationURL string
+	}{"gopher & co", "http://localhost:4000/activate?token=abc"}
+
+	t.Run("should render the template in the locale", func(t *testing.T) {
+		tests := []struct {
+			locale   string
+			expected string
+			subject  string
+		}{
+			{"en", "en", "Finish setting up your account"},
+			{"es", "es", "Terminá de configurar tu cuenta"},
+			{"es-AR", "es", "Terminá de configurar tu cuenta"},
+			{"es_ar", "es", "Terminá de configurar tu cuenta"},
+			{"fr", "en", "Finish setting up your account"},
+			{"", "en", "Finish setting up your account"},
+		}
+
+		for _, tt := range tests {
+			rendered, err := templates.Render(UserWelcomeTemplate, tt.locale, vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rendered.Locale != tt.expected || !strings.HasPrefix(rendered.Subject, tt.subject) {
+				t.Errorf("%s: expected the %s variant; got %s %q", tt.locale, tt.expected, rendered.Locale, rendered.Subject)
+			}
+		}
+	})
+
+	t.Run("should render the layout and the text part", func(t *testing.T) {
+		rendered, err := templates.Render(UserWelcomeTemplate, "en", vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(rendered.HTML, `<html lang="en">`) || !strings.Contains(rendered.HTML, "Hi gopher &amp; co,") {
+			t.Errorf("unexpected html %s", rendered.HTML)
+		}
+
+		// The plain text isn't escaped
+		if !strings.HasPrefix(rendered.Text, "Hi gopher & co,") || !strings.Contains(rendered.Text, "\n"+vars.ActivationURL+"\n") {
+			t.Errorf("unexpected text %q", rendered.Text)
+		}
+	})
+
+	t.Run("should render the notifications in the locale", func(t *testing.T) {
+		type item struct {
+			Kind   string
+			Actor  string
+			Others int
+		}
+
+		tests := []struct {
+			locale  string
+			item    item
+			subject string
+		}{
+			{"en", item{"follow", "alice", 0}, "alice followed you"},
+			{"en", item{"reaction", "alice", 3}, "alice and 3 others reacted to your post"},
+			{"en", item{"mention", "", 0}, "Someone mentioned you"},
+			{"es", item{"comment", "alice", 0}, "alice comentó tu publicación"},
+			{"es", item{"comment", "alice", 1}, "alice y 1 persona más comentaron tu publicación"},
+		}
+
+		for _, tt := range tests {
+			rendered, err := templates.Render(NotificationTemplate, tt.locale, struct {
+				Username       string
+				Item           item
+				UnsubscribeURL string
+			}{"gopher", tt.item, "http://localhost:4000/unsubscribe?token=abc"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rendered.Subject != tt.subject {
+				t.Errorf("expected %q; got %q", tt.subject, rendered.Subject)
+			}
+		}
+	})
+
+	t.Run("should fail on an unknown template", func(t *testing.T) {
+		if _, err := templates.Render("missing.tmpl", "en", vars); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("should generate the text part when not defined", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"templates/layout.tmpl":   embeddedFile(t, layoutFile),
+			"templates/en/hello.tmpl": {Data: []byte(`{{define "subject"}}Hello{{end}}{{define "body"}}<p>Hello <a href="http://localhost">there</a></p>{{end}}`)},
+		}
+
+		templates, err := ParseTemplates(fsys, "en")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rendered, err := templates.Render("hello.tmpl", "en", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(rendered.Text, "Hello there (http://localhost)") {
+			t.Errorf("unexpected text %q", rendered.Text)
+		}
+	})
+
+	t.Run("should reject invalid templates", func(t *testing.T) {
+		tests := map[string]fstest.MapFS{
+			"missing body": {
+				"templates/en/hello.tmpl": {Data: []byte(`{{define "subject"}}Hello{{end}}`)},
+			},
+			"missing default variant": {
+				"templates/en/hello.tmpl": {Data: []byte(`{{define "subject"}}Hello{{end}}{{define "body"}}Hello{{end}}`)},
+				"templates/es/bye.tmpl":   {Data: []byte(`{{define "subject"}}Chau{{end}}{{define "body"}}Chau{{end}}`)},
+			},
+			"missing default locale": {
+				"templates/es/hello.tmpl": {Data: []byte(`{{define "subject"}}Hola{{end}}{{define "body"}}Hola{{end}}`)},
+			},
+			"syntax error": {
+				"templates/en/hello.tmpl": {Data: []byte(`{{define "subject"}}Hello{{end}}{{define "body"}}{{.Name}{{end}}`)},
+			},
+		}
+
+		for name, fsys := range tests {
+			fsys["templates/layout.tmpl"] = embeddedFile(t, layoutFile)
+
+			if _, err := ParseTemplates(fsys, "en"); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+	})
+}
+
+// Returns the embedded file to use in a test file system
+func embeddedFile(t *testing.T, name string) *fstest.MapFile {
+	t.Helper()
+
+	data, err := FS.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &fstest.MapFile{Data: data}
+}
@@ -0,0 +1,84 @@
+package mailer
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	spaces     = regexp.MustCompile(`[ \t\r\n]+`)
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// Elements whose content isn't shown
+var hiddenElements = map[string]bool{"head": true, "script": true, "style": true, "title": true}
+
+// Elements set apart by blank lines
+var blockElements = map[string]bool{
+	"p": true, "div": true, "table": true, "tr": true, "ul": true, "ol": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "blockquote": true,
+}
+
+// Returns the plain text version of the HTML body, keeping the paragraphs and
+// the targets of the links
+func PlainText(body string) string {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return body
+	}
+
+	sb := new(strings.Builder)
+	writeText(sb, doc)
+
+	lines := strings.Split(sb.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+
+	text := blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text) + "\n"
+}
+
+func writeText(sb *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		sb.WriteString(spaces.ReplaceAllString(n.Data, " "))
+		return
+	case html.ElementNode:
+		if hiddenElements[n.Data] {
+			return
+		}
+		if n.Data == "br" {
+			sb.WriteString("\n")
+			return
+		}
+	}
+
+	block := n.Type == html.ElementNode && blockElements[n.Data]
+	if block {
+		sb.WriteString("\n\n")
+	}
+	if n.Type == html.ElementNode && n.Data == "li" {
+		sb.WriteString("\n- ")
+	}
+
+	start := sb.Len()
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeText(sb, c)
+	}
+
+	// Links show their target unless it's already their text
+	if n.Type == html.ElementNode && n.Data == "a" {
+		for _, attr := range n.Attr {
+			if attr.Key == "href" && strings.TrimSpace(sb.String()[start:]) != attr.Val {
+				sb.WriteString(" (" + attr.Val + ")")
+			}
+		}
+	}
+
+	if block {
+		sb.WriteString("\n\n")
+	}
+}
@@ -0,0 +1,7 @@
+package model
+
+type Block struct {
+	BlockerId uint32 `json:"blocker_id"`
+	BlockedId uint32 `json:"blocked_id"`
+	CreatedAt string `json:"created_at"`
+}
@@ -11,11 +11,12 @@ CREATE TABLE IF NOT EXISTS comments (
 */
 
 type Comment struct {
-	Id        uint32 `json:"id"`
-	UserId    uint32 `json:"user_id"`
-	PostId    uint32 `json:"post_id"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
+	Id        uint32   `json:"id"`
+	UserId    uint32   `json:"user_id"`
+	PostId    uint32   `json:"post_id"`
+	Content   string   `json:"content"`
+	CreatedAt string   `json:"created_at"`
+	Entities  Entities `json:"entities"`
 }
 
 type CreateCommentPayload struct {
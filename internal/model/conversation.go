@@ -0,0 +1,61 @@
+package model
+
+// Max number of members of a group conversation, including the creator
+const MaxConversationMembers = 10
+
+type Conversation struct {
+	Id          uint32                `json:"id"`
+	CreatorId   uint32                `json:"creator_id"`
+	Title       string                `json:"title"`
+	IsGroup     bool                  `json:"is_group"`
+	Members     []*ConversationMember `json:"members"`
+	LastMessage *Message              `json:"last_message,omitempty"`
+	UnreadCount int                   `json:"unread_count"` // messages of the others the caller didn't read
+	CreatedAt   string                `json:"created_at"`
+	UpdatedAt   string                `json:"updated_at"` // time of the last message
+}
+
+// ConversationMember is a member of a conversation with its read receipt
+type ConversationMember struct {
+	UserId            uint32  `json:"user_id"`
+	Username          string  `json:"username"`
+	LastReadMessageId uint32  `json:"last_read_message_id"`
+	LastReadAt        *string `json:"last_read_at"`
+	JoinedAt          string  `json:"joined_at"`
+}
+
+type Message struct {
+	Id             uint32 `json:"id"`
+	ConversationId uint32 `json:"conversation_id"`
+	SenderId       uint32 `json:"sender_id"`
+	Content        string `json:"content"`
+	CreatedAt      string `json:"created_at"`
+}
+
+// ReadReceipt tells the members of a conversation a user read its messages
+type ReadReceipt struct {
+	ConversationId    uint32 `json:"conversation_id"`
+	UserId            uint32 `json:"user_id"`
+	LastReadMessageId uint32 `json:"last_read_message_id"`
+}
+
+type ConversationList struct {
+	Conversations []*Conversation `json:"conversations"`
+	UnreadCount   int             `json:"unread_count"` // unread messages across every conversation
+}
+
+// Starts a direct conversation with one user, or a group with several
+type CreateConversationPayload struct {
+	UserIds []uint32 `json:"user_ids" validate:"required,min=1,max=9,dive,gt=0"`
+	Title   string   `json:"title" validate:"max=100"`
+}
+
+type SendMessagePayload struct {
+	Content string `json:"content" validate:"required,max=2000"`
+}
+
+// Messaging settings of a user
+type MessagingSettings struct {
+	// Only the users followed by the user can start a conversation with them
+	FollowingOnly bool `json:"following_only"`
+}
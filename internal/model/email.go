@@ -0,0 +1,33 @@
+package model
+
+// Status of a queued email
+const (
+	EmailQueued  = "queued"
+	EmailSending = "sending"
+	EmailSent    = "sent"
+	// Ran out of attempts
+	EmailFailed = "failed"
+)
+
+// Email is a rendered email queued to be sent by the mail queue
+type Email struct {
+	Id       uint64 `json:"id"`
+	Template string `json:"template"`
+	ToName   string `json:"to_name"`
+	ToEmail  string `json:"to_email"`
+	Subject  string `json:"subject"`
+	Locale   string `json:"locale"`
+	// Left out of the responses, they can hold links with tokens of the user
+	Body     string `json:"-"`
+	TextBody string `json:"-"`
+	// One-click unsubscribe link of the recipient, if any
+	UnsubscribeURL string  `json:"-"`
+	Status         string  `json:"status"`
+	Attempts       int     `json:"attempts"`
+	MaxAttempts    int     `json:"max_attempts"`
+	SendAt         string  `json:"send_at"`
+	LastError      string  `json:"last_error"`
+	DedupKey       *string `json:"dedup_key"`
+	CreatedAt      string  `json:"created_at"`
+	SentAt         *string `json:"sent_at"`
+}
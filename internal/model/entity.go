@@ -0,0 +1,62 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	EntityMention = "mention"
+	EntityHashtag = "hashtag"
+)
+
+// Entity is a range of the content with a special meaning, like an @mention
+// or a #hashtag.
+// Start and End are offsets in Unicode code points, End is exclusive.
+type Entity struct {
+	Type   string `json:"type"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Text   string `json:"text"`              // without the @ or # prefix
+	UserId uint32 `json:"user_id,omitempty"` // the mentioned user
+}
+
+// Entities is stored as a JSONB column
+type Entities []Entity
+
+func (e Entities) Value() (driver.Value, error) {
+	if e == nil {
+		return []byte("[]"), nil
+	}
+
+	return json.Marshal(e)
+}
+
+func (e *Entities) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*e = Entities{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, e)
+	case string:
+		return json.Unmarshal([]byte(v), e)
+	default:
+		return fmt.Errorf("cannot scan %T into Entities", src)
+	}
+}
+
+// Returns the usernames mentioned, without duplicates
+func (e Entities) Mentions() []string {
+	seen := map[string]bool{}
+	usernames := []string{}
+	for _, entity := range e {
+		if entity.Type == EntityMention && !seen[entity.Text] {
+			seen[entity.Text] = true
+			usernames = append(usernames, entity.Text)
+		}
+	}
+
+	return usernames
+}
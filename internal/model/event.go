@@ -0,0 +1,60 @@
+package model
+
+import "encoding/json"
+
+// Kinds of the domain events
+const (
+	EventUserRegistered = "user.registered"
+	EventPostCreated    = "post.created"
+	EventCommentCreated = "comment.created"
+	EventUserFollowed   = "user.followed"
+	EventPostReacted    = "post.reacted"
+	EventPostUpdated    = "post.updated"
+	EventPostDeleted    = "post.deleted"
+)
+
+// DomainEvent is a state change recorded in the outbox, in the same
+// transaction as the change itself
+type DomainEvent struct {
+	Id        uint64          `json:"id"`
+	Kind      string          `json:"kind"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	Handled   []string        `json:"handled"` // subscribers that already handled it
+	LastError string          `json:"last_error"`
+	CreatedAt string          `json:"created_at"`
+}
+
+// Payloads of the domain events
+
+// The welcome email is queued with the user, so the activation token isn't
+// stored in the event
+type UserRegistered struct {
+	User *User `json:"user"`
+}
+
+type PostCreated struct {
+	Post *Post `json:"post"`
+}
+
+// The entities before the edit, so only the new mentions are notified
+type PostUpdated struct {
+	Post     *Post    `json:"post"`
+	Previous Entities `json:"previous"`
+}
+
+type PostDeleted struct {
+	PostId uint32 `json:"post_id"`
+}
+
+type CommentCreated struct {
+	Comment *Comment `json:"comment"`
+}
+
+type UserFollowed struct {
+	Follow *FollowAction `json:"follow"`
+}
+
+type PostReacted struct {
+	Reaction *Reaction `json:"reaction"`
+}
@@ -0,0 +1,27 @@
+package model
+
+import "encoding/json"
+
+// Status of a background job
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	// Ran out of attempts, kept until retried by hand
+	JobDead = "dead"
+)
+
+// Job is a unit of background work run by the job queue
+type Job struct {
+	Id          uint64          `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       string          `json:"run_at"`
+	LastError   string          `json:"last_error"`
+	UniqueKey   *string         `json:"unique_key"`
+	CreatedAt   string          `json:"created_at"`
+	FinishedAt  *string         `json:"finished_at"`
+}
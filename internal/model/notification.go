@@ -0,0 +1,107 @@
+package model
+
+import "fmt"
+
+const (
+	NotificationFollow   = "follow"
+	NotificationComment  = "comment"
+	NotificationMention  = "mention"
+	NotificationReaction = "reaction"
+)
+
+// Notification groups the similar unread events of a user, like all the
+// reactions to one of their posts
+type Notification struct {
+	Id          uint32   `json:"id"`
+	UserId      uint32   `json:"user_id"`
+	Kind        string   `json:"kind"`
+	PostId      *uint32  `json:"post_id,omitempty"`
+	ActorIds    []uint32 `json:"actor_ids"` // most recent first
+	ActorsCount int      `json:"actors_count"`
+	Summary     string   `json:"summary"`
+	Read        bool     `json:"read"`
+	CreatedAt   string   `json:"created_at"`
+	UpdatedAt   string   `json:"updated_at"`
+	// Usernames of the most recent actors, as used in the summary
+	ActorNames []string `json:"-"`
+}
+
+// NotificationEvent is a single event added to a notification group
+type NotificationEvent struct {
+	UserId  uint32  `json:"user_id"`
+	Kind    string  `json:"kind"`
+	PostId  *uint32 `json:"post_id,omitempty"`
+	ActorId uint32  `json:"actor_id"`
+}
+
+type NotificationList struct {
+	Notifications []*Notification `json:"notifications"`
+	UnreadCount   int             `json:"unread_count"`
+}
+
+// Builds the summary from the usernames of the most recent actors,
+// like "alice and 3 others reacted to your post"
+func (n *Notification) SetSummary(usernames []string) {
+	n.ActorNames = usernames
+
+	var actors string
+	switch {
+	case len(usernames) == 0:
+		actors = "Someone"
+	case n.ActorsCount <= 1:
+		actors = usernames[0]
+	case n.ActorsCount == 2 && len(usernames) >= 2:
+		actors = fmt.Sprintf("%s and %s", usernames[0], usernames[1])
+	case n.ActorsCount == 2:
+		actors = fmt.Sprintf("%s and 1 other", usernames[0])
+	default:
+		actors = fmt.Sprintf("%s and %d others", usernames[0], n.ActorsCount-1)
+	}
+
+	switch n.Kind {
+	case NotificationFollow:
+		n.Summary = actors + " followed you"
+	case NotificationComment:
+		n.Summary = actors + " commented on your post"
+	case NotificationMention:
+		n.Summary = actors + " mentioned you"
+	case NotificationReaction:
+		n.Summary = actors + " reacted to your post"
+	default:
+		n.Summary = actors
+	}
+}
+
+// How often a kind of notification is emailed
+const (
+	EmailImmediate = "immediate"
+	EmailDaily     = "daily"
+	EmailWeekly    = "weekly"
+	EmailOff       = "off"
+)
+
+// EmailPreferences sets how often each kind of notification is emailed to
+// the user. Daily and weekly notifications are sent together in a digest of
+// the unread ones.
+type EmailPreferences struct {
+	Follow   string `json:"follow" validate:"required,oneof=immediate daily weekly off"`
+	Comment  string `json:"comment" validate:"required,oneof=immediate daily weekly off"`
+	Mention  string `json:"mention" validate:"required,oneof=immediate daily weekly off"`
+	Reaction string `json:"reaction" validate:"required,oneof=immediate daily weekly off"`
+}
+
+// Returns how often the kind of notification is emailed
+func (p *EmailPreferences) Frequency(kind string) string {
+	switch kind {
+	case NotificationFollow:
+		return p.Follow
+	case NotificationComment:
+		return p.Comment
+	case NotificationMention:
+		return p.Mention
+	case NotificationReaction:
+		return p.Reaction
+	default:
+		return EmailOff
+	}
+}
@@ -0,0 +1,27 @@
+package model
+
+import "testing"
+
+func TestNotificationSummary(t *testing.T) {
+	tests := []struct {
+		kind      string
+		count     int
+		usernames []string
+		want      string
+	}{
+		{NotificationFollow, 1, []string{"alice"}, "alice followed you"},
+		{NotificationReaction, 2, []string{"alice", "bob"}, "alice and bob reacted to your post"},
+		{NotificationComment, 4, []string{"alice", "bob"}, "alice and 3 others commented on your post"},
+		{NotificationMention, 2, []string{"alice"}, "alice and 1 other mentioned you"},
+		{NotificationFollow, 1, []string{}, "Someone followed you"},
+	}
+
+	for _, tt := range tests {
+		n := &Notification{Kind: tt.kind, ActorsCount: tt.count}
+		n.SetSummary(tt.usernames)
+
+		if n.Summary != tt.want {
+			t.Errorf("got %q, want %q", n.Summary, tt.want)
+		}
+	}
+}
@@ -1,21 +1,25 @@
 package model
 
 type Post struct {
-	Id            uint32   `json:"id"`
-	Title         string   `json:"title"`
-	Content       string   `json:"content"`
-	UserId        uint32   `json:"user_id"`
-	Tags          []string `json:"tags"`
-	CreatedAt     string   `json:"created_at"`
-	UpdatedAt     string   `json:"updated_at"`
-	Version       uint16   `json:"version"`
-	CommentsCount uint16   `json:"comments_count"`
+	Id             uint32   `json:"id"`
+	Title          string   `json:"title"`
+	Content        string   `json:"content"`
+	UserId         uint32   `json:"user_id"`
+	Tags           []string `json:"tags"`
+	CreatedAt      string   `json:"created_at"`
+	UpdatedAt      string   `json:"updated_at"`
+	Version        uint16   `json:"version"`
+	CommentsCount  uint16   `json:"comments_count"`
+	ReactionsCount uint32   `json:"reactions_count"`
+	Language       string   `json:"language"`
+	Entities       Entities `json:"entities"`
 }
 
 type CreatePostPayload struct {
-	Title   string   `json:"title" validate:"required,max=100"`
-	Content string   `json:"content" validate:"required,max=1000"`
-	Tags    []string `json:"tags"`
+	Title    string   `json:"title" validate:"required,max=100"`
+	Content  string   `json:"content" validate:"required,max=1000"`
+	Tags     []string `json:"tags"`
+	Language string   `json:"language" validate:"omitempty,oneof=english spanish french german italian portuguese simple"`
 }
 
 type UpdatePostPayload struct {
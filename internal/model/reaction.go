@@ -0,0 +1,12 @@
+package model
+
+type Reaction struct {
+	PostId    uint32 `json:"post_id"`
+	UserId    uint32 `json:"user_id"`
+	Kind      string `json:"kind"`
+	CreatedAt string `json:"created_at"`
+}
+
+type ReactionPayload struct {
+	Kind string `json:"kind" validate:"required,oneof=like love laugh sad angry"`
+}
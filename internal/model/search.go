@@ -0,0 +1,26 @@
+package model
+
+type PostSearchResult struct {
+	*Post
+	Rank     float64 `json:"rank"`
+	Headline string  `json:"headline"`
+}
+
+type CommentSearchResult struct {
+	*Comment
+	Rank     float64 `json:"rank"`
+	Headline string  `json:"headline"`
+}
+
+type UserSearchResult struct {
+	Id       uint32  `json:"id"`
+	Username string  `json:"username"`
+	Rank     float64 `json:"rank"`
+	Headline string  `json:"headline"`
+}
+
+type SearchResults struct {
+	Posts    []*PostSearchResult    `json:"posts"`
+	Comments []*CommentSearchResult `json:"comments"`
+	Users    []*UserSearchResult    `json:"users"`
+}
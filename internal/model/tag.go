@@ -0,0 +1,14 @@
+package model
+
+type TagFollow struct {
+	UserId    uint32 `json:"user_id"`
+	Tag       string `json:"tag"`
+	CreatedAt string `json:"created_at"`
+}
+
+type TagStats struct {
+	Tag            string `json:"tag"`
+	PostsCount     int    `json:"posts_count"`
+	FollowersCount int    `json:"followers_count"`
+	Following      bool   `json:"following"` // the caller follows the tag
+}
@@ -0,0 +1,20 @@
+package model
+
+type TrendingTag struct {
+	Tag        string  `json:"tag"`
+	Score      float64 `json:"score"`
+	PostsCount int     `json:"posts_count"`
+}
+
+type TrendingPost struct {
+	*Post
+	Score float64 `json:"score"`
+}
+
+type TrendingSnapshot struct {
+	Id         uint32          `json:"id"`
+	Window     string          `json:"window"`
+	ComputedAt string          `json:"computed_at"`
+	Tags       []*TrendingTag  `json:"tags"`
+	Posts      []*TrendingPost `json:"posts"`
+}
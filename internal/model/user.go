@@ -3,13 +3,15 @@ package model
 import "golang.org/x/crypto/bcrypt"
 
 type User struct {
-	Id        uint32   `json:"id"`
-	Username  string   `json:"username"`
-	Email     string   `json:"email"`
-	Password  password `json:"-"`
-	CreatedAt string   `json:"created_at"`
-	IsActive  bool     `json:"is_active"`
-	Role      Role     `json:"role"` // 0 = user, 1 = mod, 2 = admin
+	Id          uint32   `json:"id"`
+	Username    string   `json:"username"`
+	DisplayName string   `json:"display_name"`
+	Email       string   `json:"email"`
+	Language    string   `json:"language"`
+	Password    password `json:"-"`
+	CreatedAt   string   `json:"created_at"`
+	IsActive    bool     `json:"is_active"`
+	Role        Role     `json:"role"` // 0 = user, 1 = mod, 2 = admin
 }
 
 type password struct {
@@ -41,12 +43,26 @@ type CreateUserPayload struct {
 }
 
 type RegisterUserPayload struct {
-	Username string `json:"username" validate:"required,max=100"`
-	Email    string `json:"email" validate:"required,email,max=255"`
-	Password string `json:"password" validate:"required,min=8,max=72"`
+	Username    string `json:"username" validate:"required,max=100"`
+	DisplayName string `json:"display_name" validate:"max=100"`
+	Email       string `json:"email" validate:"required,email,max=255"`
+	Password    string `json:"password" validate:"required,min=8,max=72"`
+	// Language of the emails, taken from the Accept-Language header when empty
+	Language string `json:"language" validate:"omitempty,bcp47_language_tag,max=35"`
 }
 
 type UserWithToken struct {
 	*User
 	Token string `json:"token"`
 }
+
+// UserSuggestion is a user matched by the username autocomplete
+type UserSuggestion struct {
+	Id             uint32  `json:"id"`
+	Username       string  `json:"username"`
+	DisplayName    string  `json:"display_name"`
+	FollowersCount int     `json:"followers_count"`
+	Following      bool    `json:"following"`   // the caller follows the user
+	FollowsYou     bool    `json:"follows_you"` // the user follows the caller
+	Score          float64 `json:"score"`
+}
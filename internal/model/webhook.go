@@ -0,0 +1,103 @@
+package model
+
+import "encoding/json"
+
+// Events delivered to the webhooks, the domain events of the same kind
+const (
+	WebhookPostCreated    = EventPostCreated
+	WebhookCommentCreated = EventCommentCreated
+	WebhookUserFollowed   = EventUserFollowed
+	WebhookUserRegistered = EventUserRegistered
+)
+
+var WebhookEvents = []string{
+	WebhookPostCreated,
+	WebhookCommentCreated,
+	WebhookUserFollowed,
+	WebhookUserRegistered,
+}
+
+// Status of a webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is an URL the platform events are posted to, signed with its secret
+type Webhook struct {
+	Id           uint32   `json:"id"`
+	URL          string   `json:"url"`
+	Events       []string `json:"events"` // every event when empty
+	Secret       string   `json:"secret,omitempty"`
+	Active       bool     `json:"active"`
+	FailureCount int      `json:"failure_count"` // consecutive failed attempts
+	DisabledAt   *string  `json:"disabled_at"`   // set when disabled after too many failures
+	CreatedBy    *uint32  `json:"created_by"`
+	CreatedAt    string   `json:"created_at"`
+	UpdatedAt    string   `json:"updated_at"`
+}
+
+// Returns whether the webhook subscribes to the event
+func (w *Webhook) Accepts(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WebhookDelivery is a single event sent to a webhook, with the outcome of its
+// last attempt
+type WebhookDelivery struct {
+	Id             uint32          `json:"id"`
+	WebhookId      uint32          `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  string          `json:"next_attempt_at"`
+	ResponseStatus *int            `json:"response_status"`
+	ResponseBody   string          `json:"response_body"`
+	Error          string          `json:"error"`
+	CreatedAt      string          `json:"created_at"`
+	DeliveredAt    *string         `json:"delivered_at"`
+
+	// URL and secret the delivery is sent with, only loaded to send it
+	Webhook *Webhook `json:"-"`
+}
+
+// WebhookEvent is the body posted to the webhooks
+type WebhookEvent struct {
+	Event      string `json:"event"`
+	OccurredAt string `json:"occurred_at"`
+	Data       any    `json:"data"`
+}
+
+// WebhookUser is the public part of a registered user sent to the webhooks
+type WebhookUser struct {
+	Id        uint32 `json:"id"`
+	Username  string `json:"username"`
+	CreatedAt string `json:"created_at"`
+}
+
+type CreateWebhookPayload struct {
+	URL    string   `json:"url" validate:"required,url,max=2048"`
+	Events []string `json:"events" validate:"dive,oneof=post.created comment.created user.followed user.registered"`
+	// Generated when empty
+	Secret string `json:"secret" validate:"omitempty,min=16,max=128"`
+}
+
+type UpdateWebhookPayload struct {
+	URL    *string   `json:"url" validate:"omitempty,url,max=2048"`
+	Events *[]string `json:"events" validate:"omitempty,dive,oneof=post.created comment.created user.followed user.registered"`
+	Secret *string   `json:"secret" validate:"omitempty,min=16,max=128"`
+	// Enabling a webhook resets its failures
+	Active *bool `json:"active"`
+}
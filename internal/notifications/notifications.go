@@ -0,0 +1,215 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// Max time recording the notifications of a single event is allowed to run
+const eventTimeout = 10 * time.Second
+
+// Publisher receives the recorded notifications, e.g. to push them to the
+// connected clients of the recipient
+type Publisher interface {
+	PublishNotification(event *model.NotificationEvent)
+}
+
+// PublisherFunc lets a function be used as a Publisher
+type PublisherFunc func(event *model.NotificationEvent)
+
+func (f PublisherFunc) PublishNotification(event *model.NotificationEvent) {
+	f(event)
+}
+
+type Config struct {
+	Workers   int
+	QueueSize int
+}
+
+// Service records the notifications of the user actions in the background,
+// so the requests that trigger them don't wait for the writes.
+type Service struct {
+	store      store.Storage
+	logger     *zap.SugaredLogger
+	publishers []Publisher
+	events     chan []*model.NotificationEvent
+	wg         sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewService(cfg Config, store store.Storage, logger *zap.SugaredLogger) *Service {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+
+	s := &Service{
+		store:  store,
+		logger: logger,
+		events: make(chan []*model.NotificationEvent, cfg.QueueSize),
+	}
+
+	for i := 0; i < cfg.Workers; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+
+	return s
+}
+
+// Adds a publisher of the recorded notifications. Publishers must be added
+// before any event is queued.
+func (s *Service) AddPublisher(publisher Publisher) {
+	s.publishers = append(s.publishers, publisher)
+}
+
+// Notifies the followed user
+func (s *Service) UserFollowed(follow *model.FollowAction) {
+	s.enqueue(&model.NotificationEvent{
+		UserId:  follow.TargetUserId,
+		Kind:    model.NotificationFollow,
+		ActorId: follow.SenderUserId,
+	})
+}
+
+// Notifies the users mentioned in a new post
+func (s *Service) PostCreated(post *model.Post) {
+	s.enqueue(mentionEvents(post.UserId, post.Id, post.Entities, nil)...)
+}
+
+// Notifies the users mentioned by the edit that weren't mentioned before
+func (s *Service) PostUpdated(post *model.Post, previous model.Entities) {
+	s.enqueue(mentionEvents(post.UserId, post.Id, post.Entities, previous)...)
+}
+
+// Notifies the author of the post and the users mentioned in the comment
+func (s *Service) CommentCreated(comment *model.Comment, post *model.Post) {
+	events := []*model.NotificationEvent{{
+		UserId:  post.UserId,
+		Kind:    model.NotificationComment,
+		PostId:  &post.Id,
+		ActorId: comment.UserId,
+	}}
+	events = append(events, mentionEvents(comment.UserId, post.Id, comment.Entities, nil)...)
+
+	s.enqueue(events...)
+}
+
+// Notifies the author of the post
+func (s *Service) PostReacted(reaction *model.Reaction, post *model.Post) {
+	s.enqueue(&model.NotificationEvent{
+		UserId:  post.UserId,
+		Kind:    model.NotificationReaction,
+		PostId:  &post.Id,
+		ActorId: reaction.UserId,
+	})
+}
+
+// Stops accepting events and waits until the queued ones are recorded or ctx expires
+func (s *Service) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("notification workers did not drain: %w", ctx.Err())
+	}
+}
+
+// Returns one event per user mentioned in entities and not in previous
+func mentionEvents(actorId, postId uint32, entities, previous model.Entities) []*model.NotificationEvent {
+	mentioned := map[uint32]bool{}
+	for _, entity := range previous {
+		if entity.Type == model.EntityMention {
+			mentioned[entity.UserId] = true
+		}
+	}
+
+	events := []*model.NotificationEvent{}
+	for _, entity := range entities {
+		if entity.Type != model.EntityMention || entity.UserId == 0 || mentioned[entity.UserId] {
+			continue
+		}
+		mentioned[entity.UserId] = true
+
+		events = append(events, &model.NotificationEvent{
+			UserId:  entity.UserId,
+			Kind:    model.NotificationMention,
+			PostId:  &postId,
+			ActorId: actorId,
+		})
+	}
+
+	return events
+}
+
+// Queues the events, recording them in the caller when the queue is full so
+// that no notification is lost.
+func (s *Service) enqueue(events ...*model.NotificationEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		s.logger.Warnw("notification service is stopped, recording inline")
+		s.record(events)
+		return
+	}
+
+	select {
+	case s.events <- events:
+	default:
+		s.logger.Warnw("notification queue is full, recording inline")
+		s.record(events)
+	}
+}
+
+func (s *Service) worker() {
+	defer s.wg.Done()
+
+	for events := range s.events {
+		s.record(events)
+	}
+}
+
+func (s *Service) record(events []*model.NotificationEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+
+	for _, event := range events {
+		added, err := s.store.Notifications.Add(ctx, event)
+		if err != nil {
+			s.logger.Errorw("error recording notification", "kind", event.Kind, "user_id", event.UserId, "error", err)
+			continue
+		}
+
+		if !added {
+			continue
+		}
+		for _, publisher := range s.publishers {
+			publisher.PublishNotification(event)
+		}
+	}
+}
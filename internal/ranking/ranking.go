@@ -0,0 +1,179 @@
+package ranking
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+)
+
+// Signals are the per-user inputs used to score the candidate posts
+type Signals struct {
+	// Reference time for recency, usually time.Now()
+	Now time.Time
+	// Interaction weight of the user with each author
+	AuthorAffinity map[uint32]float64
+	// Interaction weight of the user with each tag
+	TagInterests map[string]float64
+}
+
+// Scorer gives a post a score, higher is better.
+// Implementations should return values roughly in [0, 1] so they can be weighted.
+type Scorer interface {
+	Score(post *model.Post, signals *Signals) float64
+}
+
+// ScorerFunc adapts a function to the Scorer interface
+type ScorerFunc func(post *model.Post, signals *Signals) float64
+
+func (f ScorerFunc) Score(post *model.Post, signals *Signals) float64 {
+	return f(post, signals)
+}
+
+// Scores by exponential decay of the post age
+type RecencyScorer struct {
+	HalfLife time.Duration
+}
+
+func (s RecencyScorer) Score(post *model.Post, signals *Signals) float64 {
+	createdAt, err := time.Parse(time.RFC3339, post.CreatedAt)
+	if err != nil || s.HalfLife <= 0 {
+		return 0
+	}
+
+	age := signals.Now.Sub(createdAt)
+	if age < 0 {
+		age = 0
+	}
+
+	return math.Pow(0.5, age.Hours()/s.HalfLife.Hours())
+}
+
+// Scores by comments and reactions, saturating with a logarithm so a single
+// viral post doesn't dominate the feed
+type EngagementScorer struct {
+	CommentWeight  float64
+	ReactionWeight float64
+}
+
+func (s EngagementScorer) Score(post *model.Post, signals *Signals) float64 {
+	engagement := float64(post.CommentsCount)*s.CommentWeight + float64(post.ReactionsCount)*s.ReactionWeight
+
+	return 1 - 1/(1+math.Log1p(engagement))
+}
+
+// Scores by how much the user interacted with the author before
+type AffinityScorer struct{}
+
+func (s AffinityScorer) Score(post *model.Post, signals *Signals) float64 {
+	affinity := signals.AuthorAffinity[post.UserId]
+
+	return 1 - 1/(1+math.Log1p(affinity))
+}
+
+// Scores by the share of the post tags the user is interested in
+type TagOverlapScorer struct{}
+
+func (s TagOverlapScorer) Score(post *model.Post, signals *Signals) float64 {
+	if len(post.Tags) == 0 || len(signals.TagInterests) == 0 {
+		return 0
+	}
+
+	matched := 0
+	for _, tag := range post.Tags {
+		if signals.TagInterests[tag] > 0 {
+			matched++
+		}
+	}
+
+	return float64(matched) / float64(len(post.Tags))
+}
+
+type WeightedScorer struct {
+	Scorer Scorer
+	Weight float64
+}
+
+// Ranker orders posts by the weighted sum of its scorers
+type Ranker struct {
+	scorers       []WeightedScorer
+	deterministic bool
+}
+
+type Config struct {
+	HalfLife         time.Duration
+	RecencyWeight    float64
+	EngagementWeight float64
+	AffinityWeight   float64
+	TagOverlapWeight float64
+	CommentWeight    float64
+	ReactionWeight   float64
+	Deterministic    bool
+}
+
+// Creates a ranker with the default scorers weighted by the config
+func NewRanker(cfg Config) *Ranker {
+	return NewRankerWithScorers(cfg.Deterministic,
+		WeightedScorer{RecencyScorer{HalfLife: cfg.HalfLife}, cfg.RecencyWeight},
+		WeightedScorer{EngagementScorer{CommentWeight: cfg.CommentWeight, ReactionWeight: cfg.ReactionWeight}, cfg.EngagementWeight},
+		WeightedScorer{AffinityScorer{}, cfg.AffinityWeight},
+		WeightedScorer{TagOverlapScorer{}, cfg.TagOverlapWeight},
+	)
+}
+
+// Creates a ranker with custom scorers.
+// In deterministic mode the reference time is the newest candidate instead of
+// the wall clock, so the same input always produces the same order.
+func NewRankerWithScorers(deterministic bool, scorers ...WeightedScorer) *Ranker {
+	return &Ranker{
+		scorers:       scorers,
+		deterministic: deterministic,
+	}
+}
+
+// Returns the weighted score of the post
+func (rk *Ranker) Score(post *model.Post, signals *Signals) float64 {
+	score := 0.0
+	for _, ws := range rk.scorers {
+		score += ws.Weight * ws.Scorer.Score(post, signals)
+	}
+
+	return score
+}
+
+// Sorts the posts in place from the highest to the lowest score.
+// Ties are broken by the newest post id first.
+func (rk *Ranker) Rank(posts []*model.Post, signals Signals) []*model.Post {
+	if rk.deterministic || signals.Now.IsZero() {
+		signals.Now = newest(posts)
+	}
+
+	scores := make(map[uint32]float64, len(posts))
+	for _, post := range posts {
+		scores[post.Id] = rk.Score(post, &signals)
+	}
+
+	sort.SliceStable(posts, func(i, j int) bool {
+		si, sj := scores[posts[i].Id], scores[posts[j].Id]
+		if si != sj {
+			return si > sj
+		}
+
+		return posts[i].Id > posts[j].Id
+	})
+
+	return posts
+}
+
+func newest(posts []*model.Post) time.Time {
+	var t time.Time
+	for _, post := range posts {
+		createdAt, err := time.Parse(time.RFC3339, post.CreatedAt)
+		if err == nil && createdAt.After(t) {
+			t = createdAt
+		}
+	}
+
+	return t
+}
@@ -0,0 +1,120 @@
+package ranking
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+)
+
+func newTestRanker() *Ranker {
+	return NewRanker(Config{
+		HalfLife:         time.Hour * 12,
+		RecencyWeight:    1.0,
+		EngagementWeight: 0.6,
+		AffinityWeight:   0.8,
+		TagOverlapWeight: 0.4,
+		CommentWeight:    2.0,
+		ReactionWeight:   1.0,
+		Deterministic:    true,
+	})
+}
+
+func ids(posts []*model.Post) []uint32 {
+	out := make([]uint32, len(posts))
+	for i, post := range posts {
+		out[i] = post.Id
+	}
+	return out
+}
+
+func equalIds(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRankerRank(t *testing.T) {
+	t.Run("should prefer recent posts when nothing else differs", func(t *testing.T) {
+		posts := []*model.Post{
+			{Id: 1, CreatedAt: "2024-03-10T00:00:00Z"},
+			{Id: 2, CreatedAt: "2024-03-10T12:00:00Z"},
+			{Id: 3, CreatedAt: "2024-03-09T00:00:00Z"},
+		}
+
+		ranked := newTestRanker().Rank(posts, Signals{})
+
+		if got := ids(ranked); !equalIds(got, []uint32{2, 1, 3}) {
+			t.Errorf("expected order [2 1 3]; got %v", got)
+		}
+	})
+
+	t.Run("should boost engagement, affinity and tag overlap", func(t *testing.T) {
+		posts := []*model.Post{
+			{Id: 1, UserId: 10, CreatedAt: "2024-03-10T12:00:00Z"},
+			{Id: 2, UserId: 20, CreatedAt: "2024-03-10T06:00:00Z", CommentsCount: 10, ReactionsCount: 30},
+			{Id: 3, UserId: 30, CreatedAt: "2024-03-10T06:00:00Z", Tags: []string{"go"}},
+			{Id: 4, UserId: 40, CreatedAt: "2024-03-10T06:00:00Z"},
+		}
+
+		ranked := newTestRanker().Rank(posts, Signals{
+			AuthorAffinity: map[uint32]float64{30: 20},
+			TagInterests:   map[string]float64{"go": 3},
+		})
+
+		if got := ids(ranked); got[len(got)-1] != 4 {
+			t.Errorf("expected the post without any signal to be last; got %v", got)
+		}
+	})
+
+	t.Run("should produce the same order regardless of the wall clock", func(t *testing.T) {
+		build := func() []*model.Post {
+			return []*model.Post{
+				{Id: 1, CreatedAt: "2024-03-10T00:00:00Z", CommentsCount: 4},
+				{Id: 2, CreatedAt: "2024-03-10T12:00:00Z"},
+				{Id: 3, CreatedAt: "2024-03-10T06:00:00Z", ReactionsCount: 2},
+			}
+		}
+
+		rk := newTestRanker()
+		first := ids(rk.Rank(build(), Signals{Now: time.Now()}))
+		second := ids(rk.Rank(build(), Signals{Now: time.Now().Add(time.Hour * 24 * 365)}))
+
+		if !equalIds(first, second) {
+			t.Errorf("expected a stable order; got %v and %v", first, second)
+		}
+	})
+
+	t.Run("should break ties by the newest id", func(t *testing.T) {
+		posts := []*model.Post{
+			{Id: 1, CreatedAt: "2024-03-10T00:00:00Z"},
+			{Id: 3, CreatedAt: "2024-03-10T00:00:00Z"},
+			{Id: 2, CreatedAt: "2024-03-10T00:00:00Z"},
+		}
+
+		ranked := newTestRanker().Rank(posts, Signals{})
+
+		if got := ids(ranked); !equalIds(got, []uint32{3, 2, 1}) {
+			t.Errorf("expected order [3 2 1]; got %v", got)
+		}
+	})
+
+	t.Run("should accept custom scorers", func(t *testing.T) {
+		byId := ScorerFunc(func(post *model.Post, signals *Signals) float64 {
+			return -float64(post.Id)
+		})
+		rk := NewRankerWithScorers(true, WeightedScorer{byId, 1})
+
+		posts := []*model.Post{{Id: 3}, {Id: 1}, {Id: 2}}
+
+		if got := ids(rk.Rank(posts, Signals{})); !equalIds(got, []uint32{1, 2, 3}) {
+			t.Errorf("expected order [1 2 3]; got %v", got)
+		}
+	})
+}
@@ -6,42 +6,65 @@ import (
 )
 
 type FixedWindowLimiter struct {
-	sync.RWMutex
-	clients map[string]int
+	sync.Mutex
+	clients map[string]*fixedWindow
 	limit   int
 	window  time.Duration
+	now     func() time.Time
+	janitor *janitor
+}
+
+type fixedWindow struct {
+	start time.Time
+	count int
 }
 
 func NewFixedWindowRateLimiter(limit int, timeFrame time.Duration) *FixedWindowLimiter {
-	return &FixedWindowLimiter{
-		clients: make(map[string]int),
+	rl := &FixedWindowLimiter{
+		clients: make(map[string]*fixedWindow),
 		limit:   limit,
 		window:  timeFrame,
+		now:     time.Now,
 	}
+	rl.janitor = startJanitor(timeFrame, rl.evict)
+
+	return rl
 }
 
 func (rl *FixedWindowLimiter) Allow(remoteAddr string) (bool, time.Duration) {
-	rl.RLock()
-	count, exists := rl.clients[remoteAddr]
-	rl.RUnlock()
-
-	if !exists || count < rl.limit {
-		rl.Lock()
-		if !exists {
-			go rl.resetCount(remoteAddr)
-		}
+	now := rl.now()
+
+	rl.Lock()
+	defer rl.Unlock()
+
+	w, exists := rl.clients[remoteAddr]
+	if !exists || now.Sub(w.start) >= rl.window {
+		w = &fixedWindow{start: now}
+		rl.clients[remoteAddr] = w
+	}
 
-		rl.clients[remoteAddr]++
-		rl.Unlock()
+	if w.count < rl.limit {
+		w.count++
 		return true, 0
 	}
 
-	return false, rl.window
+	return false, w.start.Add(rl.window).Sub(now)
+}
+
+func (rl *FixedWindowLimiter) Close() error {
+	return rl.janitor.Close()
 }
 
-func (rl *FixedWindowLimiter) resetCount(remoteAddr string) {
-	time.Sleep(rl.window)
+// Forgets the clients whose window ended
+func (rl *FixedWindowLimiter) evict() {
+	now := rl.now()
+
 	rl.Lock()
-	delete(rl.clients, remoteAddr)
-	rl.Unlock()
+	defer rl.Unlock()
+
+	for client, w := range rl.clients {
+		if now.Sub(w.start) >= rl.window {
+			delete(rl.clients, client)
+		}
+	}
 }
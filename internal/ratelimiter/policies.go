@@ -0,0 +1,162 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Policies holds a limiter for each named policy, so groups of routes can
+// have their own limits, e.g. a strict one for the login and a generous one
+// for the reads. Every policy counts the requests of a client separately.
+type Policies struct {
+	limiters map[string]Limiter
+}
+
+// Creates the limiters of the enabled policies. The keys of the policies
+// kept in Redis are prefixed with their name.
+func NewPolicies(configs map[string]Config, logger *zap.SugaredLogger) (*Policies, error) {
+	p := &Policies{limiters: map[string]Limiter{}}
+
+	for name, cfg := range configs {
+		if !cfg.Enabled {
+			continue
+		}
+		if cfg.RequestsPerTimeFrame < 1 || cfg.TimeFrame <= 0 {
+			p.Close()
+			return nil, fmt.Errorf("rate limit policy %q: invalid limit of %d requests per %s", name, cfg.RequestsPerTimeFrame, cfg.TimeFrame)
+		}
+
+		cfg.Redis.Prefix += name + ":"
+		limiter, err := New(cfg, logger)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("rate limit policy %q: %w", name, err)
+		}
+		p.limiters[name] = limiter
+	}
+
+	return p, nil
+}
+
+// Counts the request of the client against the policy. Requests of unknown
+// or disabled policies are always allowed.
+func (p *Policies) Allow(policy, client string) (bool, time.Duration) {
+	limiter, ok := p.limiters[policy]
+	if !ok {
+		return true, 0
+	}
+
+	return limiter.Allow(client)
+}
+
+func (p *Policies) Close() error {
+	var errs []error
+	for _, limiter := range p.limiters {
+		errs = append(errs, limiter.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// Parses policies like "auth=10/1m,read=300/1m:sliding_window", the number
+// of requests per time frame of each policy and optionally its strategy.
+// The policies use the strategy of the defaults when they don't set one.
+func ParsePolicies(spec string, defaults Config) (map[string]Config, error) {
+	policies := map[string]Config{}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, limit, ok := strings.Cut(entry, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("rate limit policy %q: expected name=requests/time frame", entry)
+		}
+
+		limit, strategy, _ := strings.Cut(limit, ":")
+		requests, timeFrame, ok := strings.Cut(limit, "/")
+		if !ok {
+			return nil, fmt.Errorf("rate limit policy %q: expected name=requests/time frame", entry)
+		}
+
+		cfg := defaults
+		cfg.Enabled = true
+		if strategy != "" {
+			cfg.Strategy = strategy
+		}
+
+		var err error
+		cfg.RequestsPerTimeFrame, err = strconv.Atoi(requests)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit policy %q: invalid requests: %w", entry, err)
+		}
+		cfg.TimeFrame, err = time.ParseDuration(timeFrame)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit policy %q: invalid time frame: %w", entry, err)
+		}
+
+		policies[name] = cfg
+	}
+
+	return policies, nil
+}
+
+// policyFile is a policy as written in a policies file
+type policyFile struct {
+	Requests  int    `json:"requests"`
+	TimeFrame string `json:"time_frame"`
+	Strategy  string `json:"strategy"`
+	Disabled  bool   `json:"disabled"`
+}
+
+// Reads the policies of a JSON file, an object with the policies by name:
+//
+//	{"auth": {"requests": 10, "time_frame": "1m", "strategy": "sliding_window"}}
+//
+// The policies use the strategy of the defaults when they don't set one.
+func LoadPolicies(path string, defaults Config) (map[string]Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files map[string]policyFile
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, fmt.Errorf("rate limit policies %s: %w", path, err)
+	}
+
+	policies := map[string]Config{}
+	for name, file := range files {
+		cfg := defaults
+		cfg.Enabled = !file.Disabled
+		cfg.RequestsPerTimeFrame = file.Requests
+		if file.Strategy != "" {
+			cfg.Strategy = file.Strategy
+		}
+
+		// Disabled policies switch the routes off, they need no limit
+		if cfg.Enabled {
+			if file.Requests < 1 {
+				return nil, fmt.Errorf("rate limit policy %q: invalid requests %d", name, file.Requests)
+			}
+
+			cfg.TimeFrame, err = time.ParseDuration(file.TimeFrame)
+			if err != nil {
+				return nil, fmt.Errorf("rate limit policy %q: invalid time frame: %w", name, err)
+			}
+		}
+
+		policies[name] = cfg
+	}
+
+	return policies, nil
+}
@@ -1,13 +1,112 @@
 package ratelimiter
 
-import "time"
+import (
+	"fmt"
+	"sync"
+	"time"
 
+	"go.uber.org/zap"
+)
+
+// Limiter allows a number of requests per time frame to each client, and
+// returns how long a denied client should wait before retrying
 type Limiter interface {
 	Allow(string) (bool, time.Duration)
+	// Stops the eviction of the idle clients
+	Close() error
 }
 
+// Rate limiting strategies
+const (
+	// Counts the requests of fixed windows, which lets through bursts of
+	// twice the limit around the start of a window
+	StrategyFixedWindow = "fixed_window"
+	// Refills the allowed requests at a steady rate, allowing bursts of up to
+	// the limit after a quiet period
+	StrategyTokenBucket = "token_bucket"
+	// Keeps the times of the requests of the last time frame, which is exact
+	// but uses memory for each of them
+	StrategySlidingWindow = "sliding_window"
+)
+
 type Config struct {
 	RequestsPerTimeFrame int
 	TimeFrame            time.Duration
 	Enabled              bool
+	// One of the strategies, the token bucket when empty
+	Strategy string
+	// Where the counters are kept, in the memory of the instance when empty
+	Backend string
+	Redis   RedisConfig
+}
+
+// Backends of the counters
+const (
+	BackendMemory = "memory"
+	// Shared by all the instances, only with the token bucket
+	BackendRedis = "redis"
+)
+
+// Creates the limiter of the strategy and the backend selected by the config
+func New(cfg Config, logger *zap.SugaredLogger) (Limiter, error) {
+	switch cfg.Backend {
+	case BackendMemory, "":
+	case BackendRedis:
+		if cfg.Strategy != StrategyTokenBucket && cfg.Strategy != "" {
+			return nil, fmt.Errorf("the redis rate limiter backend only supports the %s strategy", StrategyTokenBucket)
+		}
+		return NewRedisLimiter(cfg.Redis, cfg.RequestsPerTimeFrame, cfg.TimeFrame, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limiter backend %q", cfg.Backend)
+	}
+
+	switch cfg.Strategy {
+	case StrategyTokenBucket, "":
+		return NewTokenBucketLimiter(cfg.RequestsPerTimeFrame, cfg.TimeFrame), nil
+	case StrategySlidingWindow:
+		return NewSlidingWindowLimiter(cfg.RequestsPerTimeFrame, cfg.TimeFrame), nil
+	case StrategyFixedWindow:
+		return NewFixedWindowRateLimiter(cfg.RequestsPerTimeFrame, cfg.TimeFrame), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limiter strategy %q", cfg.Strategy)
+	}
+}
+
+// janitor periodically evicts the clients a limiter no longer needs to
+// remember, from a single goroutine
+type janitor struct {
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func startJanitor(interval time.Duration, evict func()) *janitor {
+	j := &janitor{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(j.done)
+
+		ticker := time.NewTicker(max(interval, time.Second))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-j.stop:
+				return
+			case <-ticker.C:
+				evict()
+			}
+		}
+	}()
+
+	return j
+}
+
+func (j *janitor) Close() error {
+	j.once.Do(func() { close(j.stop) })
+	<-j.done
+	return nil
 }
@@ -0,0 +1,310 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// clock is a manual time source for the limiters
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time { return c.t }
+
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiters(t *testing.T, limit int, window time.Duration) (map[string]Limiter, *clock) {
+	t.Helper()
+
+	c := &clock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	fixed := NewFixedWindowRateLimiter(limit, window)
+	fixed.now = c.now
+	bucket := NewTokenBucketLimiter(limit, window)
+	bucket.now = c.now
+	sliding := NewSlidingWindowLimiter(limit, window)
+	sliding.now = c.now
+
+	limiters := map[string]Limiter{
+		StrategyFixedWindow:   fixed,
+		StrategyTokenBucket:   bucket,
+		StrategySlidingWindow: sliding,
+	}
+	t.Cleanup(func() {
+		for _, l := range limiters {
+			l.Close()
+		}
+	})
+
+	return limiters, c
+}
+
+func TestLimiters(t *testing.T) {
+	t.Run("should allow the limit and then deny with a retry delay", func(t *testing.T) {
+		limiters, _ := newTestLimiters(t, 3, time.Minute)
+
+		for strategy, l := range limiters {
+			for i := range 3 {
+				if allow, _ := l.Allow("client"); !allow {
+					t.Fatalf("%s: expected request %d to be allowed", strategy, i+1)
+				}
+			}
+
+			allow, retryAfter := l.Allow("client")
+			if allow || retryAfter <= 0 || retryAfter > time.Minute {
+				t.Errorf("%s: expected a denial with a retry delay; got %v %s", strategy, allow, retryAfter)
+			}
+
+			// Other clients have their own limit
+			if allow, _ := l.Allow("other"); !allow {
+				t.Errorf("%s: expected another client to be allowed", strategy)
+			}
+		}
+	})
+
+	t.Run("should allow the client again after the retry delay", func(t *testing.T) {
+		limiters, c := newTestLimiters(t, 2, time.Minute)
+		for strategy, l := range limiters {
+			l.Allow("client")
+			l.Allow("client")
+
+			_, retryAfter := l.Allow("client")
+			c.advance(retryAfter)
+
+			if allow, _ := l.Allow("client"); !allow {
+				t.Errorf("%s: expected the request after %s to be allowed", strategy, retryAfter)
+			}
+
+			c.advance(time.Hour)
+		}
+	})
+
+	t.Run("should not allow twice the limit around the edge of a window", func(t *testing.T) {
+		limiters, c := newTestLimiters(t, 10, time.Minute)
+
+		// Allowed in the bursts two seconds apart, the fixed window lets
+		// almost twice the limit through
+		expected := map[string]int{
+			StrategyFixedWindow:   19,
+			StrategyTokenBucket:   10,
+			StrategySlidingWindow: 10,
+		}
+
+		for strategy, l := range limiters {
+			// A request starts the window, then come bursts at its end and at
+			// the start of the next one
+			l.Allow("client")
+
+			allowed := 0
+			for _, wait := range []time.Duration{time.Minute - time.Second, 2 * time.Second} {
+				c.advance(wait)
+				for range 20 {
+					if ok, _ := l.Allow("client"); ok {
+						allowed++
+					}
+				}
+			}
+
+			if allowed != expected[strategy] {
+				t.Errorf("%s: expected %d requests allowed around the edge; got %d", strategy, expected[strategy], allowed)
+			}
+
+			c.advance(time.Hour)
+		}
+	})
+
+	t.Run("should evict the idle clients", func(t *testing.T) {
+		c := &clock{t: time.Now()}
+
+		bucket := NewTokenBucketLimiter(5, time.Minute)
+		bucket.now = c.now
+		defer bucket.Close()
+		sliding := NewSlidingWindowLimiter(5, time.Minute)
+		sliding.now = c.now
+		defer sliding.Close()
+		fixed := NewFixedWindowRateLimiter(5, time.Minute)
+		fixed.now = c.now
+		defer fixed.Close()
+
+		for i := range 100 {
+			client := fmt.Sprintf("client-%d", i)
+			bucket.Allow(client)
+			sliding.Allow(client)
+			fixed.Allow(client)
+		}
+
+		c.advance(time.Minute)
+		bucket.evict()
+		sliding.evict()
+		fixed.evict()
+
+		if len(bucket.clients) != 0 || len(sliding.clients) != 0 || len(fixed.clients) != 0 {
+			t.Errorf("expected no clients left; got %d %d %d", len(bucket.clients), len(sliding.clients), len(fixed.clients))
+		}
+	})
+
+	t.Run("should create the limiter of the strategy", func(t *testing.T) {
+		for _, strategy := range []string{StrategyFixedWindow, StrategyTokenBucket, StrategySlidingWindow, ""} {
+			l, err := New(Config{RequestsPerTimeFrame: 1, TimeFrame: time.Second, Strategy: strategy}, zap.NewNop().Sugar())
+			if err != nil {
+				t.Fatalf("%q: %v", strategy, err)
+			}
+			l.Close()
+		}
+
+		if _, err := New(Config{Strategy: "leaky_bucket"}, zap.NewNop().Sugar()); err == nil {
+			t.Error("expected an error for an unknown strategy")
+		}
+		if _, err := New(Config{Strategy: StrategySlidingWindow, Backend: BackendRedis}, zap.NewNop().Sugar()); err == nil {
+			t.Error("expected an error for a strategy the redis backend doesn't support")
+		}
+	})
+}
+
+// Requests from many distinct clients, like the traffic of a public API
+func BenchmarkLimiters(b *testing.B) {
+	for _, strategy := range []string{StrategyFixedWindow, StrategyTokenBucket, StrategySlidingWindow} {
+		for _, clients := range []int{100, 10_000, 100_000} {
+			b.Run(fmt.Sprintf("%s/%d_clients", strategy, clients), func(b *testing.B) {
+				l, err := New(Config{RequestsPerTimeFrame: 50, TimeFrame: time.Minute, Strategy: strategy}, zap.NewNop().Sugar())
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer l.Close()
+
+				keys := make([]string, clients)
+				for i := range keys {
+					keys[i] = fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+				}
+
+				var next atomic.Uint64
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						l.Allow(keys[next.Add(1)%uint64(len(keys))])
+					}
+				})
+			})
+		}
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	defaults := Config{Enabled: true, Strategy: StrategySlidingWindow}
+
+	t.Run("should parse the policies", func(t *testing.T) {
+		policies, err := ParsePolicies("auth=10/1m, read=300/30s:token_bucket,", defaults)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := map[string]Config{
+			"auth": {RequestsPerTimeFrame: 10, TimeFrame: time.Minute, Enabled: true, Strategy: StrategySlidingWindow},
+			"read": {RequestsPerTimeFrame: 300, TimeFrame: 30 * time.Second, Enabled: true, Strategy: StrategyTokenBucket},
+		}
+		if len(policies) != len(expected) {
+			t.Fatalf("expected %d policies; got %v", len(expected), policies)
+		}
+		for name, cfg := range expected {
+			if policies[name] != cfg {
+				t.Errorf("%s: expected %+v; got %+v", name, cfg, policies[name])
+			}
+		}
+	})
+
+	t.Run("should reject invalid policies", func(t *testing.T) {
+		for _, spec := range []string{"auth", "=10/1m", "auth=10", "auth=ten/1m", "auth=10/minute"} {
+			if _, err := ParsePolicies(spec, defaults); err == nil {
+				t.Errorf("%q: expected an error", spec)
+			}
+		}
+
+		if _, err := NewPolicies(map[string]Config{"auth": {Enabled: true}}, zap.NewNop().Sugar()); err == nil {
+			t.Error("expected an error for a policy without a limit")
+		}
+	})
+
+	t.Run("should load the policies of a file", func(t *testing.T) {
+		path := t.TempDir() + "/policies.json"
+		data := `{"auth": {"requests": 5, "time_frame": "1m", "strategy": "fixed_window"}, "read": {"requests": 1, "time_frame": "1s", "disabled": true}}`
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		policies, err := LoadPolicies(path, defaults)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		auth := Config{RequestsPerTimeFrame: 5, TimeFrame: time.Minute, Enabled: true, Strategy: StrategyFixedWindow}
+		if policies["auth"] != auth || policies["read"].Enabled {
+			t.Errorf("unexpected policies %+v", policies)
+		}
+	})
+
+	t.Run("should load the disabled policies without a limit", func(t *testing.T) {
+		path := t.TempDir() + "/policies.json"
+		if err := os.WriteFile(path, []byte(`{"auth": {"disabled": true}}`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		policies, err := LoadPolicies(path, defaults)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if policies["auth"].Enabled {
+			t.Errorf("expected the auth policy to be disabled; got %+v", policies["auth"])
+		}
+	})
+
+	t.Run("should reject the enabled policies without requests", func(t *testing.T) {
+		path := t.TempDir() + "/policies.json"
+		if err := os.WriteFile(path, []byte(`{"auth": {"time_frame": "1m"}}`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := LoadPolicies(path, defaults); err == nil {
+			t.Error("expected an error for a policy without requests")
+		}
+	})
+
+	t.Run("should limit each policy separately", func(t *testing.T) {
+		p, err := NewPolicies(map[string]Config{
+			"auth": {RequestsPerTimeFrame: 1, TimeFrame: time.Minute, Enabled: true},
+			"read": {RequestsPerTimeFrame: 2, TimeFrame: time.Minute, Enabled: true},
+			"off":  {RequestsPerTimeFrame: 1, TimeFrame: time.Minute},
+		}, zap.NewNop().Sugar())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Close()
+
+		if allow, _ := p.Allow("auth", "client"); !allow {
+			t.Error("expected the first auth request to be allowed")
+		}
+		if allow, _ := p.Allow("auth", "client"); allow {
+			t.Error("expected the second auth request to be denied")
+		}
+		if allow, _ := p.Allow("read", "client"); !allow {
+			t.Error("expected the read request to be allowed")
+		}
+
+		// Disabled and unknown policies don't limit
+		for range 3 {
+			if allow, _ := p.Allow("off", "client"); !allow {
+				t.Error("expected the requests of a disabled policy to be allowed")
+			}
+			if allow, _ := p.Allow("unknown", "client"); !allow {
+				t.Error("expected the requests of an unknown policy to be allowed")
+			}
+		}
+	})
+}
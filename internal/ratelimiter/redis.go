@@ -0,0 +1,386 @@
+package ratelimiter
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+	// Prefix of the keys of the counters
+	Prefix string
+	// Max time of a request to Redis
+	Timeout time.Duration
+	// Max connections open, they're kept open while idle
+	PoolSize int
+	// Whether the requests are allowed while Redis is unavailable, they're
+	// denied otherwise
+	FailOpen bool
+}
+
+// Token bucket run atomically by Redis, with the time of the server so the
+// instances agree on it. Takes the limit and the time frame in milliseconds,
+// returns whether the request is allowed and the milliseconds to wait
+// before retrying otherwise. The bucket expires once it would be full again.
+const tokenBucketScript = `
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1]) or limit
+local ts = tonumber(bucket[2]) or now
+tokens = math.min(limit, tokens + math.max(now - ts, 0) * limit / window)
+
+local allowed, retry = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) * window / limit)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], window)
+return {allowed, retry}
+`
+
+var tokenBucketSHA = scriptSHA(tokenBucketScript)
+
+// RedisLimiter is a token bucket kept in Redis, or any server speaking its
+// protocol, so all the instances of the API share the limits of a client.
+// When Redis is unavailable requests are allowed or denied by the fail
+// policy of the config.
+type RedisLimiter struct {
+	client *redisClient
+	cfg    RedisConfig
+	limit  int
+	window time.Duration
+	logger *zap.SugaredLogger
+	// Whether the last request to Redis failed, to log once per outage
+	failing atomic.Bool
+}
+
+func NewRedisLimiter(cfg RedisConfig, limit int, timeFrame time.Duration, logger *zap.SugaredLogger) *RedisLimiter {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 100 * time.Millisecond
+	}
+
+	return &RedisLimiter{
+		client: newRedisClient(cfg),
+		cfg:    cfg,
+		limit:  limit,
+		window: timeFrame,
+		logger: logger,
+	}
+}
+
+func (rl *RedisLimiter) Allow(remoteAddr string) (bool, time.Duration) {
+	allowed, retryAfter, err := rl.take(rl.cfg.Prefix + remoteAddr)
+	if err != nil {
+		if !rl.failing.Swap(true) {
+			rl.logger.Errorw("rate limiter backend unavailable", "addr", rl.cfg.Addr, "fail_open", rl.cfg.FailOpen, "error", err)
+		}
+
+		if rl.cfg.FailOpen {
+			return true, 0
+		}
+		return false, time.Second
+	}
+
+	if rl.failing.Swap(false) {
+		rl.logger.Infow("rate limiter backend available again", "addr", rl.cfg.Addr)
+	}
+
+	return allowed, retryAfter
+}
+
+func (rl *RedisLimiter) Close() error {
+	return rl.client.Close()
+}
+
+// Takes a token of the client's bucket, loading the script when Redis
+// doesn't have it cached yet
+func (rl *RedisLimiter) take(key string) (bool, time.Duration, error) {
+	args := []string{"1", key, strconv.Itoa(rl.limit), strconv.FormatInt(rl.window.Milliseconds(), 10)}
+
+	reply, err := rl.client.Do(append([]string{"EVALSHA", tokenBucketSHA}, args...)...)
+	var redisErr redisError
+	if errors.As(err, &redisErr) && strings.HasPrefix(string(redisErr), "NOSCRIPT") {
+		reply, err = rl.client.Do(append([]string{"EVAL", tokenBucketScript}, args...)...)
+	}
+	if err != nil {
+		return false, 0, err
+	}
+
+	values, ok := reply.([]any)
+	if !ok || len(values) != 2 {
+		return false, 0, fmt.Errorf("unexpected reply of the rate limit script: %v", reply)
+	}
+	allowed, ok1 := values[0].(int64)
+	retry, ok2 := values[1].(int64)
+	if !ok1 || !ok2 {
+		return false, 0, fmt.Errorf("unexpected reply of the rate limit script: %v", reply)
+	}
+
+	return allowed == 1, time.Duration(retry) * time.Millisecond, nil
+}
+
+func scriptSHA(script string) string {
+	sum := sha1.Sum([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+// redisError is an error reply of Redis, the connection remains usable
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// redisClient is a minimal client of the Redis protocol with a pool of
+// connections
+type redisClient struct {
+	cfg  RedisConfig
+	pool chan *redisConn
+	// A slot is taken by every open connection, idle or not
+	slots chan struct{}
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// sendError is a failure to send a command, which never reached Redis
+type sendError struct{ err error }
+
+func (e sendError) Error() string { return e.err.Error() }
+func (e sendError) Unwrap() error { return e.err }
+
+func newRedisClient(cfg RedisConfig) *redisClient {
+	size := max(cfg.PoolSize, 1)
+
+	return &redisClient{
+		cfg:   cfg,
+		pool:  make(chan *redisConn, size),
+		slots: make(chan struct{}, size),
+	}
+}
+
+// Sends the command and returns its reply: a string, an int64, a slice of
+// replies, nil or a redisError
+func (c *redisClient) Do(args ...string) (any, error) {
+	reply, err := c.do(args...)
+
+	// Commands that weren't sent are sent once more on a new connection.
+	// Once sent a command may have run even if its reply is lost, e.g. on a
+	// read timeout, so it's never sent again.
+	var sendErr sendError
+	if errors.As(err, &sendErr) {
+		return c.do(args...)
+	}
+
+	return reply, err
+}
+
+func (c *redisClient) do(args ...string) (any, error) {
+	conn, err := c.get()
+	if err != nil {
+		return nil, sendError{err}
+	}
+
+	reply, err := conn.do(c.cfg.Timeout, args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		// The connection is in an unknown state
+		c.discard(conn)
+		return nil, err
+	}
+
+	c.put(conn)
+	return reply, err
+}
+
+func (c *redisClient) Close() error {
+	for {
+		select {
+		case conn := <-c.pool:
+			c.discard(conn)
+		default:
+			return nil
+		}
+	}
+}
+
+// Returns an idle connection of the pool, or a new one while there are
+// fewer open connections than the pool size. Waits for one of them up to
+// the timeout otherwise.
+func (c *redisClient) get() (*redisConn, error) {
+	timer := time.NewTimer(c.cfg.Timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case conn := <-c.pool:
+			if conn.alive() {
+				return conn, nil
+			}
+			// Closed by the server while idle
+			c.discard(conn)
+			continue
+		default:
+		}
+
+		select {
+		case conn := <-c.pool:
+			if conn.alive() {
+				return conn, nil
+			}
+			c.discard(conn)
+		case c.slots <- struct{}{}:
+			conn, err := c.dial()
+			if err != nil {
+				<-c.slots
+				return nil, err
+			}
+			return conn, nil
+		case <-timer.C:
+			return nil, errors.New("redis pool exhausted")
+		}
+	}
+}
+
+func (c *redisClient) dial() (*redisConn, error) {
+	netConn, err := net.DialTimeout("tcp", c.cfg.Addr, c.cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: netConn, r: bufio.NewReader(netConn)}
+
+	if c.cfg.Password != "" {
+		if _, err := conn.do(c.cfg.Timeout, "AUTH", c.cfg.Password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis auth: %w", err)
+		}
+	}
+	if c.cfg.DB != 0 {
+		if _, err := conn.do(c.cfg.Timeout, "SELECT", strconv.Itoa(c.cfg.DB)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis select: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+func (c *redisClient) put(conn *redisConn) {
+	select {
+	case c.pool <- conn:
+	default:
+		c.discard(conn)
+	}
+}
+
+// Closes the connection, freeing its slot
+func (c *redisClient) discard(conn *redisConn) {
+	conn.Close()
+	<-c.slots
+}
+
+// Reports whether the idle connection is still open, reading nothing from
+// it as an idle connection has nothing to read
+func (conn *redisConn) alive() bool {
+	if err := conn.SetReadDeadline(time.Now()); err != nil {
+		return false
+	}
+
+	_, err := conn.r.Peek(1)
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (conn *redisConn) do(timeout time.Duration, args ...string) (any, error) {
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, sendError{err}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(conn, sb.String()); err != nil {
+		return nil, sendError{err}
+	}
+
+	return readReply(conn.r)
+}
+
+// Reads a reply of the Redis protocol
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		// The elements after an error reply are read too, so the connection
+		// stays usable for the next command
+		values := make([]any, n)
+		var firstErr error
+		for i := range values {
+			values[i], err = readReply(r)
+			var redisErr redisError
+			if err != nil && !errors.As(err, &redisErr) {
+				return nil, err
+			}
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unexpected redis reply %q", line)
+	}
+}
@@ -0,0 +1,326 @@
+package ratelimiter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// redisStandIn is a minimal server of the Redis protocol running the token
+// bucket script, which it emulates as it can't run Lua
+type redisStandIn struct {
+	listener net.Listener
+	password string
+	// Delay of the replies, to time the requests out
+	delay time.Duration
+
+	mu       sync.Mutex
+	scripts  map[string]bool
+	buckets  map[string]*tokenBucket
+	commands []string
+}
+
+func newRedisStandIn(t *testing.T, password string) *redisStandIn {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &redisStandIn{
+		listener: listener,
+		password: password,
+		scripts:  map[string]bool{},
+		buckets:  map[string]*tokenBucket{},
+	}
+	go s.serve()
+
+	return s
+}
+
+func (s *redisStandIn) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *redisStandIn) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *redisStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	authed := s.password == ""
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, args[0])
+		delay := s.delay
+		s.mu.Unlock()
+
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "AUTH":
+			authed = args[1] == s.password
+			reply = "+OK"
+			if !authed {
+				reply = "-WRONGPASS invalid password"
+			}
+		case "EVAL", "EVALSHA":
+			if !authed {
+				reply = "-NOAUTH Authentication required."
+				break
+			}
+			reply = s.eval(args)
+		default:
+			reply = "-ERR unknown command"
+		}
+
+		time.Sleep(delay)
+		if _, err := conn.Write([]byte(reply + "\r\n")); err != nil {
+			return
+		}
+	}
+}
+
+// Runs the token bucket like the script, caching it on EVAL
+func (s *redisStandIn) eval(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if strings.ToUpper(args[0]) == "EVAL" {
+		if args[1] != tokenBucketScript {
+			return "-ERR unknown script"
+		}
+		s.scripts[scriptSHA(args[1])] = true
+	} else if !s.scripts[args[1]] {
+		return "-NOSCRIPT No matching script. Please use EVAL."
+	}
+
+	key := args[3]
+	limit, _ := strconv.ParseFloat(args[4], 64)
+	window, _ := strconv.ParseFloat(args[5], 64)
+	now := time.Now()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: limit, last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = min(limit, b.tokens+float64(now.Sub(b.last).Milliseconds())*limit/window)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return "*2\r\n:1\r\n:0"
+	}
+	return fmt.Sprintf("*2\r\n:0\r\n:%d", int64(math.Ceil((1-b.tokens)*window/limit)))
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	reply, err := readReply(r)
+	if err != nil {
+		return nil, err
+	}
+
+	values, ok := reply.([]any)
+	if !ok || len(values) == 0 {
+		return nil, fmt.Errorf("expected a command, got %v", reply)
+	}
+
+	args := make([]string, len(values))
+	for i, v := range values {
+		args[i], _ = v.(string)
+	}
+	return args, nil
+}
+
+func TestRedisLimiter(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+
+	t.Run("should share the limit between the instances", func(t *testing.T) {
+		server := newRedisStandIn(t, "secret")
+		cfg := RedisConfig{Addr: server.addr(), Password: "secret", Prefix: "ratelimit:"}
+
+		first := NewRedisLimiter(cfg, 3, time.Minute, logger)
+		defer first.Close()
+		second := NewRedisLimiter(cfg, 3, time.Minute, logger)
+		defer second.Close()
+
+		for i, l := range []Limiter{first, second, first} {
+			if allow, _ := l.Allow("ip:10.0.0.1"); !allow {
+				t.Fatalf("expected request %d to be allowed", i+1)
+			}
+		}
+
+		allow, retryAfter := second.Allow("ip:10.0.0.1")
+		if allow || retryAfter <= 0 || retryAfter > time.Minute {
+			t.Errorf("expected a denial with a retry delay; got %v %s", allow, retryAfter)
+		}
+
+		if allow, _ := second.Allow("ip:10.0.0.2"); !allow {
+			t.Error("expected another client to be allowed")
+		}
+
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		if _, ok := server.buckets["ratelimit:ip:10.0.0.1"]; !ok {
+			t.Errorf("expected the key to be prefixed; got %v", server.buckets)
+		}
+	})
+
+	t.Run("should load the script once", func(t *testing.T) {
+		server := newRedisStandIn(t, "")
+
+		l := NewRedisLimiter(RedisConfig{Addr: server.addr()}, 10, time.Minute, logger)
+		defer l.Close()
+
+		for range 3 {
+			l.Allow("client")
+		}
+
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		expected := []string{"EVALSHA", "EVAL", "EVALSHA", "EVALSHA"}
+		if strings.Join(server.commands, " ") != strings.Join(expected, " ") {
+			t.Errorf("expected the commands %v; got %v", expected, server.commands)
+		}
+	})
+
+	t.Run("should apply the fail policy when the backend is unavailable", func(t *testing.T) {
+		server := newRedisStandIn(t, "")
+		addr := server.addr()
+		server.listener.Close()
+
+		open := NewRedisLimiter(RedisConfig{Addr: addr, FailOpen: true}, 1, time.Minute, logger)
+		defer open.Close()
+		closed := NewRedisLimiter(RedisConfig{Addr: addr}, 1, time.Minute, logger)
+		defer closed.Close()
+
+		for range 3 {
+			if allow, _ := open.Allow("client"); !allow {
+				t.Error("expected the fail-open limiter to allow the request")
+			}
+			if allow, retryAfter := closed.Allow("client"); allow || retryAfter <= 0 {
+				t.Error("expected the fail-closed limiter to deny the request")
+			}
+		}
+	})
+
+	t.Run("should fail on a wrong password", func(t *testing.T) {
+		server := newRedisStandIn(t, "secret")
+
+		l := NewRedisLimiter(RedisConfig{Addr: server.addr(), Password: "wrong"}, 1, time.Minute, logger)
+		defer l.Close()
+
+		if allow, _ := l.Allow("client"); allow {
+			t.Error("expected the request to be denied")
+		}
+	})
+
+	t.Run("should reconnect after the server closes the idle connections", func(t *testing.T) {
+		server := newRedisStandIn(t, "")
+
+		l := NewRedisLimiter(RedisConfig{Addr: server.addr()}, 10, time.Minute, logger)
+		defer l.Close()
+
+		l.Allow("client")
+
+		// Closes the pooled connection as the server would
+		conn := <-l.client.pool
+		conn.Conn.Close()
+		l.client.pool <- conn
+
+		if _, _, err := l.take("client"); err != nil {
+			t.Errorf("expected the request to be sent on a new connection; got %v", err)
+		}
+	})
+	t.Run("should not send the command again when its reply times out", func(t *testing.T) {
+		server := newRedisStandIn(t, "")
+
+		l := NewRedisLimiter(RedisConfig{Addr: server.addr(), Timeout: 20 * time.Millisecond}, 10, time.Minute, logger)
+		defer l.Close()
+
+		// The script is loaded and the connection pooled
+		if _, _, err := l.take("client"); err != nil {
+			t.Fatal(err)
+		}
+
+		server.mu.Lock()
+		server.delay = 50 * time.Millisecond
+		server.commands = nil
+		server.mu.Unlock()
+
+		if _, _, err := l.take("client"); err == nil {
+			t.Fatal("expected the request to time out")
+		}
+
+		time.Sleep(100 * time.Millisecond)
+
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		if len(server.commands) != 1 {
+			t.Errorf("expected the command to be sent once; got %v", server.commands)
+		}
+	})
+
+	t.Run("should not open more connections than the pool size", func(t *testing.T) {
+		server := newRedisStandIn(t, "")
+
+		l := NewRedisLimiter(RedisConfig{Addr: server.addr(), PoolSize: 1, Timeout: 20 * time.Millisecond}, 10, time.Minute, logger)
+		defer l.Close()
+
+		conn, err := l.client.get()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := l.take("client"); err == nil {
+			t.Error("expected the request to wait for the busy connection")
+		}
+
+		l.client.put(conn)
+		if _, _, err := l.take("client"); err != nil {
+			t.Errorf("expected the request to reuse the connection; got %v", err)
+		}
+	})
+}
+
+func TestReadReply(t *testing.T) {
+	t.Run("should read the whole array with an error element", func(t *testing.T) {
+		r := bufio.NewReader(strings.NewReader("*3\r\n:1\r\n-ERR failed\r\n$2\r\nok\r\n+NEXT\r\n"))
+
+		_, err := readReply(r)
+		var redisErr redisError
+		if !errors.As(err, &redisErr) || string(redisErr) != "ERR failed" {
+			t.Fatalf("expected the error element; got %v", err)
+		}
+
+		next, err := readReply(r)
+		if err != nil || next != "NEXT" {
+			t.Errorf("expected the next reply; got %v %v", next, err)
+		}
+	})
+}
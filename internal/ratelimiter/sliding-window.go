@@ -0,0 +1,88 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// SlidingWindowLimiter keeps a log of the times of the allowed requests of
+// each client, and allows a request when less than limit of them were made
+// in the time frame before it
+type SlidingWindowLimiter struct {
+	sync.Mutex
+	clients map[string]*requestLog
+	limit   int
+	window  time.Duration
+	now     func() time.Time
+	janitor *janitor
+}
+
+// requestLog is a ring buffer with the times of the last allowed requests in
+// Unix nanoseconds, oldest first
+type requestLog struct {
+	times []int64
+	start int
+	size  int
+}
+
+func NewSlidingWindowLimiter(limit int, timeFrame time.Duration) *SlidingWindowLimiter {
+	rl := &SlidingWindowLimiter{
+		clients: make(map[string]*requestLog),
+		limit:   limit,
+		window:  timeFrame,
+		now:     time.Now,
+	}
+	rl.janitor = startJanitor(timeFrame, rl.evict)
+
+	return rl
+}
+
+func (rl *SlidingWindowLimiter) Allow(remoteAddr string) (bool, time.Duration) {
+	now := rl.now()
+
+	rl.Lock()
+	defer rl.Unlock()
+
+	log, exists := rl.clients[remoteAddr]
+	if !exists {
+		log = &requestLog{times: make([]int64, max(rl.limit, 1))}
+		rl.clients[remoteAddr] = log
+	}
+	log.expire(now.Add(-rl.window))
+
+	if log.size < rl.limit {
+		log.times[(log.start+log.size)%len(log.times)] = now.UnixNano()
+		log.size++
+		return true, 0
+	}
+
+	// Wait for the oldest request to leave the window
+	return false, time.Unix(0, log.times[log.start]).Add(rl.window).Sub(now)
+}
+
+func (rl *SlidingWindowLimiter) Close() error {
+	return rl.janitor.Close()
+}
+
+// Forgets the clients without requests in the time frame
+func (rl *SlidingWindowLimiter) evict() {
+	cutoff := rl.now().Add(-rl.window)
+
+	rl.Lock()
+	defer rl.Unlock()
+
+	for client, log := range rl.clients {
+		log.expire(cutoff)
+		if log.size == 0 {
+			delete(rl.clients, client)
+		}
+	}
+}
+
+// Drops the requests made up to the cutoff
+func (l *requestLog) expire(cutoff time.Time) {
+	for l.size > 0 && l.times[l.start] <= cutoff.UnixNano() {
+		l.start = (l.start + 1) % len(l.times)
+		l.size--
+	}
+}
@@ -0,0 +1,83 @@
+package ratelimiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucketLimiter gives each client a bucket of limit tokens, refilled at
+// limit tokens per time frame. Every request takes a token, so a client can
+// burst up to the limit and then keeps the average rate.
+type TokenBucketLimiter struct {
+	sync.Mutex
+	clients map[string]*tokenBucket
+	limit   float64
+	// Tokens refilled per second
+	rate    float64
+	window  time.Duration
+	now     func() time.Time
+	janitor *janitor
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucketLimiter(limit int, timeFrame time.Duration) *TokenBucketLimiter {
+	rl := &TokenBucketLimiter{
+		clients: make(map[string]*tokenBucket),
+		limit:   float64(limit),
+		rate:    float64(limit) / timeFrame.Seconds(),
+		window:  timeFrame,
+		now:     time.Now,
+	}
+	rl.janitor = startJanitor(timeFrame, rl.evict)
+
+	return rl
+}
+
+func (rl *TokenBucketLimiter) Allow(remoteAddr string) (bool, time.Duration) {
+	now := rl.now()
+
+	rl.Lock()
+	defer rl.Unlock()
+
+	b, exists := rl.clients[remoteAddr]
+	if !exists {
+		b = &tokenBucket{tokens: rl.limit, last: now}
+		rl.clients[remoteAddr] = b
+	}
+
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(rl.limit, b.tokens+elapsed.Seconds()*rl.rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	// Time until the next token, rounded up so retrying then is allowed
+	return false, time.Duration(math.Ceil((1 - b.tokens) / rl.rate * float64(time.Second)))
+}
+
+func (rl *TokenBucketLimiter) Close() error {
+	return rl.janitor.Close()
+}
+
+// Forgets the clients whose bucket is full again, they're like new ones
+func (rl *TokenBucketLimiter) evict() {
+	now := rl.now()
+
+	rl.Lock()
+	defer rl.Unlock()
+
+	for client, b := range rl.clients {
+		if b.tokens+now.Sub(b.last).Seconds()*rl.rate >= rl.limit {
+			delete(rl.clients, client)
+		}
+	}
+}
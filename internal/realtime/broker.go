@@ -0,0 +1,192 @@
+package realtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+const (
+	BrokerLocal    = "local"
+	BrokerPostgres = "postgres"
+)
+
+// Broker shares the events between the hubs of several API instances
+type Broker interface {
+	// Sends the event to the other instances
+	Publish(context.Context, Event) error
+	// Starts calling deliver with the events published by the other
+	// instances, until the broker is closed
+	Listen(deliver func(Event)) error
+	Close() error
+}
+
+// MemoryBus connects the hubs of a single process, standing in for a network
+// broker in tests and single binary setups
+type MemoryBus struct {
+	mu      sync.RWMutex
+	brokers []*memoryBroker
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+// Returns a new broker connected to the bus, one per hub
+func (b *MemoryBus) Broker() Broker {
+	broker := &memoryBroker{bus: b}
+
+	b.mu.Lock()
+	b.brokers = append(b.brokers, broker)
+	b.mu.Unlock()
+
+	return broker
+}
+
+type memoryBroker struct {
+	bus *MemoryBus
+
+	mu      sync.RWMutex
+	deliver func(Event)
+}
+
+func (m *memoryBroker) Publish(ctx context.Context, event Event) error {
+	m.bus.mu.RLock()
+	defer m.bus.mu.RUnlock()
+
+	for _, broker := range m.bus.brokers {
+		if broker == m {
+			continue
+		}
+
+		broker.mu.RLock()
+		if broker.deliver != nil {
+			broker.deliver(event)
+		}
+		broker.mu.RUnlock()
+	}
+
+	return nil
+}
+
+func (m *memoryBroker) Listen(deliver func(Event)) error {
+	m.mu.Lock()
+	m.deliver = deliver
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *memoryBroker) Close() error {
+	m.mu.Lock()
+	m.deliver = nil
+	m.mu.Unlock()
+
+	return nil
+}
+
+// NOTIFY payloads must be shorter than 8000 bytes
+const maxNotifyPayload = 7999
+
+var ErrEventTooLarge = errors.New("event too large for the broker")
+
+type postgresMessage struct {
+	Instance string `json:"instance"`
+	Event    Event  `json:"event"`
+}
+
+// PostgresBroker shares the events through LISTEN/NOTIFY on a channel of
+// the database, so no other service is needed to run several instances.
+// Events published while an instance is reconnecting are lost to its clients.
+type PostgresBroker struct {
+	db       *sql.DB
+	listener *pq.Listener
+	channel  string
+	instance string
+	logger   *zap.SugaredLogger
+	done     chan struct{} // closed when the listening goroutine returns
+}
+
+// Creates a broker notifying through db and listening with a dedicated
+// connection to addr
+func NewPostgresBroker(db *sql.DB, addr, channel string, logger *zap.SugaredLogger) *PostgresBroker {
+	listener := pq.NewListener(addr, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Warnw("realtime broker connection", "event", ev, "error", err)
+		}
+	})
+
+	return &PostgresBroker{
+		db:       db,
+		listener: listener,
+		channel:  channel,
+		instance: uuid.NewString(),
+		logger:   logger,
+	}
+}
+
+func (b *PostgresBroker) Publish(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(postgresMessage{Instance: b.instance, Event: event})
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxNotifyPayload {
+		return fmt.Errorf("%w: %d bytes", ErrEventTooLarge, len(payload))
+	}
+
+	_, err = b.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", b.channel, string(payload))
+	return err
+}
+
+func (b *PostgresBroker) Listen(deliver func(Event)) error {
+	if err := b.listener.Listen(b.channel); err != nil {
+		return err
+	}
+
+	b.done = make(chan struct{})
+	go func() {
+		defer close(b.done)
+
+		// Notify is closed by the listener on Close
+		for notification := range b.listener.Notify {
+			// nil after a reconnection
+			if notification == nil {
+				continue
+			}
+
+			var msg postgresMessage
+			if err := json.Unmarshal([]byte(notification.Extra), &msg); err != nil {
+				b.logger.Errorw("invalid realtime broker message", "error", err)
+				continue
+			}
+
+			// NOTIFY reaches the sender too, its events are already delivered
+			if msg.Instance == b.instance {
+				continue
+			}
+
+			deliver(msg.Event)
+		}
+	}()
+
+	return nil
+}
+
+func (b *PostgresBroker) Close() error {
+	if err := b.listener.Close(); err != nil {
+		return err
+	}
+
+	if b.done != nil {
+		<-b.done
+	}
+	return nil
+}
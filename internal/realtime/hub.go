@@ -0,0 +1,420 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"go.uber.org/zap"
+)
+
+// Event kinds
+const (
+	KindPostCreated    = "post.created"
+	KindCommentCreated = "comment.created"
+	KindNotification   = "notification"
+	KindTyping         = "typing"
+	KindMessageCreated = "message.created"
+	KindMessageRead    = "message.read"
+	// Sent when the events after Last-Event-ID are no longer in the history,
+	// the client should reload instead of relying on the stream
+	KindReset = "reset"
+)
+
+// Kinds not kept in the history, resuming a stream doesn't replay them
+var transientKinds = map[string]bool{
+	KindTyping: true,
+}
+
+// Max time sending an event to the broker is allowed to run
+const brokerTimeout = 5 * time.Second
+
+func UserTopic(userId uint32) string   { return fmt.Sprintf("user:%d", userId) }
+func AuthorTopic(userId uint32) string { return fmt.Sprintf("author:%d", userId) }
+func PostTopic(postId uint32) string   { return fmt.Sprintf("post:%d", postId) }
+func TagTopic(tag string) string       { return "tag:" + tag }
+
+// Event is a published event. Ids are assigned by the hub delivering it, so
+// they are only meaningful to the clients of the same instance.
+type Event struct {
+	Id      uint64          `json:"-"`
+	Kind    string          `json:"kind"`
+	Topics  []string        `json:"topics"`
+	ActorId uint32          `json:"actor_id"` // the user that caused the event, used to hide blocked users
+	Data    json.RawMessage `json:"data"`
+}
+
+const defaultHeartbeat = 15 * time.Second
+
+type Config struct {
+	// Events buffered per connection before it's considered too slow and dropped
+	BufferSize int
+	// Recent events kept for Last-Event-ID resume
+	HistorySize int
+	// Interval of the keep-alive messages sent on idle connections
+	Heartbeat time.Duration
+	// Broker sharing the events between the API instances, BrokerLocal or
+	// BrokerPostgres
+	Broker string
+}
+
+// Subscription receives the events of its topics on C. C is closed when the
+// hub shuts down or when the subscriber falls behind, in which case Lagging
+// reports true and the client should reconnect with Last-Event-ID.
+type Subscription struct {
+	C <-chan Event
+
+	c       chan Event
+	topics  map[string]bool
+	lagging bool
+	closed  bool
+}
+
+func (s *Subscription) Lagging() bool {
+	return s.lagging
+}
+
+// Event ids carry the instance of the hub that issued them in their high
+// bits, the rest is a sequence. Every instance numbers the events it delivers
+// on its own, so only the ids issued by the hub can be resumed. The ids fit
+// in 53 bits, so JavaScript clients read them exactly.
+const (
+	idBits       = 53
+	sequenceBits = 42
+)
+
+// Hub is an in-process pub/sub of real-time events with a bounded history
+type Hub struct {
+	cfg    Config
+	broker Broker
+	logger *zap.SugaredLogger
+
+	instance uint64
+
+	mu      sync.Mutex
+	nextId  uint64
+	history []Event // ring buffer
+	start   int     // index of the oldest event in history
+	evicted uint64  // id of the last event evicted from history
+	subs    map[*Subscription]struct{}
+	topics  map[string]map[*Subscription]struct{}
+	closed  bool
+}
+
+func NewHub(cfg Config, logger *zap.SugaredLogger) *Hub {
+	if cfg.BufferSize < 1 {
+		cfg.BufferSize = 1
+	}
+	if cfg.Heartbeat <= 0 {
+		cfg.Heartbeat = defaultHeartbeat
+	}
+
+	// The instance is random and the sequence starts at the current time, so
+	// the ids of the other instances and of the previous runs of this one
+	// don't match the events of this hub
+	instance := rand.Uint64N(1<<(idBits-sequenceBits)-1) + 1
+	firstId := instance<<sequenceBits | uint64(time.Now().UnixMilli())
+
+	return &Hub{
+		cfg:      cfg,
+		logger:   logger,
+		instance: instance,
+		nextId:   firstId,
+		evicted:  firstId,
+		history:  make([]Event, 0, cfg.HistorySize),
+		subs:     map[*Subscription]struct{}{},
+		topics:   map[string]map[*Subscription]struct{}{},
+	}
+}
+
+func (h *Hub) Config() Config {
+	return h.cfg
+}
+
+// Connects the hub to the broker, so the events published by the other
+// instances reach the local subscribers and the other way around. It must be
+// called before any event is published.
+func (h *Hub) Connect(broker Broker) error {
+	h.broker = broker
+	return broker.Listen(h.deliver)
+}
+
+// Publishes the event to the subscribers of any of the topics, in this
+// instance and, through the broker, in the others
+func (h *Hub) Publish(kind string, topics []string, actorId uint32, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	event := Event{
+		Kind:    kind,
+		Topics:  topics,
+		ActorId: actorId,
+		Data:    raw,
+	}
+	h.deliver(event)
+
+	if h.broker == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), brokerTimeout)
+	defer cancel()
+
+	return h.broker.Publish(ctx, event)
+}
+
+// Delivers the event to the local subscribers. Each subscriber receives the
+// event once. Subscribers with a full buffer are dropped instead of blocking
+// the publisher.
+func (h *Hub) deliver(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+
+	h.nextId++
+	event.Id = h.nextId
+	if !transientKinds[event.Kind] {
+		h.remember(event)
+	}
+
+	delivered := map[*Subscription]bool{}
+	for _, topic := range event.Topics {
+		for sub := range h.topics[topic] {
+			if delivered[sub] {
+				continue
+			}
+			delivered[sub] = true
+
+			select {
+			case sub.c <- event:
+			default:
+				sub.lagging = true
+				h.unsubscribe(sub)
+			}
+		}
+	}
+}
+
+// Subscribes to the topics. When lastEventId is not zero, the events of the
+// topics published after it are replayed first, or a reset event is sent if
+// they are no longer in the history.
+func (h *Hub) Subscribe(topics []string, lastEventId uint64) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &Subscription{topics: map[string]bool{}}
+	for _, topic := range topics {
+		sub.topics[topic] = true
+	}
+
+	var replay []Event
+	if lastEventId != 0 {
+		replay = h.replay(sub, lastEventId)
+	}
+
+	sub.c = make(chan Event, h.cfg.BufferSize+len(replay))
+	sub.C = sub.c
+	for _, event := range replay {
+		sub.c <- event
+	}
+
+	if h.closed {
+		sub.closed = true
+		close(sub.c)
+		return sub
+	}
+
+	h.subs[sub] = struct{}{}
+	for topic := range sub.topics {
+		if h.topics[topic] == nil {
+			h.topics[topic] = map[*Subscription]struct{}{}
+		}
+		h.topics[topic][sub] = struct{}{}
+	}
+
+	return sub
+}
+
+// Adds the topic to the subscription. Past events of the topic are not replayed.
+func (h *Hub) Join(sub *Subscription, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if sub.closed || sub.topics[topic] {
+		return
+	}
+
+	sub.topics[topic] = true
+	if h.topics[topic] == nil {
+		h.topics[topic] = map[*Subscription]struct{}{}
+	}
+	h.topics[topic][sub] = struct{}{}
+}
+
+func (h *Hub) Leave(sub *Subscription, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if sub.closed || !sub.topics[topic] {
+		return
+	}
+
+	delete(sub.topics, topic)
+	delete(h.topics[topic], sub)
+	if len(h.topics[topic]) == 0 {
+		delete(h.topics, topic)
+	}
+}
+
+// Reports whether the subscription receives the events of the topic
+func (h *Hub) Joined(sub *Subscription, topic string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return sub.topics[topic]
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.unsubscribe(sub)
+}
+
+// Closes every subscription and ignores the events published afterwards
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subs {
+		h.unsubscribe(sub)
+	}
+}
+
+// Disconnects from the broker
+func (h *Hub) Stop(ctx context.Context) error {
+	if h.broker == nil {
+		return nil
+	}
+
+	return h.broker.Close()
+}
+
+func (h *Hub) unsubscribe(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.c)
+
+	delete(h.subs, sub)
+	for topic := range sub.topics {
+		delete(h.topics[topic], sub)
+		if len(h.topics[topic]) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+}
+
+func (h *Hub) remember(event Event) {
+	if h.cfg.HistorySize <= 0 {
+		h.evicted = event.Id
+		return
+	}
+
+	if len(h.history) < h.cfg.HistorySize {
+		h.history = append(h.history, event)
+		return
+	}
+
+	h.evicted = h.history[h.start].Id
+	h.history[h.start] = event
+	h.start = (h.start + 1) % len(h.history)
+}
+
+// Returns the events of the subscription topics after lastEventId
+func (h *Hub) replay(sub *Subscription, lastEventId uint64) []Event {
+	if lastEventId == h.nextId {
+		return nil
+	}
+
+	// The id was issued by another instance or before a restart, or some of
+	// the following events are gone from the history
+	if lastEventId>>sequenceBits != h.instance || lastEventId > h.nextId || lastEventId < h.evicted {
+		return []Event{{Id: h.nextId, Kind: KindReset, Data: json.RawMessage("{}")}}
+	}
+
+	events := []Event{}
+	for i := range h.history {
+		event := h.history[(h.start+i)%len(h.history)]
+		if event.Id <= lastEventId {
+			continue
+		}
+
+		for _, topic := range event.Topics {
+			if sub.topics[topic] {
+				events = append(events, event)
+				break
+			}
+		}
+	}
+
+	return events
+}
+
+// Publishes a recorded notification to its recipient, satisfying
+// notifications.Publisher
+func (h *Hub) PublishNotification(event *model.NotificationEvent) {
+	h.publish(KindNotification, []string{UserTopic(event.UserId)}, event.ActorId, event)
+}
+
+// Publishes the post to the followers of the author and of its tags
+func (h *Hub) PostCreated(post *model.Post) {
+	topics := []string{AuthorTopic(post.UserId)}
+	for _, tag := range post.Tags {
+		topics = append(topics, TagTopic(tag))
+	}
+
+	h.publish(KindPostCreated, topics, post.UserId, post)
+}
+
+// Publishes the comment to the clients watching its post
+func (h *Hub) CommentCreated(comment *model.Comment) {
+	h.publish(KindCommentCreated, []string{PostTopic(comment.PostId)}, comment.UserId, comment)
+}
+
+// Publishes the message to the members of its conversation
+func (h *Hub) MessageCreated(message *model.Message, conversation *model.Conversation) {
+	h.publish(KindMessageCreated, memberTopics(conversation), message.SenderId, message)
+}
+
+// Publishes the read receipt to the members of the conversation
+func (h *Hub) ConversationRead(receipt *model.ReadReceipt, conversation *model.Conversation) {
+	h.publish(KindMessageRead, memberTopics(conversation), receipt.UserId, receipt)
+}
+
+// Publishes the event, logging the errors as the callers don't wait for it
+func (h *Hub) publish(kind string, topics []string, actorId uint32, data any) {
+	if err := h.Publish(kind, topics, actorId, data); err != nil {
+		h.logger.Errorw("error publishing realtime event", "kind", kind, "topics", topics, "error", err)
+	}
+}
+
+func memberTopics(conversation *model.Conversation) []string {
+	topics := make([]string, len(conversation.Members))
+	for i, member := range conversation.Members {
+		topics[i] = UserTopic(member.UserId)
+	}
+
+	return topics
+}
@@ -0,0 +1,212 @@
+package realtime
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func receive(t *testing.T, sub *Subscription) []Event {
+	t.Helper()
+
+	events := []Event{}
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestHub(t *testing.T) {
+	t.Run("should deliver the events of the subscribed topics once", func(t *testing.T) {
+		hub := NewHub(Config{BufferSize: 8, HistorySize: 8}, zap.NewNop().Sugar())
+		sub := hub.Subscribe([]string{AuthorTopic(1), TagTopic("go")}, 0)
+
+		hub.Publish(KindPostCreated, []string{AuthorTopic(1), TagTopic("go")}, 1, map[string]int{"id": 1})
+		hub.Publish(KindPostCreated, []string{AuthorTopic(2)}, 2, map[string]int{"id": 2})
+
+		events := receive(t, sub)
+		if len(events) != 1 {
+			t.Fatalf("expected 1 event; got %d", len(events))
+		}
+		if events[0].Kind != KindPostCreated || string(events[0].Data) != `{"id":1}` {
+			t.Errorf("unexpected event %+v", events[0])
+		}
+	})
+
+	t.Run("should replay the events after the last event id", func(t *testing.T) {
+		hub := NewHub(Config{BufferSize: 8, HistorySize: 8}, zap.NewNop().Sugar())
+
+		hub.Publish(KindCommentCreated, []string{PostTopic(1)}, 1, 1)
+		first := hub.Subscribe([]string{PostTopic(1)}, 0)
+		hub.Publish(KindCommentCreated, []string{PostTopic(2)}, 1, 2)
+		hub.Publish(KindCommentCreated, []string{PostTopic(1)}, 1, 3)
+
+		events := receive(t, first)
+		if len(events) != 1 {
+			t.Fatalf("expected 1 event; got %d", len(events))
+		}
+
+		sub := hub.Subscribe([]string{PostTopic(1)}, events[0].Id-2)
+		replayed := receive(t, sub)
+		if len(replayed) != 1 || replayed[0].Id != events[0].Id {
+			t.Errorf("expected event %d to be replayed; got %+v", events[0].Id, replayed)
+		}
+	})
+
+	t.Run("should send a reset when the missed events are gone", func(t *testing.T) {
+		hub := NewHub(Config{BufferSize: 8, HistorySize: 2}, zap.NewNop().Sugar())
+		first := hub.Subscribe([]string{UserTopic(1)}, 0)
+
+		for i := range 4 {
+			hub.Publish(KindNotification, []string{UserTopic(1)}, 2, i)
+		}
+
+		sub := hub.Subscribe([]string{UserTopic(1)}, receive(t, first)[0].Id)
+		events := receive(t, sub)
+		if len(events) != 1 || events[0].Kind != KindReset {
+			t.Errorf("expected a reset event; got %+v", events)
+		}
+	})
+
+	t.Run("should send a reset for the ids of another hub", func(t *testing.T) {
+		other := NewHub(Config{BufferSize: 8, HistorySize: 8}, zap.NewNop().Sugar())
+		hub := NewHub(Config{BufferSize: 8, HistorySize: 8}, zap.NewNop().Sugar())
+
+		first := other.Subscribe([]string{UserTopic(1)}, 0)
+		for _, h := range []*Hub{other, hub} {
+			for i := range 2 {
+				h.Publish(KindNotification, []string{UserTopic(1)}, 2, i)
+			}
+		}
+
+		lastEventId := receive(t, first)[0].Id
+		if lastEventId >= 1<<53 {
+			t.Errorf("expected the id to fit in 53 bits; got %d", lastEventId)
+		}
+		events := receive(t, hub.Subscribe([]string{UserTopic(1)}, lastEventId))
+		if len(events) != 1 || events[0].Kind != KindReset {
+			t.Errorf("expected a reset event; got %+v", events)
+		}
+
+		// The id of the reset resumes from this hub
+		if events := receive(t, hub.Subscribe([]string{UserTopic(1)}, events[0].Id)); len(events) != 0 {
+			t.Errorf("expected no events after the reset; got %+v", events)
+		}
+	})
+
+	t.Run("should drop the subscribers that fall behind", func(t *testing.T) {
+		hub := NewHub(Config{BufferSize: 2}, zap.NewNop().Sugar())
+		slow := hub.Subscribe([]string{UserTopic(1)}, 0)
+
+		for i := range 3 {
+			hub.Publish(KindNotification, []string{UserTopic(1)}, 2, i)
+		}
+
+		if events := receive(t, slow); len(events) != 2 {
+			t.Errorf("expected the 2 buffered events; got %d", len(events))
+		}
+		if _, ok := <-slow.C; ok {
+			t.Error("expected the subscription to be closed")
+		}
+		if !slow.Lagging() {
+			t.Error("expected the subscription to be lagging")
+		}
+	})
+
+	t.Run("should close the subscriptions on close", func(t *testing.T) {
+		hub := NewHub(Config{}, zap.NewNop().Sugar())
+		sub := hub.Subscribe([]string{UserTopic(1)}, 0)
+
+		hub.Close()
+
+		if _, ok := <-sub.C; ok {
+			t.Error("expected the subscription to be closed")
+		}
+		if sub.Lagging() {
+			t.Error("expected the subscription not to be lagging")
+		}
+
+		// Publishing after close is ignored
+		if err := hub.Publish(KindNotification, []string{UserTopic(1)}, 2, 1); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("should deliver the events of the joined topics", func(t *testing.T) {
+		hub := NewHub(Config{BufferSize: 8, HistorySize: 8}, zap.NewNop().Sugar())
+		sub := hub.Subscribe(nil, 0)
+
+		hub.Join(sub, PostTopic(1))
+		hub.Publish(KindCommentCreated, []string{PostTopic(1)}, 2, 1)
+		hub.Leave(sub, PostTopic(1))
+		hub.Publish(KindCommentCreated, []string{PostTopic(1)}, 2, 2)
+
+		if events := receive(t, sub); len(events) != 1 {
+			t.Errorf("expected 1 event; got %d", len(events))
+		}
+		if hub.Joined(sub, PostTopic(1)) {
+			t.Error("expected the topic to be left")
+		}
+	})
+
+	t.Run("should not replay transient events", func(t *testing.T) {
+		hub := NewHub(Config{BufferSize: 8, HistorySize: 8}, zap.NewNop().Sugar())
+		first := hub.Subscribe([]string{PostTopic(1)}, 0)
+
+		hub.Publish(KindTyping, []string{PostTopic(1)}, 2, 1)
+		hub.Publish(KindCommentCreated, []string{PostTopic(1)}, 2, 2)
+
+		events := receive(t, first)
+		if len(events) != 2 {
+			t.Fatalf("expected 2 events; got %d", len(events))
+		}
+
+		sub := hub.Subscribe([]string{PostTopic(1)}, events[0].Id-1)
+		replayed := receive(t, sub)
+		if len(replayed) != 1 || replayed[0].Kind != KindCommentCreated {
+			t.Errorf("expected only the comment to be replayed; got %+v", replayed)
+		}
+	})
+}
+
+func TestMemoryBus(t *testing.T) {
+	bus := NewMemoryBus()
+	first := NewHub(Config{BufferSize: 8}, zap.NewNop().Sugar())
+	second := NewHub(Config{BufferSize: 8}, zap.NewNop().Sugar())
+
+	for _, hub := range []*Hub{first, second} {
+		if err := hub.Connect(bus.Broker()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	local := first.Subscribe([]string{UserTopic(1)}, 0)
+	remote := second.Subscribe([]string{UserTopic(1)}, 0)
+
+	if err := first.Publish(KindNotification, []string{UserTopic(1)}, 2, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if events := receive(t, local); len(events) != 1 {
+		t.Errorf("expected the local hub to deliver the event once; got %d", len(events))
+	}
+	if events := receive(t, remote); len(events) != 1 || events[0].ActorId != 2 {
+		t.Errorf("expected the remote hub to deliver the event; got %+v", events)
+	}
+
+	// Stopped hubs don't receive the events of the others
+	if err := second.Stop(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	first.Publish(KindNotification, []string{UserTopic(1)}, 2, 2)
+
+	if events := receive(t, remote); len(events) != 0 {
+		t.Errorf("expected no events after stop; got %d", len(events))
+	}
+}
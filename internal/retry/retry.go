@@ -0,0 +1,40 @@
+package retry
+
+import "time"
+
+// Config is the retry policy of the background queues: the jobs, the events,
+// the emails and the webhook deliveries
+type Config struct {
+	// Attempts before giving up, at least one
+	MaxAttempts int
+	// Delay before the first retry, doubled on every attempt up to BackoffMax
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+}
+
+// Returns the config with at least one attempt
+func (c Config) Normalize() Config {
+	if c.MaxAttempts < 1 {
+		c.MaxAttempts = 1
+	}
+	return c
+}
+
+// Returns the delay before the retry following the given attempt
+func (c Config) Backoff(attempt int) time.Duration {
+	return Backoff(c.BackoffBase, c.BackoffMax, attempt)
+}
+
+// Returns the delay before the retry following the given attempt, doubling
+// from base and capped at max when set
+func Backoff(base, max time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 1; i < attempt && (max <= 0 || delay < max); i++ {
+		delay *= 2
+	}
+
+	if max > 0 && delay > max {
+		return max
+	}
+	return delay
+}
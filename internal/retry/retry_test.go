@@ -0,0 +1,27 @@
+package retry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second}
+
+	cfg := Config{BackoffBase: time.Second, BackoffMax: 10 * time.Second}
+	for i, delay := range expected {
+		if got := cfg.Backoff(i + 1); got != delay {
+			t.Errorf("attempt %d: expected %s; got %s", i+1, delay, got)
+		}
+	}
+
+	if got := Backoff(time.Second, 0, 4); got != 8*time.Second {
+		t.Errorf("expected no cap without a max; got %s", got)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if cfg := (Config{}).Normalize(); cfg.MaxAttempts != 1 {
+		t.Errorf("expected at least one attempt; got %d", cfg.MaxAttempts)
+	}
+}
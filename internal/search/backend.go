@@ -0,0 +1,422 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/store"
+	"go.uber.org/zap"
+)
+
+const (
+	BackendPostgres = "postgres"
+	BackendEmbedded = "embedded"
+)
+
+// Number of words kept in the highlighted snippets of the embedded backend
+const snippetWords = 20
+
+type Config struct {
+	Backend      string
+	IndexPath    string
+	SaveInterval time.Duration
+}
+
+// Backend serves /v1/search and is notified when posts and comments change
+type Backend interface {
+	SearchPosts(context.Context, uint32, store.SearchQuery) ([]*model.PostSearchResult, error)
+	SearchComments(context.Context, uint32, store.SearchQuery) ([]*model.CommentSearchResult, error)
+	SearchUsers(context.Context, uint32, store.SearchQuery) ([]*model.UserSearchResult, error)
+	PostSaved(*model.Post)
+	PostDeleted(uint32)
+	CommentSaved(*model.Comment, *model.Post)
+	Close(context.Context) error
+}
+
+// Creates the backend selected by the config. The embedded index is loaded
+// from disk, or rebuilt from the database when there is no index file yet.
+func NewBackend(ctx context.Context, cfg Config, store store.Storage, logger *zap.SugaredLogger) (Backend, error) {
+	switch cfg.Backend {
+	case BackendPostgres:
+		return NewPostgresBackend(store), nil
+	case BackendEmbedded:
+		backend := NewEmbeddedBackend(NewMemoryIndex(), store, cfg.IndexPath, logger)
+
+		err := backend.Load()
+		if errors.Is(err, os.ErrNotExist) {
+			logger.Infow("search index not found, rebuilding from the database", "path", cfg.IndexPath)
+			err = backend.Rebuild(ctx)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		backend.Start(cfg.SaveInterval)
+		return backend, nil
+	default:
+		return nil, fmt.Errorf("unknown search backend %q", cfg.Backend)
+	}
+}
+
+// PostgresBackend searches the tsvector columns, which Postgres keeps up to date
+type PostgresBackend struct {
+	store store.Storage
+}
+
+func NewPostgresBackend(store store.Storage) *PostgresBackend {
+	return &PostgresBackend{store: store}
+}
+
+func (b *PostgresBackend) SearchPosts(ctx context.Context, viewerId uint32, sq store.SearchQuery) ([]*model.PostSearchResult, error) {
+	return b.store.Search.SearchPosts(ctx, viewerId, sq)
+}
+
+func (b *PostgresBackend) SearchComments(ctx context.Context, viewerId uint32, sq store.SearchQuery) ([]*model.CommentSearchResult, error) {
+	return b.store.Search.SearchComments(ctx, viewerId, sq)
+}
+
+func (b *PostgresBackend) SearchUsers(ctx context.Context, viewerId uint32, sq store.SearchQuery) ([]*model.UserSearchResult, error) {
+	return b.store.Search.SearchUsers(ctx, viewerId, sq)
+}
+
+func (b *PostgresBackend) PostSaved(post *model.Post)                            {}
+func (b *PostgresBackend) PostDeleted(postId uint32)                             {}
+func (b *PostgresBackend) CommentSaved(comment *model.Comment, post *model.Post) {}
+func (b *PostgresBackend) Close(ctx context.Context) error                       { return nil }
+
+// EmbeddedBackend searches posts and comments in an in-process index that is
+// persisted to disk. Users are still searched in Postgres.
+// The lang parameter is ignored as the index doesn't stem.
+type EmbeddedBackend struct {
+	index  SearchIndex
+	store  store.Storage
+	path   string
+	logger *zap.SugaredLogger
+
+	saveMu sync.Mutex
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func NewEmbeddedBackend(index SearchIndex, store store.Storage, path string, logger *zap.SugaredLogger) *EmbeddedBackend {
+	return &EmbeddedBackend{
+		index:  index,
+		store:  store,
+		path:   path,
+		logger: logger,
+	}
+}
+
+func (b *EmbeddedBackend) SearchPosts(ctx context.Context, viewerId uint32, sq store.SearchQuery) ([]*model.PostSearchResult, error) {
+	hits, err := b.search(ctx, viewerId, sq, KindPost)
+	if err != nil {
+		return nil, err
+	}
+
+	return paginate(hits, sq, func(hits []Hit) ([]*model.PostSearchResult, error) {
+		// Read the posts to return the current counters, the posts deleted
+		// or of inactive users are missing
+		ids := make([]uint32, len(hits))
+		for i, hit := range hits {
+			ids[i] = hit.Doc.Key.Id
+		}
+
+		posts, err := b.store.Posts.GetByIds(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+
+		byId := make(map[uint32]*model.Post, len(posts))
+		for _, post := range posts {
+			byId[post.Id] = post
+		}
+
+		results := []*model.PostSearchResult{}
+		for _, hit := range hits {
+			post, ok := byId[hit.Doc.Key.Id]
+			if !ok {
+				continue
+			}
+
+			results = append(results, &model.PostSearchResult{
+				Post:     post,
+				Rank:     hit.Score,
+				Headline: Highlight(post.Title+" "+post.Content, sq.Query, snippetWords),
+			})
+		}
+
+		return results, nil
+	})
+}
+
+func (b *EmbeddedBackend) SearchComments(ctx context.Context, viewerId uint32, sq store.SearchQuery) ([]*model.CommentSearchResult, error) {
+	hits, err := b.search(ctx, viewerId, sq, KindComment)
+	if err != nil {
+		return nil, err
+	}
+
+	return paginate(hits, sq, func(hits []Hit) ([]*model.CommentSearchResult, error) {
+		authorIds := make([]uint32, len(hits))
+		for i, hit := range hits {
+			authorIds[i] = hit.Doc.AuthorId
+		}
+
+		activeIds, err := b.store.Users.GetActiveIds(ctx, authorIds)
+		if err != nil {
+			return nil, err
+		}
+
+		active := make(map[uint32]bool, len(activeIds))
+		for _, id := range activeIds {
+			active[id] = true
+		}
+
+		results := []*model.CommentSearchResult{}
+		for _, hit := range hits {
+			if !active[hit.Doc.AuthorId] {
+				continue
+			}
+
+			results = append(results, &model.CommentSearchResult{
+				Comment: &model.Comment{
+					Id:        hit.Doc.Key.Id,
+					UserId:    hit.Doc.AuthorId,
+					PostId:    hit.Doc.PostId,
+					Content:   hit.Doc.Content,
+					CreatedAt: hit.Doc.CreatedAt.Format(time.RFC3339),
+				},
+				Rank:     hit.Score,
+				Headline: Highlight(hit.Doc.Content, sq.Query, snippetWords),
+			})
+		}
+
+		return results, nil
+	})
+}
+
+func (b *EmbeddedBackend) SearchUsers(ctx context.Context, viewerId uint32, sq store.SearchQuery) ([]*model.UserSearchResult, error) {
+	return b.store.Search.SearchUsers(ctx, viewerId, sq)
+}
+
+func (b *EmbeddedBackend) PostSaved(post *model.Post) {
+	b.index.Put(postDocument(post))
+}
+
+func (b *EmbeddedBackend) PostDeleted(postId uint32) {
+	// Comments are deleted with the post
+	b.index.DeleteByPost(postId)
+}
+
+func (b *EmbeddedBackend) CommentSaved(comment *model.Comment, post *model.Post) {
+	b.index.Put(commentDocument(comment, post.Tags))
+}
+
+// Replaces the index content with every post and comment in the database
+func (b *EmbeddedBackend) Rebuild(ctx context.Context) error {
+	index := NewMemoryIndex()
+
+	err := b.store.Search.ScanPosts(ctx, func(post *model.Post) error {
+		index.Put(postDocument(post))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = b.store.Search.ScanComments(ctx, func(comment *model.Comment, tags []string) error {
+		index.Put(commentDocument(comment, tags))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	b.index = index
+	b.logger.Infow("search index rebuilt", "documents", index.Len())
+
+	return b.Save()
+}
+
+func (b *EmbeddedBackend) Load() error {
+	f, err := os.Open(b.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := b.index.Load(f); err != nil {
+		return fmt.Errorf("failed to load search index %s: %w", b.path, err)
+	}
+
+	b.logger.Infow("search index loaded", "path", b.path, "documents", b.index.Len())
+	return nil
+}
+
+// Writes the index to a temporary file and renames it over the previous one,
+// so a crash never leaves a truncated index behind
+func (b *EmbeddedBackend) Save() error {
+	b.saveMu.Lock()
+	defer b.saveMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(b.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(b.path), filepath.Base(b.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := b.index.Save(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), b.path)
+}
+
+// Saves the index to disk every interval
+func (b *EmbeddedBackend) Start(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	b.stop = make(chan struct{})
+	b.done = make(chan struct{})
+
+	go func() {
+		defer close(b.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-b.stop:
+				return
+			case <-ticker.C:
+				if err := b.Save(); err != nil {
+					b.logger.Errorw("error saving search index", "path", b.path, "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stops the periodic save and writes the index one last time
+func (b *EmbeddedBackend) Close(ctx context.Context) error {
+	if b.stop != nil {
+		close(b.stop)
+
+		select {
+		case <-b.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return b.Save()
+}
+
+// Returns every hit of the query, without the documents of the users that
+// blocked or were blocked by the viewer
+func (b *EmbeddedBackend) search(ctx context.Context, viewerId uint32, sq store.SearchQuery, kind DocKind) ([]Hit, error) {
+	q, err := toIndexQuery(sq, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	blockedIds, err := b.store.Blocks.GetBlockedIds(ctx, viewerId)
+	if err != nil {
+		return nil, err
+	}
+
+	q.ExcludeAuthors = make(map[uint32]bool, len(blockedIds))
+	for _, id := range blockedIds {
+		q.ExcludeAuthors[id] = true
+	}
+
+	return b.index.Search(q), nil
+}
+
+// Resolves the hits in batches until the page is full, so the hits dropped
+// by resolve don't leave the page short
+func paginate[T any](hits []Hit, sq store.SearchQuery, resolve func([]Hit) ([]T, error)) ([]T, error) {
+	end := sq.Offset + sq.Limit
+	batch := max(end, 1)
+
+	results := []T{}
+	for start := 0; start < len(hits) && len(results) < end; start += batch {
+		resolved, err := resolve(hits[start:min(start+batch, len(hits))])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, resolved...)
+	}
+
+	if sq.Offset >= len(results) {
+		return []T{}, nil
+	}
+
+	return results[sq.Offset:min(end, len(results))], nil
+}
+
+func toIndexQuery(sq store.SearchQuery, kind DocKind) (Query, error) {
+	q := Query{
+		Text:     sq.Query,
+		Kind:     kind,
+		AuthorId: sq.AuthorId,
+		Tag:      sq.Tag,
+	}
+
+	var err error
+	if sq.Since != "" {
+		if q.Since, err = time.Parse(time.RFC3339, sq.Since); err != nil {
+			return q, err
+		}
+	}
+	if sq.Until != "" {
+		if q.Until, err = time.Parse(time.RFC3339, sq.Until); err != nil {
+			return q, err
+		}
+	}
+
+	return q, nil
+}
+
+func postDocument(post *model.Post) *Document {
+	createdAt, _ := time.Parse(time.RFC3339, post.CreatedAt)
+
+	return &Document{
+		Key:       DocKey{Kind: KindPost, Id: post.Id},
+		AuthorId:  post.UserId,
+		PostId:    post.Id,
+		Tags:      post.Tags,
+		CreatedAt: createdAt,
+		Title:     post.Title,
+		Content:   post.Content,
+	}
+}
+
+func commentDocument(comment *model.Comment, tags []string) *Document {
+	createdAt, _ := time.Parse(time.RFC3339, comment.CreatedAt)
+
+	return &Document{
+		Key:       DocKey{Kind: KindComment, Id: comment.Id},
+		AuthorId:  comment.UserId,
+		PostId:    comment.PostId,
+		Tags:      tags,
+		CreatedAt: createdAt,
+		Content:   comment.Content,
+	}
+}
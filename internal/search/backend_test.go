@@ -0,0 +1,137 @@
+package search
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// Posts of the active users, counting the lookups
+type searchPostStore struct {
+	store.MockPostStore
+	posts    map[uint32]*model.Post
+	inactive map[uint32]bool
+	lookups  int
+}
+
+func (s *searchPostStore) GetByIds(ctx context.Context, ids []uint32) ([]*model.Post, error) {
+	s.lookups++
+
+	posts := []*model.Post{}
+	for _, id := range ids {
+		if post, ok := s.posts[id]; ok && !s.inactive[post.UserId] {
+			posts = append(posts, post)
+		}
+	}
+	return posts, nil
+}
+
+type searchUserStore struct {
+	store.MockUserStore
+	inactive map[uint32]bool
+}
+
+func (s *searchUserStore) GetActiveIds(ctx context.Context, ids []uint32) ([]uint32, error) {
+	active := []uint32{}
+	for _, id := range ids {
+		if !s.inactive[id] {
+			active = append(active, id)
+		}
+	}
+	return active, nil
+}
+
+type searchBlockStore struct {
+	store.MockBlockStore
+	blocked []uint32
+}
+
+func (s *searchBlockStore) GetBlockedIds(ctx context.Context, userId uint32) ([]uint32, error) {
+	return s.blocked, nil
+}
+
+func TestEmbeddedBackend(t *testing.T) {
+	inactive := map[uint32]bool{3: true}
+	posts := &searchPostStore{posts: map[uint32]*model.Post{}, inactive: inactive}
+	storage := *store.NewMockStore()
+	storage.Posts = posts
+	storage.Users = &searchUserStore{inactive: inactive}
+	storage.Blocks = &searchBlockStore{blocked: []uint32{2}}
+
+	backend := NewEmbeddedBackend(NewMemoryIndex(), storage, t.TempDir()+"/index", zap.NewNop().Sugar())
+
+	// Authors 2 and 3 are hidden, the newest posts rank first on a tie
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for id := uint32(1); id <= 8; id++ {
+		post := &model.Post{Id: id, UserId: []uint32{2, 3, 1, 4}[id%4], Title: "Gophers", Content: "about gophers", CreatedAt: base.Add(time.Duration(id) * time.Hour).Format(time.RFC3339)}
+		posts.posts[id] = post
+		backend.PostSaved(post)
+
+		comment := &model.Comment{Id: id, UserId: post.UserId, PostId: 100 + id, Content: "gophers", CreatedAt: post.CreatedAt}
+		backend.CommentSaved(comment, &model.Post{})
+	}
+
+	ctx := context.Background()
+	sq := store.SearchQuery{Query: "gophers", Limit: 2}
+
+	t.Run("should fill the pages with the visible posts", func(t *testing.T) {
+		first, err := backend.SearchPosts(ctx, 1, sq)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sq := sq
+		sq.Offset = 2
+		second, err := backend.SearchPosts(ctx, 1, sq)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := []uint32{}
+		for _, result := range append(first, second...) {
+			got = append(got, result.Id)
+		}
+		if !equalIds(got, []uint32{7, 6, 3, 2}) {
+			t.Errorf("got %v", got)
+		}
+	})
+
+	t.Run("should read the posts in batches", func(t *testing.T) {
+		posts.lookups = 0
+
+		if _, err := backend.SearchPosts(ctx, 1, store.SearchQuery{Query: "gophers", Limit: 25}); err != nil {
+			t.Fatal(err)
+		}
+		if posts.lookups != 1 {
+			t.Errorf("expected 1 lookup, got %d", posts.lookups)
+		}
+	})
+
+	t.Run("should hide the comments of hidden authors", func(t *testing.T) {
+		results, err := backend.SearchComments(ctx, 1, sq)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(results) != 2 || results[0].UserId == 2 || results[0].UserId == 3 || results[1].UserId == 2 || results[1].UserId == 3 {
+			t.Errorf("unexpected results %+v %+v", results[0], results[1])
+		}
+	})
+
+	t.Run("should exclude the words", func(t *testing.T) {
+		posts.posts[7].Content = "about spam"
+		backend.PostSaved(posts.posts[7])
+
+		results, err := backend.SearchPosts(ctx, 1, store.SearchQuery{Query: "gophers -spam", Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Id != 6 {
+			t.Errorf("unexpected results %v", results)
+		}
+	})
+}
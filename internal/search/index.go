@@ -0,0 +1,388 @@
+package search
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Version of the on-disk format written by MemoryIndex.Save
+const indexFormatVersion = 1
+
+type DocKind string
+
+const (
+	KindPost    DocKind = "post"
+	KindComment DocKind = "comment"
+)
+
+type DocKey struct {
+	Kind DocKind
+	Id   uint32
+}
+
+type Document struct {
+	Key       DocKey
+	AuthorId  uint32
+	PostId    uint32 // the post of a comment, or the post itself
+	Tags      []string
+	CreatedAt time.Time
+	Title     string
+	Content   string
+}
+
+type Query struct {
+	Text     string
+	Kind     DocKind // empty means any kind
+	AuthorId uint32  // zero means any author
+	Tag      string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+	Offset   int
+	// Authors whose documents, and the comments on their posts, are skipped
+	ExcludeAuthors map[uint32]bool
+}
+
+type Hit struct {
+	Doc   *Document
+	Score float64
+}
+
+// SearchIndex is a full-text index of posts and comments
+type SearchIndex interface {
+	Put(*Document)
+	Delete(DocKey)
+	DeleteByPost(postId uint32)
+	Search(Query) []Hit
+	Len() int
+	Save(io.Writer) error
+	Load(io.Reader) error
+}
+
+// MemoryIndex is an in-process inverted index scored with BM25
+type MemoryIndex struct {
+	mu       sync.RWMutex
+	docs     map[DocKey]*Document
+	lengths  map[DocKey]int
+	postings map[string]map[DocKey]int // term -> document -> term frequency
+	totalLen int
+
+	// Sorted terms for prefix queries, rebuilt lazily after writes
+	terms      []string
+	termsDirty bool
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{
+		docs:     map[DocKey]*Document{},
+		lengths:  map[DocKey]int{},
+		postings: map[string]map[DocKey]int{},
+	}
+}
+
+// Adds the document to the index, replacing any previous version
+func (idx *MemoryIndex) Put(doc *Document) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.delete(doc.Key)
+
+	// Title terms count twice so they weigh more than the content
+	terms := Tokenize(doc.Title)
+	terms = append(terms, terms...)
+	terms = append(terms, Tokenize(doc.Content)...)
+
+	for _, term := range terms {
+		docs, ok := idx.postings[term]
+		if !ok {
+			docs = map[DocKey]int{}
+			idx.postings[term] = docs
+			idx.termsDirty = true
+		}
+		docs[doc.Key]++
+	}
+
+	idx.docs[doc.Key] = doc
+	idx.lengths[doc.Key] = len(terms)
+	idx.totalLen += len(terms)
+}
+
+func (idx *MemoryIndex) Delete(key DocKey) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.delete(key)
+}
+
+// Deletes the post and all of its comments
+func (idx *MemoryIndex) DeleteByPost(postId uint32) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for key, doc := range idx.docs {
+		if doc.PostId == postId {
+			idx.delete(key)
+		}
+	}
+}
+
+func (idx *MemoryIndex) delete(key DocKey) {
+	doc, ok := idx.docs[key]
+	if !ok {
+		return
+	}
+
+	terms := Tokenize(doc.Title)
+	terms = append(terms, Tokenize(doc.Content)...)
+	for _, term := range terms {
+		docs := idx.postings[term]
+		delete(docs, key)
+		if len(docs) == 0 {
+			delete(idx.postings, term)
+			idx.termsDirty = true
+		}
+	}
+
+	idx.totalLen -= idx.lengths[key]
+	delete(idx.lengths, key)
+	delete(idx.docs, key)
+}
+
+func (idx *MemoryIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.docs)
+}
+
+// Returns the documents matching the query, best first. The filters apply
+// before the pagination, so only the last page can be short.
+func (idx *MemoryIndex) Search(q Query) []Hit {
+	parsed := parseQuery(q.Text)
+	if len(parsed) == 0 {
+		return []Hit{}
+	}
+
+	idx.mu.Lock()
+	if idx.termsDirty {
+		idx.rebuildTerms()
+	}
+	idx.mu.Unlock()
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	// Every match gets a score, even when its terms are only in a phrase
+	scores := map[DocKey]float64{}
+	for _, group := range parsed {
+		for key := range idx.matchGroup(group) {
+			if idx.accepts(idx.docs[key], q) {
+				scores[key] = 0
+			}
+		}
+	}
+
+	n := float64(len(idx.docs))
+	avgLen := float64(idx.totalLen) / math.Max(n, 1)
+
+	for _, qt := range parsed.terms() {
+		for _, term := range idx.expand(qt) {
+			docs := idx.postings[term]
+			df := float64(len(docs))
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+			for key, tf := range docs {
+				if _, ok := scores[key]; !ok {
+					continue
+				}
+
+				f := float64(tf)
+				norm := 1 - bm25B + bm25B*float64(idx.lengths[key])/avgLen
+				scores[key] += idf * f * (bm25K1 + 1) / (f + bm25K1*norm)
+			}
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for key, score := range scores {
+		hits = append(hits, Hit{Doc: idx.docs[key], Score: score})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if !hits[i].Doc.CreatedAt.Equal(hits[j].Doc.CreatedAt) {
+			return hits[i].Doc.CreatedAt.After(hits[j].Doc.CreatedAt)
+		}
+		return hits[i].Doc.Key.Id > hits[j].Doc.Key.Id
+	})
+
+	if q.Offset >= len(hits) {
+		return []Hit{}
+	}
+	hits = hits[q.Offset:]
+	if q.Limit > 0 && len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+
+	return hits
+}
+
+// Returns the documents matching every required clause of the group and
+// none of its excluded ones
+func (idx *MemoryIndex) matchGroup(group queryGroup) map[DocKey]bool {
+	var keys map[DocKey]bool
+	for _, clause := range group.required {
+		keys = idx.matchClause(clause, keys)
+		if len(keys) == 0 {
+			return keys
+		}
+	}
+
+	for _, clause := range group.excluded {
+		for key := range idx.matchClause(clause, keys) {
+			delete(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// Returns the documents matching the clause, among the candidates unless
+// they're nil
+func (idx *MemoryIndex) matchClause(clause queryClause, candidates map[DocKey]bool) map[DocKey]bool {
+	keys := candidates
+	for _, qt := range clause {
+		containing := map[DocKey]bool{}
+		for _, term := range idx.expand(qt) {
+			for key := range idx.postings[term] {
+				if keys == nil || keys[key] {
+					containing[key] = true
+				}
+			}
+		}
+		keys = containing
+	}
+
+	// The terms of a phrase must also follow each other
+	if len(clause) > 1 {
+		for key := range keys {
+			doc := idx.docs[key]
+			if !clause.matchesIn(Tokenize(doc.Title)) && !clause.matchesIn(Tokenize(doc.Content)) {
+				delete(keys, key)
+			}
+		}
+	}
+
+	return keys
+}
+
+// Returns the indexed terms matched by the query term
+func (idx *MemoryIndex) expand(qt queryTerm) []string {
+	if !qt.Prefix {
+		return []string{qt.Text}
+	}
+
+	start := sort.SearchStrings(idx.terms, qt.Text)
+	end := start
+	for end < len(idx.terms) && strings.HasPrefix(idx.terms[end], qt.Text) {
+		end++
+	}
+
+	return idx.terms[start:end]
+}
+
+func (idx *MemoryIndex) accepts(doc *Document, q Query) bool {
+	if q.Kind != "" && doc.Key.Kind != q.Kind {
+		return false
+	}
+	if q.AuthorId != 0 && doc.AuthorId != q.AuthorId {
+		return false
+	}
+	if q.ExcludeAuthors[doc.AuthorId] {
+		return false
+	}
+	if post, ok := idx.docs[DocKey{KindPost, doc.PostId}]; ok && doc.Key.Kind == KindComment && q.ExcludeAuthors[post.AuthorId] {
+		return false
+	}
+	if q.Tag != "" && !slices.Contains(doc.Tags, q.Tag) {
+		return false
+	}
+	if !q.Since.IsZero() && doc.CreatedAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && doc.CreatedAt.After(q.Until) {
+		return false
+	}
+
+	return true
+}
+
+func (idx *MemoryIndex) rebuildTerms() {
+	idx.terms = make([]string, 0, len(idx.postings))
+	for term := range idx.postings {
+		idx.terms = append(idx.terms, term)
+	}
+	sort.Strings(idx.terms)
+	idx.termsDirty = false
+}
+
+type indexFile struct {
+	Version int
+	Docs    []*Document
+}
+
+// Writes the indexed documents. The postings are rebuilt on Load.
+func (idx *MemoryIndex) Save(w io.Writer) error {
+	idx.mu.RLock()
+	file := indexFile{
+		Version: indexFormatVersion,
+		Docs:    make([]*Document, 0, len(idx.docs)),
+	}
+	for _, doc := range idx.docs {
+		file.Docs = append(file.Docs, doc)
+	}
+	idx.mu.RUnlock()
+
+	return gob.NewEncoder(w).Encode(&file)
+}
+
+// Replaces the content of the index with the documents read from r
+func (idx *MemoryIndex) Load(r io.Reader) error {
+	var file indexFile
+	if err := gob.NewDecoder(r).Decode(&file); err != nil {
+		return err
+	}
+
+	if file.Version != indexFormatVersion {
+		return fmt.Errorf("unsupported search index version %d", file.Version)
+	}
+
+	idx.mu.Lock()
+	idx.docs = map[DocKey]*Document{}
+	idx.lengths = map[DocKey]int{}
+	idx.postings = map[string]map[DocKey]int{}
+	idx.totalLen = 0
+	idx.termsDirty = true
+	idx.mu.Unlock()
+
+	for _, doc := range file.Docs {
+		idx.Put(doc)
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package search
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func newTestIndex() *MemoryIndex {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	idx := NewMemoryIndex()
+	idx.Put(&Document{Key: DocKey{KindPost, 1}, AuthorId: 1, PostId: 1, Tags: []string{"go"}, CreatedAt: base, Title: "Gophers", Content: "Concurrency in Go with goroutines and channels"})
+	idx.Put(&Document{Key: DocKey{KindPost, 2}, AuthorId: 2, PostId: 2, Tags: []string{"rust"}, CreatedAt: base.Add(time.Hour), Title: "Ownership", Content: "The borrow checker explained, no goroutines here"})
+	idx.Put(&Document{Key: DocKey{KindPost, 3}, AuthorId: 1, PostId: 3, Tags: []string{"go"}, CreatedAt: base.Add(2 * time.Hour), Title: "Goroutines", Content: "Goroutines goroutines goroutines"})
+	idx.Put(&Document{Key: DocKey{KindComment, 4}, AuthorId: 2, PostId: 1, Tags: []string{"go"}, CreatedAt: base.Add(3 * time.Hour), Content: "Nice goroutines post"})
+
+	return idx
+}
+
+func ids(hits []Hit) []uint32 {
+	result := make([]uint32, len(hits))
+	for i, hit := range hits {
+		result[i] = hit.Doc.Key.Id
+	}
+
+	return result
+}
+
+func equalIds(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestMemoryIndexSearch(t *testing.T) {
+	idx := newTestIndex()
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []uint32
+	}{
+		{"term frequency and title weight rank first", Query{Text: "goroutines", Kind: KindPost}, []uint32{3, 1, 2}},
+		{"no match", Query{Text: "haskell"}, []uint32{}},
+		{"stopwords only", Query{Text: "the and"}, []uint32{}},
+		{"prefix query", Query{Text: "own*"}, []uint32{2}},
+		{"kind filter", Query{Text: "goroutines", Kind: KindComment}, []uint32{4}},
+		{"author filter", Query{Text: "goroutines", Kind: KindPost, AuthorId: 2}, []uint32{2}},
+		{"tag filter", Query{Text: "goroutines", Kind: KindPost, Tag: "go"}, []uint32{3, 1}},
+		{"date filter", Query{Text: "goroutines", Kind: KindPost, Since: time.Date(2025, 1, 1, 1, 0, 0, 0, time.UTC), Until: time.Date(2025, 1, 1, 1, 30, 0, 0, time.UTC)}, []uint32{2}},
+		{"pagination", Query{Text: "goroutines", Kind: KindPost, Limit: 1, Offset: 1}, []uint32{1}},
+		{"all the words", Query{Text: "goroutines channels"}, []uint32{1}},
+		{"excluded word", Query{Text: "goroutines -borrow", Kind: KindPost}, []uint32{3, 1}},
+		{"excluded prefix", Query{Text: "goroutines -chan*", Kind: KindPost}, []uint32{3, 2}},
+		{"phrase", Query{Text: `"borrow checker"`}, []uint32{2}},
+		{"phrase out of order", Query{Text: `"checker borrow"`}, []uint32{}},
+		{"excluded phrase", Query{Text: `goroutines -"nice goroutines"`, Kind: KindComment}, []uint32{}},
+		{"or", Query{Text: "ownership or channels"}, []uint32{2, 1}},
+		{"only excluded words", Query{Text: "-goroutines"}, []uint32{}},
+		{"excluded authors", Query{Text: "goroutines", ExcludeAuthors: map[uint32]bool{2: true}}, []uint32{3, 1}},
+		// The comment is on a post of the excluded author
+		{"excluded authors of the post", Query{Text: "goroutines", Kind: KindComment, ExcludeAuthors: map[uint32]bool{1: true}}, []uint32{}},
+		{"pagination after the filters", Query{Text: "goroutines", Limit: 1, Offset: 1, ExcludeAuthors: map[uint32]bool{2: true}}, []uint32{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(idx.Search(tt.query))
+			if !equalIds(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	q := parseQuery(`go* "borrow checker" -rust or e-mail -"the spam"`)
+
+	if len(q) != 2 {
+		t.Fatalf("expected 2 groups, got %+v", q)
+	}
+
+	first := q[0]
+	if len(first.required) != 2 || len(first.excluded) != 1 {
+		t.Fatalf("unexpected first group %+v", first)
+	}
+	if first.required[0][0] != (queryTerm{Text: "go", Prefix: true}) {
+		t.Errorf("expected a prefix term, got %+v", first.required[0])
+	}
+	if len(first.required[1]) != 2 || first.excluded[0][0].Text != "rust" {
+		t.Errorf("expected the phrase and the excluded word, got %+v", first)
+	}
+
+	// Words splitting into several terms are phrases, stop words are dropped
+	second := q[1]
+	if len(second.required) != 1 || len(second.required[0]) != 2 || len(second.excluded) != 1 || len(second.excluded[0]) != 1 {
+		t.Errorf("unexpected second group %+v", second)
+	}
+}
+
+func TestMemoryIndexDelete(t *testing.T) {
+	idx := newTestIndex()
+
+	idx.Delete(DocKey{KindPost, 3})
+	if got := ids(idx.Search(Query{Text: "goroutines", Kind: KindPost})); !equalIds(got, []uint32{1, 2}) {
+		t.Errorf("after delete got %v", got)
+	}
+
+	// Deleting a post deletes its comments
+	idx.DeleteByPost(1)
+	if got := ids(idx.Search(Query{Text: "goroutines"})); !equalIds(got, []uint32{2}) {
+		t.Errorf("after delete by post got %v", got)
+	}
+
+	if idx.Len() != 1 {
+		t.Errorf("expected 1 document, got %d", idx.Len())
+	}
+}
+
+func TestMemoryIndexPutReplaces(t *testing.T) {
+	idx := newTestIndex()
+
+	idx.Put(&Document{Key: DocKey{KindPost, 2}, AuthorId: 2, PostId: 2, Title: "Lifetimes", Content: "Nothing about threads"})
+
+	if got := ids(idx.Search(Query{Text: "ownership"})); len(got) != 0 {
+		t.Errorf("old terms still indexed: %v", got)
+	}
+	if got := ids(idx.Search(Query{Text: "lifetimes"})); !equalIds(got, []uint32{2}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestMemoryIndexSaveLoad(t *testing.T) {
+	idx := newTestIndex()
+
+	var buf bytes.Buffer
+	if err := idx.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewMemoryIndex()
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Len() != idx.Len() {
+		t.Fatalf("expected %d documents, got %d", idx.Len(), loaded.Len())
+	}
+
+	q := Query{Text: "gorout*"}
+	if got, want := ids(loaded.Search(q)), ids(idx.Search(q)); !equalIds(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	got := Highlight("Concurrency in Go with goroutines", "goroutine*", 10)
+	want := "Concurrency in Go with <mark>goroutines</mark>"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHighlightEscapes(t *testing.T) {
+	got := Highlight(`<img src=x onerror="alert(1)"> goroutines & <b>channels</b>`, "goroutines channels", 10)
+	want := "&lt;img src=x onerror=&#34;alert(1)&#34;&gt; <mark>goroutines</mark> &amp; <mark>&lt;b&gt;channels&lt;/b&gt;</mark>"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,219 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Words too common to be useful in a query
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "for": true, "if": true, "in": true,
+	"into": true, "is": true, "it": true, "no": true, "not": true, "of": true,
+	"on": true, "or": true, "such": true, "that": true, "the": true, "their": true,
+	"then": true, "there": true, "these": true, "they": true, "this": true, "to": true,
+	"was": true, "will": true, "with": true,
+}
+
+// Splits the text into lowercase terms of letters and digits, dropping stop words
+func Tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if stopWords[f] {
+			continue
+		}
+		terms = append(terms, f)
+	}
+
+	return terms
+}
+
+// A query term, matching every indexed term starting with Text when Prefix is set
+type queryTerm struct {
+	Text   string
+	Prefix bool
+}
+
+// A word of the query, or the terms of a "quoted phrase" that must follow
+// each other
+type queryClause []queryTerm
+
+// A group of clauses that all match, and none of the excluded ones do
+type queryGroup struct {
+	required []queryClause
+	excluded []queryClause
+}
+
+// A query parsed like websearch_to_tsquery parses the queries of the
+// Postgres backend. The words of a group are all required, OR separates the
+// groups, "quoted phrases" match the words in order and -word excludes the
+// documents with the word.
+type parsedQuery []queryGroup
+
+// Parses the query text. A trailing '*' turns a word into a prefix query,
+// e.g. "gopher*" matches "gophers" and "gophercon". Groups with only
+// excluded words are dropped, they would match almost every document.
+func parseQuery(text string) parsedQuery {
+	q := parsedQuery{}
+	group := queryGroup{}
+
+	for {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		if text == "" {
+			break
+		}
+
+		excluded := strings.HasPrefix(text, "-")
+		if excluded {
+			text = text[1:]
+		}
+
+		var clause queryClause
+		if strings.HasPrefix(text, `"`) {
+			var phrase string
+			phrase, text, _ = strings.Cut(text[1:], `"`)
+			clause = newClause(phrase, false)
+		} else {
+			end := strings.IndexFunc(text, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+			if end < 0 {
+				end = len(text)
+			}
+			word := text[:end]
+			text = text[end:]
+
+			if !excluded && strings.EqualFold(word, "or") {
+				if len(group.required) > 0 {
+					q = append(q, group)
+				}
+				group = queryGroup{}
+				continue
+			}
+			clause = newClause(word, strings.HasSuffix(word, "*"))
+		}
+
+		if len(clause) == 0 {
+			continue
+		}
+		if excluded {
+			group.excluded = append(group.excluded, clause)
+		} else {
+			group.required = append(group.required, clause)
+		}
+	}
+
+	if len(group.required) > 0 {
+		q = append(q, group)
+	}
+
+	return q
+}
+
+// Words splitting into several terms, like "e-mail", are phrases
+func newClause(text string, prefix bool) queryClause {
+	tokens := Tokenize(text)
+
+	clause := make(queryClause, len(tokens))
+	for i, token := range tokens {
+		clause[i] = queryTerm{Text: token, Prefix: prefix && i == len(tokens)-1}
+	}
+
+	return clause
+}
+
+// Returns the terms the documents are searched and scored by, without the
+// excluded ones
+func (q parsedQuery) terms() []queryTerm {
+	seen := map[queryTerm]bool{}
+	terms := []queryTerm{}
+	for _, group := range q {
+		for _, clause := range group.required {
+			for _, qt := range clause {
+				if !seen[qt] {
+					seen[qt] = true
+					terms = append(terms, qt)
+				}
+			}
+		}
+	}
+
+	return terms
+}
+
+func (qt queryTerm) matches(term string) bool {
+	if qt.Prefix {
+		return strings.HasPrefix(term, qt.Text)
+	}
+
+	return term == qt.Text
+}
+
+// Whether the clause matches consecutive terms
+func (c queryClause) matchesIn(terms []string) bool {
+	for i := 0; i+len(c) <= len(terms); i++ {
+		matched := true
+		for j, qt := range c {
+			if !qt.matches(terms[i+j]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Builds a snippet of the text around the first match, wrapping the matched
+// words in <mark> tags. The words are HTML escaped so the snippet is safe to
+// render.
+func Highlight(text, query string, maxWords int) string {
+	terms := parseQuery(query).terms()
+	words := strings.Fields(text)
+
+	matched := make([]bool, len(words))
+	first := -1
+	for i, word := range words {
+		for _, token := range Tokenize(word) {
+			for _, qt := range terms {
+				if qt.matches(token) {
+					matched[i] = true
+				}
+			}
+		}
+		if matched[i] && first == -1 {
+			first = i
+		}
+	}
+
+	// Keep some context before the first match, without leaving the end of
+	// the window empty
+	start := max(0, min(first-maxWords/4, len(words)-maxWords))
+	end := min(start+maxWords, len(words))
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("... ")
+	}
+	for i := start; i < end; i++ {
+		if i > start {
+			b.WriteByte(' ')
+		}
+		if matched[i] {
+			b.WriteString("<mark>" + html.EscapeString(words[i]) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(words[i]))
+		}
+	}
+	if end < len(words) {
+		b.WriteString(" ...")
+	}
+
+	return b.String()
+}
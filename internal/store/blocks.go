@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/lib/pq"
+)
+
+type BlockStore struct {
+	db *sql.DB
+}
+
+// Blocks the user and removes the follow relationship in both directions
+func (s *BlockStore) Block(ctx context.Context, block *model.Block) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO user_blocks (blocker_id, blocked_id)
+			VALUES ($1, $2)
+			RETURNING created_at
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, block.BlockerId, block.BlockedId).Scan(&block.CreatedAt)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrResourceAlreadyExists
+			}
+			return err
+		}
+
+		unfollowQuery := `
+			DELETE FROM followers
+			WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)
+		`
+
+		_, err = tx.ExecContext(ctx, unfollowQuery, block.BlockerId, block.BlockedId)
+		return err
+	})
+}
+
+func (s *BlockStore) Unblock(ctx context.Context, block *model.Block) error {
+	query := `
+		DELETE FROM user_blocks
+		WHERE blocker_id = $1 AND blocked_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, block.BlockerId, block.BlockedId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrResourceNotFound
+	}
+
+	return nil
+}
+
+// Reports whether either user blocked the other
+func (s *BlockStore) IsBlocked(ctx context.Context, userId, otherUserId uint32) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM user_blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var blocked bool
+	err := s.db.QueryRowContext(ctx, query, userId, otherUserId).Scan(&blocked)
+	if err != nil {
+		return false, err
+	}
+
+	return blocked, nil
+}
+
+// Returns the ids of the users blocked by, or blocking, the user
+func (s *BlockStore) GetBlockedIds(ctx context.Context, userId uint32) ([]uint32, error) {
+	query := `
+		SELECT blocked_id FROM user_blocks WHERE blocker_id = $1
+		UNION
+		SELECT blocker_id FROM user_blocks WHERE blocked_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uint32{}
+	for rows.Next() {
+		var id uint32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
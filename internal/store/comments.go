@@ -12,36 +12,12 @@ type CommentStore struct {
 }
 
 func (s *CommentStore) Create(ctx context.Context, comment *model.Comment) error {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-
 	// Create the query to insert the comment
 	query := `
-		INSERT INTO comments (user_id, post_id, content)
-		VALUES ($1, $2, $3) RETURNING id, created_at
+		INSERT INTO comments (user_id, post_id, content, language, entities)
+		VALUES ($1, $2, $3, (SELECT language FROM posts WHERE id = $2), $4) RETURNING id, created_at
 	`
 
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
-
-	// Send the query with the context and arguments
-	err = s.db.QueryRowContext(
-		ctx,
-		query,
-		comment.UserId,
-		comment.PostId,
-		comment.Content,
-	).Scan( // Scan the post to insert the generated values
-		&comment.Id,
-		&comment.CreatedAt,
-	)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-
 	// Update the comments_count in the posts table
 	updateQuery := `
 		UPDATE posts
@@ -49,14 +25,42 @@ func (s *CommentStore) Create(ctx context.Context, comment *model.Comment) error
 		WHERE id = $1
 	`
 
-	_, err = s.db.ExecContext(ctx, updateQuery, comment.PostId)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		entities, err := resolveMentions(ctx, tx, comment.Entities)
+		if err != nil {
+			return err
+		}
+		comment.Entities = entities
+
+		// Send the query with the context and arguments
+		err = tx.QueryRowContext(
+			ctx,
+			query,
+			comment.UserId,
+			comment.PostId,
+			comment.Content,
+			comment.Entities,
+		).Scan( // Scan the post to insert the generated values
+			&comment.Id,
+			&comment.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, updateQuery, comment.PostId); err != nil {
+			return err
+		}
+
+		if err := saveMentions(ctx, tx, comment.UserId, comment.PostId, &comment.Id, comment.Entities); err != nil {
+			return err
+		}
 
-	tx.Commit()
-	return nil
+		return addEvent(ctx, tx, model.EventCommentCreated, &model.CommentCreated{Comment: comment})
+	})
 }
 
 // Get comments by their postId
@@ -71,7 +75,7 @@ func (s *CommentStore) GetAllByPostId(ctx context.Context, postId uint32) ([]*mo
 
 	// Create the query to get the comment by the id
 	query := `
-		SELECT id, user_id, post_id, content, created_at
+		SELECT id, user_id, post_id, content, created_at, entities
 		FROM comments
 		WHERE post_id = $1
 	`
@@ -107,6 +111,7 @@ func (s *CommentStore) GetAllByPostId(ctx context.Context, postId uint32) ([]*mo
 			&comment.PostId,
 			&comment.Content,
 			&comment.CreatedAt,
+			&comment.Entities,
 		)
 		if err != nil {
 			return nil, err
@@ -0,0 +1,556 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/lib/pq"
+)
+
+type ConversationQuery struct {
+	Limit  int `json:"limit" validate:"gte=1,lte=50"`
+	Offset int `json:"offset" validate:"gte=0"`
+}
+
+func (cq ConversationQuery) Parse(r *http.Request) (ConversationQuery, error) {
+	qs := r.URL.Query()
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return cq, err
+		}
+
+		cq.Limit = l
+	}
+
+	if offset := qs.Get("offset"); offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return cq, err
+		}
+
+		cq.Offset = o
+	}
+
+	return cq, nil
+}
+
+// MessageQuery pages through the messages from the newest, Before being the
+// id of the oldest message of the previous page
+type MessageQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Before uint32 `json:"before"`
+}
+
+func (mq MessageQuery) Parse(r *http.Request) (MessageQuery, error) {
+	qs := r.URL.Query()
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return mq, err
+		}
+
+		mq.Limit = l
+	}
+
+	if before := qs.Get("before"); before != "" {
+		b, err := strconv.ParseUint(before, 10, 32)
+		if err != nil {
+			return mq, err
+		}
+
+		mq.Before = uint32(b)
+	}
+
+	return mq, nil
+}
+
+type ConversationStore struct {
+	db *sql.DB
+}
+
+// Matches the messages of senders blocking, or blocked by, the user $1
+const blockedSender = `
+	EXISTS (
+		SELECT 1 FROM user_blocks b
+		WHERE (b.blocker_id = $1 AND b.blocked_id = m.sender_id) OR (b.blocker_id = m.sender_id AND b.blocked_id = $1)
+	)
+`
+
+// Selects the conversations of the user $1 with their unread count and last
+// message, the messages of blocked users being left out of both
+const conversationsQuery = `
+	SELECT c.id, c.creator_id, c.title, c.is_group, c.created_at, c.updated_at,
+		(
+			SELECT COUNT(*) FROM messages m
+			WHERE m.conversation_id = c.id AND m.id > me.last_read_message_id AND m.sender_id <> $1 AND NOT ` + blockedSender + `
+		)::int,
+		lm.id, lm.sender_id, lm.content, lm.created_at
+	FROM conversation_members me
+	JOIN conversations c ON c.id = me.conversation_id
+	LEFT JOIN LATERAL (
+		SELECT m.id, m.sender_id, m.content, m.created_at
+		FROM messages m
+		WHERE m.conversation_id = c.id AND NOT ` + blockedSender + `
+		ORDER BY m.id DESC
+		LIMIT 1
+	) lm ON true
+	WHERE me.user_id = $1
+`
+
+// Checks the sender can message the recipients. Users that blocked, or were
+// blocked by, the sender can't be messaged, nor users only accepting messages
+// from the users they follow when they don't follow the sender.
+func (s *ConversationStore) CanMessage(ctx context.Context, senderId uint32, recipientIds []uint32) error {
+	query := `
+		SELECT
+			u.id,
+			EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = u.id AND b.blocked_id = $1) OR (b.blocker_id = $1 AND b.blocked_id = u.id)
+			),
+			u.dm_following_only AND NOT EXISTS (
+				SELECT 1 FROM followers f WHERE f.user_id = $1 AND f.follower_id = u.id
+			)
+		FROM users u
+		WHERE u.id = ANY($2)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	ids := make([]int64, len(recipientIds))
+	for i, id := range recipientIds {
+		ids[i] = int64(id)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, senderId, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := 0
+	for rows.Next() {
+		var id uint32
+		var blocked, restricted bool
+		if err := rows.Scan(&id, &blocked, &restricted); err != nil {
+			return err
+		}
+		found++
+
+		if blocked || restricted {
+			return fmt.Errorf("%w: user %d", ErrMessagingNotAllowed, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if found != len(recipientIds) {
+		return ErrResourceNotFound
+	}
+
+	return nil
+}
+
+// Creates the conversation of the creator and the members. Two users share a
+// single direct conversation, when it already exists its id is set and
+// ErrResourceAlreadyExists is returned.
+func (s *ConversationStore) Create(ctx context.Context, conversation *model.Conversation, memberIds []uint32) error {
+	query := `
+		INSERT INTO conversations (creator_id, title, is_group, direct_key)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (direct_key) DO NOTHING
+		RETURNING id, created_at, updated_at
+	`
+
+	existingQuery := `
+		SELECT id FROM conversations WHERE direct_key = $1
+	`
+
+	membersQuery := `
+		INSERT INTO conversation_members (conversation_id, user_id)
+		SELECT $1, UNNEST($2::bigint[])
+	`
+
+	var directKey *string
+	if !conversation.IsGroup {
+		if len(memberIds) != 1 {
+			return fmt.Errorf("direct conversations have a single other member")
+		}
+
+		key := fmt.Sprintf("%d:%d", min(conversation.CreatorId, memberIds[0]), max(conversation.CreatorId, memberIds[0]))
+		directKey = &key
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			conversation.CreatorId,
+			conversation.Title,
+			conversation.IsGroup,
+			directKey,
+		).Scan(
+			&conversation.Id,
+			&conversation.CreatedAt,
+			&conversation.UpdatedAt,
+		)
+		if err == sql.ErrNoRows {
+			if err := tx.QueryRowContext(ctx, existingQuery, directKey).Scan(&conversation.Id); err != nil {
+				return err
+			}
+			return ErrResourceAlreadyExists
+		}
+		if err != nil {
+			return err
+		}
+
+		ids := []int64{int64(conversation.CreatorId)}
+		for _, id := range memberIds {
+			if !slices.Contains(ids, int64(id)) {
+				ids = append(ids, int64(id))
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, membersQuery, conversation.Id, pq.Array(ids))
+		return err
+	})
+}
+
+// Returns the conversation with its members. Conversations the user isn't a
+// member of are not found.
+func (s *ConversationStore) GetById(ctx context.Context, conversationId, userId uint32) (*model.Conversation, error) {
+	query := conversationsQuery + `AND c.id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId, conversationId)
+	if err != nil {
+		return nil, err
+	}
+
+	conversations, err := s.scanConversations(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(conversations) == 0 {
+		return nil, ErrResourceNotFound
+	}
+
+	return conversations[0], nil
+}
+
+// Returns the conversations of the user, the ones with the most recent
+// messages first, with the unread messages count across all of them
+func (s *ConversationStore) GetByUser(ctx context.Context, userId uint32, cq ConversationQuery) (*model.ConversationList, error) {
+	query := conversationsQuery + `
+		ORDER BY c.updated_at DESC, c.id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId, cq.Limit, cq.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	conversations, err := s.scanConversations(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	unread, err := s.CountUnread(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.ConversationList{Conversations: conversations, UnreadCount: unread}, nil
+}
+
+// Scans the rows of conversationsQuery, closing them, and loads the members
+// of the conversations
+func (s *ConversationStore) scanConversations(ctx context.Context, rows *sql.Rows) ([]*model.Conversation, error) {
+	defer rows.Close()
+
+	conversations := []*model.Conversation{}
+	byId := map[uint32]*model.Conversation{}
+	ids := []int64{}
+	for rows.Next() {
+		c := &model.Conversation{Members: []*model.ConversationMember{}}
+		var lastId, lastSenderId sql.NullInt64
+		var lastContent, lastCreatedAt sql.NullString
+		err := rows.Scan(
+			&c.Id,
+			&c.CreatorId,
+			&c.Title,
+			&c.IsGroup,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+			&c.UnreadCount,
+			&lastId,
+			&lastSenderId,
+			&lastContent,
+			&lastCreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if lastId.Valid {
+			c.LastMessage = &model.Message{
+				Id:             uint32(lastId.Int64),
+				ConversationId: c.Id,
+				SenderId:       uint32(lastSenderId.Int64),
+				Content:        lastContent.String,
+				CreatedAt:      lastCreatedAt.String,
+			}
+		}
+
+		conversations = append(conversations, c)
+		byId[c.Id] = c
+		ids = append(ids, int64(c.Id))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(ids) == 0 {
+		return conversations, nil
+	}
+
+	membersQuery := `
+		SELECT cm.conversation_id, cm.user_id, u.username, cm.last_read_message_id, cm.last_read_at, cm.joined_at
+		FROM conversation_members cm
+		JOIN users u ON u.id = cm.user_id
+		WHERE cm.conversation_id = ANY($1)
+		ORDER BY cm.joined_at, cm.user_id
+	`
+
+	memberRows, err := s.db.QueryContext(ctx, membersQuery, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer memberRows.Close()
+
+	for memberRows.Next() {
+		var conversationId uint32
+		var lastReadAt sql.NullString
+		member := &model.ConversationMember{}
+		err := memberRows.Scan(
+			&conversationId,
+			&member.UserId,
+			&member.Username,
+			&member.LastReadMessageId,
+			&lastReadAt,
+			&member.JoinedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if lastReadAt.Valid {
+			member.LastReadAt = &lastReadAt.String
+		}
+
+		c := byId[conversationId]
+		c.Members = append(c.Members, member)
+	}
+
+	return conversations, memberRows.Err()
+}
+
+// Adds the message to the conversation. The message is read by its sender.
+func (s *ConversationStore) AddMessage(ctx context.Context, message *model.Message) error {
+	query := `
+		INSERT INTO messages (conversation_id, sender_id, content)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+
+	updateQuery := `
+		UPDATE conversations
+		SET updated_at = $2
+		WHERE id = $1
+	`
+
+	readQuery := `
+		UPDATE conversation_members
+		SET last_read_message_id = $3, last_read_at = $4
+		WHERE conversation_id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			message.ConversationId,
+			message.SenderId,
+			message.Content,
+		).Scan(
+			&message.Id,
+			&message.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, updateQuery, message.ConversationId, message.CreatedAt); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, readQuery, message.ConversationId, message.SenderId, message.Id, message.CreatedAt)
+		return err
+	})
+}
+
+// Returns the messages of the conversation from the newest, leaving out the
+// messages of users blocking, or blocked by, the viewer
+func (s *ConversationStore) GetMessages(ctx context.Context, conversationId, viewerId uint32, mq MessageQuery) ([]*model.Message, error) {
+	query := `
+		SELECT m.id, m.conversation_id, m.sender_id, m.content, m.created_at
+		FROM messages m
+		WHERE m.conversation_id = $2 AND ($3 = 0 OR m.id < $3) AND NOT ` + blockedSender + `
+		ORDER BY m.id DESC
+		LIMIT $4
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, viewerId, conversationId, mq.Before, mq.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []*model.Message{}
+	for rows.Next() {
+		m := &model.Message{}
+		err := rows.Scan(
+			&m.Id,
+			&m.ConversationId,
+			&m.SenderId,
+			&m.Content,
+			&m.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+// Marks every message of the conversation as read by the user, returning the
+// id of the last one
+func (s *ConversationStore) MarkRead(ctx context.Context, conversationId, userId uint32) (uint32, error) {
+	query := `
+		UPDATE conversation_members cm
+		SET
+			last_read_message_id = GREATEST(cm.last_read_message_id, last.id),
+			last_read_at = NOW()
+		FROM (
+			SELECT COALESCE(MAX(id), 0) AS id FROM messages WHERE conversation_id = $1
+		) last
+		WHERE cm.conversation_id = $1 AND cm.user_id = $2
+		RETURNING cm.last_read_message_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var lastReadId uint32
+	err := s.db.QueryRowContext(ctx, query, conversationId, userId).Scan(&lastReadId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrResourceNotFound
+		}
+		return 0, err
+	}
+
+	return lastReadId, nil
+}
+
+// Counts the unread messages of the user across every conversation
+func (s *ConversationStore) CountUnread(ctx context.Context, userId uint32) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM conversation_members me
+		JOIN messages m ON m.conversation_id = me.conversation_id AND m.id > me.last_read_message_id
+		WHERE me.user_id = $1 AND m.sender_id <> $1 AND NOT ` + blockedSender
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var count int
+	err := s.db.QueryRowContext(ctx, query, userId).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (s *ConversationStore) GetSettings(ctx context.Context, userId uint32) (*model.MessagingSettings, error) {
+	query := `
+		SELECT dm_following_only FROM users WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	settings := &model.MessagingSettings{}
+	err := s.db.QueryRowContext(ctx, query, userId).Scan(&settings.FollowingOnly)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrResourceNotFound
+		}
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func (s *ConversationStore) UpdateSettings(ctx context.Context, userId uint32, settings *model.MessagingSettings) error {
+	query := `
+		UPDATE users SET dm_following_only = $2 WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userId, settings.FollowingOnly)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrResourceNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,264 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+)
+
+type EmailQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset int    `json:"offset" validate:"gte=0"`
+	Status string `json:"status" validate:"omitempty,oneof=queued sending sent failed"`
+}
+
+func (eq EmailQuery) Parse(r *http.Request) (EmailQuery, error) {
+	qs := r.URL.Query()
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return eq, err
+		}
+
+		eq.Limit = l
+	}
+
+	if offset := qs.Get("offset"); offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return eq, err
+		}
+
+		eq.Offset = o
+	}
+
+	if status := qs.Get("status"); status != "" {
+		eq.Status = status
+	}
+
+	return eq, nil
+}
+
+type EmailStore struct {
+	db *sql.DB
+}
+
+const emailColumns = `
+	id, template, to_name, to_email, subject, locale, body, text_body, unsubscribe_url, status, attempts, max_attempts, send_at, last_error, dedup_key, created_at, sent_at
+`
+
+func scanEmail(row interface{ Scan(...any) error }) (*model.Email, error) {
+	email := &model.Email{}
+	var dedupKey, sentAt sql.NullString
+	err := row.Scan(
+		&email.Id,
+		&email.Template,
+		&email.ToName,
+		&email.ToEmail,
+		&email.Subject,
+		&email.Locale,
+		&email.Body,
+		&email.TextBody,
+		&email.UnsubscribeURL,
+		&email.Status,
+		&email.Attempts,
+		&email.MaxAttempts,
+		&email.SendAt,
+		&email.LastError,
+		&dedupKey,
+		&email.CreatedAt,
+		&sentAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if dedupKey.Valid {
+		email.DedupKey = &dedupKey.String
+	}
+	if sentAt.Valid {
+		email.SentAt = &sentAt.String
+	}
+
+	return email, nil
+}
+
+// Queues the email to be sent. Emails with the dedup key of an existing email
+// are not queued, reporting false.
+func (s *EmailStore) Enqueue(ctx context.Context, email *model.Email) (bool, error) {
+	var queued bool
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+		queued, err = enqueueEmail(ctx, tx, email)
+		return err
+	})
+
+	return queued, err
+}
+
+// Queues the email in the transaction, reporting false when an email with
+// its dedup key is already queued
+func enqueueEmail(ctx context.Context, tx *sql.Tx, email *model.Email) (bool, error) {
+	query := `
+		INSERT INTO emails (template, to_name, to_email, subject, locale, body, text_body, unsubscribe_url, max_attempts, dedup_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (dedup_key) DO NOTHING
+		RETURNING id, status, send_at, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		email.Template,
+		email.ToName,
+		email.ToEmail,
+		email.Subject,
+		email.Locale,
+		email.Body,
+		email.TextBody,
+		email.UnsubscribeURL,
+		email.MaxAttempts,
+		email.DedupKey,
+	).Scan(
+		&email.Id,
+		&email.Status,
+		&email.SendAt,
+		&email.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Claims up to limit emails that are due, counting the attempt. Emails whose
+// lease expired while being sent, e.g. because the instance crashed, are
+// claimed again.
+func (s *EmailStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]*model.Email, error) {
+	query := `
+		UPDATE emails
+		SET status = 'sending', attempts = attempts + 1, locked_until = NOW() + $2 * INTERVAL '1 millisecond'
+		WHERE id IN (
+			SELECT id
+			FROM emails
+			WHERE (status = 'queued' AND send_at <= NOW()) OR (status = 'sending' AND locked_until < NOW())
+			ORDER BY send_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + emailColumns
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := []*model.Email{}
+	for rows.Next() {
+		email, err := scanEmail(rows)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+
+	return emails, rows.Err()
+}
+
+func (s *EmailStore) MarkSent(ctx context.Context, id uint64) error {
+	query := `
+		UPDATE emails
+		SET status = 'sent', locked_until = NULL, last_error = '', sent_at = NOW()
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// Records a failed attempt of the email, queueing it again after retryIn or
+// giving up on it when final
+func (s *EmailStore) MarkFailed(ctx context.Context, email *model.Email, retryIn time.Duration, final bool) error {
+	query := `
+		UPDATE emails
+		SET
+			status = CASE WHEN $4 THEN 'failed' ELSE 'queued' END,
+			send_at = NOW() + $3 * INTERVAL '1 millisecond',
+			locked_until = NULL,
+			last_error = $2
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, email.Id, email.LastError, retryIn.Milliseconds(), final)
+	return err
+}
+
+// Returns the emails, most recent first
+func (s *EmailStore) GetAll(ctx context.Context, eq EmailQuery) ([]*model.Email, error) {
+	query := `
+		SELECT ` + emailColumns + `
+		FROM emails
+		WHERE $3 = '' OR status = $3
+		ORDER BY id DESC
+		LIMIT $1 OFFSET $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, eq.Limit, eq.Offset, eq.Status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := []*model.Email{}
+	for rows.Next() {
+		email, err := scanEmail(rows)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+
+	return emails, rows.Err()
+}
+
+// Deletes the emails sent before the retention
+func (s *EmailStore) Prune(ctx context.Context, retention time.Duration) error {
+	query := `
+		DELETE FROM emails
+		WHERE status = 'sent' AND sent_at < NOW() - make_interval(secs => $1)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, retention.Seconds())
+	return err
+}
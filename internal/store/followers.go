@@ -12,28 +12,44 @@ type FollowerStore struct {
 	db *sql.DB
 }
 
+// Follows the user, unless either of the users blocked the other
 func (s *FollowerStore) Follow(ctx context.Context, unfollower *model.FollowAction) error {
 	query := `
 		INSERT INTO followers (user_id, follower_id)
-		VALUES ($1, $2)
+		SELECT $1, $2
+		WHERE NOT EXISTS (
+			SELECT 1 FROM user_blocks b
+			WHERE (b.blocker_id = $1 AND b.blocked_id = $2) OR (b.blocker_id = $2 AND b.blocked_id = $1)
+		)
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := s.db.ExecContext(
-		ctx,
-		query,
-		unfollower.TargetUserId,
-		unfollower.SenderUserId,
-	)
-	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
-			return ErrResourceAlreadyExists
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(
+			ctx,
+			query,
+			unfollower.TargetUserId,
+			unfollower.SenderUserId,
+		)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrResourceAlreadyExists
+			}
+			return err
 		}
-	}
 
-	return nil
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrFollowNotAllowed
+		}
+
+		return addEvent(ctx, tx, model.EventUserFollowed, &model.UserFollowed{Follow: unfollower})
+	})
 }
 
 func (s *FollowerStore) Unfollow(ctx context.Context, follower *model.FollowAction) error {
@@ -62,3 +78,51 @@ func (s *FollowerStore) Unfollow(ctx context.Context, follower *model.FollowActi
 
 	return nil
 }
+
+func (s *FollowerStore) CountFollowers(ctx context.Context, userId uint32) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM followers
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var count int
+	err := s.db.QueryRowContext(ctx, query, userId).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Returns the ids of the users followed by the user
+func (s *FollowerStore) GetFollowingIds(ctx context.Context, userId uint32) ([]uint32, error) {
+	query := `
+		SELECT user_id
+		FROM followers
+		WHERE follower_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uint32{}
+	for rows.Next() {
+		var id uint32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,262 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+)
+
+type JobQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset int    `json:"offset" validate:"gte=0"`
+	Status string `json:"status" validate:"omitempty,oneof=queued running succeeded dead"`
+}
+
+func (jq JobQuery) Parse(r *http.Request) (JobQuery, error) {
+	qs := r.URL.Query()
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return jq, err
+		}
+
+		jq.Limit = l
+	}
+
+	if offset := qs.Get("offset"); offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return jq, err
+		}
+
+		jq.Offset = o
+	}
+
+	if status := qs.Get("status"); status != "" {
+		jq.Status = status
+	}
+
+	return jq, nil
+}
+
+type JobStore struct {
+	db *sql.DB
+}
+
+const jobColumns = `
+	id, kind, payload, status, attempts, max_attempts, run_at, last_error, unique_key, created_at, finished_at
+`
+
+func scanJob(row interface{ Scan(...any) error }) (*model.Job, error) {
+	job := &model.Job{}
+	var payload []byte
+	var uniqueKey, finishedAt sql.NullString
+	err := row.Scan(
+		&job.Id,
+		&job.Kind,
+		&payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LastError,
+		&uniqueKey,
+		&job.CreatedAt,
+		&finishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Payload = payload
+	if uniqueKey.Valid {
+		job.UniqueKey = &uniqueKey.String
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.String
+	}
+
+	return job, nil
+}
+
+// Queues the job to run after delay. Jobs with the unique key of an existing
+// job are not queued, reporting false.
+func (s *JobStore) Enqueue(ctx context.Context, job *model.Job, delay time.Duration) (bool, error) {
+	query := `
+		INSERT INTO jobs (kind, payload, max_attempts, run_at, unique_key)
+		VALUES ($1, $2, $3, NOW() + $4 * INTERVAL '1 millisecond', $5)
+		ON CONFLICT (unique_key) DO NOTHING
+		RETURNING id, status, run_at, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		job.Kind,
+		string(job.Payload),
+		job.MaxAttempts,
+		delay.Milliseconds(),
+		job.UniqueKey,
+	).Scan(
+		&job.Id,
+		&job.Status,
+		&job.RunAt,
+		&job.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Claims the next job that is due, counting the attempt. Running jobs whose
+// lease expired, e.g. because their worker crashed, are claimed again.
+// Returns ErrResourceNotFound when there is no job to run.
+func (s *JobStore) Claim(ctx context.Context, lease time.Duration) (*model.Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, locked_until = NOW() + $1 * INTERVAL '1 millisecond'
+		WHERE id = (
+			SELECT id
+			FROM jobs
+			WHERE (status = 'queued' AND run_at <= NOW()) OR (status = 'running' AND locked_until < NOW())
+			ORDER BY run_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + jobColumns
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	job, err := scanJob(s.db.QueryRowContext(ctx, query, lease.Milliseconds()))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrResourceNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return job, nil
+}
+
+func (s *JobStore) Complete(ctx context.Context, id uint64) error {
+	query := `
+		UPDATE jobs
+		SET status = 'succeeded', locked_until = NULL, last_error = '', finished_at = NOW()
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// Records a failed attempt of the job, queueing it again after retryIn or
+// moving it to the dead jobs when dead
+func (s *JobStore) Fail(ctx context.Context, job *model.Job, retryIn time.Duration, dead bool) error {
+	query := `
+		UPDATE jobs
+		SET
+			status = CASE WHEN $4 THEN 'dead' ELSE 'queued' END,
+			run_at = NOW() + $3 * INTERVAL '1 millisecond',
+			locked_until = NULL,
+			last_error = $2,
+			finished_at = CASE WHEN $4 THEN NOW() ELSE NULL END
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, job.Id, job.LastError, retryIn.Milliseconds(), dead)
+	return err
+}
+
+// Returns the jobs, most recent first
+func (s *JobStore) GetAll(ctx context.Context, jq JobQuery) ([]*model.Job, error) {
+	query := `
+		SELECT ` + jobColumns + `
+		FROM jobs
+		WHERE $3 = '' OR status = $3
+		ORDER BY id DESC
+		LIMIT $1 OFFSET $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, jq.Limit, jq.Offset, jq.Status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*model.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// Queues a dead job again with all its attempts
+func (s *JobStore) Retry(ctx context.Context, id uint64) (*model.Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'queued', attempts = 0, run_at = NOW(), finished_at = NULL
+		WHERE id = $1 AND status = 'dead'
+		RETURNING ` + jobColumns
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	job, err := scanJob(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrResourceNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return job, nil
+}
+
+// Deletes the succeeded jobs finished before the retention
+func (s *JobStore) Prune(ctx context.Context, retention time.Duration) error {
+	query := `
+		DELETE FROM jobs
+		WHERE status = 'succeeded' AND finished_at < NOW() - make_interval(secs => $1)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, retention.Seconds())
+	return err
+}
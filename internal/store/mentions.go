@@ -0,0 +1,92 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/lib/pq"
+)
+
+// Sets the user ids of the mention entities, dropping the mentions of unknown
+// or inactive users so only real users are linked
+func resolveMentions(ctx context.Context, tx *sql.Tx, entities model.Entities) (model.Entities, error) {
+	usernames := entities.Mentions()
+	if len(usernames) == 0 {
+		return entities, nil
+	}
+
+	query := `
+		SELECT id, username
+		FROM users
+		WHERE username = ANY($1) AND is_active = true
+	`
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(usernames))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := map[string]uint32{}
+	for rows.Next() {
+		var id uint32
+		var username string
+		if err := rows.Scan(&id, &username); err != nil {
+			return nil, err
+		}
+		ids[username] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	resolved := model.Entities{}
+	for _, entity := range entities {
+		if entity.Type == model.EntityMention {
+			id, ok := ids[entity.Text]
+			if !ok {
+				continue
+			}
+			entity.UserId = id
+		}
+		resolved = append(resolved, entity)
+	}
+
+	return resolved, nil
+}
+
+// Replaces the mentions of a post, or of a comment when commentId is not nil.
+// Authors mentioning themselves are not recorded.
+func saveMentions(ctx context.Context, tx *sql.Tx, authorId, postId uint32, commentId *uint32, entities model.Entities) error {
+	deleteQuery := `
+		DELETE FROM mentions
+		WHERE post_id = $1 AND comment_id IS NOT DISTINCT FROM $2
+	`
+
+	if _, err := tx.ExecContext(ctx, deleteQuery, postId, commentId); err != nil {
+		return err
+	}
+
+	userIds := []int64{}
+	seen := map[uint32]bool{}
+	for _, entity := range entities {
+		if entity.Type != model.EntityMention || entity.UserId == authorId || seen[entity.UserId] {
+			continue
+		}
+		seen[entity.UserId] = true
+		userIds = append(userIds, int64(entity.UserId))
+	}
+
+	if len(userIds) == 0 {
+		return nil
+	}
+
+	insertQuery := `
+		INSERT INTO mentions (user_id, author_id, post_id, comment_id)
+		SELECT UNNEST($1::bigint[]), $2::bigint, $3::bigint, $4::bigint
+	`
+
+	_, err := tx.ExecContext(ctx, insertQuery, pq.Array(userIds), authorId, postId, commentId)
+	return err
+}
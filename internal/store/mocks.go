@@ -10,7 +10,21 @@ import (
 
 func NewMockStore() *Storage {
 	return &Storage{
-		Users: &MockUserStore{},
+		Users:         &MockUserStore{},
+		Posts:         &MockPostStore{},
+		Reactions:     &MockReactionStore{},
+		Trending:      &MockTrendingStore{},
+		Tags:          &MockTagStore{},
+		Search:        &MockSearchStore{},
+		Notifications: &MockNotificationStore{},
+		Followers:     &MockFollowerStore{},
+		Blocks:        &MockBlockStore{},
+		Conversations: &MockConversationStore{},
+		Roles:         &MockRoleStore{},
+		Webhooks:      &MockWebhookStore{},
+		Outbox:        &MockOutboxStore{},
+		Jobs:          &MockJobStore{},
+		Emails:        &MockEmailStore{},
 	}
 }
 
@@ -34,14 +48,473 @@ func (m *MockUserStore) GetByEmail(ctx context.Context, email string) (*model.Us
 	return &model.User{}, nil
 }
 
+func (m *MockUserStore) GetActiveIds(ctx context.Context, ids []uint32) ([]uint32, error) {
+	return ids, nil
+}
+
 func (m *MockUserStore) DeleteById(ctx context.Context, id uint32) error {
 	return nil
 }
 
-func (m *MockUserStore) CreateAndInvite(ctx context.Context, user *model.User, baseUrl string, tokenTTL time.Duration) error {
+func (m *MockUserStore) CreateAndInvite(ctx context.Context, user *model.User, baseUrl string, tokenTTL time.Duration, welcome *model.Email) error {
 	return nil
 }
 
 func (m *MockUserStore) Activate(ctx context.Context, token string) error {
 	return nil
 }
+
+func (m *MockUserStore) Search(ctx context.Context, viewerId uint32, uq UserSearchQuery) ([]*model.UserSuggestion, error) {
+	return []*model.UserSuggestion{}, nil
+}
+
+func (m *MockUserStore) DeleteExpiredInvitations(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+type MockPostStore struct {
+}
+
+func (m *MockPostStore) Create(ctx context.Context, post *model.Post) error {
+	return nil
+}
+
+func (m *MockPostStore) GetById(ctx context.Context, id uint32) (*model.Post, error) {
+	if id == 0 {
+		return nil, ErrResourceNotFound
+	}
+	return &model.Post{
+		Id: id,
+	}, nil
+}
+
+func (m *MockPostStore) GetByIds(ctx context.Context, ids []uint32) ([]*model.Post, error) {
+	posts := []*model.Post{}
+	for _, id := range ids {
+		post, err := m.GetById(ctx, id)
+		if err != nil {
+			continue
+		}
+		posts = append(posts, post)
+	}
+	return posts, nil
+}
+
+func (m *MockPostStore) Update(ctx context.Context, post *model.Post) error {
+	return nil
+}
+
+func (m *MockPostStore) DeleteById(ctx context.Context, id uint32) error {
+	return nil
+}
+
+func (m *MockPostStore) GetUserFeed(ctx context.Context, userId uint32, fq PaginatedFeedQuery) ([]*model.Post, error) {
+	return []*model.Post{}, nil
+}
+
+func (m *MockPostStore) GetExplore(ctx context.Context, viewerId uint32, fq PaginatedFeedQuery) ([]*model.Post, error) {
+	return []*model.Post{}, nil
+}
+
+func (m *MockPostStore) GetByTag(ctx context.Context, viewerId uint32, tag string, fq PaginatedFeedQuery) ([]*model.Post, error) {
+	return []*model.Post{}, nil
+}
+
+func (m *MockPostStore) GetMentioning(ctx context.Context, userId uint32, fq PaginatedFeedQuery) ([]*model.Post, error) {
+	return []*model.Post{}, nil
+}
+
+type MockReactionStore struct {
+}
+
+func (m *MockReactionStore) React(ctx context.Context, reaction *model.Reaction) error {
+	return nil
+}
+
+func (m *MockReactionStore) Unreact(ctx context.Context, postId, userId uint32) error {
+	return nil
+}
+
+func (m *MockReactionStore) GetAuthorAffinities(ctx context.Context, userId uint32) (map[uint32]float64, error) {
+	return map[uint32]float64{}, nil
+}
+
+func (m *MockReactionStore) GetTagInterests(ctx context.Context, userId uint32) (map[string]float64, error) {
+	return map[string]float64{}, nil
+}
+
+type MockTrendingStore struct {
+}
+
+func (m *MockTrendingStore) Refresh(ctx context.Context, window string, duration time.Duration, limit int) (*model.TrendingSnapshot, error) {
+	return &model.TrendingSnapshot{Window: window}, nil
+}
+
+func (m *MockTrendingStore) GetLatest(ctx context.Context, window string) (*model.TrendingSnapshot, error) {
+	return &model.TrendingSnapshot{
+		Window: window,
+		Tags:   []*model.TrendingTag{},
+		Posts:  []*model.TrendingPost{},
+	}, nil
+}
+
+func (m *MockTrendingStore) Prune(ctx context.Context, retention time.Duration) error {
+	return nil
+}
+
+type MockTagStore struct {
+}
+
+func (m *MockTagStore) Follow(ctx context.Context, follow *model.TagFollow) error {
+	return nil
+}
+
+func (m *MockTagStore) Unfollow(ctx context.Context, follow *model.TagFollow) error {
+	return nil
+}
+
+func (m *MockTagStore) GetStats(ctx context.Context, userId uint32, tag string) (*model.TagStats, error) {
+	return &model.TagStats{Tag: tag}, nil
+}
+
+func (m *MockTagStore) GetFollowed(ctx context.Context, userId uint32) ([]*model.TagStats, error) {
+	return []*model.TagStats{}, nil
+}
+
+func (m *MockTagStore) GetFollowedNames(ctx context.Context, userId uint32) ([]string, error) {
+	return []string{}, nil
+}
+
+type MockSearchStore struct {
+}
+
+func (m *MockSearchStore) SearchPosts(ctx context.Context, viewerId uint32, sq SearchQuery) ([]*model.PostSearchResult, error) {
+	return []*model.PostSearchResult{}, nil
+}
+
+func (m *MockSearchStore) SearchComments(ctx context.Context, viewerId uint32, sq SearchQuery) ([]*model.CommentSearchResult, error) {
+	return []*model.CommentSearchResult{}, nil
+}
+
+func (m *MockSearchStore) SearchUsers(ctx context.Context, viewerId uint32, sq SearchQuery) ([]*model.UserSearchResult, error) {
+	return []*model.UserSearchResult{}, nil
+}
+
+func (m *MockSearchStore) ScanPosts(ctx context.Context, fn func(*model.Post) error) error {
+	return nil
+}
+
+func (m *MockSearchStore) ScanComments(ctx context.Context, fn func(*model.Comment, []string) error) error {
+	return nil
+}
+
+type MockFollowerStore struct {
+}
+
+func (m *MockFollowerStore) Follow(ctx context.Context, follow *model.FollowAction) error {
+	return nil
+}
+
+func (m *MockFollowerStore) Unfollow(ctx context.Context, follow *model.FollowAction) error {
+	return nil
+}
+
+func (m *MockFollowerStore) CountFollowers(ctx context.Context, userId uint32) (int, error) {
+	return 0, nil
+}
+
+func (m *MockFollowerStore) GetFollowingIds(ctx context.Context, userId uint32) ([]uint32, error) {
+	return []uint32{}, nil
+}
+
+type MockBlockStore struct {
+}
+
+func (m *MockBlockStore) Block(ctx context.Context, block *model.Block) error {
+	return nil
+}
+
+func (m *MockBlockStore) Unblock(ctx context.Context, block *model.Block) error {
+	return nil
+}
+
+func (m *MockBlockStore) IsBlocked(ctx context.Context, userId, otherUserId uint32) (bool, error) {
+	return false, nil
+}
+
+func (m *MockBlockStore) GetBlockedIds(ctx context.Context, userId uint32) ([]uint32, error) {
+	return []uint32{}, nil
+}
+
+type MockNotificationStore struct {
+}
+
+func (m *MockNotificationStore) Add(ctx context.Context, event *model.NotificationEvent) (bool, error) {
+	return event.UserId != event.ActorId, nil
+}
+
+func (m *MockNotificationStore) GetByUser(ctx context.Context, userId uint32, nq NotificationQuery) (*model.NotificationList, error) {
+	return &model.NotificationList{Notifications: []*model.Notification{}}, nil
+}
+
+func (m *MockNotificationStore) CountUnread(ctx context.Context, userId uint32) (int, error) {
+	return 0, nil
+}
+
+func (m *MockNotificationStore) MarkRead(ctx context.Context, userId, notificationId uint32) error {
+	if notificationId == 0 {
+		return ErrResourceNotFound
+	}
+	return nil
+}
+
+func (m *MockNotificationStore) MarkAllRead(ctx context.Context, userId uint32) error {
+	return nil
+}
+
+func (m *MockNotificationStore) GetEmailPreferences(ctx context.Context, userId uint32) (*model.EmailPreferences, error) {
+	if userId == 0 {
+		return nil, ErrResourceNotFound
+	}
+	return &model.EmailPreferences{
+		Follow:   model.EmailWeekly,
+		Comment:  model.EmailDaily,
+		Mention:  model.EmailImmediate,
+		Reaction: model.EmailWeekly,
+	}, nil
+}
+
+func (m *MockNotificationStore) UpdateEmailPreferences(ctx context.Context, userId uint32, prefs *model.EmailPreferences) error {
+	return nil
+}
+
+func (m *MockNotificationStore) UnsubscribeEmails(ctx context.Context, userId uint32, scope string) error {
+	if userId == 0 {
+		return ErrResourceNotFound
+	}
+	return nil
+}
+
+func (m *MockNotificationStore) GetDigestRecipients(ctx context.Context, dq DigestQuery, afterUserId uint32, limit int) ([]uint32, error) {
+	return []uint32{}, nil
+}
+
+func (m *MockNotificationStore) GetDigest(ctx context.Context, userId uint32, dq DigestQuery) ([]*model.Notification, error) {
+	return []*model.Notification{}, nil
+}
+
+func (m *MockNotificationStore) QueueDigest(ctx context.Context, userId uint32, dq DigestQuery, email *model.Email) (bool, error) {
+	return true, nil
+}
+
+type MockConversationStore struct {
+}
+
+func (m *MockConversationStore) CanMessage(ctx context.Context, senderId uint32, recipientIds []uint32) error {
+	for _, id := range recipientIds {
+		if id == 0 {
+			return ErrResourceNotFound
+		}
+	}
+	return nil
+}
+
+func (m *MockConversationStore) Create(ctx context.Context, conversation *model.Conversation, memberIds []uint32) error {
+	conversation.Id = 1
+	return nil
+}
+
+func (m *MockConversationStore) GetById(ctx context.Context, conversationId, userId uint32) (*model.Conversation, error) {
+	if conversationId == 0 {
+		return nil, ErrResourceNotFound
+	}
+	return &model.Conversation{
+		Id:        conversationId,
+		CreatorId: userId,
+		Members: []*model.ConversationMember{
+			{UserId: userId},
+			{UserId: userId + 1},
+		},
+	}, nil
+}
+
+func (m *MockConversationStore) GetByUser(ctx context.Context, userId uint32, cq ConversationQuery) (*model.ConversationList, error) {
+	return &model.ConversationList{Conversations: []*model.Conversation{}}, nil
+}
+
+func (m *MockConversationStore) AddMessage(ctx context.Context, message *model.Message) error {
+	message.Id = 1
+	return nil
+}
+
+func (m *MockConversationStore) GetMessages(ctx context.Context, conversationId, viewerId uint32, mq MessageQuery) ([]*model.Message, error) {
+	return []*model.Message{}, nil
+}
+
+func (m *MockConversationStore) MarkRead(ctx context.Context, conversationId, userId uint32) (uint32, error) {
+	return 0, nil
+}
+
+func (m *MockConversationStore) CountUnread(ctx context.Context, userId uint32) (int, error) {
+	return 0, nil
+}
+
+func (m *MockConversationStore) GetSettings(ctx context.Context, userId uint32) (*model.MessagingSettings, error) {
+	return &model.MessagingSettings{}, nil
+}
+
+func (m *MockConversationStore) UpdateSettings(ctx context.Context, userId uint32, settings *model.MessagingSettings) error {
+	return nil
+}
+
+type MockRoleStore struct {
+}
+
+func (m *MockRoleStore) GetByName(ctx context.Context, name string) (*model.Role, error) {
+	levels := map[string]int{"user": 1, "moderator": 2, "admin": 3}
+
+	level, ok := levels[name]
+	if !ok {
+		return nil, ErrResourceNotFound
+	}
+	return &model.Role{Name: name, Level: level}, nil
+}
+
+type MockWebhookStore struct {
+}
+
+func (m *MockWebhookStore) Create(ctx context.Context, webhook *model.Webhook) error {
+	webhook.Id = 1
+	return nil
+}
+
+func (m *MockWebhookStore) GetById(ctx context.Context, id uint32) (*model.Webhook, error) {
+	if id == 0 {
+		return nil, ErrResourceNotFound
+	}
+	return &model.Webhook{
+		Id:     id,
+		URL:    "http://localhost/hook",
+		Events: []string{},
+		Active: true,
+	}, nil
+}
+
+func (m *MockWebhookStore) GetAll(ctx context.Context) ([]*model.Webhook, error) {
+	return []*model.Webhook{}, nil
+}
+
+func (m *MockWebhookStore) Update(ctx context.Context, webhook *model.Webhook) error {
+	return nil
+}
+
+func (m *MockWebhookStore) DeleteById(ctx context.Context, id uint32) error {
+	if id == 0 {
+		return ErrResourceNotFound
+	}
+	return nil
+}
+
+func (m *MockWebhookStore) Enqueue(ctx context.Context, event string, payload []byte) (int, error) {
+	return 0, nil
+}
+
+func (m *MockWebhookStore) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*model.WebhookDelivery, error) {
+	return []*model.WebhookDelivery{}, nil
+}
+
+func (m *MockWebhookStore) RecordAttempt(ctx context.Context, delivery *model.WebhookDelivery, attempt *WebhookAttempt, disableAfter int) (bool, error) {
+	return false, nil
+}
+
+func (m *MockWebhookStore) GetDeliveries(ctx context.Context, webhookId uint32, dq WebhookDeliveryQuery) ([]*model.WebhookDelivery, error) {
+	return []*model.WebhookDelivery{}, nil
+}
+
+func (m *MockWebhookStore) PruneDeliveries(ctx context.Context, retention time.Duration) error {
+	return nil
+}
+
+type MockOutboxStore struct {
+}
+
+func (m *MockOutboxStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]*model.DomainEvent, error) {
+	return []*model.DomainEvent{}, nil
+}
+
+func (m *MockOutboxStore) MarkDispatched(ctx context.Context, id uint64) error {
+	return nil
+}
+
+func (m *MockOutboxStore) MarkFailed(ctx context.Context, event *model.DomainEvent, retryIn time.Duration, final bool) error {
+	return nil
+}
+
+func (m *MockOutboxStore) Prune(ctx context.Context, retention time.Duration) error {
+	return nil
+}
+
+type MockJobStore struct {
+}
+
+func (m *MockJobStore) Enqueue(ctx context.Context, job *model.Job, delay time.Duration) (bool, error) {
+	job.Id = 1
+	job.Status = model.JobQueued
+	return true, nil
+}
+
+func (m *MockJobStore) Claim(ctx context.Context, lease time.Duration) (*model.Job, error) {
+	return nil, ErrResourceNotFound
+}
+
+func (m *MockJobStore) Complete(ctx context.Context, id uint64) error {
+	return nil
+}
+
+func (m *MockJobStore) Fail(ctx context.Context, job *model.Job, retryIn time.Duration, dead bool) error {
+	return nil
+}
+
+func (m *MockJobStore) GetAll(ctx context.Context, jq JobQuery) ([]*model.Job, error) {
+	return []*model.Job{}, nil
+}
+
+func (m *MockJobStore) Retry(ctx context.Context, id uint64) (*model.Job, error) {
+	if id == 0 {
+		return nil, ErrResourceNotFound
+	}
+	return &model.Job{Id: id, Status: model.JobQueued}, nil
+}
+
+func (m *MockJobStore) Prune(ctx context.Context, retention time.Duration) error {
+	return nil
+}
+
+type MockEmailStore struct {
+}
+
+func (m *MockEmailStore) Enqueue(ctx context.Context, email *model.Email) (bool, error) {
+	email.Id = 1
+	email.Status = model.EmailQueued
+	return true, nil
+}
+
+func (m *MockEmailStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]*model.Email, error) {
+	return []*model.Email{}, nil
+}
+
+func (m *MockEmailStore) MarkSent(ctx context.Context, id uint64) error {
+	return nil
+}
+
+func (m *MockEmailStore) MarkFailed(ctx context.Context, email *model.Email, retryIn time.Duration, final bool) error {
+	return nil
+}
+
+func (m *MockEmailStore) GetAll(ctx context.Context, eq EmailQuery) ([]*model.Email, error) {
+	return []*model.Email{}, nil
+}
+
+func (m *MockEmailStore) Prune(ctx context.Context, retention time.Duration) error {
+	return nil
+}
@@ -0,0 +1,439 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/lib/pq"
+)
+
+// Number of actor usernames used to build the summary of a notification
+const notificationSummaryActors = 2
+
+type NotificationQuery struct {
+	Limit      int  `json:"limit" validate:"gte=1,lte=50"`
+	Offset     int  `json:"offset" validate:"gte=0"`
+	UnreadOnly bool `json:"unread"`
+}
+
+func (nq NotificationQuery) Parse(r *http.Request) (NotificationQuery, error) {
+	qs := r.URL.Query()
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return nq, err
+		}
+
+		nq.Limit = l
+	}
+
+	if offset := qs.Get("offset"); offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return nq, err
+		}
+
+		nq.Offset = o
+	}
+
+	if unread := qs.Get("unread"); unread != "" {
+		u, err := strconv.ParseBool(unread)
+		if err != nil {
+			return nq, err
+		}
+
+		nq.UnreadOnly = u
+	}
+
+	return nq, nil
+}
+
+type NotificationStore struct {
+	db *sql.DB
+}
+
+// Adds the event to the unread notification of the same group, creating it
+// when there is none. Events of users blocking, or blocked by, the recipient
+// and events of the recipient itself are ignored, reporting false.
+func (s *NotificationStore) Add(ctx context.Context, event *model.NotificationEvent) (bool, error) {
+	query := `
+		INSERT INTO notifications (user_id, kind, post_id, actor_ids)
+		SELECT $1, $2, $3, ARRAY[$4]::bigint[]
+		WHERE
+			$1 <> $4 AND
+			NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = $1 AND b.blocked_id = $4) OR (b.blocker_id = $4 AND b.blocked_id = $1)
+			)
+		ON CONFLICT (user_id, kind, COALESCE(post_id, 0)) WHERE read_at IS NULL
+		DO UPDATE SET
+			actor_ids = ARRAY[$4]::bigint[] || array_remove(notifications.actor_ids, $4),
+			updated_at = NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, int64(event.UserId), event.Kind, event.PostId, int64(event.ActorId))
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// Returns the notifications of the user, most recently updated first, with
+// the number of unread notifications
+func (s *NotificationStore) GetByUser(ctx context.Context, userId uint32, nq NotificationQuery) (*model.NotificationList, error) {
+	query := `
+		SELECT n.id, n.user_id, n.kind, n.post_id, n.actor_ids, cardinality(n.actor_ids), n.read_at IS NOT NULL, n.created_at, n.updated_at,
+			ARRAY(
+				SELECT u.username
+				FROM UNNEST(n.actor_ids[1:$5]) WITH ORDINALITY AS a(id, ord)
+				JOIN users u ON u.id = a.id
+				ORDER BY a.ord
+			)
+		FROM notifications n
+		WHERE n.user_id = $1 AND ($4 = false OR n.read_at IS NULL)
+		ORDER BY n.updated_at DESC, n.id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId, nq.Limit, nq.Offset, nq.UnreadOnly, notificationSummaryActors)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := &model.NotificationList{}
+	list.Notifications, err = scanNotifications(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	list.UnreadCount, err = s.CountUnread(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// Scans the rows of notifications selected with their actor usernames
+func scanNotifications(rows *sql.Rows) ([]*model.Notification, error) {
+	notifications := []*model.Notification{}
+	for rows.Next() {
+		n := &model.Notification{}
+		var postId sql.NullInt64
+		var actorIds []int64
+		var usernames []string
+		err := rows.Scan(
+			&n.Id,
+			&n.UserId,
+			&n.Kind,
+			&postId,
+			pq.Array(&actorIds),
+			&n.ActorsCount,
+			&n.Read,
+			&n.CreatedAt,
+			&n.UpdatedAt,
+			pq.Array(&usernames),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if postId.Valid {
+			id := uint32(postId.Int64)
+			n.PostId = &id
+		}
+		n.ActorIds = make([]uint32, len(actorIds))
+		for i, id := range actorIds {
+			n.ActorIds[i] = uint32(id)
+		}
+		n.SetSummary(usernames)
+
+		notifications = append(notifications, n)
+	}
+
+	return notifications, rows.Err()
+}
+
+func (s *NotificationStore) CountUnread(ctx context.Context, userId uint32) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM notifications
+		WHERE user_id = $1 AND read_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var count int
+	err := s.db.QueryRowContext(ctx, query, userId).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Marks the notification as read. Notifications of other users are not found.
+func (s *NotificationStore) MarkRead(ctx context.Context, userId, notificationId uint32) error {
+	query := `
+		UPDATE notifications
+		SET read_at = COALESCE(read_at, NOW())
+		WHERE id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, notificationId, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrResourceNotFound
+	}
+
+	return nil
+}
+
+func (s *NotificationStore) MarkAllRead(ctx context.Context, userId uint32) error {
+	query := `
+		UPDATE notifications
+		SET read_at = NOW()
+		WHERE user_id = $1 AND read_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userId)
+	return err
+}
+
+// DigestQuery selects the unread notifications emailed in a digest of the
+// frequency, updated since the last digest and up to Until. Window is how
+// far back the first digest of a user goes.
+type DigestQuery struct {
+	Frequency string
+	Window    time.Duration
+	Until     time.Time
+}
+
+// Matches the unread notifications of the digest, with $1 the frequency, $2
+// the window and $3 the end of the digest
+const digestCondition = `
+	n.read_at IS NULL AND
+	n.updated_at <= $3 AND
+	n.updated_at > COALESCE(
+		CASE WHEN $1 = 'daily' THEN p.daily_digest_at ELSE p.weekly_digest_at END,
+		$3 - $2 * INTERVAL '1 millisecond'
+	) AND
+	CASE n.kind
+		WHEN 'follow' THEN p.follow
+		WHEN 'comment' THEN p.comment
+		WHEN 'mention' THEN p.mention
+		WHEN 'reaction' THEN p.reaction
+	END = $1
+`
+
+func (s *NotificationStore) GetEmailPreferences(ctx context.Context, userId uint32) (*model.EmailPreferences, error) {
+	query := `
+		SELECT follow, comment, mention, reaction
+		FROM email_preferences
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	prefs := &model.EmailPreferences{}
+	err := s.db.QueryRowContext(ctx, query, userId).Scan(
+		&prefs.Follow,
+		&prefs.Comment,
+		&prefs.Mention,
+		&prefs.Reaction,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrResourceNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return prefs, nil
+}
+
+func (s *NotificationStore) UpdateEmailPreferences(ctx context.Context, userId uint32, prefs *model.EmailPreferences) error {
+	query := `
+		UPDATE email_preferences
+		SET follow = $2, comment = $3, mention = $4, reaction = $5
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userId, prefs.Follow, prefs.Comment, prefs.Mention, prefs.Reaction)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrResourceNotFound
+	}
+
+	return nil
+}
+
+// Stops emailing the notifications of the scope to the user. The scope is a
+// kind of notification, or a frequency to stop every kind emailed that often.
+func (s *NotificationStore) UnsubscribeEmails(ctx context.Context, userId uint32, scope string) error {
+	query := `
+		UPDATE email_preferences
+		SET
+			follow = CASE WHEN $2 IN ('follow', follow) THEN 'off' ELSE follow END,
+			comment = CASE WHEN $2 IN ('comment', comment) THEN 'off' ELSE comment END,
+			mention = CASE WHEN $2 IN ('mention', mention) THEN 'off' ELSE mention END,
+			reaction = CASE WHEN $2 IN ('reaction', reaction) THEN 'off' ELSE reaction END
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userId, scope)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrResourceNotFound
+	}
+
+	return nil
+}
+
+// Returns up to limit ids of the users with notifications for the digest,
+// in order and after the given user id
+func (s *NotificationStore) GetDigestRecipients(ctx context.Context, dq DigestQuery, afterUserId uint32, limit int) ([]uint32, error) {
+	query := `
+		SELECT DISTINCT n.user_id
+		FROM notifications n
+		JOIN email_preferences p ON p.user_id = n.user_id
+		WHERE n.user_id > $4 AND ` + digestCondition + `
+		ORDER BY n.user_id
+		LIMIT $5
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, dq.Frequency, dq.Window.Milliseconds(), dq.Until, afterUserId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uint32{}
+	for rows.Next() {
+		var id uint32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Returns the notifications of the user for the digest, most recently
+// updated first
+func (s *NotificationStore) GetDigest(ctx context.Context, userId uint32, dq DigestQuery) ([]*model.Notification, error) {
+	query := `
+		SELECT n.id, n.user_id, n.kind, n.post_id, n.actor_ids, cardinality(n.actor_ids), n.read_at IS NOT NULL, n.created_at, n.updated_at,
+			ARRAY(
+				SELECT u.username
+				FROM UNNEST(n.actor_ids[1:$5]) WITH ORDINALITY AS a(id, ord)
+				JOIN users u ON u.id = a.id
+				ORDER BY a.ord
+			)
+		FROM notifications n
+		JOIN email_preferences p ON p.user_id = n.user_id
+		WHERE n.user_id = $4 AND ` + digestCondition + `
+		ORDER BY n.updated_at DESC, n.id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, dq.Frequency, dq.Window.Milliseconds(), dq.Until, userId, notificationSummaryActors)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanNotifications(rows)
+}
+
+// Queues the digest email and records that the notifications up to the end
+// of the digest were sent, so the next digest starts from there. Both happen
+// in one transaction, a retried job neither repeats nor skips the digest.
+// Reports false when an email with the dedup key of the digest was queued.
+func (s *NotificationStore) QueueDigest(ctx context.Context, userId uint32, dq DigestQuery, email *model.Email) (bool, error) {
+	query := `
+		UPDATE email_preferences
+		SET
+			daily_digest_at = CASE WHEN $2 = 'daily' THEN $3 ELSE daily_digest_at END,
+			weekly_digest_at = CASE WHEN $2 = 'weekly' THEN $3 ELSE weekly_digest_at END
+		WHERE user_id = $1
+	`
+
+	var queued bool
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+		queued, err = enqueueEmail(ctx, tx, email)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		_, err = tx.ExecContext(ctx, query, userId, dq.Frequency, dq.Until)
+		return err
+	})
+
+	return queued, err
+}
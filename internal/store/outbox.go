@@ -0,0 +1,149 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/lib/pq"
+)
+
+type OutboxStore struct {
+	db *sql.DB
+}
+
+// Records the domain event within tx, so it's only dispatched when the state
+// change it describes is committed
+func addEvent(ctx context.Context, tx *sql.Tx, kind string, payload any) error {
+	query := `
+		INSERT INTO outbox_events (kind, payload)
+		VALUES ($1, $2)
+	`
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, query, kind, string(data))
+	return err
+}
+
+// Claims up to limit events that are due, oldest first. Their next attempt is
+// pushed back by lease, so other instances don't dispatch them again while
+// they are being handled.
+func (s *OutboxStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]*model.DomainEvent, error) {
+	query := `
+		UPDATE outbox_events
+		SET next_attempt_at = NOW() + $2 * INTERVAL '1 millisecond'
+		WHERE id IN (
+			SELECT id
+			FROM outbox_events
+			WHERE dispatched_at IS NULL AND failed_at IS NULL AND next_attempt_at <= NOW()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, kind, payload, attempts, handled, last_error, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*model.DomainEvent{}
+	for rows.Next() {
+		event := &model.DomainEvent{}
+		var payload []byte
+		err := rows.Scan(
+			&event.Id,
+			&event.Kind,
+			&payload,
+			&event.Attempts,
+			pq.Array(&event.Handled),
+			&event.LastError,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		event.Payload = payload
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING doesn't keep the order of the subquery
+	slices.SortFunc(events, func(a, b *model.DomainEvent) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+
+	return events, nil
+}
+
+func (s *OutboxStore) MarkDispatched(ctx context.Context, id uint64) error {
+	query := `
+		UPDATE outbox_events
+		SET dispatched_at = NOW(), attempts = attempts + 1, last_error = ''
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// Records a failed attempt of the event, with the subscribers that handled
+// it. The event is retried after retryIn, or given up on when final.
+func (s *OutboxStore) MarkFailed(ctx context.Context, event *model.DomainEvent, retryIn time.Duration, final bool) error {
+	query := `
+		UPDATE outbox_events
+		SET
+			attempts = attempts + 1,
+			handled = $2,
+			last_error = $3,
+			next_attempt_at = NOW() + $4 * INTERVAL '1 millisecond',
+			failed_at = CASE WHEN $5 THEN NOW() ELSE NULL END
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(
+		ctx,
+		query,
+		event.Id,
+		pq.Array(event.Handled),
+		event.LastError,
+		retryIn.Milliseconds(),
+		final,
+	)
+	return err
+}
+
+// Deletes the events dispatched before the retention
+func (s *OutboxStore) Prune(ctx context.Context, retention time.Duration) error {
+	query := `
+		DELETE FROM outbox_events
+		WHERE dispatched_at < NOW() - make_interval(secs => $1)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, retention.Seconds())
+	return err
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -8,13 +9,14 @@ import (
 )
 
 type PaginatedFeedQuery struct {
-	Limit  int      `json:"limit" validate:"gte=1,lte=25"`
-	Offset int      `json:"offset" validate:"gte=0"`
-	Sort   string   `json:"sort" validate:"oneof=asc desc"`
-	Tags   []string `json:"tags" validate:"max=5"`
-	Search string   `json:"search" validate:"max=100"`
-	Since  string   `json:"since"`
-	Until  string   `json:"until"`
+	Limit   int      `json:"limit" validate:"gte=1,lte=25"`
+	Offset  int      `json:"offset" validate:"gte=0"`
+	Sort    string   `json:"sort" validate:"oneof=asc desc"`
+	Tags    []string `json:"tags" validate:"max=5"`
+	Search  string   `json:"search" validate:"max=100"`
+	Since   string   `json:"since"`
+	Until   string   `json:"until"`
+	Ranking string   `json:"ranking" validate:"oneof=chronological for_you"`
 }
 
 func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
@@ -55,24 +57,69 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 		fq.Search = search
 	}
 
-	since := qs.Get("since")
+	ranking := qs.Get("ranking")
+	if ranking != "" {
+		fq.Ranking = ranking
+	}
+
+	since, until, err := parseTimeRange(qs.Get("since"), qs.Get("until"))
+	if err != nil {
+		return fq, err
+	}
+	fq.Since, fq.Until = since, until
+
+	return fq, nil
+}
+
+// Parses the bounds of a time filter, which may be empty, and returns them
+// normalised to UTC in RFC 3339 format with the fractional seconds
+func parseTimeRange(since, until string) (string, string, error) {
+	var sinceTime, untilTime time.Time
+
 	if since != "" {
-		fq.Since = parseTime(since)
+		t, err := parseTime(since, false)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid since: %w", err)
+		}
+		sinceTime = t
+		since = t.Format(time.RFC3339Nano)
 	}
 
-	until := qs.Get("until")
 	if until != "" {
-		fq.Until = parseTime(until)
+		t, err := parseTime(until, true)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid until: %w", err)
+		}
+		untilTime = t
+		until = t.Format(time.RFC3339Nano)
 	}
 
-	return fq, nil
+	if since != "" && until != "" && sinceTime.After(untilTime) {
+		return "", "", fmt.Errorf("since must be before until")
+	}
+
+	return since, until, nil
 }
 
-func parseTime(s string) string {
-	t, err := time.Parse(time.DateTime, s)
-	if err != nil {
-		return ""
+// Parses an ISO 8601 timestamp (RFC 3339, or a plain date) in UTC. A plain
+// date is taken as midnight, or as the end of the day for the upper bounds:
+// its last microsecond, the precision of the stored timestamps.
+func parseTime(s string, upper bool) (time.Time, error) {
+	// A '+' in an unescaped query string is decoded as a space
+	s = strings.Replace(s, " ", "+", 1)
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t.UTC(), nil
+	}
+
+	d, dateErr := time.Parse(time.DateOnly, s)
+	if dateErr != nil {
+		return time.Time{}, err
+	}
+	if upper {
+		d = d.AddDate(0, 0, 1).Add(-time.Microsecond)
 	}
 
-	return t.Format(time.DateTime)
+	return d, nil
 }
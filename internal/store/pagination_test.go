@@ -0,0 +1,102 @@
+package store
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPaginatedFeedQueryParseTime(t *testing.T) {
+	parse := func(t *testing.T, rawQuery string) (PaginatedFeedQuery, error) {
+		t.Helper()
+
+		req, err := http.NewRequest("GET", "/v1/users/feed?"+rawQuery, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return PaginatedFeedQuery{}.Parse(req)
+	}
+
+	t.Run("should normalise offsets to UTC", func(t *testing.T) {
+		fq, err := parse(t, "since=2024-03-10T10:00:00%2B02:00&until=2024-03-10T10:00:00-05:00")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fq.Since != "2024-03-10T08:00:00Z" {
+			t.Errorf("expected since 2024-03-10T08:00:00Z; got %s", fq.Since)
+		}
+		if fq.Until != "2024-03-10T15:00:00Z" {
+			t.Errorf("expected until 2024-03-10T15:00:00Z; got %s", fq.Until)
+		}
+	})
+
+	t.Run("should accept an unescaped plus sign in the offset", func(t *testing.T) {
+		fq, err := parse(t, "since=2024-03-10T10:00:00+02:00")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fq.Since != "2024-03-10T08:00:00Z" {
+			t.Errorf("expected since 2024-03-10T08:00:00Z; got %s", fq.Since)
+		}
+	})
+
+	t.Run("should treat a plain date as midnight UTC", func(t *testing.T) {
+		fq, err := parse(t, "since=2024-03-10")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fq.Since != "2024-03-10T00:00:00Z" {
+			t.Errorf("expected since 2024-03-10T00:00:00Z; got %s", fq.Since)
+		}
+	})
+
+	t.Run("should include the whole day of a plain until date", func(t *testing.T) {
+		fq, err := parse(t, "since=2024-03-10&until=2024-03-10")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fq.Until != "2024-03-10T23:59:59.999999Z" {
+			t.Errorf("expected until 2024-03-10T23:59:59.999999Z; got %s", fq.Until)
+		}
+	})
+
+	t.Run("should keep the fractional seconds", func(t *testing.T) {
+		fq, err := parse(t, "since=2024-03-10T12:00:00.25Z&until=2024-03-10T12:00:00.5Z")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fq.Since != "2024-03-10T12:00:00.25Z" || fq.Until != "2024-03-10T12:00:00.5Z" {
+			t.Errorf("expected the fractional seconds; got %s and %s", fq.Since, fq.Until)
+		}
+
+		if _, err := parse(t, "since=2024-03-10T12:00:00.5Z&until=2024-03-10T12:00:00Z"); err == nil {
+			t.Error("expected an error when since is after until by a fraction of a second")
+		}
+	})
+
+	t.Run("should compare bounds across timezones", func(t *testing.T) {
+		// 09:00+02:00 is 07:00Z, which is before 08:00Z
+		_, err := parse(t, "since=2024-03-10T09:00:00%2B02:00&until=2024-03-10T08:00:00Z")
+		if err != nil {
+			t.Errorf("expected no error; got %v", err)
+		}
+
+		_, err = parse(t, "since=2024-03-10T08:00:00Z&until=2024-03-10T09:00:00%2B02:00")
+		if err == nil {
+			t.Error("expected an error when since is after until")
+		}
+	})
+
+	t.Run("should reject invalid timestamps", func(t *testing.T) {
+		for _, q := range []string{"since=yesterday", "until=2024-03-10%2010:00:00", "since=2024-13-01"} {
+			if _, err := parse(t, q); err == nil {
+				t.Errorf("expected an error for %q", q)
+			}
+		}
+	})
+}
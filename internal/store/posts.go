@@ -16,38 +16,55 @@ type PostStore struct {
 func (s *PostStore) Create(ctx context.Context, post *model.Post) error {
 	// Create the query to insert the post
 	query := `
-		INSERT INTO posts (title, content, user_id, tags)
-		VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at, version
+		INSERT INTO posts (title, content, user_id, tags, language, entities)
+		VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, '')::regconfig, 'english'), $6)
+		RETURNING id, created_at, updated_at, version, language
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	// Send the query with the context and arguments
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		post.Title,
-		post.Content,
-		post.UserId,
-		pq.Array(post.Tags),
-	).Scan( // Scan the post to insert the generated values
-		&post.Id,
-		&post.CreatedAt,
-		&post.UpdatedAt,
-		&post.Version,
-	)
-	if err != nil {
-		return err
-	}
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// Link the mentions to their users before storing the entities
+		entities, err := resolveMentions(ctx, tx, post.Entities)
+		if err != nil {
+			return err
+		}
+		post.Entities = entities
+
+		// Send the query with the context and arguments
+		err = tx.QueryRowContext(
+			ctx,
+			query,
+			post.Title,
+			post.Content,
+			post.UserId,
+			pq.Array(post.Tags),
+			post.Language,
+			post.Entities,
+		).Scan( // Scan the post to insert the generated values
+			&post.Id,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.Version,
+			&post.Language,
+		)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		if err := saveMentions(ctx, tx, post.UserId, post.Id, nil, post.Entities); err != nil {
+			return err
+		}
+
+		return addEvent(ctx, tx, model.EventPostCreated, &model.PostCreated{Post: post})
+	})
 }
 
 func (s *PostStore) GetById(ctx context.Context, id uint32) (*model.Post, error) {
 	// Create the query to get the post by the id
 	query := `
-		SELECT id, title, content, user_id, tags, created_at, updated_at, comments_count, version
+		SELECT id, title, content, user_id, tags, created_at, updated_at, comments_count, reactions_count, version, language, entities
 		FROM posts
 		WHERE id = $1
 	`
@@ -69,7 +86,10 @@ func (s *PostStore) GetById(ctx context.Context, id uint32) (*model.Post, error)
 		&post.CreatedAt,
 		&post.UpdatedAt,
 		&post.CommentsCount,
+		&post.ReactionsCount,
 		&post.Version,
+		&post.Language,
+		&post.Entities,
 	)
 	if err != nil {
 		switch {
@@ -85,45 +105,80 @@ func (s *PostStore) GetById(ctx context.Context, id uint32) (*model.Post, error)
 	return &post, nil
 }
 
+// Returns the posts of active users among the ids, in no particular order
+func (s *PostStore) GetByIds(ctx context.Context, ids []uint32) ([]*model.Post, error) {
+	query := `
+		SELECT p.id, p.title, p.content, p.user_id, p.tags, p.created_at, p.updated_at, p.comments_count, p.reactions_count, p.version, p.language, p.entities
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.id = ANY($1) AND u.is_active = true
+	`
+
+	postIds := make([]int64, len(ids))
+	for i, id := range ids {
+		postIds[i] = int64(id)
+	}
+
+	return s.queryPosts(ctx, query, pq.Array(postIds))
+}
+
 func (s *PostStore) Update(ctx context.Context, post *model.Post) error {
 
 	// Create the query to get the post by the id
+	// The locked row of the subquery keeps the entities before the edit
 	updateQuery := `
-		UPDATE posts
-		SET title = $1, content = $2, updated_at = NOW(), version = version + 1
-		WHERE id = $3 AND version = $4
-		RETURNING title, content, updated_at, version
+		UPDATE posts p
+		SET title = $1, content = $2, entities = $3, tags = $4, updated_at = NOW(), version = p.version + 1
+		FROM (SELECT id, entities FROM posts WHERE id = $5 FOR UPDATE) previous
+		WHERE p.id = previous.id AND p.version = $6
+		RETURNING p.title, p.content, p.updated_at, p.version, previous.entities
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	// Perform the query with the ctx and id
-	err := s.db.QueryRowContext(
-		ctx,
-		updateQuery,
-		post.Title,
-		post.Content,
-		post.Id,
-		post.Version,
-	).Scan(
-		&post.Title,
-		&post.Content,
-		&post.UpdatedAt,
-		&post.Version,
-	)
-	if err != nil {
-		switch {
-		// If no rows found, return a ErrResourceNotFound
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrResourceNotFound
-		default:
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		entities, err := resolveMentions(ctx, tx, post.Entities)
+		if err != nil {
+			return err
+		}
+		post.Entities = entities
+
+		var previous model.Entities
+
+		// Perform the query with the ctx and id
+		err = tx.QueryRowContext(
+			ctx,
+			updateQuery,
+			post.Title,
+			post.Content,
+			post.Entities,
+			pq.Array(post.Tags),
+			post.Id,
+			post.Version,
+		).Scan(
+			&post.Title,
+			&post.Content,
+			&post.UpdatedAt,
+			&post.Version,
+			&previous,
+		)
+		if err != nil {
+			switch {
+			// If no rows found, return a ErrResourceNotFound
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrResourceNotFound
+			default:
+				return err
+			}
+		}
+
+		if err := saveMentions(ctx, tx, post.UserId, post.Id, nil, post.Entities); err != nil {
 			return err
 		}
-	}
 
-	// Return no errors
-	return err
+		return addEvent(ctx, tx, model.EventPostUpdated, &model.PostUpdated{Post: post, Previous: previous})
+	})
 }
 
 func (s *PostStore) DeleteById(ctx context.Context, id uint32) error {
@@ -137,34 +192,48 @@ func (s *PostStore) DeleteById(ctx context.Context, id uint32) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	// Perform the query with the ctx and id
-	_, err := s.db.ExecContext(ctx, query, id)
-	if err != nil {
-		switch {
-		// If no rows found, return a ErrResourceNotFound
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrResourceNotFound
-		default:
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// Perform the query with the ctx and id
+		res, err := tx.ExecContext(ctx, query, id)
+		if err != nil {
 			return err
 		}
-	}
 
-	// Return no errors
-	return nil
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		// If no rows were deleted, return a ErrResourceNotFound
+		if rows == 0 {
+			return ErrResourceNotFound
+		}
+
+		return addEvent(ctx, tx, model.EventPostDeleted, &model.PostDeleted{PostId: id})
+	})
 }
 
 func (s *PostStore) GetUserFeed(ctx context.Context, userId uint32, fq PaginatedFeedQuery) ([]*model.Post, error) {
 
 	query := `
-		SELECT DISTINCT p.id, p.title, p.content, p.user_id, p.tags, p.created_at, p.updated_at, p.comments_count, p.version
+		SELECT DISTINCT p.id, p.title, p.content, p.user_id, p.tags, p.created_at, p.updated_at, p.comments_count, p.reactions_count, p.version, p.language, p.entities
 		FROM posts p
 		LEFT JOIN followers f ON p.user_id = f.user_id
 		LEFT JOIN users u ON p.user_id = u.id
 		WHERE 
 			(u.is_active = true) AND
-		    (f.follower_id = $1 OR p.user_id = $1) AND
+			(
+				f.follower_id = $1 OR
+				p.user_id = $1 OR
+				p.tags && ARRAY(SELECT tf.tag FROM tag_follows tf WHERE tf.user_id = $1)
+			) AND
+			NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = $1 AND b.blocked_id = p.user_id) OR (b.blocker_id = p.user_id AND b.blocked_id = $1)
+			) AND
 		    (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
-		    (p.tags @> $5 OR $5 = '{}')
+		    (p.tags @> $5 OR $5 = '{}') AND
+		    (NULLIF($6, '')::timestamptz IS NULL OR p.created_at >= NULLIF($6, '')::timestamptz) AND
+		    (NULLIF($7, '')::timestamptz IS NULL OR p.created_at <= NULLIF($7, '')::timestamptz)
 		ORDER BY p.created_at ` + fq.Sort + `
 		LIMIT $2 OFFSET $3
 	`
@@ -185,6 +254,8 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userId uint32, fq Paginated
 		fq.Offset,
 		fq.Search,
 		pq.Array(fq.Tags),
+		fq.Since,
+		fq.Until,
 	)
 	if err != nil {
 		switch {
@@ -209,7 +280,10 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userId uint32, fq Paginated
 			&post.CreatedAt,
 			&post.UpdatedAt,
 			&post.CommentsCount,
+			&post.ReactionsCount,
 			&post.Version,
+			&post.Language,
+			&post.Entities,
 		)
 		if err != nil {
 			return nil, err
@@ -220,6 +294,147 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userId uint32, fq Paginated
 	return posts, nil
 }
 
+// Returns recent posts from every active user, hiding users that blocked or
+// were blocked by the viewer
+func (s *PostStore) GetExplore(ctx context.Context, viewerId uint32, fq PaginatedFeedQuery) ([]*model.Post, error) {
+
+	query := `
+		SELECT p.id, p.title, p.content, p.user_id, p.tags, p.created_at, p.updated_at, p.comments_count, p.reactions_count, p.version, p.language, p.entities
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE
+			(u.is_active = true) AND
+			NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = $1 AND b.blocked_id = p.user_id) OR (b.blocker_id = p.user_id AND b.blocked_id = $1)
+			) AND
+		    (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
+		    (p.tags @> $5 OR $5 = '{}') AND
+		    (NULLIF($6, '')::timestamptz IS NULL OR p.created_at >= NULLIF($6, '')::timestamptz) AND
+		    (NULLIF($7, '')::timestamptz IS NULL OR p.created_at <= NULLIF($7, '')::timestamptz)
+		ORDER BY p.created_at ` + fq.Sort + `, p.id ` + fq.Sort + `
+		LIMIT $2 OFFSET $3
+	`
+
+	return s.queryPosts(
+		ctx,
+		query,
+		viewerId,
+		fq.Limit,
+		fq.Offset,
+		fq.Search,
+		pq.Array(fq.Tags),
+		fq.Since,
+		fq.Until,
+	)
+}
+
+// Returns the posts tagged with the tag, using the idx_posts_tags GIN index
+func (s *PostStore) GetByTag(ctx context.Context, viewerId uint32, tag string, fq PaginatedFeedQuery) ([]*model.Post, error) {
+
+	query := `
+		SELECT p.id, p.title, p.content, p.user_id, p.tags, p.created_at, p.updated_at, p.comments_count, p.reactions_count, p.version, p.language, p.entities
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE
+			p.tags @> ARRAY[$4]::varchar[] AND
+			(u.is_active = true) AND
+			NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = $1 AND b.blocked_id = p.user_id) OR (b.blocker_id = p.user_id AND b.blocked_id = $1)
+			) AND
+		    (NULLIF($5, '')::timestamptz IS NULL OR p.created_at >= NULLIF($5, '')::timestamptz) AND
+		    (NULLIF($6, '')::timestamptz IS NULL OR p.created_at <= NULLIF($6, '')::timestamptz)
+		ORDER BY p.created_at ` + fq.Sort + `, p.id ` + fq.Sort + `
+		LIMIT $2 OFFSET $3
+	`
+
+	return s.queryPosts(
+		ctx,
+		query,
+		viewerId,
+		fq.Limit,
+		fq.Offset,
+		tag,
+		fq.Since,
+		fq.Until,
+	)
+}
+
+// Returns the posts mentioning the user, newest first by default
+func (s *PostStore) GetMentioning(ctx context.Context, userId uint32, fq PaginatedFeedQuery) ([]*model.Post, error) {
+
+	query := `
+		SELECT p.id, p.title, p.content, p.user_id, p.tags, p.created_at, p.updated_at, p.comments_count, p.reactions_count, p.version, p.language, p.entities
+		FROM mentions m
+		JOIN posts p ON p.id = m.post_id
+		JOIN users u ON p.user_id = u.id
+		WHERE
+			m.user_id = $1 AND
+			m.comment_id IS NULL AND
+			(u.is_active = true) AND
+			NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = $1 AND b.blocked_id = p.user_id) OR (b.blocker_id = p.user_id AND b.blocked_id = $1)
+			) AND
+		    (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
+		    (p.tags @> $5 OR $5 = '{}') AND
+		    (NULLIF($6, '')::timestamptz IS NULL OR p.created_at >= NULLIF($6, '')::timestamptz) AND
+		    (NULLIF($7, '')::timestamptz IS NULL OR p.created_at <= NULLIF($7, '')::timestamptz)
+		ORDER BY p.created_at ` + fq.Sort + `, p.id ` + fq.Sort + `
+		LIMIT $2 OFFSET $3
+	`
+
+	return s.queryPosts(
+		ctx,
+		query,
+		userId,
+		fq.Limit,
+		fq.Offset,
+		fq.Search,
+		pq.Array(fq.Tags),
+		fq.Since,
+		fq.Until,
+	)
+}
+
+// Runs a query selecting full post rows and scans them
+func (s *PostStore) queryPosts(ctx context.Context, query string, args ...any) ([]*model.Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []*model.Post{}
+	for rows.Next() {
+		post := &model.Post{}
+		err := rows.Scan(
+			&post.Id,
+			&post.Title,
+			&post.Content,
+			&post.UserId,
+			pq.Array(&post.Tags), // note: tags is a slice, so use pq.Array()
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.CommentsCount,
+			&post.ReactionsCount,
+			&post.Version,
+			&post.Language,
+			&post.Entities,
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
+
 func postExists(ctx context.Context, db *sql.DB, postId uint32) (bool, error) {
 	var exists bool
 
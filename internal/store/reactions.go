@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/dottox/social/internal/model"
+)
+
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// Sets the reaction of the user on the post, replacing any previous one
+func (s *ReactionStore) React(ctx context.Context, reaction *model.Reaction) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO post_reactions (post_id, user_id, kind)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (post_id, user_id) DO UPDATE SET kind = EXCLUDED.kind
+			RETURNING created_at, (xmax = 0) AS inserted
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var inserted bool
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			reaction.PostId,
+			reaction.UserId,
+			reaction.Kind,
+		).Scan(
+			&reaction.CreatedAt,
+			&inserted,
+		)
+		if err != nil {
+			return err
+		}
+
+		// Changing the kind of an existing reaction doesn't change the count
+		if inserted {
+			updateQuery := `
+				UPDATE posts
+				SET reactions_count = reactions_count + 1
+				WHERE id = $1
+			`
+
+			if _, err := tx.ExecContext(ctx, updateQuery, reaction.PostId); err != nil {
+				return err
+			}
+		}
+
+		return addEvent(ctx, tx, model.EventPostReacted, &model.PostReacted{Reaction: reaction})
+	})
+}
+
+func (s *ReactionStore) Unreact(ctx context.Context, postId, userId uint32) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			DELETE FROM post_reactions
+			WHERE post_id = $1 AND user_id = $2
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, postId, userId)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrResourceNotFound
+		}
+
+		updateQuery := `
+			UPDATE posts
+			SET reactions_count = GREATEST(reactions_count - 1, 0)
+			WHERE id = $1
+		`
+
+		_, err = tx.ExecContext(ctx, updateQuery, postId)
+		return err
+	})
+}
+
+// Returns how much the user interacted with each author through comments and
+// reactions on their posts, over the last 90 days.
+func (s *ReactionStore) GetAuthorAffinities(ctx context.Context, userId uint32) (map[uint32]float64, error) {
+	query := `
+		SELECT author_id, SUM(weight)
+		FROM (
+			SELECT p.user_id AS author_id, 2.0 AS weight
+			FROM comments c
+			JOIN posts p ON p.id = c.post_id
+			WHERE c.user_id = $1 AND c.created_at > NOW() - INTERVAL '90 days'
+			UNION ALL
+			SELECT p.user_id AS author_id, 1.0 AS weight
+			FROM post_reactions r
+			JOIN posts p ON p.id = r.post_id
+			WHERE r.user_id = $1 AND r.created_at > NOW() - INTERVAL '90 days'
+		) interactions
+		WHERE author_id <> $1
+		GROUP BY author_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	affinities := map[uint32]float64{}
+	for rows.Next() {
+		var authorId uint32
+		var weight float64
+		if err := rows.Scan(&authorId, &weight); err != nil {
+			return nil, err
+		}
+		affinities[authorId] = weight
+	}
+
+	return affinities, rows.Err()
+}
+
+// Returns the tags of the posts the user wrote, commented on or reacted to
+// over the last 90 days, weighted by the number of interactions.
+func (s *ReactionStore) GetTagInterests(ctx context.Context, userId uint32) (map[string]float64, error) {
+	query := `
+		SELECT tag, COUNT(*)
+		FROM (
+			SELECT UNNEST(p.tags) AS tag
+			FROM posts p
+			WHERE p.user_id = $1 AND p.created_at > NOW() - INTERVAL '90 days'
+			UNION ALL
+			SELECT UNNEST(p.tags) AS tag
+			FROM comments c
+			JOIN posts p ON p.id = c.post_id
+			WHERE c.user_id = $1 AND c.created_at > NOW() - INTERVAL '90 days'
+			UNION ALL
+			SELECT UNNEST(p.tags) AS tag
+			FROM post_reactions r
+			JOIN posts p ON p.id = r.post_id
+			WHERE r.user_id = $1 AND r.created_at > NOW() - INTERVAL '90 days'
+		) interests
+		GROUP BY tag
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	interests := map[string]float64{}
+	for rows.Next() {
+		var tag string
+		var count float64
+		if err := rows.Scan(&tag, &count); err != nil {
+			return nil, err
+		}
+		interests[tag] = count
+	}
+
+	return interests, rows.Err()
+}
@@ -0,0 +1,393 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/lib/pq"
+)
+
+// Markers of the matches in the output of ts_headline, from the Unicode
+// private use area so the content can't be mistaken for them
+const (
+	headlineStart = "\uE000"
+	headlineStop  = "\uE001"
+)
+
+// Options passed to ts_headline to build the highlighted snippets
+const headlineOptions = "StartSel=" + headlineStart + ", StopSel=" + headlineStop + ", MaxFragments=2, MaxWords=20, MinWords=5"
+
+type SearchQuery struct {
+	Query    string `json:"q" validate:"required,max=200"`
+	Type     string `json:"type" validate:"oneof=all posts comments users"`
+	Language string `json:"lang" validate:"oneof=english spanish french german italian portuguese simple"`
+	AuthorId uint32 `json:"author"`
+	Tag      string `json:"tag" validate:"max=255"`
+	Since    string `json:"since"`
+	Until    string `json:"until"`
+	Limit    int    `json:"limit" validate:"gte=1,lte=25"`
+	Offset   int    `json:"offset" validate:"gte=0"`
+}
+
+func (sq SearchQuery) Parse(r *http.Request) (SearchQuery, error) {
+	qs := r.URL.Query()
+
+	sq.Query = qs.Get("q")
+
+	if t := qs.Get("type"); t != "" {
+		sq.Type = t
+	}
+
+	if lang := qs.Get("lang"); lang != "" {
+		sq.Language = lang
+	}
+
+	if author := qs.Get("author"); author != "" {
+		id, err := strconv.ParseUint(author, 10, 32)
+		if err != nil {
+			return sq, fmt.Errorf("invalid author: %w", err)
+		}
+
+		sq.AuthorId = uint32(id)
+	}
+
+	if tag := qs.Get("tag"); tag != "" {
+		sq.Tag = tag
+	}
+
+	since, until, err := parseTimeRange(qs.Get("since"), qs.Get("until"))
+	if err != nil {
+		return sq, err
+	}
+	sq.Since, sq.Until = since, until
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return sq, err
+		}
+
+		sq.Limit = l
+	}
+
+	if offset := qs.Get("offset"); offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return sq, err
+		}
+
+		sq.Offset = o
+	}
+
+	return sq, nil
+}
+
+type SearchStore struct {
+	db *sql.DB
+}
+
+func (s *SearchStore) SearchPosts(ctx context.Context, viewerId uint32, sq SearchQuery) ([]*model.PostSearchResult, error) {
+	query := `
+		SELECT p.id, p.title, p.content, p.user_id, p.tags, p.created_at, p.updated_at, p.comments_count, p.reactions_count, p.version, p.language, p.entities,
+			ts_rank_cd(p.search_vector, q) AS rank,
+			ts_headline(p.language, p.title || ' ' || p.content, q, $10) AS headline
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		CROSS JOIN websearch_to_tsquery($2::regconfig, $3) AS q
+		WHERE
+			(u.is_active = true) AND
+			p.search_vector @@ q AND
+			NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = $1 AND b.blocked_id = p.user_id) OR (b.blocker_id = p.user_id AND b.blocked_id = $1)
+			) AND
+			($4 = 0 OR p.user_id = $4) AND
+			($5 = '' OR p.tags @> ARRAY[$5]::varchar[]) AND
+			(NULLIF($6, '')::timestamptz IS NULL OR p.created_at >= NULLIF($6, '')::timestamptz) AND
+			(NULLIF($7, '')::timestamptz IS NULL OR p.created_at <= NULLIF($7, '')::timestamptz)
+		ORDER BY rank DESC, p.created_at DESC
+		LIMIT $8 OFFSET $9
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		viewerId,
+		sq.Language,
+		sq.Query,
+		sq.AuthorId,
+		sq.Tag,
+		sq.Since,
+		sq.Until,
+		sq.Limit,
+		sq.Offset,
+		headlineOptions,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*model.PostSearchResult{}
+	for rows.Next() {
+		result := &model.PostSearchResult{Post: &model.Post{}}
+		err := rows.Scan(
+			&result.Id,
+			&result.Title,
+			&result.Content,
+			&result.UserId,
+			pq.Array(&result.Tags), // note: tags is a slice, so use pq.Array()
+			&result.CreatedAt,
+			&result.UpdatedAt,
+			&result.CommentsCount,
+			&result.ReactionsCount,
+			&result.Version,
+			&result.Language,
+			&result.Entities,
+			&result.Rank,
+			&result.Headline,
+		)
+		if err != nil {
+			return nil, err
+		}
+		result.Headline = markHeadline(result.Headline)
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+func (s *SearchStore) SearchComments(ctx context.Context, viewerId uint32, sq SearchQuery) ([]*model.CommentSearchResult, error) {
+	query := `
+		SELECT c.id, c.user_id, c.post_id, c.content, c.created_at, c.entities,
+			ts_rank_cd(c.search_vector, q) AS rank,
+			ts_headline(c.language, c.content, q, $10) AS headline
+		FROM comments c
+		JOIN posts p ON p.id = c.post_id
+		JOIN users u ON u.id = c.user_id
+		CROSS JOIN websearch_to_tsquery($2::regconfig, $3) AS q
+		WHERE
+			(u.is_active = true) AND
+			c.search_vector @@ q AND
+			NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = $1 AND b.blocked_id IN (c.user_id, p.user_id)) OR (b.blocked_id = $1 AND b.blocker_id IN (c.user_id, p.user_id))
+			) AND
+			($4 = 0 OR c.user_id = $4) AND
+			($5 = '' OR p.tags @> ARRAY[$5]::varchar[]) AND
+			(NULLIF($6, '')::timestamptz IS NULL OR c.created_at >= NULLIF($6, '')::timestamptz) AND
+			(NULLIF($7, '')::timestamptz IS NULL OR c.created_at <= NULLIF($7, '')::timestamptz)
+		ORDER BY rank DESC, c.created_at DESC
+		LIMIT $8 OFFSET $9
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		viewerId,
+		sq.Language,
+		sq.Query,
+		sq.AuthorId,
+		sq.Tag,
+		sq.Since,
+		sq.Until,
+		sq.Limit,
+		sq.Offset,
+		headlineOptions,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*model.CommentSearchResult{}
+	for rows.Next() {
+		result := &model.CommentSearchResult{Comment: &model.Comment{}}
+		err := rows.Scan(
+			&result.Id,
+			&result.UserId,
+			&result.PostId,
+			&result.Content,
+			&result.CreatedAt,
+			&result.Entities,
+			&result.Rank,
+			&result.Headline,
+		)
+		if err != nil {
+			return nil, err
+		}
+		result.Headline = markHeadline(result.Headline)
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// Usernames are matched without stemming
+func (s *SearchStore) SearchUsers(ctx context.Context, viewerId uint32, sq SearchQuery) ([]*model.UserSearchResult, error) {
+	query := `
+		SELECT u.id, u.username,
+			ts_rank_cd(u.search_vector, q) AS rank,
+			ts_headline('simple', u.username, q, $5) AS headline
+		FROM users u
+		CROSS JOIN websearch_to_tsquery('simple', $2) AS q
+		WHERE
+			(u.is_active = true) AND
+			u.search_vector @@ q AND
+			NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = $1 AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = $1)
+			)
+		ORDER BY rank DESC, u.username
+		LIMIT $3 OFFSET $4
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, viewerId, sq.Query, sq.Limit, sq.Offset, headlineOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*model.UserSearchResult{}
+	for rows.Next() {
+		result := &model.UserSearchResult{}
+		err := rows.Scan(
+			&result.Id,
+			&result.Username,
+			&result.Rank,
+			&result.Headline,
+		)
+		if err != nil {
+			return nil, err
+		}
+		result.Headline = markHeadline(result.Headline)
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// Calls fn for every post, used to rebuild external search indexes
+func (s *SearchStore) ScanPosts(ctx context.Context, fn func(*model.Post) error) error {
+	query := `
+		SELECT p.id, p.title, p.content, p.user_id, p.tags, p.created_at
+		FROM posts p
+		ORDER BY p.id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		post := &model.Post{}
+		err := rows.Scan(
+			&post.Id,
+			&post.Title,
+			&post.Content,
+			&post.UserId,
+			pq.Array(&post.Tags), // note: tags is a slice, so use pq.Array()
+			&post.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(post); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Calls fn for every comment with the tags of its post, used to rebuild
+// external search indexes
+func (s *SearchStore) ScanComments(ctx context.Context, fn func(*model.Comment, []string) error) error {
+	query := `
+		SELECT c.id, c.user_id, c.post_id, c.content, c.created_at, p.tags
+		FROM comments c
+		JOIN posts p ON p.id = c.post_id
+		ORDER BY c.id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		comment := &model.Comment{}
+		var tags []string
+		err := rows.Scan(
+			&comment.Id,
+			&comment.UserId,
+			&comment.PostId,
+			&comment.Content,
+			&comment.CreatedAt,
+			pq.Array(&tags),
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(comment, tags); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Escapes the content of a ts_headline snippet and wraps its matches in
+// <mark>, so the snippet is safe to render as HTML. Stray markers are dropped
+// and the tags are always balanced.
+func markHeadline(headline string) string {
+	var sb strings.Builder
+	open := false
+
+	for {
+		i := strings.IndexAny(headline, headlineStart+headlineStop)
+		if i < 0 {
+			sb.WriteString(html.EscapeString(headline))
+			break
+		}
+		sb.WriteString(html.EscapeString(headline[:i]))
+
+		// Both markers have the same length
+		marker := headline[i : i+len(headlineStart)]
+		switch {
+		case marker == headlineStart && !open:
+			sb.WriteString("<mark>")
+			open = true
+		case marker == headlineStop && open:
+			sb.WriteString("</mark>")
+			open = false
+		}
+		headline = headline[i+len(marker):]
+	}
+
+	if open {
+		sb.WriteString("</mark>")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSearchQueryParse(t *testing.T) {
+	parse := func(t *testing.T, rawQuery string) (SearchQuery, error) {
+		t.Helper()
+
+		req, err := http.NewRequest("GET", "/v1/search?"+rawQuery, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return SearchQuery{Type: "all", Language: "english", Limit: 10}.Parse(req)
+	}
+
+	t.Run("should parse the filters", func(t *testing.T) {
+		sq, err := parse(t, `q=%22go+gopher%22+-java&type=posts&lang=spanish&author=7&tag=go&since=2024-03-10&until=2024-03-11T10:00:00%2B02:00&limit=5&offset=10`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := SearchQuery{
+			Query:    `"go gopher" -java`,
+			Type:     "posts",
+			Language: "spanish",
+			AuthorId: 7,
+			Tag:      "go",
+			Since:    "2024-03-10T00:00:00Z",
+			Until:    "2024-03-11T08:00:00Z",
+			Limit:    5,
+			Offset:   10,
+		}
+		if sq != expected {
+			t.Errorf("expected %+v; got %+v", expected, sq)
+		}
+	})
+
+	t.Run("should keep the defaults", func(t *testing.T) {
+		sq, err := parse(t, "q=go")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sq.Type != "all" || sq.Language != "english" || sq.Limit != 10 || sq.Offset != 0 {
+			t.Errorf("unexpected query %+v", sq)
+		}
+	})
+
+	t.Run("should reject invalid filters", func(t *testing.T) {
+		for _, rawQuery := range []string{
+			"q=go&author=abc",
+			"q=go&author=-1",
+			"q=go&since=yesterday",
+			"q=go&until=2024-13-01",
+			"q=go&since=2024-03-11&until=2024-03-10",
+			"q=go&limit=ten",
+			"q=go&offset=ten",
+		} {
+			if _, err := parse(t, rawQuery); err == nil {
+				t.Errorf("%s: expected an error", rawQuery)
+			}
+		}
+	})
+}
+
+func TestMarkHeadline(t *testing.T) {
+	tests := []struct {
+		headline string
+		expected string
+	}{
+		{"learning " + headlineStart + "go" + headlineStop + " today", "learning <mark>go</mark> today"},
+		{
+			`<script>alert("` + headlineStart + "go" + headlineStop + `")</script>`,
+			"&lt;script&gt;alert(&#34;<mark>go</mark>&#34;)&lt;/script&gt;",
+		},
+		// Markers typed in the content don't unbalance the tags
+		{headlineStop + "a " + headlineStart + "b " + headlineStart + "c", "a <mark>b c</mark>"},
+		{"no matches & more", "no matches &amp; more"},
+	}
+
+	for _, tt := range tests {
+		if got := markHeadline(tt.headline); got != tt.expected {
+			t.Errorf("%q: expected %q; got %q", tt.headline, tt.expected, got)
+		}
+	}
+}
@@ -14,6 +14,8 @@ var (
 	ErrUsersDuplicateUsername = errors.New("user with this username already exists")
 	ErrResourceNotFound       = errors.New("resource not found")
 	ErrResourceAlreadyExists  = errors.New("resource already exists")
+	ErrMessagingNotAllowed    = errors.New("user does not accept messages from you")
+	ErrFollowNotAllowed       = errors.New("user can't be followed")
 	QueryTimeoutDuration      = 5 * time.Second
 )
 
@@ -21,17 +23,24 @@ type Storage struct {
 	Posts interface {
 		Create(context.Context, *model.Post) error
 		GetById(context.Context, uint32) (*model.Post, error)
+		GetByIds(context.Context, []uint32) ([]*model.Post, error)
 		Update(context.Context, *model.Post) error
 		DeleteById(context.Context, uint32) error
 		GetUserFeed(context.Context, uint32, PaginatedFeedQuery) ([]*model.Post, error)
+		GetExplore(context.Context, uint32, PaginatedFeedQuery) ([]*model.Post, error)
+		GetByTag(context.Context, uint32, string, PaginatedFeedQuery) ([]*model.Post, error)
+		GetMentioning(context.Context, uint32, PaginatedFeedQuery) ([]*model.Post, error)
 	}
 	Users interface {
 		Create(context.Context, *sql.Tx, *model.User) error
 		GetById(context.Context, uint32) (*model.User, error)
 		GetByEmail(context.Context, string) (*model.User, error)
+		GetActiveIds(context.Context, []uint32) ([]uint32, error)
 		DeleteById(context.Context, uint32) error
-		CreateAndInvite(context.Context, *model.User, string, time.Duration) error
+		CreateAndInvite(context.Context, *model.User, string, time.Duration, *model.Email) error
 		Activate(context.Context, string) error
+		Search(context.Context, uint32, UserSearchQuery) ([]*model.UserSuggestion, error)
+		DeleteExpiredInvitations(context.Context) (int, error)
 	}
 	Comments interface {
 		Create(context.Context, *model.Comment) error
@@ -40,18 +49,133 @@ type Storage struct {
 	Followers interface {
 		Follow(context.Context, *model.FollowAction) error
 		Unfollow(context.Context, *model.FollowAction) error
+		CountFollowers(context.Context, uint32) (int, error)
+		GetFollowingIds(context.Context, uint32) ([]uint32, error)
 	}
 	Roles interface {
 		GetByName(context.Context, string) (*model.Role, error)
 	}
+	Reactions interface {
+		React(context.Context, *model.Reaction) error
+		Unreact(context.Context, uint32, uint32) error
+		GetAuthorAffinities(context.Context, uint32) (map[uint32]float64, error)
+		GetTagInterests(context.Context, uint32) (map[string]float64, error)
+	}
+	Blocks interface {
+		Block(context.Context, *model.Block) error
+		Unblock(context.Context, *model.Block) error
+		IsBlocked(context.Context, uint32, uint32) (bool, error)
+		GetBlockedIds(context.Context, uint32) ([]uint32, error)
+	}
+	Trending interface {
+		Refresh(context.Context, string, time.Duration, int) (*model.TrendingSnapshot, error)
+		GetLatest(context.Context, string) (*model.TrendingSnapshot, error)
+		Prune(context.Context, time.Duration) error
+	}
+	Search interface {
+		SearchPosts(context.Context, uint32, SearchQuery) ([]*model.PostSearchResult, error)
+		SearchComments(context.Context, uint32, SearchQuery) ([]*model.CommentSearchResult, error)
+		SearchUsers(context.Context, uint32, SearchQuery) ([]*model.UserSearchResult, error)
+		ScanPosts(context.Context, func(*model.Post) error) error
+		ScanComments(context.Context, func(*model.Comment, []string) error) error
+	}
+	Tags interface {
+		Follow(context.Context, *model.TagFollow) error
+		Unfollow(context.Context, *model.TagFollow) error
+		GetStats(context.Context, uint32, string) (*model.TagStats, error)
+		GetFollowed(context.Context, uint32) ([]*model.TagStats, error)
+		GetFollowedNames(context.Context, uint32) ([]string, error)
+	}
+	Notifications interface {
+		Add(context.Context, *model.NotificationEvent) (bool, error)
+		GetByUser(context.Context, uint32, NotificationQuery) (*model.NotificationList, error)
+		CountUnread(context.Context, uint32) (int, error)
+		MarkRead(context.Context, uint32, uint32) error
+		MarkAllRead(context.Context, uint32) error
+		GetEmailPreferences(context.Context, uint32) (*model.EmailPreferences, error)
+		UpdateEmailPreferences(context.Context, uint32, *model.EmailPreferences) error
+		UnsubscribeEmails(context.Context, uint32, string) error
+		GetDigestRecipients(context.Context, DigestQuery, uint32, int) ([]uint32, error)
+		GetDigest(context.Context, uint32, DigestQuery) ([]*model.Notification, error)
+		QueueDigest(context.Context, uint32, DigestQuery, *model.Email) (bool, error)
+	}
+	Conversations interface {
+		CanMessage(context.Context, uint32, []uint32) error
+		Create(context.Context, *model.Conversation, []uint32) error
+		GetById(context.Context, uint32, uint32) (*model.Conversation, error)
+		GetByUser(context.Context, uint32, ConversationQuery) (*model.ConversationList, error)
+		AddMessage(context.Context, *model.Message) error
+		GetMessages(context.Context, uint32, uint32, MessageQuery) ([]*model.Message, error)
+		MarkRead(context.Context, uint32, uint32) (uint32, error)
+		CountUnread(context.Context, uint32) (int, error)
+		GetSettings(context.Context, uint32) (*model.MessagingSettings, error)
+		UpdateSettings(context.Context, uint32, *model.MessagingSettings) error
+	}
+	Webhooks interface {
+		Create(context.Context, *model.Webhook) error
+		GetById(context.Context, uint32) (*model.Webhook, error)
+		GetAll(context.Context) ([]*model.Webhook, error)
+		Update(context.Context, *model.Webhook) error
+		DeleteById(context.Context, uint32) error
+		Enqueue(context.Context, string, []byte) (int, error)
+		ClaimDue(context.Context, int, time.Duration) ([]*model.WebhookDelivery, error)
+		RecordAttempt(context.Context, *model.WebhookDelivery, *WebhookAttempt, int) (bool, error)
+		GetDeliveries(context.Context, uint32, WebhookDeliveryQuery) ([]*model.WebhookDelivery, error)
+		PruneDeliveries(context.Context, time.Duration) error
+	}
+	Outbox interface {
+		Claim(context.Context, int, time.Duration) ([]*model.DomainEvent, error)
+		MarkDispatched(context.Context, uint64) error
+		MarkFailed(context.Context, *model.DomainEvent, time.Duration, bool) error
+		Prune(context.Context, time.Duration) error
+	}
+	Jobs interface {
+		Enqueue(context.Context, *model.Job, time.Duration) (bool, error)
+		Claim(context.Context, time.Duration) (*model.Job, error)
+		Complete(context.Context, uint64) error
+		Fail(context.Context, *model.Job, time.Duration, bool) error
+		GetAll(context.Context, JobQuery) ([]*model.Job, error)
+		Retry(context.Context, uint64) (*model.Job, error)
+		Prune(context.Context, time.Duration) error
+	}
+	Emails interface {
+		Enqueue(context.Context, *model.Email) (bool, error)
+		Claim(context.Context, int, time.Duration) ([]*model.Email, error)
+		MarkSent(context.Context, uint64) error
+		MarkFailed(context.Context, *model.Email, time.Duration, bool) error
+		GetAll(context.Context, EmailQuery) ([]*model.Email, error)
+		Prune(context.Context, time.Duration) error
+	}
+	Timelines interface {
+		FanOut(context.Context, *model.Post) error
+		AddToAuthor(context.Context, *model.Post) error
+		Backfill(context.Context, *model.FollowAction) error
+		BackfillFollowers(context.Context, uint32) error
+		Prune(context.Context, *model.FollowAction) error
+		IsHeavy(context.Context, uint32) (bool, error)
+		UpdateHeavy(context.Context, uint32, int) (bool, bool, error)
+		GetFeed(context.Context, uint32, PaginatedFeedQuery, bool) ([]*model.Post, error)
+	}
 }
 
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:     &PostStore{db},
-		Users:     &UserStore{db},
-		Comments:  &CommentStore{db},
-		Followers: &FollowerStore{db},
-		Roles:     &RoleStore{db},
+		Posts:         &PostStore{db},
+		Users:         &UserStore{db},
+		Comments:      &CommentStore{db},
+		Followers:     &FollowerStore{db},
+		Roles:         &RoleStore{db},
+		Timelines:     &TimelineStore{db},
+		Reactions:     &ReactionStore{db},
+		Blocks:        &BlockStore{db},
+		Trending:      &TrendingStore{db},
+		Search:        &SearchStore{db},
+		Tags:          &TagStore{db},
+		Notifications: &NotificationStore{db},
+		Conversations: &ConversationStore{db},
+		Webhooks:      &WebhookStore{db},
+		Outbox:        &OutboxStore{db},
+		Jobs:          &JobStore{db},
+		Emails:        &EmailStore{db},
 	}
 }
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/lib/pq"
+)
+
+type TagStore struct {
+	db *sql.DB
+}
+
+func (s *TagStore) Follow(ctx context.Context, follow *model.TagFollow) error {
+	query := `
+		INSERT INTO tag_follows (user_id, tag)
+		VALUES ($1, $2)
+		RETURNING created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, follow.UserId, follow.Tag).Scan(&follow.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrResourceAlreadyExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *TagStore) Unfollow(ctx context.Context, follow *model.TagFollow) error {
+	query := `
+		DELETE FROM tag_follows
+		WHERE user_id = $1 AND tag = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, follow.UserId, follow.Tag)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrResourceNotFound
+	}
+
+	return nil
+}
+
+// Returns the post and follower counts of the tag.
+// Posts are counted with the idx_posts_tags GIN index.
+func (s *TagStore) GetStats(ctx context.Context, userId uint32, tag string) (*model.TagStats, error) {
+	query := `
+		SELECT
+			$2,
+			(SELECT COUNT(*) FROM posts p WHERE p.tags @> ARRAY[$2]::varchar[])::int,
+			(SELECT COUNT(*) FROM tag_follows tf WHERE tf.tag = $2)::int,
+			EXISTS (SELECT 1 FROM tag_follows tf WHERE tf.tag = $2 AND tf.user_id = $1)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	stats := &model.TagStats{}
+	err := s.db.QueryRowContext(ctx, query, userId, tag).Scan(
+		&stats.Tag,
+		&stats.PostsCount,
+		&stats.FollowersCount,
+		&stats.Following,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// Returns the tags followed by the user with their counts, most recently
+// followed first
+func (s *TagStore) GetFollowed(ctx context.Context, userId uint32) ([]*model.TagStats, error) {
+	query := `
+		SELECT
+			f.tag,
+			(SELECT COUNT(*) FROM posts p WHERE p.tags @> ARRAY[f.tag]::varchar[])::int,
+			(SELECT COUNT(*) FROM tag_follows tf WHERE tf.tag = f.tag)::int,
+			true
+		FROM tag_follows f
+		WHERE f.user_id = $1
+		ORDER BY f.created_at DESC, f.tag
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*model.TagStats{}
+	for rows.Next() {
+		stats := &model.TagStats{}
+		err := rows.Scan(
+			&stats.Tag,
+			&stats.PostsCount,
+			&stats.FollowersCount,
+			&stats.Following,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, stats)
+	}
+
+	return tags, rows.Err()
+}
+
+// Returns the names of the tags followed by the user, without the counts
+func (s *TagStore) GetFollowedNames(ctx context.Context, userId uint32) ([]string, error) {
+	query := `
+		SELECT tag
+		FROM tag_follows
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
@@ -0,0 +1,298 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/lib/pq"
+)
+
+// Number of recent posts copied into a timeline when a user follows someone
+const TimelineBackfillSize = 50
+
+type TimelineStore struct {
+	db *sql.DB
+}
+
+// Inserts the post into the timeline of the author and of every follower
+func (s *TimelineStore) FanOut(ctx context.Context, post *model.Post) error {
+	query := `
+		INSERT INTO timelines (user_id, post_id, author_id, created_at)
+		SELECT f.follower_id, $1::bigint, $2::bigint, $3::timestamptz
+		FROM followers f
+		WHERE f.user_id = $2
+		UNION
+		SELECT $2::bigint, $1::bigint, $2::bigint, $3::timestamptz
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, post.Id, post.UserId, post.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Inserts the post only into the timeline of its author
+func (s *TimelineStore) AddToAuthor(ctx context.Context, post *model.Post) error {
+	query := `
+		INSERT INTO timelines (user_id, post_id, author_id, created_at)
+		VALUES ($1, $2, $1, $3)
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, post.UserId, post.Id, post.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Copies the latest posts of the followed user into the follower's timeline.
+// Nothing is copied when the user was unfollowed in the meantime.
+func (s *TimelineStore) Backfill(ctx context.Context, follow *model.FollowAction) error {
+	query := `
+		INSERT INTO timelines (user_id, post_id, author_id, created_at)
+		SELECT $1::bigint, p.id, p.user_id, p.created_at
+		FROM posts p
+		WHERE p.user_id = $2
+			AND EXISTS (SELECT 1 FROM followers f WHERE f.user_id = $2 AND f.follower_id = $1)
+		ORDER BY p.created_at DESC
+		LIMIT $3
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, follow.SenderUserId, follow.TargetUserId, TimelineBackfillSize)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Copies the latest posts of the author into the timeline of every follower,
+// once the author is no longer merged in at read time
+func (s *TimelineStore) BackfillFollowers(ctx context.Context, authorId uint32) error {
+	query := `
+		INSERT INTO timelines (user_id, post_id, author_id, created_at)
+		SELECT f.follower_id, p.id, p.user_id, p.created_at
+		FROM followers f
+		CROSS JOIN LATERAL (
+			SELECT lp.id, lp.user_id, lp.created_at
+			FROM posts lp
+			WHERE lp.user_id = $1
+			ORDER BY lp.created_at DESC
+			LIMIT $2
+		) p
+		WHERE f.user_id = $1
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, authorId, TimelineBackfillSize)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Reports whether the posts of the author are merged in at read time
+func (s *TimelineStore) IsHeavy(ctx context.Context, authorId uint32) (bool, error) {
+	query := `
+		SELECT timeline_heavy
+		FROM users
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var heavy bool
+	err := s.db.QueryRowContext(ctx, query, authorId).Scan(&heavy)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, ErrResourceNotFound
+		default:
+			return false, err
+		}
+	}
+
+	return heavy, nil
+}
+
+// Marks the author as heavy when they have more followers than threshold, and
+// as light otherwise. Reports the new state and whether it changed, so only
+// one of the concurrent callers reacts to the change.
+func (s *TimelineStore) UpdateHeavy(ctx context.Context, authorId uint32, threshold int) (bool, bool, error) {
+	selectQuery := `
+		SELECT timeline_heavy, (SELECT COUNT(*) FROM followers f WHERE f.user_id = u.id) > $2
+		FROM users u
+		WHERE u.id = $1
+		FOR UPDATE
+	`
+	updateQuery := `
+		UPDATE users
+		SET timeline_heavy = $2
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var heavy, changed bool
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var wasHeavy bool
+		err := tx.QueryRowContext(ctx, selectQuery, authorId, threshold).Scan(&wasHeavy, &heavy)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrResourceNotFound
+			default:
+				return err
+			}
+		}
+
+		if heavy == wasHeavy {
+			return nil
+		}
+		changed = true
+
+		_, err = tx.ExecContext(ctx, updateQuery, authorId, heavy)
+		return err
+	})
+	if err != nil {
+		return false, false, err
+	}
+
+	return heavy, changed, nil
+}
+
+// Removes the posts of the unfollowed user from the follower's timeline.
+// Nothing is removed when the user was followed again in the meantime.
+func (s *TimelineStore) Prune(ctx context.Context, unfollow *model.FollowAction) error {
+	query := `
+		DELETE FROM timelines
+		WHERE user_id = $1 AND author_id = $2
+			AND NOT EXISTS (SELECT 1 FROM followers f WHERE f.user_id = $2 AND f.follower_id = $1)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, unfollow.SenderUserId, unfollow.TargetUserId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Reads the feed from the materialised timeline.
+// Posts with a tag followed by the user are merged in at read time.
+// When mergeHeavy is set, posts of the followed heavy authors are merged in at
+// read time (hybrid mode).
+func (s *TimelineStore) GetFeed(ctx context.Context, userId uint32, fq PaginatedFeedQuery, mergeHeavy bool) ([]*model.Post, error) {
+
+	query := `
+		SELECT p.id, p.title, p.content, p.user_id, p.tags, p.created_at, p.updated_at, p.comments_count, p.reactions_count, p.version, p.language, p.entities
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE
+			(u.is_active = true) AND
+			p.id IN (
+				SELECT t.post_id FROM timelines t WHERE t.user_id = $1
+				UNION
+				SELECT hp.id
+				FROM posts hp
+				JOIN followers f ON hp.user_id = f.user_id
+				JOIN users hu ON hu.id = f.user_id
+				WHERE
+					$8 AND
+					f.follower_id = $1 AND
+					hu.timeline_heavy
+				UNION
+				SELECT tp.id
+				FROM posts tp
+				WHERE tp.tags && ARRAY(SELECT tf.tag FROM tag_follows tf WHERE tf.user_id = $1)
+			) AND
+			NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = $1 AND b.blocked_id = p.user_id) OR (b.blocker_id = p.user_id AND b.blocked_id = $1)
+			) AND
+		    (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
+		    (p.tags @> $5 OR $5 = '{}') AND
+		    (NULLIF($6, '')::timestamptz IS NULL OR p.created_at >= NULLIF($6, '')::timestamptz) AND
+		    (NULLIF($7, '')::timestamptz IS NULL OR p.created_at <= NULLIF($7, '')::timestamptz)
+		ORDER BY p.created_at ` + fq.Sort + `
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	posts := []*model.Post{}
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		userId,
+		fq.Limit,
+		fq.Offset,
+		fq.Search,
+		pq.Array(fq.Tags),
+		fq.Since,
+		fq.Until,
+		mergeHeavy,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrResourceNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		post := &model.Post{}
+		err := rows.Scan(
+			&post.Id,
+			&post.Title,
+			&post.Content,
+			&post.UserId,
+			pq.Array(&post.Tags), // note: tags is a slice, so use pq.Array())
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.CommentsCount,
+			&post.ReactionsCount,
+			&post.Version,
+			&post.Language,
+			&post.Entities,
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+
+	return posts, nil
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/lib/pq"
+)
+
+type TrendingStore struct {
+	db *sql.DB
+}
+
+// Computes the trending tags and posts over the window and stores them as a
+// new snapshot. Activity is weighted as: new post 3, comment 2, reaction 1.
+func (s *TrendingStore) Refresh(ctx context.Context, window string, duration time.Duration, limit int) (*model.TrendingSnapshot, error) {
+	query := `
+		WITH activity AS (
+			SELECT p.id AS post_id, 3.0 AS weight
+			FROM posts p
+			WHERE p.created_at > NOW() - make_interval(secs => $2)
+			UNION ALL
+			SELECT c.post_id, 2.0 AS weight
+			FROM comments c
+			WHERE c.created_at > NOW() - make_interval(secs => $2)
+			UNION ALL
+			SELECT r.post_id, 1.0 AS weight
+			FROM post_reactions r
+			WHERE r.created_at > NOW() - make_interval(secs => $2)
+		),
+		scored_posts AS (
+			SELECT p.id AS post_id, p.tags, SUM(a.weight)::float8 AS score
+			FROM activity a
+			JOIN posts p ON p.id = a.post_id
+			JOIN users u ON u.id = p.user_id
+			WHERE u.is_active = true
+			GROUP BY p.id
+		),
+		top_tags AS (
+			SELECT tag, SUM(sp.score)::float8 AS score, COUNT(*)::int AS posts_count
+			FROM scored_posts sp, UNNEST(sp.tags) AS tag
+			GROUP BY tag
+			ORDER BY score DESC, tag
+			LIMIT $3
+		),
+		top_posts AS (
+			SELECT post_id, score
+			FROM scored_posts
+			ORDER BY score DESC, post_id DESC
+			LIMIT $3
+		)
+		INSERT INTO trending_snapshots (time_window, tags, posts)
+		SELECT
+			$1,
+			COALESCE((SELECT jsonb_agg(t ORDER BY t.score DESC, t.tag) FROM top_tags t), '[]'),
+			COALESCE((SELECT jsonb_agg(tp ORDER BY tp.score DESC, tp.post_id DESC) FROM top_posts tp), '[]')
+		RETURNING id, time_window, computed_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	snapshot := &model.TrendingSnapshot{}
+	err := s.db.QueryRowContext(ctx, query, window, duration.Seconds(), limit).Scan(
+		&snapshot.Id,
+		&snapshot.Window,
+		&snapshot.ComputedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// Returns the latest snapshot of the window with the current post data
+func (s *TrendingStore) GetLatest(ctx context.Context, window string) (*model.TrendingSnapshot, error) {
+	query := `
+		SELECT id, time_window, computed_at, tags
+		FROM trending_snapshots
+		WHERE time_window = $1
+		ORDER BY computed_at DESC, id DESC
+		LIMIT 1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	snapshot := &model.TrendingSnapshot{}
+	var tags []byte
+	err := s.db.QueryRowContext(ctx, query, window).Scan(
+		&snapshot.Id,
+		&snapshot.Window,
+		&snapshot.ComputedAt,
+		&tags,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrResourceNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	snapshot.Tags = []*model.TrendingTag{}
+	if err := json.Unmarshal(tags, &snapshot.Tags); err != nil {
+		return nil, err
+	}
+
+	// Posts deleted since the snapshot was computed are skipped
+	postsQuery := `
+		SELECT p.id, p.title, p.content, p.user_id, p.tags, p.created_at, p.updated_at, p.comments_count, p.reactions_count, p.version, p.language, p.entities,
+			(e.item->>'score')::float8
+		FROM trending_snapshots s
+		CROSS JOIN LATERAL jsonb_array_elements(s.posts) WITH ORDINALITY AS e(item, rank)
+		JOIN posts p ON p.id = (e.item->>'post_id')::bigint
+		WHERE s.id = $1
+		ORDER BY e.rank
+	`
+
+	rows, err := s.db.QueryContext(ctx, postsQuery, snapshot.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshot.Posts = []*model.TrendingPost{}
+	for rows.Next() {
+		post := &model.TrendingPost{Post: &model.Post{}}
+		err := rows.Scan(
+			&post.Id,
+			&post.Title,
+			&post.Content,
+			&post.UserId,
+			pq.Array(&post.Tags), // note: tags is a slice, so use pq.Array()
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.CommentsCount,
+			&post.ReactionsCount,
+			&post.Version,
+			&post.Language,
+			&post.Entities,
+			&post.Score,
+		)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Posts = append(snapshot.Posts, post)
+	}
+
+	return snapshot, rows.Err()
+}
+
+// Deletes the snapshots older than the retention, always keeping the latest
+// snapshot of every window
+func (s *TrendingStore) Prune(ctx context.Context, retention time.Duration) error {
+	query := `
+		DELETE FROM trending_snapshots
+		WHERE computed_at < NOW() - make_interval(secs => $1) AND id NOT IN (
+			SELECT DISTINCT ON (time_window) id
+			FROM trending_snapshots
+			ORDER BY time_window, computed_at DESC, id DESC
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, retention.Seconds())
+	return err
+}
@@ -3,9 +3,13 @@ package store
 import (
 	"context"
 	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dottox/social/internal/model"
+	"github.com/lib/pq"
 )
 
 type UserStore struct {
@@ -14,8 +18,8 @@ type UserStore struct {
 
 func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *model.User) error {
 	query := `
-		INSERT INTO users (username, email, password)
-		VALUES ($1, $2, $3) 
+		INSERT INTO users (username, display_name, email, password, language)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at
 	`
 
@@ -26,8 +30,10 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *model.User) er
 		ctx,
 		query,
 		user.Username,
+		user.DisplayName,
 		user.Email,
 		user.Password.Hash,
+		user.Language,
 	).Scan(
 		&user.Id,
 		&user.CreatedAt,
@@ -43,12 +49,14 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *model.User) er
 		}
 	}
 
-	return nil
+	// The user starts with the default email preferences
+	_, err = tx.ExecContext(ctx, `INSERT INTO email_preferences (user_id) VALUES ($1)`, user.Id)
+	return err
 }
 
 func (s *UserStore) GetById(ctx context.Context, id uint32) (*model.User, error) {
 	query := `
-		SELECT u.id, u.username, u.email, u.password, u.created_at, u.is_active, r.*
+		SELECT u.id, u.username, u.display_name, u.email, u.language, u.password, u.created_at, u.is_active, r.*
 		FROM users u
 		LEFT JOIN roles r ON u.role_id = r.id
 		WHERE u.id = $1 AND u.is_active = true
@@ -61,7 +69,9 @@ func (s *UserStore) GetById(ctx context.Context, id uint32) (*model.User, error)
 	err := s.db.QueryRowContext(ctx, query, id).Scan(
 		&user.Id,
 		&user.Username,
+		&user.DisplayName,
 		&user.Email,
+		&user.Language,
 		&user.Password.Hash,
 		&user.CreatedAt,
 		&user.IsActive,
@@ -84,7 +94,7 @@ func (s *UserStore) GetById(ctx context.Context, id uint32) (*model.User, error)
 
 func (s *UserStore) GetByEmail(ctx context.Context, email string) (*model.User, error) {
 	query := `
-		SELECT u.id, u.username, u.email, u.password, u.created_at, u.is_active, r.*
+		SELECT u.id, u.username, u.display_name, u.email, u.language, u.password, u.created_at, u.is_active, r.*
 		FROM users u
 		LEFT JOIN roles r ON u.role_id = r.id
 		WHERE u.email = $1 AND u.is_active = true
@@ -97,7 +107,9 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*model.User,
 	err := s.db.QueryRowContext(ctx, query, email).Scan(
 		&user.Id,
 		&user.Username,
+		&user.DisplayName,
 		&user.Email,
+		&user.Language,
 		&user.Password.Hash,
 		&user.CreatedAt,
 		&user.IsActive,
@@ -118,6 +130,40 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*model.User,
 	return user, nil
 }
 
+// Returns the ids of the active users among the ids
+func (s *UserStore) GetActiveIds(ctx context.Context, ids []uint32) ([]uint32, error) {
+	query := `
+		SELECT id
+		FROM users
+		WHERE id = ANY($1) AND is_active = true
+	`
+
+	userIds := make([]int64, len(ids))
+	for i, id := range ids {
+		userIds[i] = int64(id)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(userIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	active := []uint32{}
+	for rows.Next() {
+		var id uint32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		active = append(active, id)
+	}
+
+	return active, rows.Err()
+}
+
 func (s *UserStore) DeleteById(ctx context.Context, id uint32) error {
 	query := `
 		DELETE FROM users
@@ -135,7 +181,10 @@ func (s *UserStore) DeleteById(ctx context.Context, id uint32) error {
 	return nil
 }
 
-func (s *UserStore) CreateAndInvite(ctx context.Context, user *model.User, token string, invitationExp time.Duration) error {
+// Creates the user with its invitation and queues the welcome email with the
+// activation link, recording the UserRegistered event. The email is queued
+// in the transaction so the activation token is never stored in the event.
+func (s *UserStore) CreateAndInvite(ctx context.Context, user *model.User, token string, invitationExp time.Duration, welcome *model.Email) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 		if err := s.Create(ctx, tx, user); err != nil {
 			return err
@@ -146,7 +195,11 @@ func (s *UserStore) CreateAndInvite(ctx context.Context, user *model.User, token
 			return err
 		}
 
-		return nil
+		if _, err := enqueueEmail(ctx, tx, welcome); err != nil {
+			return err
+		}
+
+		return addEvent(ctx, tx, model.EventUserRegistered, &model.UserRegistered{User: user})
 	})
 }
 
@@ -174,6 +227,29 @@ func (s *UserStore) createUserInvitation(ctx context.Context, tx *sql.Tx, token
 	return nil
 }
 
+// Deletes the invitations that expired, returning how many were deleted
+func (s *UserStore) DeleteExpiredInvitations(ctx context.Context) (int, error) {
+	query := `
+		DELETE FROM user_invitations
+		WHERE expires_at < NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rows), nil
+}
+
 func (s *UserStore) Activate(ctx context.Context, token string) error {
 	// Within a transaction
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
@@ -201,7 +277,7 @@ func (s *UserStore) Activate(ctx context.Context, token string) error {
 
 func (s *UserStore) getUserByInvitationToken(ctx context.Context, tx *sql.Tx, token string) (*model.User, error) {
 	query := `
-		SELECT u.id, u.username, u.email, u.password, u.created_at
+		SELECT u.id, u.username, u.display_name, u.email, u.password, u.created_at
 		FROM users u
 		INNER JOIN user_invitations ui ON ui.user_id = u.id
 		WHERE ui.token = $1 AND ui.expires_at > $2
@@ -214,6 +290,7 @@ func (s *UserStore) getUserByInvitationToken(ctx context.Context, tx *sql.Tx, to
 	err := tx.QueryRowContext(ctx, query, token, time.Now()).Scan(
 		&user.Id,
 		&user.Username,
+		&user.DisplayName,
 		&user.Email,
 		&user.Password.Hash,
 		&user.CreatedAt,
@@ -273,6 +350,105 @@ func (s *UserStore) deleteUserInvitation(ctx context.Context, tx *sql.Tx, userId
 	return nil
 }
 
+type UserSearchQuery struct {
+	Query string `json:"q" validate:"required,max=100"`
+	Limit int    `json:"limit" validate:"gte=1,lte=20"`
+}
+
+func (uq UserSearchQuery) Parse(r *http.Request) (UserSearchQuery, error) {
+	qs := r.URL.Query()
+
+	uq.Query = strings.TrimSpace(qs.Get("q"))
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return uq, err
+		}
+
+		uq.Limit = l
+	}
+
+	return uq, nil
+}
+
+// Escapes the LIKE wildcards so the query only matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Finds users whose username or display name starts with, or looks like, the
+// query. Exact and prefix matches rank first, then the users the caller
+// follows, the users following the caller and the most followed users.
+func (s *UserStore) Search(ctx context.Context, viewerId uint32, uq UserSearchQuery) ([]*model.UserSuggestion, error) {
+	query := `
+		WITH candidates AS (
+			SELECT u.id, u.username, u.display_name,
+				(SELECT COUNT(*) FROM followers f WHERE f.user_id = u.id)::int AS followers_count,
+				EXISTS (SELECT 1 FROM followers f WHERE f.user_id = u.id AND f.follower_id = $1) AS following,
+				EXISTS (SELECT 1 FROM followers f WHERE f.user_id = $1 AND f.follower_id = u.id) AS follows_you,
+				CASE
+					WHEN lower(u.username) = lower($2) THEN 3.0
+					WHEN u.username ILIKE $3 ESCAPE '\' THEN 2.0
+					WHEN u.display_name ILIKE $3 ESCAPE '\' OR u.display_name ILIKE ('% ' || $3) ESCAPE '\' THEN 1.5
+					ELSE GREATEST(word_similarity($2, u.username), word_similarity($2, u.display_name))
+				END AS match
+			FROM users u
+			WHERE
+				(u.is_active = true) AND
+				u.id <> $1 AND
+				(
+					u.username ILIKE $3 ESCAPE '\' OR
+					u.display_name ILIKE $3 ESCAPE '\' OR
+					u.display_name ILIKE ('% ' || $3) ESCAPE '\' OR
+					$2 <% u.username OR
+					$2 <% u.display_name
+				) AND
+				NOT EXISTS (
+					SELECT 1 FROM user_blocks b
+					WHERE (b.blocker_id = $1 AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = $1)
+				)
+		)
+		SELECT id, username, display_name, followers_count, following, follows_you,
+			(match +
+				CASE WHEN following THEN 1.0 ELSE 0 END +
+				CASE WHEN follows_you THEN 0.5 ELSE 0 END +
+				ln(1 + followers_count) / 10)::float8 AS score
+		FROM candidates
+		ORDER BY score DESC, username
+		LIMIT $4
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	prefix := likeEscaper.Replace(uq.Query) + "%"
+
+	rows, err := s.db.QueryContext(ctx, query, viewerId, uq.Query, prefix, uq.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*model.UserSuggestion{}
+	for rows.Next() {
+		user := &model.UserSuggestion{}
+		err := rows.Scan(
+			&user.Id,
+			&user.Username,
+			&user.DisplayName,
+			&user.FollowersCount,
+			&user.Following,
+			&user.FollowsYou,
+			&user.Score,
+		)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
 func withTx(db *sql.DB, ctx context.Context, fn func(*sql.Tx) error) error {
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
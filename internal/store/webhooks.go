@@ -0,0 +1,457 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/lib/pq"
+)
+
+type WebhookDeliveryQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset int    `json:"offset" validate:"gte=0"`
+	Status string `json:"status" validate:"omitempty,oneof=pending succeeded failed"`
+}
+
+func (dq WebhookDeliveryQuery) Parse(r *http.Request) (WebhookDeliveryQuery, error) {
+	qs := r.URL.Query()
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return dq, err
+		}
+
+		dq.Limit = l
+	}
+
+	if offset := qs.Get("offset"); offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return dq, err
+		}
+
+		dq.Offset = o
+	}
+
+	if status := qs.Get("status"); status != "" {
+		dq.Status = status
+	}
+
+	return dq, nil
+}
+
+// WebhookAttempt is the outcome of a delivery attempt
+type WebhookAttempt struct {
+	Status         string // the new status of the delivery
+	RetryIn        time.Duration
+	ResponseStatus int // 0 when there was no response
+	ResponseBody   string
+	Error          string
+}
+
+type WebhookStore struct {
+	db *sql.DB
+}
+
+const webhookColumns = `
+	id, url, events, secret, active, failure_count, disabled_at, created_by, created_at, updated_at
+`
+
+func scanWebhook(row interface{ Scan(...any) error }) (*model.Webhook, error) {
+	webhook := &model.Webhook{}
+	var disabledAt sql.NullString
+	var createdBy sql.NullInt64
+	err := row.Scan(
+		&webhook.Id,
+		&webhook.URL,
+		pq.Array(&webhook.Events),
+		&webhook.Secret,
+		&webhook.Active,
+		&webhook.FailureCount,
+		&disabledAt,
+		&createdBy,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if disabledAt.Valid {
+		webhook.DisabledAt = &disabledAt.String
+	}
+	if createdBy.Valid {
+		id := uint32(createdBy.Int64)
+		webhook.CreatedBy = &id
+	}
+
+	return webhook, nil
+}
+
+func (s *WebhookStore) Create(ctx context.Context, webhook *model.Webhook) error {
+	query := `
+		INSERT INTO webhooks (url, events, secret, active, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		webhook.URL,
+		pq.Array(webhook.Events),
+		webhook.Secret,
+		webhook.Active,
+		webhook.CreatedBy,
+	).Scan(
+		&webhook.Id,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+}
+
+func (s *WebhookStore) GetById(ctx context.Context, id uint32) (*model.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	webhook, err := scanWebhook(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrResourceNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return webhook, nil
+}
+
+func (s *WebhookStore) GetAll(ctx context.Context) ([]*model.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*model.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// Updates the webhook. Enabling it clears its failures.
+func (s *WebhookStore) Update(ctx context.Context, webhook *model.Webhook) error {
+	query := `
+		UPDATE webhooks
+		SET
+			url = $2,
+			events = $3,
+			secret = $4,
+			active = $5,
+			failure_count = CASE WHEN $5 AND NOT active THEN 0 ELSE failure_count END,
+			disabled_at = CASE WHEN $5 THEN NULL ELSE disabled_at END,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING failure_count, disabled_at, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var disabledAt sql.NullString
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		webhook.Id,
+		webhook.URL,
+		pq.Array(webhook.Events),
+		webhook.Secret,
+		webhook.Active,
+	).Scan(
+		&webhook.FailureCount,
+		&disabledAt,
+		&webhook.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrResourceNotFound
+		default:
+			return err
+		}
+	}
+
+	webhook.DisabledAt = nil
+	if disabledAt.Valid {
+		webhook.DisabledAt = &disabledAt.String
+	}
+
+	return nil
+}
+
+func (s *WebhookStore) DeleteById(ctx context.Context, id uint32) error {
+	query := `DELETE FROM webhooks WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrResourceNotFound
+	}
+
+	return nil
+}
+
+// Queues a delivery of the payload to every active webhook subscribed to the
+// event, returning the number of deliveries queued
+func (s *WebhookStore) Enqueue(ctx context.Context, event string, payload []byte) (int, error) {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT id, $1, $2
+		FROM webhooks
+		WHERE active AND (events = '{}' OR $1 = ANY(events))
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, event, string(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rows), nil
+}
+
+// Claims up to limit pending deliveries that are due, along with their
+// webhook. Their next attempt is pushed back by lease, so other instances
+// don't send them again while they are in flight.
+func (s *WebhookStore) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*model.WebhookDelivery, error) {
+	query := `
+		WITH claimed AS (
+			UPDATE webhook_deliveries
+			SET next_attempt_at = NOW() + $2 * INTERVAL '1 millisecond'
+			WHERE id IN (
+				SELECT d.id
+				FROM webhook_deliveries d
+				JOIN webhooks w ON w.id = d.webhook_id
+				WHERE d.status = 'pending' AND d.next_attempt_at <= NOW() AND w.active
+				ORDER BY d.next_attempt_at
+				LIMIT $1
+				FOR UPDATE OF d SKIP LOCKED
+			)
+			RETURNING id, webhook_id, event, payload, status, attempts, next_attempt_at, created_at
+		)
+		SELECT c.id, c.webhook_id, c.event, c.payload, c.status, c.attempts, c.next_attempt_at, c.created_at,
+			w.id, w.url, w.secret
+		FROM claimed c
+		JOIN webhooks w ON w.id = c.webhook_id
+		ORDER BY c.id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*model.WebhookDelivery{}
+	for rows.Next() {
+		delivery := &model.WebhookDelivery{Webhook: &model.Webhook{}}
+		var payload []byte
+		err := rows.Scan(
+			&delivery.Id,
+			&delivery.WebhookId,
+			&delivery.Event,
+			&payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.CreatedAt,
+			&delivery.Webhook.Id,
+			&delivery.Webhook.URL,
+			&delivery.Webhook.Secret,
+		)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = payload
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// Records the outcome of an attempt of the delivery. Failed attempts count
+// against the webhook, which is disabled once it reaches disableAfter
+// consecutive failures; reporting whether it was disabled.
+func (s *WebhookStore) RecordAttempt(ctx context.Context, delivery *model.WebhookDelivery, attempt *WebhookAttempt, disableAfter int) (bool, error) {
+	deliveryQuery := `
+		UPDATE webhook_deliveries
+		SET
+			status = $2,
+			attempts = attempts + 1,
+			next_attempt_at = NOW() + $3 * INTERVAL '1 millisecond',
+			response_status = NULLIF($4, 0),
+			response_body = $5,
+			error = $6,
+			delivered_at = CASE WHEN $2 = 'succeeded' THEN NOW() ELSE NULL END
+		WHERE id = $1
+	`
+
+	webhookQuery := `
+		UPDATE webhooks
+		SET
+			failure_count = CASE WHEN $2 THEN 0 ELSE failure_count + 1 END,
+			active = active AND ($2 OR failure_count + 1 < $3),
+			disabled_at = CASE WHEN active AND NOT $2 AND failure_count + 1 >= $3 THEN NOW() ELSE disabled_at END
+		WHERE id = $1
+		RETURNING NOT active AND NOT $2 AND failure_count = $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var disabled bool
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(
+			ctx,
+			deliveryQuery,
+			delivery.Id,
+			attempt.Status,
+			attempt.RetryIn.Milliseconds(),
+			attempt.ResponseStatus,
+			attempt.ResponseBody,
+			attempt.Error,
+		)
+		if err != nil {
+			return err
+		}
+
+		succeeded := attempt.Status == model.DeliverySucceeded
+		err = tx.QueryRowContext(ctx, webhookQuery, delivery.WebhookId, succeeded, disableAfter).Scan(&disabled)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Deleted while the delivery was in flight
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return disabled, nil
+}
+
+// Returns the deliveries of the webhook, most recent first
+func (s *WebhookStore) GetDeliveries(ctx context.Context, webhookId uint32, dq WebhookDeliveryQuery) ([]*model.WebhookDelivery, error) {
+	query := `
+		SELECT id, webhook_id, event, payload, status, attempts, next_attempt_at,
+			response_status, response_body, error, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1 AND ($4 = '' OR status = $4)
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, webhookId, dq.Limit, dq.Offset, dq.Status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*model.WebhookDelivery{}
+	for rows.Next() {
+		delivery := &model.WebhookDelivery{}
+		var payload []byte
+		var responseStatus sql.NullInt64
+		var deliveredAt sql.NullString
+		err := rows.Scan(
+			&delivery.Id,
+			&delivery.WebhookId,
+			&delivery.Event,
+			&payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&responseStatus,
+			&delivery.ResponseBody,
+			&delivery.Error,
+			&delivery.CreatedAt,
+			&deliveredAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		delivery.Payload = payload
+		if responseStatus.Valid {
+			status := int(responseStatus.Int64)
+			delivery.ResponseStatus = &status
+		}
+		if deliveredAt.Valid {
+			delivery.DeliveredAt = &deliveredAt.String
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// Deletes the finished deliveries created before the retention
+func (s *WebhookStore) PruneDeliveries(ctx context.Context, retention time.Duration) error {
+	query := `
+		DELETE FROM webhook_deliveries
+		WHERE status <> 'pending' AND created_at < NOW() - make_interval(secs => $1)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, retention.Seconds())
+	return err
+}
@@ -0,0 +1,259 @@
+package timeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/store"
+	"go.uber.org/zap"
+)
+
+type Mode string
+
+const (
+	// The feed is computed with a join over followers and posts on every request
+	ModeRead Mode = "read"
+	// Posts are copied into the timeline of every follower when created
+	ModeWrite Mode = "write"
+	// Like ModeWrite, but authors with more than FanOutThreshold followers
+	// are marked as heavy, skipped on write and merged in at read time
+	ModeHybrid Mode = "hybrid"
+)
+
+// Max time a single fan-out job is allowed to run
+const jobTimeout = 30 * time.Second
+
+type Config struct {
+	Mode            Mode
+	FanOutThreshold int
+	Workers         int
+	// Jobs queued per worker
+	QueueSize int
+}
+
+type job struct {
+	name string
+	// Jobs with the same key run in order on the same worker, so the backfill
+	// and the prune of a follower's timeline can't overtake each other
+	key uint32
+	run func(context.Context) error
+}
+
+// Service keeps the materialised timelines up to date and serves the user feed
+// according to the configured mode.
+type Service struct {
+	cfg    Config
+	store  store.Storage
+	logger *zap.SugaredLogger
+	queues []chan job
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewService(cfg Config, store store.Storage, logger *zap.SugaredLogger) (*Service, error) {
+	switch cfg.Mode {
+	case ModeRead, ModeWrite, ModeHybrid:
+	default:
+		return nil, fmt.Errorf("unknown feed mode %q", cfg.Mode)
+	}
+
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+
+	s := &Service{
+		cfg:    cfg,
+		store:  store,
+		logger: logger,
+		queues: make([]chan job, cfg.Workers),
+	}
+
+	for i := range s.queues {
+		s.queues[i] = make(chan job, cfg.QueueSize)
+		s.wg.Add(1)
+		go s.worker(s.queues[i])
+	}
+
+	return s, nil
+}
+
+// Returns the feed for the user, reading from the timeline table unless the
+// service runs in read mode.
+func (s *Service) Feed(ctx context.Context, userId uint32, fq store.PaginatedFeedQuery) ([]*model.Post, error) {
+	switch s.cfg.Mode {
+	case ModeWrite:
+		return s.store.Timelines.GetFeed(ctx, userId, fq, false)
+	case ModeHybrid:
+		return s.store.Timelines.GetFeed(ctx, userId, fq, true)
+	default:
+		return s.store.Posts.GetUserFeed(ctx, userId, fq)
+	}
+}
+
+// Schedules the fan-out of a newly created post
+func (s *Service) PostCreated(post *model.Post) {
+	if s.cfg.Mode == ModeRead {
+		return
+	}
+
+	s.enqueue(job{
+		name: "fan-out post",
+		key:  post.UserId,
+		run: func(ctx context.Context) error {
+			heavy, err := s.isHeavy(ctx, post.UserId)
+			if err != nil {
+				return err
+			}
+
+			if heavy {
+				return s.store.Timelines.AddToAuthor(ctx, post)
+			}
+
+			return s.store.Timelines.FanOut(ctx, post)
+		},
+	})
+}
+
+// Schedules the backfill of the follower's timeline with the followed user's posts
+func (s *Service) UserFollowed(follow *model.FollowAction) {
+	if s.cfg.Mode == ModeRead {
+		return
+	}
+
+	s.enqueue(job{
+		name: "backfill timeline",
+		key:  follow.SenderUserId,
+		run: func(ctx context.Context) error {
+			heavy, err := s.updateHeavy(ctx, follow.TargetUserId)
+			if err != nil {
+				return err
+			}
+
+			// Heavy accounts are merged in at read time
+			if heavy {
+				return nil
+			}
+
+			return s.store.Timelines.Backfill(ctx, follow)
+		},
+	})
+}
+
+// Schedules the removal of the unfollowed user's posts from the timeline
+func (s *Service) UserUnfollowed(unfollow *model.FollowAction) {
+	if s.cfg.Mode == ModeRead {
+		return
+	}
+
+	s.enqueue(job{
+		name: "prune timeline",
+		key:  unfollow.SenderUserId,
+		run: func(ctx context.Context) error {
+			if err := s.store.Timelines.Prune(ctx, unfollow); err != nil {
+				return err
+			}
+
+			_, err := s.updateHeavy(ctx, unfollow.TargetUserId)
+			return err
+		},
+	})
+}
+
+// Stops accepting jobs and waits until the queued ones are done or ctx expires
+func (s *Service) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		for _, queue := range s.queues {
+			close(queue)
+		}
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timeline workers did not drain: %w", ctx.Err())
+	}
+}
+
+func (s *Service) isHeavy(ctx context.Context, userId uint32) (bool, error) {
+	if s.cfg.Mode != ModeHybrid {
+		return false, nil
+	}
+
+	return s.store.Timelines.IsHeavy(ctx, userId)
+}
+
+// Marks the author as heavy or light by their follower count. An author that
+// is no longer heavy is copied into the timelines of all of their followers,
+// as neither their posts since they became heavy nor the followers gained
+// since then were.
+func (s *Service) updateHeavy(ctx context.Context, authorId uint32) (bool, error) {
+	if s.cfg.Mode != ModeHybrid {
+		return false, nil
+	}
+
+	heavy, changed, err := s.store.Timelines.UpdateHeavy(ctx, authorId, s.cfg.FanOutThreshold)
+	if err != nil {
+		return false, err
+	}
+
+	if changed && !heavy {
+		if err := s.store.Timelines.BackfillFollowers(ctx, authorId); err != nil {
+			return false, err
+		}
+	}
+
+	return heavy, nil
+}
+
+// Queues the job on the worker of its key, running it in the caller when the
+// queue is full so that no timeline update is lost. A job run in the caller
+// may overtake the queued ones, the store re-checks the follow for that.
+func (s *Service) enqueue(j job) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		s.logger.Warnw("timeline service is stopped, running job inline", "job", j.name)
+		s.execute(j)
+		return
+	}
+
+	select {
+	case s.queues[int(j.key)%len(s.queues)] <- j:
+	default:
+		s.logger.Warnw("timeline queue is full, running job inline", "job", j.name)
+		s.execute(j)
+	}
+}
+
+func (s *Service) worker(queue <-chan job) {
+	defer s.wg.Done()
+
+	for j := range queue {
+		s.execute(j)
+	}
+}
+
+func (s *Service) execute(j job) {
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+
+	if err := j.run(ctx); err != nil {
+		s.logger.Errorw("timeline job failed", "job", j.name, "error", err)
+	}
+}
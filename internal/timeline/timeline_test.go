@@ -0,0 +1,195 @@
+package timeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// fakeTimelineStore records the timeline updates in the order they ran
+type fakeTimelineStore struct {
+	mu    sync.Mutex
+	calls []string
+	// Delay of the backfills, to let a later job overtake them
+	delay time.Duration
+	// Follower counts and heavy marks of the authors
+	counts map[uint32]int
+	heavy  map[uint32]bool
+}
+
+func (f *fakeTimelineStore) record(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, call)
+}
+
+func (f *fakeTimelineStore) FanOut(ctx context.Context, post *model.Post) error {
+	f.record(fmt.Sprintf("fan-out %d", post.Id))
+	return nil
+}
+
+func (f *fakeTimelineStore) AddToAuthor(ctx context.Context, post *model.Post) error {
+	f.record(fmt.Sprintf("author %d", post.Id))
+	return nil
+}
+
+func (f *fakeTimelineStore) Backfill(ctx context.Context, follow *model.FollowAction) error {
+	time.Sleep(f.delay)
+	f.record(fmt.Sprintf("backfill %d->%d", follow.SenderUserId, follow.TargetUserId))
+	return nil
+}
+
+func (f *fakeTimelineStore) BackfillFollowers(ctx context.Context, authorId uint32) error {
+	f.record(fmt.Sprintf("backfill followers %d", authorId))
+	return nil
+}
+
+func (f *fakeTimelineStore) IsHeavy(ctx context.Context, authorId uint32) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.heavy[authorId], nil
+}
+
+func (f *fakeTimelineStore) UpdateHeavy(ctx context.Context, authorId uint32, threshold int) (bool, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	heavy := f.counts[authorId] > threshold
+	changed := heavy != f.heavy[authorId]
+	f.heavy[authorId] = heavy
+
+	return heavy, changed, nil
+}
+
+func (f *fakeTimelineStore) Prune(ctx context.Context, unfollow *model.FollowAction) error {
+	f.record(fmt.Sprintf("prune %d->%d", unfollow.SenderUserId, unfollow.TargetUserId))
+	return nil
+}
+
+func (f *fakeTimelineStore) GetFeed(ctx context.Context, userId uint32, fq store.PaginatedFeedQuery, mergeHeavy bool) ([]*model.Post, error) {
+	return []*model.Post{}, nil
+}
+
+func newTestService(t *testing.T, cfg Config) (*Service, *fakeTimelineStore) {
+	t.Helper()
+
+	fake := &fakeTimelineStore{
+		counts: map[uint32]int{1: 100},
+		heavy:  map[uint32]bool{1: true},
+	}
+
+	s, err := NewService(cfg, store.Storage{Timelines: fake}, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, fake
+}
+
+func stop(t *testing.T, s *Service) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewService(t *testing.T) {
+	if _, err := NewService(Config{Mode: "push"}, store.Storage{}, zap.NewNop().Sugar()); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestService(t *testing.T) {
+	t.Run("should run the jobs of a follower in order", func(t *testing.T) {
+		s, fake := newTestService(t, Config{Mode: ModeWrite, Workers: 4, QueueSize: 16})
+		fake.delay = 20 * time.Millisecond
+
+		follow := &model.FollowAction{SenderUserId: 2, TargetUserId: 3}
+		s.UserFollowed(follow)
+		s.UserUnfollowed(follow)
+		stop(t, s)
+
+		if len(fake.calls) != 2 || fake.calls[0] != "backfill 2->3" || fake.calls[1] != "prune 2->3" {
+			t.Errorf("expected the backfill before the prune; got %v", fake.calls)
+		}
+	})
+
+	t.Run("should skip the heavy authors in hybrid mode", func(t *testing.T) {
+		s, fake := newTestService(t, Config{Mode: ModeHybrid, FanOutThreshold: 10, Workers: 2, QueueSize: 16})
+
+		s.PostCreated(&model.Post{Id: 7, UserId: 1})
+		s.PostCreated(&model.Post{Id: 8, UserId: 2})
+		s.UserFollowed(&model.FollowAction{SenderUserId: 2, TargetUserId: 1})
+		stop(t, s)
+
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+
+		want := map[string]bool{"author 7": true, "fan-out 8": true}
+		if len(fake.calls) != len(want) {
+			t.Fatalf("expected %d updates; got %v", len(want), fake.calls)
+		}
+		for _, call := range fake.calls {
+			if !want[call] {
+				t.Errorf("unexpected update %q", call)
+			}
+		}
+	})
+
+	t.Run("should backfill the followers of an author that is no longer heavy", func(t *testing.T) {
+		s, fake := newTestService(t, Config{Mode: ModeHybrid, FanOutThreshold: 10, Workers: 2, QueueSize: 16})
+		fake.counts[1] = 10
+
+		s.UserUnfollowed(&model.FollowAction{SenderUserId: 2, TargetUserId: 1})
+		s.UserUnfollowed(&model.FollowAction{SenderUserId: 3, TargetUserId: 1})
+		stop(t, s)
+
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+
+		backfills := 0
+		for _, call := range fake.calls {
+			if call == "backfill followers 1" {
+				backfills++
+			}
+		}
+		if backfills != 1 || fake.heavy[1] {
+			t.Errorf("expected the author to be marked light and backfilled once; got %v", fake.calls)
+		}
+	})
+
+	t.Run("should not update the timelines in read mode", func(t *testing.T) {
+		s, fake := newTestService(t, Config{Mode: ModeRead})
+
+		s.PostCreated(&model.Post{Id: 7, UserId: 2})
+		s.UserFollowed(&model.FollowAction{SenderUserId: 2, TargetUserId: 3})
+		stop(t, s)
+
+		if len(fake.calls) != 0 {
+			t.Errorf("expected no updates; got %v", fake.calls)
+		}
+	})
+
+	t.Run("should run the jobs inline once stopped", func(t *testing.T) {
+		s, fake := newTestService(t, Config{Mode: ModeWrite})
+		stop(t, s)
+
+		s.UserUnfollowed(&model.FollowAction{SenderUserId: 2, TargetUserId: 3})
+
+		if len(fake.calls) != 1 || fake.calls[0] != "prune 2->3" {
+			t.Errorf("expected the prune to run; got %v", fake.calls)
+		}
+	})
+}
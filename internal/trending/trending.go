@@ -0,0 +1,92 @@
+package trending
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dottox/social/internal/store"
+	"go.uber.org/zap"
+)
+
+type Window struct {
+	Name     string
+	Duration time.Duration
+}
+
+var DefaultWindows = []Window{
+	{Name: "1h", Duration: time.Hour},
+	{Name: "24h", Duration: time.Hour * 24},
+	{Name: "7d", Duration: time.Hour * 24 * 7},
+}
+
+type Config struct {
+	// Cron spec of the refresh, run by the job queue so that only one
+	// instance computes each snapshot
+	Schedule  string
+	Limit     int
+	Retention time.Duration
+	Windows   []Window
+}
+
+// Worker recomputes the trending snapshots on every scheduled refresh.
+// Clients read the latest snapshot, so results are stable between runs.
+type Worker struct {
+	cfg    Config
+	store  store.Storage
+	logger *zap.SugaredLogger
+}
+
+func NewWorker(cfg Config, store store.Storage, logger *zap.SugaredLogger) *Worker {
+	if len(cfg.Windows) == 0 {
+		cfg.Windows = DefaultWindows
+	}
+
+	return &Worker{
+		cfg:    cfg,
+		store:  store,
+		logger: logger,
+	}
+}
+
+// Returns the window with the given name
+func (wk *Worker) Window(name string) (Window, bool) {
+	for _, w := range wk.cfg.Windows {
+		if w.Name == name {
+			return w, true
+		}
+	}
+
+	return Window{}, false
+}
+
+// Computes a new snapshot for every window and prunes the old ones,
+// returning the errors of the windows that failed
+func (wk *Worker) RefreshAll(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(wk.cfg.Windows))
+	for i, w := range wk.cfg.Windows {
+		wg.Add(1)
+		go func(i int, w Window) {
+			defer wg.Done()
+
+			start := time.Now()
+			snapshot, err := wk.store.Trending.Refresh(ctx, w.Name, w.Duration, wk.cfg.Limit)
+			if err != nil {
+				errs[i] = fmt.Errorf("computing the %s trending snapshot: %w", w.Name, err)
+				return
+			}
+
+			wk.logger.Infow("trending snapshot computed", "window", w.Name, "snapshot_id", snapshot.Id, "took", time.Since(start).String())
+		}(i, w)
+	}
+	wg.Wait()
+
+	if err := wk.store.Trending.Prune(ctx, wk.cfg.Retention); err != nil {
+		errs = append(errs, fmt.Errorf("pruning the trending snapshots: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
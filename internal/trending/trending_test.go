@@ -0,0 +1,90 @@
+package trending
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// fakeTrendingStore records the refreshed windows, failing the given one
+type fakeTrendingStore struct {
+	store.MockTrendingStore
+
+	mu        sync.Mutex
+	refreshed []string
+	failing   string
+	retention time.Duration
+}
+
+func (f *fakeTrendingStore) Refresh(ctx context.Context, window string, duration time.Duration, limit int) (*model.TrendingSnapshot, error) {
+	if window == f.failing {
+		return nil, errors.New("timeout")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.refreshed = append(f.refreshed, window)
+	return &model.TrendingSnapshot{Window: window}, nil
+}
+
+func (f *fakeTrendingStore) Prune(ctx context.Context, retention time.Duration) error {
+	f.retention = retention
+	return nil
+}
+
+func newTestWorker(failing string) (*Worker, *fakeTrendingStore) {
+	fake := &fakeTrendingStore{failing: failing}
+	cfg := Config{Schedule: "*/5 * * * *", Limit: 20, Retention: time.Hour}
+
+	return NewWorker(cfg, store.Storage{Trending: fake}, zap.NewNop().Sugar()), fake
+}
+
+func TestWorker(t *testing.T) {
+	t.Run("should find the default windows", func(t *testing.T) {
+		wk, _ := newTestWorker("")
+
+		if w, ok := wk.Window("24h"); !ok || w.Duration != 24*time.Hour {
+			t.Errorf("expected the 24h window; got %+v", w)
+		}
+		if _, ok := wk.Window("2h"); ok {
+			t.Error("expected no 2h window")
+		}
+	})
+
+	t.Run("should refresh every window and prune the old snapshots", func(t *testing.T) {
+		wk, fake := newTestWorker("")
+
+		if err := wk.RefreshAll(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		sort.Strings(fake.refreshed)
+		if strings.Join(fake.refreshed, ",") != "1h,24h,7d" {
+			t.Errorf("expected every window to be refreshed; got %v", fake.refreshed)
+		}
+		if fake.retention != time.Hour {
+			t.Errorf("expected the snapshots to be pruned with the retention; got %s", fake.retention)
+		}
+	})
+
+	t.Run("should report the windows that failed", func(t *testing.T) {
+		wk, fake := newTestWorker("7d")
+
+		err := wk.RefreshAll(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "7d") {
+			t.Errorf("expected the error of the 7d window; got %v", err)
+		}
+		if len(fake.refreshed) != 2 || fake.retention != time.Hour {
+			t.Errorf("expected the other windows to be refreshed and pruned; got %v", fake.refreshed)
+		}
+	})
+}
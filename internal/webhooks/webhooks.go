@@ -0,0 +1,256 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/retry"
+	"github.com/dottox/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// Headers of the deliveries. The signature is "sha256=" followed by the hex
+// HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook secret.
+const (
+	EventHeader     = "X-Social-Event"
+	DeliveryHeader  = "X-Social-Delivery"
+	TimestampHeader = "X-Social-Timestamp"
+	SignatureHeader = "X-Social-Signature"
+)
+
+// Max bytes of the response body kept in the delivery log
+const maxResponseBody = 1024
+
+type Config struct {
+	// Deliveries sent at once
+	Workers int
+	// Interval between the checks for due deliveries
+	PollInterval time.Duration
+	// Max time a webhook has to respond
+	Timeout time.Duration
+	// Attempts of a delivery before it's marked as failed, and the delay between them
+	Retry retry.Config
+	// Consecutive failed attempts before a webhook is disabled
+	DisableAfter int
+}
+
+// Dispatcher stores the deliveries of the platform events for the subscribed
+// webhooks and sends them in the background, retrying the failed deliveries
+// with exponential backoff. Deliveries are stored, so they survive restarts
+// and are shared by all the API instances.
+type Dispatcher struct {
+	cfg    Config
+	store  store.Storage
+	logger *zap.SugaredLogger
+	client *http.Client
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewDispatcher(cfg Config, store store.Storage, logger *zap.SugaredLogger) *Dispatcher {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	cfg.Retry = cfg.Retry.Normalize()
+
+	return &Dispatcher{
+		cfg:    cfg,
+		store:  store,
+		logger: logger,
+		client: &http.Client{Timeout: cfg.Timeout},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Queues a delivery of the event to every webhook subscribed to it
+func (d *Dispatcher) Publish(ctx context.Context, event *model.WebhookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	queued, err := d.store.Webhooks.Enqueue(ctx, event.Event, payload)
+	if err != nil {
+		return err
+	}
+
+	if queued > 0 {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Starts sending the due deliveries every poll interval, and right after new
+// events are queued
+func (d *Dispatcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.done = make(chan struct{})
+
+	go func() {
+		defer close(d.done)
+
+		ticker := time.NewTicker(d.cfg.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			// In flight deliveries are bounded by the timeout, they aren't
+			// cancelled on stop. Keep going while there are deliveries left.
+			if d.DeliverDue(context.Background()) > 0 && ctx.Err() == nil {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-d.wake:
+			}
+		}
+	}()
+}
+
+// Stops sending the deliveries, waiting for the in flight ones or until ctx
+// expires. The pending deliveries are sent once the dispatcher is started
+// again.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	if d.cancel == nil {
+		return nil
+	}
+	d.cancel()
+
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("webhook dispatcher did not stop: %w", ctx.Err())
+	}
+}
+
+// Sends a batch of the due deliveries, returning how many were sent
+func (d *Dispatcher) DeliverDue(ctx context.Context) int {
+	// Deliveries not recorded within the lease are sent again
+	lease := 2*d.cfg.Timeout + time.Minute
+
+	deliveries, err := d.store.Webhooks.ClaimDue(ctx, d.cfg.Workers, lease)
+	if err != nil {
+		d.logger.Errorw("error claiming webhook deliveries", "error", err)
+		return 0
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery *model.WebhookDelivery) {
+			defer wg.Done()
+
+			attempt := d.Send(ctx, delivery)
+
+			recordCtx, cancel := context.WithTimeout(context.Background(), store.QueryTimeoutDuration)
+			defer cancel()
+
+			disabled, err := d.store.Webhooks.RecordAttempt(recordCtx, delivery, attempt, d.cfg.DisableAfter)
+			if err != nil {
+				d.logger.Errorw("error recording webhook delivery", "delivery_id", delivery.Id, "error", err)
+				return
+			}
+
+			if attempt.Status != model.DeliverySucceeded {
+				d.logger.Warnw("webhook delivery failed", "delivery_id", delivery.Id, "webhook_id", delivery.WebhookId, "attempt", delivery.Attempts+1, "status", attempt.Status, "error", attempt.Error)
+			}
+			if disabled {
+				d.logger.Warnw("webhook disabled after repeated failures", "webhook_id", delivery.WebhookId, "failures", d.cfg.DisableAfter)
+			}
+		}(delivery)
+	}
+	wg.Wait()
+
+	return len(deliveries)
+}
+
+// Posts the delivery to its webhook, returning the outcome of the attempt.
+// Any 2xx response is a success, anything else is retried after a backoff
+// until the delivery runs out of attempts.
+func (d *Dispatcher) Send(ctx context.Context, delivery *model.WebhookDelivery) *store.WebhookAttempt {
+	attempt := &store.WebhookAttempt{Status: model.DeliverySucceeded}
+
+	err := d.post(ctx, delivery, attempt)
+	if err == nil {
+		return attempt
+	}
+
+	attempt.Error = err.Error()
+	attempts := delivery.Attempts + 1
+	if attempts >= d.cfg.Retry.MaxAttempts {
+		attempt.Status = model.DeliveryFailed
+	} else {
+		attempt.Status = model.DeliveryPending
+		attempt.RetryIn = d.cfg.Retry.Backoff(attempts)
+	}
+
+	return attempt
+}
+
+func (d *Dispatcher) post(ctx context.Context, delivery *model.WebhookDelivery, attempt *store.WebhookAttempt) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GopherSocial-Webhooks")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(uint64(delivery.Id), 10))
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(delivery.Webhook.Secret, timestamp, delivery.Payload))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxResponseBody))
+	attempt.ResponseStatus = res.StatusCode
+	attempt.ResponseBody = string(bytes.ToValidUTF8(body, nil))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// Returns the signature of a delivery body sent at timestamp
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Reports whether signature is the signature of a delivery body sent at
+// timestamp, for the receivers of the webhooks
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
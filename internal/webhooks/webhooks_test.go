@@ -0,0 +1,136 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dottox/social/internal/model"
+	"github.com/dottox/social/internal/retry"
+	"github.com/dottox/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// fakeWebhookStore hands out the queued deliveries and records their attempts
+type fakeWebhookStore struct {
+	store.MockWebhookStore
+
+	mu       sync.Mutex
+	due      []*model.WebhookDelivery
+	attempts []*store.WebhookAttempt
+}
+
+func (f *fakeWebhookStore) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*model.WebhookDelivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	due := f.due
+	f.due = nil
+	return due, nil
+}
+
+func (f *fakeWebhookStore) RecordAttempt(ctx context.Context, delivery *model.WebhookDelivery, attempt *store.WebhookAttempt, disableAfter int) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.attempts = append(f.attempts, attempt)
+	return false, nil
+}
+
+func newTestDispatcher(t *testing.T, cfg Config, delivery *model.WebhookDelivery) (*Dispatcher, *fakeWebhookStore) {
+	t.Helper()
+
+	fake := &fakeWebhookStore{due: []*model.WebhookDelivery{delivery}}
+	d := NewDispatcher(cfg, store.Storage{Webhooks: fake}, zap.NewNop().Sugar())
+	t.Cleanup(func() { d.Stop(context.Background()) })
+
+	return d, fake
+}
+
+func TestDispatcher(t *testing.T) {
+	cfg := Config{
+		Timeout: time.Second,
+		Retry:   retry.Config{MaxAttempts: 3, BackoffBase: time.Second, BackoffMax: time.Minute},
+	}
+
+	t.Run("should send signed deliveries", func(t *testing.T) {
+		var got *http.Request
+		var body []byte
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r
+			body, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		d, fake := newTestDispatcher(t, cfg, &model.WebhookDelivery{
+			Id:      7,
+			Event:   model.WebhookPostCreated,
+			Payload: []byte(`{"event":"post.created","data":{"id":1}}`),
+			Webhook: &model.Webhook{URL: server.URL, Secret: "s3cret"},
+		})
+
+		if sent := d.DeliverDue(context.Background()); sent != 1 {
+			t.Fatalf("expected 1 delivery; got %d", sent)
+		}
+
+		if got.Header.Get(EventHeader) != model.WebhookPostCreated || got.Header.Get(DeliveryHeader) != "7" {
+			t.Errorf("unexpected headers %v", got.Header)
+		}
+		if !Verify("s3cret", got.Header.Get(TimestampHeader), body, got.Header.Get(SignatureHeader)) {
+			t.Errorf("invalid signature %s", got.Header.Get(SignatureHeader))
+		}
+		if Verify("other", got.Header.Get(TimestampHeader), body, got.Header.Get(SignatureHeader)) {
+			t.Errorf("signature verified with the wrong secret")
+		}
+
+		attempt := fake.attempts[0]
+		if attempt.Status != model.DeliverySucceeded || attempt.ResponseStatus != http.StatusNoContent {
+			t.Errorf("unexpected attempt %+v", attempt)
+		}
+	})
+
+	t.Run("should retry the failed deliveries with backoff", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		d, fake := newTestDispatcher(t, cfg, &model.WebhookDelivery{
+			Attempts: 1,
+			Payload:  []byte(`{}`),
+			Webhook:  &model.Webhook{URL: server.URL},
+		})
+		d.DeliverDue(context.Background())
+
+		attempt := fake.attempts[0]
+		if attempt.Status != model.DeliveryPending || attempt.RetryIn != 2*time.Second {
+			t.Errorf("unexpected attempt %+v", attempt)
+		}
+		if attempt.ResponseStatus != http.StatusServiceUnavailable || attempt.ResponseBody != "unavailable\n" {
+			t.Errorf("unexpected response %d %q", attempt.ResponseStatus, attempt.ResponseBody)
+		}
+	})
+
+	t.Run("should fail the deliveries out of attempts", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		d, fake := newTestDispatcher(t, cfg, &model.WebhookDelivery{
+			Attempts: 2,
+			Payload:  []byte(`{}`),
+			Webhook:  &model.Webhook{URL: server.URL},
+		})
+		d.DeliverDue(context.Background())
+
+		if attempt := fake.attempts[0]; attempt.Status != model.DeliveryFailed {
+			t.Errorf("unexpected attempt %+v", attempt)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/a-h/templ"
+	"github.com/dottox/social/internal/mailer"
+	"github.com/dottox/social/web/components"
+	"github.com/go-chi/chi/v5"
+)
+
+func (wApp *WebApp) InboxHandler(w http.ResponseWriter, r *http.Request) {
+
+	emails, err := mailer.ReadCapturedEmails(wApp.inboxDir)
+	if err != nil {
+		http.Error(w, "Failed to read the inbox", http.StatusInternalServerError)
+		return
+	}
+
+	templ.Handler(components.Inbox(emails)).ServeHTTP(w, r)
+}
+
+func (wApp *WebApp) InboxEmailHandler(w http.ResponseWriter, r *http.Request) {
+
+	email, err := mailer.ReadCapturedEmail(wApp.inboxDir, chi.URLParam(r, "emailId"))
+	if err != nil {
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			http.NotFound(w, r)
+		default:
+			http.Error(w, "Failed to read the email", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	templ.Handler(components.InboxEmail(email)).ServeHTTP(w, r)
+}
+
+// Downloads the .eml file, to open the email in a mail client
+func (wApp *WebApp) InboxRawEmailHandler(w http.ResponseWriter, r *http.Request) {
+
+	id := chi.URLParam(r, "emailId")
+
+	// Checks the id before it's used in the path
+	if _, err := mailer.ReadCapturedEmail(wApp.inboxDir, id); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "message/rfc822")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+id+`.eml"`)
+	http.ServeFile(w, r, mailer.CapturedPath(wApp.inboxDir, id))
+}
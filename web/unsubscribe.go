@@ -0,0 +1,56 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/a-h/templ"
+	"github.com/dottox/social/web/components"
+)
+
+// Asks to confirm the unsubscribe, so link checkers opening the link of the
+// email don't unsubscribe the user
+func (wApp *WebApp) UnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		templ.Handler(components.UnsubscribeError("Invalid unsubscribe link")).ServeHTTP(w, r)
+		return
+	}
+
+	templ.Handler(components.Unsubscribe(token)).ServeHTTP(w, r)
+}
+
+// Unsubscribes from the confirmation form, and from the mail clients that
+// support the one-click unsubscribe of the List-Unsubscribe header
+func (wApp *WebApp) ConfirmUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+
+	token := r.FormValue("token")
+	if token == "" {
+		templ.Handler(components.UnsubscribeError("Invalid unsubscribe link")).ServeHTTP(w, r)
+		return
+	}
+
+	// Create a new request
+	client := &http.Client{}
+	req, err := http.NewRequest("POST", wApp.apiUrl+"/v1/notifications/unsubscribe?token="+url.QueryEscape(token), nil)
+	if err != nil {
+		templ.Handler(components.UnsubscribeError("Failed to unsubscribe")).ServeHTTP(w, r)
+		return
+	}
+
+	// Sent the request
+	resp, err := client.Do(req)
+	if err != nil {
+		templ.Handler(components.UnsubscribeError("Failed to unsubscribe")).ServeHTTP(w, r)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		templ.Handler(components.UnsubscribeError("Failed to unsubscribe")).ServeHTTP(w, r)
+		return
+	}
+
+	templ.Handler(components.Unsubscribed()).ServeHTTP(w, r)
+}
@@ -15,6 +15,8 @@ type (
 	WebApp struct {
 		config webConfig
 		apiUrl string
+		// Directory of the captured emails, the inbox is off when empty
+		inboxDir string
 	}
 
 	webConfig struct {
@@ -35,6 +37,11 @@ func NewWebApp(protocol, domain, port, apiUrl string) *WebApp {
 	}
 }
 
+// Serves the emails captured by the development mailer on /inbox
+func (app *WebApp) ServeInbox(dir string) {
+	app.inboxDir = dir
+}
+
 func (app *WebApp) Mount() http.Handler {
 
 	// Creates a new chi router
@@ -53,6 +60,17 @@ func (app *WebApp) Mount() http.Handler {
 	r.Get("/", templ.Handler(components.Index()).ServeHTTP)
 	r.Get("/feed", app.FeedHandler)
 	r.Get("/activate", app.ActivateUserHandler)
+	r.Get("/unsubscribe", app.UnsubscribeHandler)
+	r.Post("/unsubscribe", app.ConfirmUnsubscribeHandler)
+
+	if app.inboxDir != "" {
+		r.Route("/inbox", func(r chi.Router) {
+			r.Get("/", app.InboxHandler)
+			r.Get("/{emailId}", app.InboxEmailHandler)
+			r.Get("/{emailId}/raw", app.InboxRawEmailHandler)
+		})
+	}
+
 	return r
 }
 